@@ -0,0 +1,250 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/api/vlabs"
+	"github.com/Azure/aks-engine/pkg/engine"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	convertName             = "convert"
+	convertShortDescription = "Convert an api model to another API version"
+	convertLongDescription  = "Convert an api model to another API version, reporting the fields that were lost, added or changed by the conversion. Cluster defaults are not applied, they are set when the api model is generated"
+)
+
+type convertCmd struct {
+	fromFile   string
+	toVersion  string
+	outputFile string
+
+	// derived
+	locale *gotext.Locale
+	out    io.Writer
+	report io.Writer
+}
+
+func newConvertCmd() *cobra.Command {
+	cc := convertCmd{
+		out:    os.Stdout,
+		report: os.Stderr,
+	}
+
+	convertCmd := &cobra.Command{
+		Use:   convertName,
+		Short: convertShortDescription,
+		Long:  convertLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := cc.validate(cmd, args); err != nil {
+				return errors.Wrap(err, "failed to validate convert command")
+			}
+			return cc.run()
+		},
+	}
+
+	f := convertCmd.Flags()
+	f.StringVar(&cc.fromFile, "from-file", "", "path to the apimodel file to convert")
+	f.StringVar(&cc.toVersion, "to-version", vlabs.APIVersion, "API version to convert the api model to")
+	f.StringVar(&cc.outputFile, "output-file", "", "write the converted api model to this file instead of stdout")
+
+	return convertCmd
+}
+
+func (cc *convertCmd) validate(cmd *cobra.Command, args []string) error {
+	var err error
+
+	cc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if cc.fromFile == "" {
+		if len(args) == 1 {
+			cc.fromFile = args[0]
+		} else if len(args) > 1 {
+			cmd.Usage()
+			return errors.New("too many arguments were provided to 'convert'")
+		} else {
+			cmd.Usage()
+			return errors.New("--from-file was not supplied, nor was one specified as a positional argument")
+		}
+	}
+
+	if _, err := os.Stat(cc.fromFile); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", cc.fromFile)
+	}
+
+	if cc.toVersion == "" {
+		cmd.Usage()
+		return errors.New("--to-version must be specified")
+	}
+
+	return nil
+}
+
+func (cc *convertCmd) run() error {
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: cc.locale,
+		},
+	}
+	contents, err := ioutil.ReadFile(cc.fromFile)
+	if err != nil {
+		return errors.Wrapf(err, "error reading %s", cc.fromFile)
+	}
+	// YAML api models are compared with the converted api model as JSON
+	if contents, err = api.APIModelToJSON(contents); err != nil {
+		return errors.Wrapf(err, "error reading %s", cc.fromFile)
+	}
+	// the api model is converted as is, it is validated when it is deployed in its new version
+	containerService, fromVersion, err := apiloader.DeserializeContainerService(contents, false, false, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+
+	b, err := apiloader.SerializeContainerService(containerService, cc.toVersion)
+	if err != nil {
+		return errors.Wrapf(err, "error converting the api model to version %s", cc.toVersion)
+	}
+
+	changes, err := conversionChanges(contents, b, secretValues(containerService))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cc.report, "Converted %s from %s to %s\n", cc.fromFile, fromVersion, cc.toVersion)
+	printConversionChanges(cc.report, changes)
+
+	if cc.outputFile != "" {
+		return errors.Wrap(ioutil.WriteFile(cc.outputFile, b, 0600), "error writing the converted api model")
+	}
+	if _, err = cc.out.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err, "error writing output")
+	}
+	return nil
+}
+
+// secretValues returns the values of the secrets of the container service, which are not shown in the conversion report
+func secretValues(cs *api.ContainerService) map[string]bool {
+	secrets := api.ExtractSecrets(cs)
+	api.RestoreSecrets(cs, secrets)
+	values := map[string]bool{}
+	for _, value := range secrets {
+		if value != "" {
+			values[value] = true
+		}
+	}
+	if cs.Properties != nil {
+		for _, extension := range cs.Properties.ExtensionProfiles {
+			if extension != nil && extension.ExtensionParameters != "" {
+				values[extension.ExtensionParameters] = true
+			}
+		}
+	}
+	return values
+}
+
+// conversionChanges returns the fields of an api model that differ after its conversion, except for its API version.
+// The values of secrets are replaced so they are not shown by the report.
+func conversionChanges(from, to []byte, secrets map[string]bool) ([]engine.PropertyDiff, error) {
+	var fromModel, toModel map[string]interface{}
+	if err := json.Unmarshal(from, &fromModel); err != nil {
+		return nil, errors.Wrap(err, "error parsing the api model")
+	}
+	if err := json.Unmarshal(to, &toModel); err != nil {
+		return nil, errors.Wrap(err, "error parsing the converted api model")
+	}
+	delete(fromModel, "apiVersion")
+	delete(toModel, "apiVersion")
+	changes := []engine.PropertyDiff{}
+	for _, c := range engine.DiffJSON(redactJSONValues(fromModel, secrets), redactJSONValues(toModel, secrets)) {
+		// versions serialize unset fields differently, an empty field added or removed does not change the api model
+		if (c.Change == engine.DiffAdded && isEmptyJSONValue(c.New)) || (c.Change == engine.DiffRemoved && isEmptyJSONValue(c.Old)) {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// redactJSONValues replaces the strings of a decoded JSON value that are secrets
+func redactJSONValues(v interface{}, secrets map[string]bool) interface{} {
+	switch value := v.(type) {
+	case string:
+		if secrets[value] {
+			return "(redacted)"
+		}
+	case []interface{}:
+		for i := range value {
+			value[i] = redactJSONValues(value[i], secrets)
+		}
+	case map[string]interface{}:
+		for k := range value {
+			value[k] = redactJSONValues(value[k], secrets)
+		}
+	}
+	return v
+}
+
+// isEmptyJSONValue returns true if a decoded JSON value is a zero value, or an object or array of zero values
+func isEmptyJSONValue(v interface{}) bool {
+	switch value := v.(type) {
+	case nil:
+		return true
+	case string:
+		return value == ""
+	case bool:
+		return !value
+	case float64:
+		return value == 0
+	case []interface{}:
+		for _, e := range value {
+			if !isEmptyJSONValue(e) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		for _, e := range value {
+			if !isEmptyJSONValue(e) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func printConversionChanges(w io.Writer, changes []engine.PropertyDiff) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No fields were lost, added or changed")
+		return
+	}
+	for _, group := range []struct {
+		title  string
+		change string
+	}{
+		{"Lost", engine.DiffRemoved},
+		{"Added", engine.DiffAdded},
+		{"Changed", engine.DiffModified},
+	} {
+		diffs := []engine.PropertyDiff{}
+		for _, c := range changes {
+			if c.Change == group.change {
+				diffs = append(diffs, c)
+			}
+		}
+		printPropertyDiffs(w, group.title, diffs)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+)
+
+func TestNewConvertCmd(t *testing.T) {
+	output := newConvertCmd()
+	if output.Use != convertName || output.Short != convertShortDescription || output.Long != convertLongDescription {
+		t.Fatalf("convert command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, convertName, output.Short, convertShortDescription, output.Long, convertLongDescription)
+	}
+
+	expectedFlags := []string{"from-file", "to-version", "output-file"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("convert command should have flag %s", f)
+		}
+	}
+}
+
+func TestConvertCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		args        []string
+		toVersion   string
+		expectedErr string
+	}{
+		{
+			args:        []string{},
+			toVersion:   "vlabs",
+			expectedErr: "--from-file was not supplied, nor was one specified as a positional argument",
+		},
+		{
+			args:        []string{"a.json", "b.json"},
+			toVersion:   "vlabs",
+			expectedErr: "too many arguments were provided to 'convert'",
+		},
+		{
+			args:        []string{"does-not-exist.json"},
+			toVersion:   "vlabs",
+			expectedErr: "specified api model does not exist (does-not-exist.json)",
+		},
+		{
+			args:        []string{"../examples/v20160930/kubernetes.json"},
+			expectedErr: "--to-version must be specified",
+		},
+		{
+			args:      []string{"../examples/v20160930/kubernetes.json"},
+			toVersion: "vlabs",
+		},
+	}
+
+	for _, c := range cases {
+		cc := &convertCmd{toVersion: c.toVersion}
+		err := cc.validate(r, c.args)
+		if c.expectedErr == "" {
+			if err != nil {
+				t.Fatalf("expected validate convert command to return no error, but instead got %s", err.Error())
+			}
+		} else if err == nil || err.Error() != c.expectedErr {
+			t.Fatalf("expected validate convert command to return error %s, but instead got %v", c.expectedErr, err)
+		}
+	}
+}
+
+func TestConvertCmdRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "convert")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// an older API version is converted to vlabs, reporting what the conversion added
+	converted := path.Join(dir, "kubernetes.json")
+	report := &bytes.Buffer{}
+	cc := &convertCmd{fromFile: "../examples/v20160930/kubernetes.json", toVersion: "vlabs", outputFile: converted, report: report}
+	if err = cc.run(); err != nil {
+		t.Fatalf("unexpected error converting the api model: %s", err)
+	}
+	b, err := ioutil.ReadFile(converted)
+	if err != nil {
+		t.Fatalf("unable to read the converted api model: %s", err)
+	}
+	if !strings.Contains(string(b), `"apiVersion": "vlabs"`) {
+		t.Fatalf("expected the api model to be converted to vlabs, got %s", string(b))
+	}
+	for _, expected := range []string{"Converted ../examples/v20160930/kubernetes.json from 2016-09-30 to vlabs", "Added:", "+ properties.orchestratorProfile.orchestratorVersion:"} {
+		if !strings.Contains(report.String(), expected) {
+			t.Fatalf("expected the conversion report to contain %q, got %s", expected, report.String())
+		}
+	}
+	if strings.Contains(report.String(), "Lost:") || strings.Contains(report.String(), `""`) {
+		t.Fatalf("expected no field to be lost nor empty fields to be reported, got %s", report.String())
+	}
+
+	// YAML api models are converted and compared as JSON
+	b, err = ioutil.ReadFile("../examples/v20160930/kubernetes.json")
+	if err != nil {
+		t.Fatalf("unable to read the api model: %s", err)
+	}
+	y, err := yaml.JSONToYAML(b)
+	if err != nil {
+		t.Fatalf("unable to convert the api model to YAML: %s", err)
+	}
+	yamlFile := path.Join(dir, "kubernetes.yaml")
+	if err = ioutil.WriteFile(yamlFile, y, 0600); err != nil {
+		t.Fatalf("unable to write the YAML api model: %s", err)
+	}
+	report = &bytes.Buffer{}
+	cc = &convertCmd{fromFile: yamlFile, toVersion: "vlabs", out: &bytes.Buffer{}, report: report}
+	if err = cc.run(); err != nil {
+		t.Fatalf("unexpected error converting the YAML api model: %s", err)
+	}
+	if !strings.Contains(report.String(), "+ properties.orchestratorProfile.orchestratorVersion:") || strings.Contains(report.String(), "Lost:") {
+		t.Fatalf("expected the YAML api model to be compared with the converted api model, got %s", report.String())
+	}
+
+	// fields that do not exist in an older API version are reported as lost, without the values of secrets
+	out := &bytes.Buffer{}
+	report = &bytes.Buffer{}
+	cc = &convertCmd{fromFile: "../pkg/engine/testdata/simple/kubernetes.json", toVersion: "2017-07-01", out: out, report: report}
+	if err = cc.run(); err != nil {
+		t.Fatalf("unexpected error converting the api model: %s", err)
+	}
+	if !strings.Contains(out.String(), `"apiVersion": "2017-07-01"`) {
+		t.Fatalf("expected the api model to be converted to 2017-07-01, got %s", out.String())
+	}
+	if !strings.Contains(report.String(), "Lost:") || !strings.Contains(report.String(), "- properties.certificateProfile:") {
+		t.Fatalf("expected the certificate profile to be reported as lost, got %s", report.String())
+	}
+	if strings.Contains(report.String(), `"caPrivateKey":"caPrivateKey"`) || !strings.Contains(report.String(), `"caPrivateKey":"(redacted)"`) {
+		t.Fatalf("expected the values of secrets to be redacted, got %s", report.String())
+	}
+
+	cc = &convertCmd{fromFile: "../examples/v20160930/kubernetes.json", toVersion: "bogus", out: &bytes.Buffer{}, report: &bytes.Buffer{}}
+	if err = cc.run(); err == nil {
+		t.Fatalf("expected an error converting the api model to an unknown version")
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/Azure/azure-sdk-for-go/services/graphrbac/1.6/graphrbac"
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	deleteName             = "delete"
+	deleteShortDescription = "Delete an existing cluster"
+	deleteLongDescription  = "Delete the resources aks-engine created for an existing cluster, leaving the rest of the resource group untouched, and optionally the service principal created by deploy"
+)
+
+type deleteCmd struct {
+	authProvider
+
+	// user input
+	resourceGroupName      string
+	deploymentDirectory    string
+	location               string
+	deleteServicePrincipal bool
+	dryRun                 bool
+	force                  bool
+
+	// derived
+	in               io.Reader
+	containerService *api.ContainerService
+	locale           *gotext.Locale
+	client           armhelpers.AKSEngineClient
+	nameSuffix       string
+	logger           *log.Entry
+}
+
+// clusterServicePrincipal is the service principal deploy created for a cluster, with its role assignments
+type clusterServicePrincipal struct {
+	application     graphrbac.Application
+	roleAssignments []string
+}
+
+func newDeleteCmd() *cobra.Command {
+	dc := deleteCmd{
+		authProvider: &authArgs{},
+		in:           os.Stdin,
+	}
+
+	deleteCmd := &cobra.Command{
+		Use:   deleteName,
+		Short: deleteShortDescription,
+		Long:  deleteLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dc.run(cmd, args)
+		},
+	}
+
+	f := deleteCmd.Flags()
+	f.StringVarP(&dc.location, "location", "l", "", "location the cluster is deployed in (required)")
+	f.StringVarP(&dc.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed (required)")
+	f.StringVar(&dc.deploymentDirectory, "deployment-dir", "", "the location of the output from `generate` (required)")
+	f.BoolVar(&dc.deleteServicePrincipal, "delete-service-principal", false, "also delete the service principal and role assignments deploy created for the cluster")
+	f.BoolVar(&dc.dryRun, "dry-run", false, "print the resources that would be deleted as JSON without deleting them")
+	f.BoolVar(&dc.force, "force", false, "delete the resources without asking for confirmation")
+	addAuthFlags(dc.getAuthArgs(), f)
+
+	return deleteCmd
+}
+
+func (dc *deleteCmd) validate(cmd *cobra.Command) error {
+	var err error
+
+	dc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if dc.resourceGroupName == "" {
+		cmd.Usage()
+		return errors.New("--resource-group must be specified")
+	}
+
+	if dc.location == "" {
+		cmd.Usage()
+		return errors.New("--location must be specified")
+	}
+	dc.location = helpers.NormalizeAzureRegion(dc.location)
+
+	if dc.deploymentDirectory == "" {
+		cmd.Usage()
+		return errors.New("--deployment-dir must be specified")
+	}
+	return nil
+}
+
+func (dc *deleteCmd) load() error {
+	var err error
+
+	dc.logger = log.New().WithField("source", "delete command line")
+
+	if err = dc.getAuthArgs().validateAuthArgs(); err != nil {
+		return err
+	}
+	if dc.client, err = dc.authProvider.getClient(); err != nil {
+		return errors.Wrap(err, "failed to get client")
+	}
+
+	apiModelPath := api.FindAPIModelFile(dc.deploymentDirectory)
+	if _, err = os.Stat(apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", apiModelPath)
+	}
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: dc.locale,
+		},
+		KeyVaultClient: dc.client,
+	}
+	dc.containerService, _, err = apiloader.LoadContainerServiceFromFile(apiModelPath, true, true, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+
+	if dc.containerService.Location == "" {
+		dc.containerService.Location = dc.location
+	} else if dc.containerService.Location != dc.location {
+		return errors.New("--location does not match api model location")
+	}
+
+	template, _, err := loadDeployedTemplate(dc.deploymentDirectory)
+	if err != nil {
+		return err
+	}
+	dc.nameSuffix, err = templateNameSuffix(template)
+	return err
+}
+
+func (dc *deleteCmd) run(cmd *cobra.Command, args []string) error {
+	if err := dc.validate(cmd); err != nil {
+		return errors.Wrap(err, "failed to validate delete command")
+	}
+	if err := dc.load(); err != nil {
+		return errors.Wrap(err, "failed to load existing container service")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+
+	var all []resources.GenericResource
+	for page, err := dc.client.ListResources(ctx, dc.resourceGroupName); page.NotDone(); err = page.Next() {
+		if err != nil {
+			return errors.Wrapf(err, "failed to list the resources of resource group %s", dc.resourceGroupName)
+		}
+		all = append(all, page.Values()...)
+	}
+	groups := operations.ClusterResources(all, dc.nameSuffix)
+
+	var sp *clusterServicePrincipal
+	if dc.deleteServicePrincipal {
+		var err error
+		if sp, err = dc.servicePrincipal(ctx); err != nil {
+			return err
+		}
+	}
+
+	if dc.dryRun {
+		return printPlan(cmd.OutOrStdout(), dc.plan(groups, sp))
+	}
+	if !dc.force {
+		confirmed, err := dc.confirm(cmd.OutOrStderr(), dc.plan(groups, sp))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			return errors.New("delete was not confirmed, nothing was deleted")
+		}
+	}
+
+	if err := operations.DeleteClusterResources(dc.client, dc.logger, groups); err != nil {
+		return err
+	}
+
+	if sp != nil {
+		for _, id := range sp.roleAssignments {
+			dc.logger.Infof("Deleting role assignment %s", id)
+			if _, err := dc.client.DeleteRoleAssignmentByID(ctx, id); err != nil {
+				return errors.Wrapf(err, "failed to delete role assignment %s", id)
+			}
+		}
+		appID := to.String(sp.application.AppID)
+		dc.logger.Infof("Deleting application %s and its service principal", appID)
+		if _, err := dc.client.DeleteApp(ctx, to.String(sp.application.DisplayName), to.String(sp.application.ObjectID)); err != nil {
+			return errors.Wrapf(err, "failed to delete application %s", appID)
+		}
+	}
+	return nil
+}
+
+// servicePrincipal returns the service principal of the cluster and its role assignments in the resource group.
+// Only the application deploy creates when the api model has no service principal is returned, as other service
+// principals may be shared with other clusters.
+func (dc *deleteCmd) servicePrincipal(ctx context.Context) (*clusterServicePrincipal, error) {
+	properties := dc.containerService.Properties
+	spp := properties.ServicePrincipalProfile
+	if spp == nil || spp.ClientID == "" {
+		return nil, errors.New("the api model has no service principal to delete")
+	}
+
+	app, err := dc.client.GetApplicationByAppID(ctx, spp.ClientID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get application %s", spp.ClientID)
+	}
+	// deploy names the application after the DNS prefix of the masters
+	appURL := fmt.Sprintf("https://%s/", properties.MasterProfile.DNSPrefix)
+	created := false
+	if app.IdentifierUris != nil {
+		for _, uri := range *app.IdentifierUris {
+			if uri == appURL {
+				created = true
+			}
+		}
+	}
+	if !created {
+		return nil, errors.Errorf("service principal %s was not created by deploy for this cluster and will not be deleted", spp.ClientID)
+	}
+
+	servicePrincipal, err := dc.client.GetServicePrincipalByAppID(ctx, spp.ClientID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get the service principal of application %s", spp.ClientID)
+	}
+	sp := &clusterServicePrincipal{application: app}
+	scope := fmt.Sprintf(armhelpers.AADRoleResourceGroupScopeTemplate, dc.getAuthArgs().SubscriptionID.String(), dc.resourceGroupName)
+	for page, err := dc.client.ListRoleAssignmentsForPrincipal(ctx, scope, to.String(servicePrincipal.ObjectID)); page.NotDone(); err = page.Next() {
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list the role assignments of service principal %s", spp.ClientID)
+		}
+		for _, roleAssignment := range page.Values() {
+			sp.roleAssignments = append(sp.roleAssignments, to.String(roleAssignment.ID))
+		}
+	}
+	return sp, nil
+}
+
+// plan returns the plan of deleting the resources in order, followed by the service principal
+func (dc *deleteCmd) plan(groups [][]resources.GenericResource, sp *clusterServicePrincipal) *operations.Plan {
+	count := 0
+	for _, group := range groups {
+		count += len(group)
+	}
+	plan := operations.NewPlan("delete", fmt.Sprintf("Delete the %d resources of cluster %s", count, dc.containerService.Properties.MasterProfile.DNSPrefix), dc.resourceGroupName)
+	for _, group := range groups {
+		for _, resource := range group {
+			plan.AddStep(operations.PlanActionDelete, "", to.String(resource.Name), to.String(resource.Type))
+		}
+	}
+	if sp != nil {
+		for _, id := range sp.roleAssignments {
+			plan.AddStep(operations.PlanActionDelete, "", id, "role assignment")
+		}
+		plan.AddStep(operations.PlanActionDelete, "", to.String(sp.application.AppID), "application and service principal")
+	}
+	return plan
+}
+
+// confirm lists the steps of the plan and asks the user to confirm them
+func (dc *deleteCmd) confirm(out io.Writer, plan *operations.Plan) (bool, error) {
+	fmt.Fprintf(out, "%s in resource group %s:\n", plan.Summary, dc.resourceGroupName)
+	for _, step := range plan.Steps {
+		fmt.Fprintf(out, "  %s (%s)\n", step.Target, step.Detail)
+	}
+	fmt.Fprint(out, "Delete these resources? [y/N]: ")
+	answer, err := bufio.NewReader(dc.in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, errors.Wrap(err, "failed to read the confirmation")
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
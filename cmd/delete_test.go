@@ -0,0 +1,229 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func TestNewDeleteCmd(t *testing.T) {
+	output := newDeleteCmd()
+	if output.Use != deleteName || output.Short != deleteShortDescription || output.Long != deleteLongDescription {
+		t.Fatalf("delete command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, deleteName, output.Short, deleteShortDescription, output.Long, deleteLongDescription)
+	}
+
+	expectedFlags := []string{"location", "resource-group", "deployment-dir", "delete-service-principal", "dry-run", "force", "subscription-id"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("delete command should have flag %s", f)
+		}
+	}
+}
+
+func TestDeleteCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		dc          *deleteCmd
+		expectedErr error
+	}{
+		{
+			dc: &deleteCmd{
+				location:            "centralus",
+				deploymentDirectory: "_output/test",
+			},
+			expectedErr: errors.New("--resource-group must be specified"),
+		},
+		{
+			dc: &deleteCmd{
+				resourceGroupName:   "testRG",
+				deploymentDirectory: "_output/test",
+			},
+			expectedErr: errors.New("--location must be specified"),
+		},
+		{
+			dc: &deleteCmd{
+				resourceGroupName: "testRG",
+				location:          "centralus",
+			},
+			expectedErr: errors.New("--deployment-dir must be specified"),
+		},
+		{
+			dc: &deleteCmd{
+				resourceGroupName:   "testRG",
+				location:            "centralus",
+				deploymentDirectory: "_output/test",
+			},
+			expectedErr: nil,
+		},
+	}
+
+	for _, c := range cases {
+		err := c.dc.validate(r)
+		if err != nil && c.expectedErr != nil {
+			if err.Error() != c.expectedErr.Error() {
+				t.Fatalf("expected validate delete command to return error %s, but instead got %s", c.expectedErr.Error(), err.Error())
+			}
+		} else {
+			if c.expectedErr != nil {
+				t.Fatalf("expected validate delete command to return error %s, but instead got no error", c.expectedErr.Error())
+			} else if err != nil {
+				t.Fatalf("expected validate delete command to return no error, but instead got %s", err.Error())
+			}
+		}
+	}
+}
+
+// newTestDeleteCmd returns a deleteCmd that deletes the test deployment written to dir without asking for confirmation
+func newTestDeleteCmd(t *testing.T, dir string, client armhelpers.AKSEngineClient) *deleteCmd {
+	writeTestDeployment(t, dir)
+	return &deleteCmd{
+		authProvider:        newTestAuthProvider(client),
+		location:            "westus",
+		resourceGroupName:   "testRG",
+		deploymentDirectory: dir,
+		force:               true,
+	}
+}
+
+func TestDeleteCmdRunDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delete")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &armhelpers.MockAKSEngineClient{ShouldSupportVMIdentity: true}
+	dc := newTestDeleteCmd(t, dir, client)
+	dc.dryRun = true
+	dc.deleteServicePrincipal = true
+
+	out := &bytes.Buffer{}
+	r := &cobra.Command{}
+	r.SetOutput(out)
+	if err = dc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running delete --dry-run: %s", err)
+	}
+	if len(client.DeletedResourceIDs) != 0 {
+		t.Fatalf("expected delete --dry-run not to delete resources, got %v", client.DeletedResourceIDs)
+	}
+
+	plan := operations.Plan{}
+	if err = json.Unmarshal(out.Bytes(), &plan); err != nil {
+		t.Fatalf("unable to parse the plan: %s", err)
+	}
+	// 9 cluster resources, the role assignment and the application
+	if len(plan.Steps) != 11 {
+		t.Fatalf("expected 11 steps in the plan, got %d", len(plan.Steps))
+	}
+	if plan.Steps[0].Target != "k8s-master-12345678-0" || plan.Steps[0].Detail != "Microsoft.Compute/virtualMachines" {
+		t.Fatalf("expected the master VM to be deleted first, got %v", plan.Steps[0])
+	}
+	if plan.Steps[9].Target != "role-assignment-id" || plan.Steps[10].Target != "ServicePrincipalClientID" {
+		t.Fatalf("expected the role assignment and application to be deleted last, got %v and %v", plan.Steps[9], plan.Steps[10])
+	}
+	for _, step := range plan.Steps {
+		if step.Target == "shared-vnet" || step.Target == "k8s-master-87654321-0" {
+			t.Fatalf("expected resources of other clusters not to be deleted, got %v", step)
+		}
+	}
+}
+
+func TestDeleteCmdRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delete")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &armhelpers.MockAKSEngineClient{}
+	dc := newTestDeleteCmd(t, dir, client)
+	if err = dc.run(&cobra.Command{}, []string{}); err != nil {
+		t.Fatalf("unexpected error running delete: %s", err)
+	}
+	if len(client.DeletedResourceIDs) != 9 {
+		t.Fatalf("expected the 9 cluster resources to be deleted, got %v", client.DeletedResourceIDs)
+	}
+
+	client = &armhelpers.MockAKSEngineClient{ShouldSupportVMIdentity: true, FailDeleteRoleAssignment: true}
+	dc = newTestDeleteCmd(t, dir, client)
+	dc.deleteServicePrincipal = true
+	if err = dc.run(&cobra.Command{}, []string{}); err == nil || err.Error() != "failed to delete role assignment role-assignment-id: DeleteRoleAssignmentByID failed" {
+		t.Fatalf("expected failing to delete the role assignment to be reported, got %v", err)
+	}
+
+	client = &armhelpers.MockAKSEngineClient{FailDeleteResourceByID: true, ShouldSupportVMIdentity: true, FailDeleteRoleAssignment: true}
+	dc = newTestDeleteCmd(t, dir, client)
+	dc.deleteServicePrincipal = true
+	if err = dc.run(&cobra.Command{}, []string{}); err == nil || err.Error() != "failed to delete Microsoft.Compute/virtualMachines k8s-master-12345678-0: DeleteResourceByID failed" {
+		t.Fatalf("expected the service principal not to be deleted when the cluster resources fail to delete, got %v", err)
+	}
+}
+
+func TestDeleteCmdRunConfirmation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delete")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &armhelpers.MockAKSEngineClient{}
+	dc := newTestDeleteCmd(t, dir, client)
+	dc.force = false
+	dc.in = strings.NewReader("n\n")
+	out := &bytes.Buffer{}
+	r := &cobra.Command{}
+	r.SetOutput(out)
+	if err = dc.run(r, []string{}); err == nil || err.Error() != "delete was not confirmed, nothing was deleted" {
+		t.Fatalf("expected delete to stop when not confirmed, got %v", err)
+	}
+	if len(client.DeletedResourceIDs) != 0 {
+		t.Fatalf("expected no resource to be deleted without confirmation, got %v", client.DeletedResourceIDs)
+	}
+	if !strings.Contains(out.String(), "k8s-master-12345678-0 (Microsoft.Compute/virtualMachines)") || !strings.HasSuffix(out.String(), "[y/N]: ") {
+		t.Fatalf("expected the resources to be listed before asking for confirmation, got %s", out.String())
+	}
+
+	dc.in = strings.NewReader("yes\n")
+	if err = dc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running a confirmed delete: %s", err)
+	}
+	if len(client.DeletedResourceIDs) != 9 {
+		t.Fatalf("expected the 9 cluster resources to be deleted once confirmed, got %v", client.DeletedResourceIDs)
+	}
+}
+
+func TestDeleteCmdServicePrincipal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delete")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dc := newTestDeleteCmd(t, dir, &armhelpers.MockAKSEngineClient{})
+	if err = dc.load(); err != nil {
+		t.Fatalf("unexpected error loading the cluster: %s", err)
+	}
+	dc.containerService.Properties.MasterProfile.DNSPrefix = "otherdns"
+	_, err = dc.servicePrincipal(context.Background())
+	if err == nil || err.Error() != "service principal ServicePrincipalClientID was not created by deploy for this cluster and will not be deleted" {
+		t.Fatalf("expected a service principal not created by deploy to be kept, got %v", err)
+	}
+
+	dc.containerService.Properties.ServicePrincipalProfile = nil
+	if _, err = dc.servicePrincipal(context.Background()); err == nil || err.Error() != "the api model has no service principal to delete" {
+		t.Fatalf("expected a cluster without service principal to fail, got %v", err)
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/Azure/aks-engine/pkg/engine/transform"
 	"github.com/Azure/aks-engine/pkg/helpers"
 	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/aks-engine/pkg/operations"
 	"github.com/Azure/azure-sdk-for-go/services/graphrbac/1.6/graphrbac"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/pkg/errors"
@@ -48,7 +49,11 @@ type deployCmd struct {
 	caCertificatePath string
 	caPrivateKeyPath  string
 	parametersOnly    bool
-	set               []string
+	overrides         transform.APIModelOverrides
+	secrets           secretStoreArgs
+	redact            bool
+	apiModelFormat    string
+	outputFormat      string
 
 	// derived
 	containerService *api.ContainerService
@@ -59,6 +64,7 @@ type deployCmd struct {
 	resourceGroup string
 	random        *rand.Rand
 	location      string
+	events        *operations.EventStream
 }
 
 func newDeployCmd() *cobra.Command {
@@ -74,16 +80,21 @@ func newDeployCmd() *cobra.Command {
 			if err := dc.validateArgs(cmd, args); err != nil {
 				log.Fatalf("error validating deployCmd: %s", err.Error())
 			}
+			dc.events = newEventStream(dc.outputFormat, cmd.OutOrStdout())
+			dc.events.StartPhase("load-api-model")
 			if err := dc.mergeAPIModel(); err != nil {
-				log.Fatalf("error merging API model in deployCmd: %s", err.Error())
+				dc.fatalf(err, "error merging API model in deployCmd: %s", err.Error())
 			}
 			if err := dc.loadAPIModel(cmd, args); err != nil {
-				log.Fatalf("failed to load apimodel: %s", err.Error())
+				dc.fatalf(err, "failed to load apimodel: %s", err.Error())
 			}
 			if _, _, err := dc.validateApimodel(); err != nil {
-				log.Fatalf("Failed to validate the apimodel after populating values: %s", err.Error())
+				dc.fatalf(err, "Failed to validate the apimodel after populating values: %s", err.Error())
 			}
-			return dc.run()
+			dc.events.FinishPhase("load-api-model", nil)
+			err := dc.run()
+			dc.events.Finish(err)
+			return err
 		},
 	}
 
@@ -97,7 +108,11 @@ func newDeployCmd() *cobra.Command {
 	f.StringVarP(&dc.resourceGroup, "resource-group", "g", "", "resource group to deploy to (will use the DNS prefix from the apimodel if not specified)")
 	f.StringVarP(&dc.location, "location", "l", "", "location to deploy to (required)")
 	f.BoolVarP(&dc.forceOverwrite, "force-overwrite", "f", false, "automatically overwrite existing files in the output directory")
-	f.StringArrayVar(&dc.set, "set", []string{}, "set values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	addAPIModelOverrideFlags(&dc.overrides, f)
+	f.BoolVar(&dc.redact, "redact", false, "also write the api model without its secrets to apimodel.redacted.json, for sharing")
+	addAPIModelFormatFlag(&dc.apiModelFormat, f)
+	addSecretStoreFlags(&dc.secrets, f)
+	addOutputFormatFlag(&dc.outputFormat, f)
 
 	addAuthFlags(dc.getAuthArgs(), f)
 
@@ -132,7 +147,15 @@ func (dc *deployCmd) validateArgs(cmd *cobra.Command, args []string) error {
 	}
 	dc.location = helpers.NormalizeAzureRegion(dc.location)
 
-	return nil
+	if err = validateOutputFormat(dc.outputFormat); err != nil {
+		return err
+	}
+
+	if err = validateAPIModelFormat(dc.apiModelFormat); err != nil {
+		return err
+	}
+
+	return dc.secrets.validate()
 }
 
 func (dc *deployCmd) mergeAPIModel() error {
@@ -153,17 +176,13 @@ func (dc *deployCmd) mergeAPIModel() error {
 		dc.apimodelPath = f.Name()
 	}
 
-	// if --set flag has been used
-	if len(dc.set) > 0 {
-		m := make(map[string]transform.APIModelValue)
-		transform.MapValues(m, dc.set)
-
-		// overrides the api model and generates a new file
-		dc.apimodelPath, err = transform.MergeValuesWithAPIModel(dc.apimodelPath, m)
-		if err != nil {
-			return errors.Wrapf(err, "error merging --set values with the api model: %s", dc.apimodelPath)
-		}
-
+	// overlays, variables and --set flags generate a new api model file
+	apimodelPath, err := transform.MergeOverridesWithAPIModel(dc.apimodelPath, &dc.overrides)
+	if err != nil {
+		return errors.Wrapf(err, "error merging overlays and --set values with the api model: %s", dc.apimodelPath)
+	}
+	if apimodelPath != dc.apimodelPath {
+		dc.apimodelPath = apimodelPath
 		log.Infoln(fmt.Sprintf("new api model file has been generated during merge: %s", dc.apimodelPath))
 	}
 
@@ -373,6 +392,7 @@ func (dc *deployCmd) validateApimodel() (*api.ContainerService, string, error) {
 }
 
 func (dc *deployCmd) run() error {
+	dc.events.StartPhase("generate-template")
 	ctx := engine.Context{
 		Translator: &i18n.Translator{
 			Locale: dc.locale,
@@ -381,36 +401,42 @@ func (dc *deployCmd) run() error {
 
 	templateGenerator, err := engine.InitializeTemplateGenerator(ctx)
 	if err != nil {
-		log.Fatalf("failed to initialize template generator: %s", err.Error())
+		dc.fatalf(err, "failed to initialize template generator: %s", err.Error())
 	}
 
 	certsgenerated, err := dc.containerService.SetPropertiesDefaults(false, false)
 	if err != nil {
-		log.Fatalf("error in SetPropertiesDefaults template %s: %s", dc.apimodelPath, err.Error())
-		os.Exit(1)
+		dc.fatalf(err, "error in SetPropertiesDefaults template %s: %s", dc.apimodelPath, err.Error())
 	}
 
 	template, parameters, err := templateGenerator.GenerateTemplate(dc.containerService, engine.DefaultGeneratorCode, BuildTag)
 	if err != nil {
-		log.Fatalf("error generating template %s: %s", dc.apimodelPath, err.Error())
-		os.Exit(1)
+		dc.fatalf(err, "error generating template %s: %s", dc.apimodelPath, err.Error())
 	}
 
 	if template, err = transform.PrettyPrintArmTemplate(template); err != nil {
-		log.Fatalf("error pretty printing template: %s \n", err.Error())
+		dc.fatalf(err, "error pretty printing template: %s \n", err.Error())
 	}
 	var parametersFile string
 	if parametersFile, err = transform.BuildAzureParametersFile(parameters); err != nil {
-		log.Fatalf("error pretty printing template parameters: %s \n", err.Error())
+		dc.fatalf(err, "error pretty printing template parameters: %s \n", err.Error())
 	}
 
+	secretStore, err := dc.secrets.secretStore(dc.containerService, dc.client)
+	if err != nil {
+		dc.fatalf(err, "error selecting the secret store: %s \n", err.Error())
+	}
 	writer := &engine.ArtifactWriter{
 		Translator: &i18n.Translator{
 			Locale: dc.locale,
 		},
+		SecretStore:    secretStore,
+		KeyVaultClient: dc.client,
+		Redact:         dc.redact,
+		APIModelFormat: dc.apiModelFormat,
 	}
 	if err = writer.WriteTLSArtifacts(dc.containerService, dc.apiVersion, template, parametersFile, dc.outputDirectory, certsgenerated, dc.parametersOnly); err != nil {
-		log.Fatalf("error writing artifacts: %s \n", err.Error())
+		dc.fatalf(err, "error writing artifacts: %s \n", err.Error())
 	}
 
 	templateJSON := make(map[string]interface{})
@@ -418,32 +444,70 @@ func (dc *deployCmd) run() error {
 
 	err = json.Unmarshal([]byte(template), &templateJSON)
 	if err != nil {
-		log.Fatalln(err)
+		dc.fatalf(err, "%s", err.Error())
 	}
 
 	err = json.Unmarshal([]byte(parameters), &parametersJSON)
 	if err != nil {
-		log.Fatalln(err)
+		dc.fatalf(err, "%s", err.Error())
 	}
+	dc.events.FinishPhase("generate-template", nil)
 
 	deploymentSuffix := dc.random.Int31()
+	deploymentName := fmt.Sprintf("%s-%d", dc.resourceGroup, deploymentSuffix)
 	cx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
 	defer cancel()
 
-	if res, err := dc.client.DeployTemplate(
+	dc.events.StartPhase("deploy")
+	res, err := armhelpers.DeployTemplateWithProgress(
 		cx,
+		dc.client,
 		dc.resourceGroup,
-		fmt.Sprintf("%s-%d", dc.resourceGroup, deploymentSuffix),
+		deploymentName,
 		templateJSON,
 		parametersJSON,
-	); err != nil {
+		armhelpers.DefaultDeploymentProgressInterval,
+		func(progress armhelpers.DeploymentOperationProgress) {
+			dc.reportProgress(deploymentName, progress)
+		},
+	)
+	if err != nil {
 		if res.Response.Response != nil && res.Body != nil {
 			defer res.Body.Close()
 			body, _ := ioutil.ReadAll(res.Body)
 			log.Errorf(string(body))
 		}
-		log.Fatalln(err)
+		dc.fatalf(err, "%s", err.Error())
 	}
+	dc.events.FinishPhase("deploy", nil)
 
 	return nil
 }
+
+// reportProgress logs a resource of the deployment that changed state, and emits it to the event stream
+func (dc *deployCmd) reportProgress(deploymentName string, progress armhelpers.DeploymentOperationProgress) {
+	if progress.ResourceName == "" {
+		// the operation of the deployment itself
+		return
+	}
+	if progress.Reason != "" {
+		log.Errorf("%s %s: %s: %s", progress.ResourceType, progress.ResourceName, progress.ProvisioningState, progress.Reason)
+	} else {
+		log.Infof("%s %s: %s", progress.ResourceType, progress.ResourceName, progress.ProvisioningState)
+	}
+	dc.events.Emit(operations.Event{
+		Type:         operations.EventDeploymentOperation,
+		Deployment:   deploymentName,
+		Resource:     progress.ResourceName,
+		ResourceType: progress.ResourceType,
+		Status:       progress.ProvisioningState,
+		StatusCode:   progress.StatusCode,
+		Error:        progress.Reason,
+	})
+}
+
+// fatalf ends the event stream with err before exiting
+func (dc *deployCmd) fatalf(err error, format string, args ...interface{}) {
+	dc.events.Finish(err)
+	log.Fatalf(format, args...)
+}
@@ -4,14 +4,19 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 
 	"os"
 
 	"github.com/Azure/aks-engine/pkg/api"
 	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
 	"github.com/spf13/cobra"
@@ -99,7 +104,7 @@ func TestNewDeployCmd(t *testing.T) {
 		t.Fatalf("deploy command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, deployName, output.Short, deployShortDescription, output.Long, versionLongDescription)
 	}
 
-	expectedFlags := []string{"api-model", "dns-prefix", "auto-suffix", "output-directory", "ca-private-key-path", "resource-group", "location", "force-overwrite"}
+	expectedFlags := []string{"api-model", "dns-prefix", "auto-suffix", "output-directory", "ca-private-key-path", "resource-group", "location", "force-overwrite", "output-format", "set", "set-json", "unset", "values-file", "overlay", "vars-file", "env-vars"}
 	for _, f := range expectedFlags {
 		if output.Flags().Lookup(f) == nil {
 			t.Fatalf("deploy command should have flag %s", f)
@@ -515,7 +520,7 @@ func TestDeployCmdMergeAPIModel(t *testing.T) {
 
 	d = &deployCmd{}
 	d.apimodelPath = "../pkg/engine/testdata/simple/kubernetes.json"
-	d.set = []string{"masterProfile.count=3,linuxProfile.adminUsername=testuser"}
+	d.overrides.Set = []string{"masterProfile.count=3,linuxProfile.adminUsername=testuser"}
 	err = d.mergeAPIModel()
 	if err != nil {
 		t.Fatalf("unexpected error calling mergeAPIModel with one --set flag: %s", err.Error())
@@ -523,7 +528,7 @@ func TestDeployCmdMergeAPIModel(t *testing.T) {
 
 	d = &deployCmd{}
 	d.apimodelPath = "../pkg/engine/testdata/simple/kubernetes.json"
-	d.set = []string{"masterProfile.count=3", "linuxProfile.adminUsername=testuser"}
+	d.overrides.Set = []string{"masterProfile.count=3", "linuxProfile.adminUsername=testuser"}
 	err = d.mergeAPIModel()
 	if err != nil {
 		t.Fatalf("unexpected error calling mergeAPIModel with multiple --set flags: %s", err.Error())
@@ -531,7 +536,7 @@ func TestDeployCmdMergeAPIModel(t *testing.T) {
 
 	d = &deployCmd{}
 	d.apimodelPath = "../pkg/engine/testdata/simple/kubernetes.json"
-	d.set = []string{"agentPoolProfiles[0].count=1"}
+	d.overrides.Set = []string{"agentPoolProfiles[0].count=1"}
 	err = d.mergeAPIModel()
 	if err != nil {
 		t.Fatalf("unexpected error calling mergeAPIModel with one --set flag to override an array property: %s", err.Error())
@@ -542,8 +547,22 @@ func TestDeployCmdRun(t *testing.T) {
 	d := &deployCmd{
 		client: &armhelpers.MockAKSEngineClient{},
 		authProvider: &mockAuthProvider{
-			authArgs:      &authArgs{},
-			getClientMock: &armhelpers.MockAKSEngineClient{},
+			authArgs: &authArgs{},
+			getClientMock: &armhelpers.MockAKSEngineClient{
+				DeploymentOperations: []resources.DeploymentOperation{
+					{
+						OperationID: to.StringPtr("1"),
+						Properties: &resources.DeploymentOperationProperties{
+							ProvisioningState: to.StringPtr("Succeeded"),
+							StatusCode:        to.StringPtr("OK"),
+							TargetResource: &resources.TargetResource{
+								ResourceName: to.StringPtr("k8s-master-12345678-0/cse-master-0"),
+								ResourceType: to.StringPtr("Microsoft.Compute/virtualMachines/extensions"),
+							},
+						},
+					},
+				},
+			},
 		},
 		apimodelPath:    "./this/is/unused.json",
 		outputDirectory: "_test_output",
@@ -578,8 +597,15 @@ func TestDeployCmdRun(t *testing.T) {
 		t.Fatalf("Failed to call LoadAPIModel: %s", err)
 	}
 
+	events := &bytes.Buffer{}
+	d.events = operations.NewEventStream(events)
 	err = d.run()
 	if err != nil {
 		t.Fatalf("Failed to call LoadAPIModel: %s", err)
 	}
+	for _, expected := range []string{`"type":"PhaseFinished","phase":"generate-template"`, `"type":"DeploymentOperation","deployment":"`, `"resource":"k8s-master-12345678-0/cse-master-0","resourceType":"Microsoft.Compute/virtualMachines/extensions","status":"Succeeded","statusCode":"OK"`, `"type":"PhaseFinished","phase":"deploy"`} {
+		if !strings.Contains(events.String(), expected) {
+			t.Fatalf("expected the events of the deployment to contain %s, got %s", expected, events.String())
+		}
+	}
 }
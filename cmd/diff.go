@@ -0,0 +1,223 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/engine"
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	diffName             = "diff"
+	diffShortDescription = "Compare the ARM templates of two cluster definitions"
+	diffLongDescription  = "Compare the ARM templates generated from two api models, or from an api model and a previous output directory, reporting the resources, properties and scripts that differ"
+)
+
+type diffCmd struct {
+	outputFormat string
+
+	// derived
+	oldPath string
+	newPath string
+	locale  *gotext.Locale
+	out     io.Writer
+}
+
+func newDiffCmd() *cobra.Command {
+	dc := diffCmd{
+		out: os.Stdout,
+	}
+
+	diffCmd := &cobra.Command{
+		Use:   diffName + " <old api model or output directory> <new api model or output directory>",
+		Short: diffShortDescription,
+		Long:  diffLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := dc.validate(cmd, args); err != nil {
+				return errors.Wrap(err, "failed to validate diff command")
+			}
+			return dc.run()
+		},
+	}
+
+	f := diffCmd.Flags()
+	f.StringVarP(&dc.outputFormat, "output", "o", "human", fmt.Sprintf("Output format to use: %s", outputFormatOptions))
+
+	return diffCmd
+}
+
+func (dc *diffCmd) validate(cmd *cobra.Command, args []string) error {
+	var err error
+
+	dc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if len(args) != 2 {
+		cmd.Usage()
+		return errors.New("diff requires exactly two api models or output directories")
+	}
+	dc.oldPath, dc.newPath = args[0], args[1]
+	for _, p := range args {
+		if _, err = os.Stat(p); os.IsNotExist(err) {
+			return errors.Errorf("specified path does not exist (%s)", p)
+		}
+	}
+
+	if dc.outputFormat != "human" && dc.outputFormat != "json" {
+		cmd.Usage()
+		return errors.Errorf("unsupported output format: %s", dc.outputFormat)
+	}
+
+	return nil
+}
+
+func (dc *diffCmd) run() error {
+	oldTemplate, oldParameters, err := dc.loadTemplate(dc.oldPath)
+	if err != nil {
+		return err
+	}
+	newTemplate, newParameters, err := dc.loadTemplate(dc.newPath)
+	if err != nil {
+		return err
+	}
+
+	diff, err := engine.DiffTemplates(oldTemplate, oldParameters, newTemplate, newParameters)
+	if err != nil {
+		return errors.Wrap(err, "error comparing templates")
+	}
+
+	if dc.outputFormat == "json" {
+		b, err := helpers.JSONMarshalIndent(diff, "", "  ", false)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal diff")
+		}
+		fmt.Fprintln(dc.out, string(b))
+		return nil
+	}
+	printTemplateDiff(dc.out, diff)
+	return nil
+}
+
+// loadTemplate returns the ARM template and parameters for a path. Directories are expected to hold
+// the output of a previous `generate` or `deploy`, anything else is treated as an api model and generated.
+func (dc *diffCmd) loadTemplate(p string) (string, string, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "error reading %s", p)
+	}
+	if info.IsDir() {
+		template, err := ioutil.ReadFile(path.Join(p, templateFilename))
+		if err != nil {
+			return "", "", errors.Wrapf(err, "error reading %s", templateFilename)
+		}
+		// the parameters file is optional, the template defaults are compared without it
+		parameters, err := ioutil.ReadFile(path.Join(p, parametersFilename))
+		if err != nil && !os.IsNotExist(err) {
+			return "", "", errors.Wrapf(err, "error reading %s", parametersFilename)
+		}
+		return string(template), string(parameters), nil
+	}
+
+	translator := &i18n.Translator{
+		Locale: dc.locale,
+	}
+	apiloader := &api.Apiloader{
+		Translator: translator,
+	}
+	containerService, _, err := apiloader.LoadContainerServiceFromFile(p, true, false, nil)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "error parsing the api model %s", p)
+	}
+	if _, err = containerService.SetPropertiesDefaults(false, false); err != nil {
+		return "", "", errors.Wrapf(err, "error in SetPropertiesDefaults for %s", p)
+	}
+	templateGenerator, err := engine.InitializeTemplateGenerator(engine.Context{Translator: translator})
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to initialize template generator")
+	}
+	template, parameters, err := templateGenerator.GenerateTemplate(containerService, engine.DefaultGeneratorCode, BuildTag)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "error generating template %s", p)
+	}
+	return template, parameters, nil
+}
+
+func printTemplateDiff(w io.Writer, diff *engine.TemplateDiff) {
+	if diff.IsEmpty() {
+		fmt.Fprintln(w, "No differences found")
+		return
+	}
+	printPropertyDiffs(w, "Parameters", diff.Parameters)
+	printPropertyDiffs(w, "Variables", diff.Variables)
+	if len(diff.Resources) > 0 {
+		fmt.Fprintln(w, "Resources:")
+		for _, r := range diff.Resources {
+			fmt.Fprintf(w, "  %s %s %s\n", diffSymbol(r.Change), r.Type, r.Name)
+			for _, p := range r.Properties {
+				printPropertyDiff(w, "      ", p)
+			}
+		}
+	}
+	printPropertyDiffs(w, "Outputs", diff.Outputs)
+}
+
+func printPropertyDiffs(w io.Writer, title string, diffs []engine.PropertyDiff) {
+	if len(diffs) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, p := range diffs {
+		printPropertyDiff(w, "  ", p)
+	}
+}
+
+func printPropertyDiff(w io.Writer, indent string, p engine.PropertyDiff) {
+	switch {
+	case p.ScriptDiff != "":
+		fmt.Fprintf(w, "%s%s %s:\n", indent, diffSymbol(p.Change), p.Path)
+		for _, line := range strings.Split(strings.TrimSuffix(p.ScriptDiff, "\n"), "\n") {
+			fmt.Fprintf(w, "%s    %s\n", indent, line)
+		}
+	case p.Change == engine.DiffAdded:
+		fmt.Fprintf(w, "%s+ %s: %s\n", indent, p.Path, diffValue(p.New))
+	case p.Change == engine.DiffRemoved:
+		fmt.Fprintf(w, "%s- %s: %s\n", indent, p.Path, diffValue(p.Old))
+	default:
+		fmt.Fprintf(w, "%s~ %s: %s => %s\n", indent, p.Path, diffValue(p.Old), diffValue(p.New))
+	}
+}
+
+func diffSymbol(change string) string {
+	switch change {
+	case engine.DiffAdded:
+		return "+"
+	case engine.DiffRemoved:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+func diffValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
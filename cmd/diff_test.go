@@ -0,0 +1,120 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/engine"
+	"github.com/spf13/cobra"
+)
+
+func TestNewDiffCmd(t *testing.T) {
+	output := newDiffCmd()
+	if output.Name() != diffName || output.Short != diffShortDescription || output.Long != diffLongDescription {
+		t.Fatalf("diff command should have name %s equal %s, short %s equal %s and long %s equal to %s", output.Name(), diffName, output.Short, diffShortDescription, output.Long, diffLongDescription)
+	}
+
+	if output.Flags().Lookup("output") == nil {
+		t.Fatalf("diff command should have flag output")
+	}
+}
+
+func TestDiffCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+	apimodel := "../pkg/engine/testdata/simple/kubernetes.json"
+
+	cases := []struct {
+		dc          *diffCmd
+		args        []string
+		expectedErr string
+	}{
+		{
+			dc:          &diffCmd{outputFormat: "human"},
+			args:        []string{apimodel},
+			expectedErr: "diff requires exactly two api models or output directories",
+		},
+		{
+			dc:          &diffCmd{outputFormat: "human"},
+			args:        []string{apimodel, "does-not-exist.json"},
+			expectedErr: "specified path does not exist (does-not-exist.json)",
+		},
+		{
+			dc:          &diffCmd{outputFormat: "yaml"},
+			args:        []string{apimodel, apimodel},
+			expectedErr: "unsupported output format: yaml",
+		},
+		{
+			dc:   &diffCmd{outputFormat: "json"},
+			args: []string{apimodel, "../pkg/engine/testdata/simple"},
+		},
+	}
+
+	for _, c := range cases {
+		err := c.dc.validate(r, c.args)
+		if c.expectedErr == "" && err != nil {
+			t.Fatalf("expected diff command to validate with no error, got %s", err)
+		}
+		if c.expectedErr != "" && (err == nil || err.Error() != c.expectedErr) {
+			t.Fatalf("expected diff command to return error %s, got %v", c.expectedErr, err)
+		}
+	}
+}
+
+func TestDiffCmdRun(t *testing.T) {
+	apimodel := "../pkg/engine/testdata/simple/kubernetes.json"
+	contents, err := ioutil.ReadFile(apimodel)
+	if err != nil {
+		t.Fatalf("unable to read test api model: %s", err)
+	}
+	changed := strings.Replace(string(contents), `"dnsPrefix": "masterdns1"`, `"dnsPrefix": "masterdns2"`, 1)
+	f, err := ioutil.TempFile("", "apimodel")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString(changed); err != nil {
+		t.Fatalf("unable to write test api model: %s", err)
+	}
+	f.Close()
+
+	var out bytes.Buffer
+	dc := &diffCmd{outputFormat: "json", out: &out}
+	if err = dc.validate(&cobra.Command{}, []string{apimodel, f.Name()}); err != nil {
+		t.Fatalf("unexpected error validating diff command: %s", err)
+	}
+	if err = dc.run(); err != nil {
+		t.Fatalf("unexpected error running diff command: %s", err)
+	}
+	diff := &engine.TemplateDiff{}
+	if err = json.Unmarshal(out.Bytes(), diff); err != nil {
+		t.Fatalf("expected json output, got %s", out.String())
+	}
+	found := false
+	for _, p := range diff.Parameters {
+		if p.Path == "masterEndpointDNSNamePrefix" && p.Old == "masterdns1" && p.New == "masterdns2" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected the dns prefix parameter to be reported as changed, got %+v", diff.Parameters)
+	}
+
+	out.Reset()
+	dc = &diffCmd{outputFormat: "human", out: &out}
+	if err = dc.validate(&cobra.Command{}, []string{apimodel, apimodel}); err != nil {
+		t.Fatalf("unexpected error validating diff command: %s", err)
+	}
+	if err = dc.run(); err != nil {
+		t.Fatalf("unexpected error running diff command: %s", err)
+	}
+	if strings.TrimSpace(out.String()) != "No differences found" {
+		t.Fatalf("expected no differences between identical api models, got %s", out.String())
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	etcdName             = "etcd"
+	etcdShortDescription = "Back up and restore the etcd data of an existing Kubernetes cluster"
+	etcdLongDescription  = "Save snapshots of the etcd data of an existing Kubernetes cluster and restore them on every master"
+
+	etcdBackupName             = "backup"
+	etcdBackupShortDescription = "Save a snapshot of the etcd data of an existing Kubernetes cluster"
+	etcdBackupLongDescription  = "Save a snapshot of the etcd data of an existing Kubernetes cluster to a storage account container, or to a local file"
+
+	etcdRestoreName             = "restore"
+	etcdRestoreShortDescription = "Restore a snapshot of the etcd data of an existing Kubernetes cluster"
+	etcdRestoreLongDescription  = "Replace the etcd data on every master of an existing Kubernetes cluster with a snapshot saved by `etcd backup`"
+)
+
+const (
+	// defaultEtcdBackupContainer is the storage account container snapshots are saved to
+	defaultEtcdBackupContainer = "etcd-backups"
+	// etcdSnapshotTimeFormat is the timestamp in the name of saved snapshots
+	etcdSnapshotTimeFormat = "20060102T150405Z"
+)
+
+// etcdCmd holds the arguments shared by the etcd subcommands
+type etcdCmd struct {
+	authProvider
+
+	// user input
+	resourceGroupName    string
+	deploymentDirectory  string
+	location             string
+	sshKeyPath           string
+	storageAccount       string
+	storageContainer     string
+	storageResourceGroup string
+
+	// derived
+	containerService *api.ContainerService
+	locale           *gotext.Locale
+	client           armhelpers.AKSEngineClient
+	storageClient    armhelpers.AKSStorageClient
+	sshRunner        operations.RemoteRunner
+	masterFQDN       string
+	logger           *log.Entry
+}
+
+type etcdBackupCmd struct {
+	etcdCmd
+
+	// user input
+	outputPath string
+}
+
+type etcdRestoreCmd struct {
+	etcdCmd
+
+	// user input
+	snapshot string
+}
+
+func newEtcdCmd() *cobra.Command {
+	etcdCmd := &cobra.Command{
+		Use:   etcdName,
+		Short: etcdShortDescription,
+		Long:  etcdLongDescription,
+	}
+	etcdCmd.AddCommand(newEtcdBackupCmd())
+	etcdCmd.AddCommand(newEtcdRestoreCmd())
+	return etcdCmd
+}
+
+func newEtcdBackupCmd() *cobra.Command {
+	ebc := etcdBackupCmd{
+		etcdCmd: etcdCmd{
+			authProvider: &authArgs{},
+		},
+	}
+
+	backupCmd := &cobra.Command{
+		Use:   etcdBackupName,
+		Short: etcdBackupShortDescription,
+		Long:  etcdBackupLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ebc.run(cmd, args)
+		},
+	}
+
+	f := backupCmd.Flags()
+	ebc.addFlags(f)
+	f.StringVarP(&ebc.outputPath, "output", "o", "", "path of the file to save the snapshot to, instead of the storage account (defaults to a timestamped file in the deployment directory when no storage account is given)")
+
+	return backupCmd
+}
+
+func newEtcdRestoreCmd() *cobra.Command {
+	erc := etcdRestoreCmd{
+		etcdCmd: etcdCmd{
+			authProvider: &authArgs{},
+		},
+	}
+
+	restoreCmd := &cobra.Command{
+		Use:   etcdRestoreName,
+		Short: etcdRestoreShortDescription,
+		Long:  etcdRestoreLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return erc.run(cmd, args)
+		},
+	}
+
+	f := restoreCmd.Flags()
+	erc.addFlags(f)
+	f.StringVar(&erc.snapshot, "snapshot", "", "name of the snapshot blob in the storage account container, or path of the snapshot file when no storage account is given (required)")
+
+	return restoreCmd
+}
+
+func (ec *etcdCmd) addFlags(f *pflag.FlagSet) {
+	f.StringVarP(&ec.location, "location", "l", "", "location the cluster is deployed in (required)")
+	f.StringVarP(&ec.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed (required)")
+	f.StringVar(&ec.deploymentDirectory, "deployment-dir", "", "the location of the output from `generate` (required)")
+	f.StringVar(&ec.sshKeyPath, "ssh-key-path", "", "path to the private key used to SSH into the masters (defaults to <adminUsername>_rsa in the deployment directory)")
+	f.StringVar(&ec.storageAccount, "storage-account", "", "name of the storage account snapshots are saved in")
+	f.StringVar(&ec.storageContainer, "storage-container", defaultEtcdBackupContainer, "name of the storage account container snapshots are saved in")
+	f.StringVar(&ec.storageResourceGroup, "storage-resource-group", "", "the resource group of the storage account (defaults to the resource group of the cluster)")
+	addAuthFlags(ec.getAuthArgs(), f)
+}
+
+func (ec *etcdCmd) validate(cmd *cobra.Command) error {
+	var err error
+
+	ec.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if ec.resourceGroupName == "" {
+		cmd.Usage()
+		return errors.New("--resource-group must be specified")
+	}
+
+	if ec.location == "" {
+		cmd.Usage()
+		return errors.New("--location must be specified")
+	}
+	ec.location = helpers.NormalizeAzureRegion(ec.location)
+
+	if ec.deploymentDirectory == "" {
+		cmd.Usage()
+		return errors.New("--deployment-dir must be specified")
+	}
+
+	if ec.storageResourceGroup == "" {
+		ec.storageResourceGroup = ec.resourceGroupName
+	}
+	return nil
+}
+
+func (ebc *etcdBackupCmd) validate(cmd *cobra.Command) error {
+	if err := ebc.etcdCmd.validate(cmd); err != nil {
+		return err
+	}
+	if ebc.outputPath != "" && ebc.storageAccount != "" {
+		cmd.Usage()
+		return errors.New("--output and --storage-account cannot be used together")
+	}
+	return nil
+}
+
+func (erc *etcdRestoreCmd) validate(cmd *cobra.Command) error {
+	if err := erc.etcdCmd.validate(cmd); err != nil {
+		return err
+	}
+	if erc.snapshot == "" {
+		cmd.Usage()
+		return errors.New("--snapshot must be specified")
+	}
+	return nil
+}
+
+func (ec *etcdCmd) loadCluster() error {
+	var err error
+
+	ec.logger = log.New().WithField("source", "etcd command line")
+
+	apiModelPath := api.FindAPIModelFile(ec.deploymentDirectory)
+	if _, err = os.Stat(apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", apiModelPath)
+	}
+
+	// the client reads the snapshots in the storage account and the secrets of the api model kept in Key Vault
+	manifest, err := api.LoadSecretsManifest(ec.deploymentDirectory)
+	if err != nil {
+		return err
+	}
+	if ec.storageAccount != "" || (manifest != nil && manifest.Store == api.KeyVaultSecretStoreKind) {
+		if err = ec.getAuthArgs().validateAuthArgs(); err != nil {
+			return err
+		}
+		if ec.client, err = ec.authProvider.getClient(); err != nil {
+			return errors.Wrap(err, "failed to get client")
+		}
+	}
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: ec.locale,
+		},
+		KeyVaultClient: ec.client,
+	}
+	ec.containerService, _, err = apiloader.LoadContainerServiceFromFile(apiModelPath, true, true, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+
+	if ec.containerService.Location == "" {
+		ec.containerService.Location = ec.location
+	} else if ec.containerService.Location != ec.location {
+		return errors.New("--location does not match api model location")
+	}
+
+	properties := ec.containerService.Properties
+	if err = validateEtcdSnapshotSupported(properties); err != nil {
+		return err
+	}
+	ec.masterFQDN = api.FormatAzureProdFQDNByLocation(properties.MasterProfile.DNSPrefix, ec.location)
+
+	if ec.sshRunner == nil {
+		if ec.sshRunner, err = newSSHRemoteRunner(properties.LinuxProfile, ec.deploymentDirectory, ec.sshKeyPath); err != nil {
+			return err
+		}
+	}
+
+	if ec.storageAccount != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+		defer cancel()
+		if ec.storageClient, err = ec.client.GetStorageClient(ctx, ec.storageResourceGroup, ec.storageAccount); err != nil {
+			return errors.Wrapf(err, "failed to get a client for storage account %s", ec.storageAccount)
+		}
+	}
+	return nil
+}
+
+func (ec *etcdCmd) snapshotter() *operations.EtcdSnapshotter {
+	return &operations.EtcdSnapshotter{
+		Runner:             ec.sshRunner,
+		Logger:             ec.logger,
+		CertificateProfile: ec.containerService.Properties.CertificateProfile,
+	}
+}
+
+func (ebc *etcdBackupCmd) run(cmd *cobra.Command, args []string) error {
+	if err := ebc.validate(cmd); err != nil {
+		return errors.Wrap(err, "failed to validate etcd backup command")
+	}
+	if err := ebc.loadCluster(); err != nil {
+		return errors.Wrap(err, "failed to load existing container service")
+	}
+
+	masters := masterHosts(ebc.masterFQDN, ebc.containerService.Properties.MasterProfile.Count)
+	snapshot, err := takeEtcdSnapshot(ebc.snapshotter(), masters)
+	if err != nil {
+		return err
+	}
+
+	name := etcdSnapshotFilename(ebc.containerService.Properties.MasterProfile.DNSPrefix, time.Now())
+	if ebc.storageAccount != "" {
+		if _, err = ebc.storageClient.CreateContainer(ebc.storageContainer, nil); err != nil {
+			return errors.Wrapf(err, "failed to create storage container %s", ebc.storageContainer)
+		}
+		if err = ebc.storageClient.SaveBlockBlob(ebc.storageContainer, name, snapshot, nil); err != nil {
+			return errors.Wrap(err, "failed to upload the etcd snapshot")
+		}
+		ebc.logger.Infof("Saved the etcd snapshot to %s/%s in storage account %s", ebc.storageContainer, name, ebc.storageAccount)
+		return nil
+	}
+
+	if ebc.outputPath == "" {
+		ebc.outputPath = path.Join(ebc.deploymentDirectory, name)
+	}
+	if err = ioutil.WriteFile(ebc.outputPath, snapshot, 0600); err != nil {
+		return errors.Wrap(err, "failed to write the etcd snapshot")
+	}
+	ebc.logger.Infof("Saved the etcd snapshot to %s", ebc.outputPath)
+	return nil
+}
+
+func (erc *etcdRestoreCmd) run(cmd *cobra.Command, args []string) error {
+	if err := erc.validate(cmd); err != nil {
+		return errors.Wrap(err, "failed to validate etcd restore command")
+	}
+	if err := erc.loadCluster(); err != nil {
+		return errors.Wrap(err, "failed to load existing container service")
+	}
+
+	var snapshot []byte
+	var err error
+	if erc.storageAccount != "" {
+		snapshot, err = erc.storageClient.GetBlockBlob(erc.storageContainer, erc.snapshot)
+	} else {
+		snapshot, err = ioutil.ReadFile(erc.snapshot)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read etcd snapshot %s", erc.snapshot)
+	}
+
+	masters := masterHosts(erc.masterFQDN, erc.containerService.Properties.MasterProfile.Count)
+	if err = erc.snapshotter().Restore(masters, snapshot); err != nil {
+		return errors.Wrap(err, "failed to restore the etcd snapshot")
+	}
+	erc.logger.Infof("Restored etcd snapshot %s on %d masters", erc.snapshot, len(masters))
+	return nil
+}
+
+// validateEtcdSnapshotSupported returns an error if the etcd data of the cluster cannot be saved over SSH
+func validateEtcdSnapshotSupported(properties *api.Properties) error {
+	if !properties.OrchestratorProfile.IsKubernetes() || properties.MasterProfile == nil {
+		return errors.New("etcd snapshots are only supported for Kubernetes clusters with a master profile")
+	}
+	if properties.MasterProfile.IsVirtualMachineScaleSets() {
+		return errors.New("etcd snapshots are not supported for clusters with VirtualMachineScaleSets masters")
+	}
+	if to.Bool(properties.MasterProfile.CosmosEtcd) {
+		return errors.New("etcd snapshots are not supported for clusters whose etcd is backed by Cosmos DB")
+	}
+	if properties.MasterProfile.Count > len(masterSSHPorts) {
+		return errors.Errorf("etcd snapshots support at most %d masters", len(masterSSHPorts))
+	}
+	if properties.LinuxProfile == nil {
+		return errors.New("etcd snapshots require a linuxProfile to SSH into the masters")
+	}
+	return nil
+}
+
+// takeEtcdSnapshot saves a snapshot from the first master it succeeds on, so one unhealthy member does not prevent a backup
+func takeEtcdSnapshot(s *operations.EtcdSnapshotter, masters []*operations.RemoteHost) ([]byte, error) {
+	var err error
+	for i, host := range masters {
+		var snapshot []byte
+		if snapshot, err = s.Snapshot(host); err == nil {
+			return snapshot, nil
+		}
+		s.Logger.Warnf("Failed to save an etcd snapshot on master %d: %v", i, err)
+	}
+	return nil, err
+}
+
+// etcdSnapshotFilename returns the name a snapshot of the cluster with the given DNS prefix taken at t is saved as
+func etcdSnapshotFilename(dnsPrefix string, t time.Time) string {
+	return fmt.Sprintf("%s-etcd-%s.db.gz", dnsPrefix, t.UTC().Format(etcdSnapshotTimeFormat))
+}
+
+// masterHosts returns the SSH endpoints of count masters behind the master FQDN, in index order
+func masterHosts(masterFQDN string, count int) []*operations.RemoteHost {
+	masters := make([]*operations.RemoteHost, count)
+	for i := range masters {
+		masters[i] = &operations.RemoteHost{Addr: masterFQDN, Port: masterSSHPorts[i]}
+	}
+	return masters
+}
+
+// newSSHRemoteRunner returns a runner that connects as the cluster admin user, with the private key at sshKeyPath
+// or <adminUsername>_rsa in the deployment directory
+func newSSHRemoteRunner(linuxProfile *api.LinuxProfile, deploymentDirectory, sshKeyPath string) (*operations.SSHRemoteRunner, error) {
+	if sshKeyPath == "" {
+		sshKeyPath = path.Join(deploymentDirectory, fmt.Sprintf("%s_rsa", linuxProfile.AdminUsername))
+	}
+	sshKey, err := ioutil.ReadFile(sshKeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read SSH private key")
+	}
+	return &operations.SSHRemoteRunner{
+		User:   linuxProfile.AdminUsername,
+		SSHKey: sshKey,
+	}, nil
+}
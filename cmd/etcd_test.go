@@ -0,0 +1,332 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/spf13/cobra"
+)
+
+func TestNewEtcdCmd(t *testing.T) {
+	output := newEtcdCmd()
+	if output.Use != etcdName || output.Short != etcdShortDescription || output.Long != etcdLongDescription {
+		t.Fatalf("etcd command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, etcdName, output.Short, etcdShortDescription, output.Long, etcdLongDescription)
+	}
+
+	expectedCommands := []*cobra.Command{newEtcdBackupCmd(), newEtcdRestoreCmd()}
+	subcommands := output.Commands()
+	if len(subcommands) != len(expectedCommands) {
+		t.Fatalf("etcd command should have %d subcommands, got %d", len(expectedCommands), len(subcommands))
+	}
+	for i, c := range expectedCommands {
+		if subcommands[i].Use != c.Use {
+			t.Fatalf("etcd command should have command %s", c.Use)
+		}
+	}
+
+	expectedFlags := []string{"location", "resource-group", "deployment-dir", "ssh-key-path", "storage-account", "storage-container", "storage-resource-group", "subscription-id"}
+	for _, c := range subcommands {
+		for _, f := range expectedFlags {
+			if c.Flags().Lookup(f) == nil {
+				t.Fatalf("etcd %s command should have flag %s", c.Use, f)
+			}
+		}
+	}
+	if newEtcdBackupCmd().Flags().Lookup("output") == nil {
+		t.Fatalf("etcd backup command should have flag output")
+	}
+	if newEtcdRestoreCmd().Flags().Lookup("snapshot") == nil {
+		t.Fatalf("etcd restore command should have flag snapshot")
+	}
+}
+
+func TestEtcdCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		validate    func(*cobra.Command) error
+		expectedErr error
+	}{
+		{
+			validate: (&etcdBackupCmd{
+				etcdCmd: etcdCmd{
+					location:            "centralus",
+					deploymentDirectory: "_output/test",
+				},
+			}).validate,
+			expectedErr: errors.New("--resource-group must be specified"),
+		},
+		{
+			validate: (&etcdBackupCmd{
+				etcdCmd: etcdCmd{
+					resourceGroupName:   "testRG",
+					deploymentDirectory: "_output/test",
+				},
+			}).validate,
+			expectedErr: errors.New("--location must be specified"),
+		},
+		{
+			validate: (&etcdBackupCmd{
+				etcdCmd: etcdCmd{
+					location:          "centralus",
+					resourceGroupName: "testRG",
+				},
+			}).validate,
+			expectedErr: errors.New("--deployment-dir must be specified"),
+		},
+		{
+			validate: (&etcdBackupCmd{
+				etcdCmd: etcdCmd{
+					location:            "centralus",
+					resourceGroupName:   "testRG",
+					deploymentDirectory: "_output/test",
+					storageAccount:      "backups",
+				},
+				outputPath: "snapshot.db.gz",
+			}).validate,
+			expectedErr: errors.New("--output and --storage-account cannot be used together"),
+		},
+		{
+			validate: (&etcdBackupCmd{
+				etcdCmd: etcdCmd{
+					location:            "centralus",
+					resourceGroupName:   "testRG",
+					deploymentDirectory: "_output/test",
+				},
+			}).validate,
+			expectedErr: nil,
+		},
+		{
+			validate: (&etcdRestoreCmd{
+				etcdCmd: etcdCmd{
+					location:            "centralus",
+					resourceGroupName:   "testRG",
+					deploymentDirectory: "_output/test",
+				},
+			}).validate,
+			expectedErr: errors.New("--snapshot must be specified"),
+		},
+		{
+			validate: (&etcdRestoreCmd{
+				etcdCmd: etcdCmd{
+					location:            "centralus",
+					resourceGroupName:   "testRG",
+					deploymentDirectory: "_output/test",
+				},
+				snapshot: "snapshot.db.gz",
+			}).validate,
+			expectedErr: nil,
+		},
+	}
+
+	for _, c := range cases {
+		err := c.validate(r)
+		if err != nil && c.expectedErr != nil {
+			if err.Error() != c.expectedErr.Error() {
+				t.Fatalf("expected validate etcd command to return error %s, but instead got %s", c.expectedErr.Error(), err.Error())
+			}
+		} else {
+			if c.expectedErr != nil {
+				t.Fatalf("expected validate etcd command to return error %s, but instead got no error", c.expectedErr.Error())
+			} else if err != nil {
+				t.Fatalf("expected validate etcd command to return no error, but instead got %s", err.Error())
+			}
+		}
+	}
+}
+
+func TestValidateEtcdSnapshotSupported(t *testing.T) {
+	newProperties := func() *api.Properties {
+		return &api.Properties{
+			OrchestratorProfile: &api.OrchestratorProfile{OrchestratorType: api.Kubernetes},
+			MasterProfile:       &api.MasterProfile{Count: 3},
+			LinuxProfile:        &api.LinuxProfile{AdminUsername: "azureuser"},
+		}
+	}
+	if err := validateEtcdSnapshotSupported(newProperties()); err != nil {
+		t.Fatalf("expected etcd snapshots to be supported, got %s", err)
+	}
+
+	cosmos := newProperties()
+	cosmos.MasterProfile.CosmosEtcd = to.BoolPtr(true)
+	tooMany := newProperties()
+	tooMany.MasterProfile.Count = 7
+	noLinuxProfile := newProperties()
+	noLinuxProfile.LinuxProfile = nil
+	for _, p := range []*api.Properties{cosmos, tooMany, noLinuxProfile} {
+		if err := validateEtcdSnapshotSupported(p); err == nil {
+			t.Fatalf("expected etcd snapshots not to be supported for %+v", p.MasterProfile)
+		}
+	}
+}
+
+func TestEtcdSnapshotFilename(t *testing.T) {
+	name := etcdSnapshotFilename("mycluster", time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC))
+	if name != "mycluster-etcd-20190304T050607Z.db.gz" {
+		t.Fatalf("unexpected snapshot file name %s", name)
+	}
+}
+
+func TestEtcdCmdRun(t *testing.T) {
+	outdir, err := ioutil.TempDir("", "etcd")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(outdir)
+
+	apimodel, err := ioutil.ReadFile("../pkg/engine/testdata/simple/kubernetes.json")
+	if err != nil {
+		t.Fatalf("unable to read test api model: %s", err)
+	}
+	if err = ioutil.WriteFile(path.Join(outdir, apiModelFilename), apimodel, 0600); err != nil {
+		t.Fatalf("unable to write test api model: %s", err)
+	}
+
+	client := &armhelpers.MockAKSEngineClient{}
+	runner := &fakeRemoteRunner{outputs: map[string]string{"snapshot save": "snapshot"}}
+	newCmd := func(storageAccount string) etcdCmd {
+		ec := etcdCmd{
+			authProvider: &mockAuthProvider{
+				authArgs:      &authArgs{},
+				getClientMock: client,
+			},
+			location:            "westus",
+			resourceGroupName:   "testRG",
+			deploymentDirectory: outdir,
+			storageAccount:      storageAccount,
+			storageContainer:    defaultEtcdBackupContainer,
+			sshRunner:           runner,
+		}
+		addAuthFlags(ec.getAuthArgs(), (&cobra.Command{}).Flags())
+		fakeRawSubscriptionID := "6dc93fae-9a76-421f-bbe5-cc6460ea81cb"
+		fakeSubscriptionID, _ := uuid.FromString(fakeRawSubscriptionID)
+		ec.getAuthArgs().SubscriptionID = fakeSubscriptionID
+		ec.getAuthArgs().rawSubscriptionID = fakeRawSubscriptionID
+		ec.getAuthArgs().rawClientID = "b829b379-ca1f-4f1d-91a2-0d26b244680d"
+		ec.getAuthArgs().ClientSecret = "0se43bie-3zs5-303e-aav5-dcf231vb82ds"
+		return ec
+	}
+	r := &cobra.Command{}
+
+	// save the snapshot to a local file and restore it
+	snapshotPath := path.Join(outdir, "snapshot.db.gz")
+	ebc := &etcdBackupCmd{etcdCmd: newCmd(""), outputPath: snapshotPath}
+	if err = ebc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running etcd backup: %s", err)
+	}
+	if b, err := ioutil.ReadFile(snapshotPath); err != nil || string(b) != "snapshot" {
+		t.Fatalf("expected the snapshot to be saved to %s, got %q (%v)", snapshotPath, b, err)
+	}
+
+	master := "masterdns1.westus.cloudapp.azure.com:22"
+	runner.inputs = nil
+	runner.commands = nil
+	erc := &etcdRestoreCmd{etcdCmd: newCmd(""), snapshot: snapshotPath}
+	if err = erc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running etcd restore: %s", err)
+	}
+	if string(runner.inputs[master][0]) != "snapshot" {
+		t.Fatalf("expected the snapshot to be copied to the master, got %q", runner.inputs[master][0])
+	}
+
+	// save the snapshot to a storage account and restore it
+	ebc = &etcdBackupCmd{etcdCmd: newCmd("backups")}
+	if err = ebc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running etcd backup: %s", err)
+	}
+	if len(client.MockStorageClient.Blobs) != 1 {
+		t.Fatalf("expected the snapshot to be uploaded, got %v", client.MockStorageClient.Blobs)
+	}
+	var blob string
+	for k := range client.MockStorageClient.Blobs {
+		blob = strings.TrimPrefix(k, defaultEtcdBackupContainer+"/")
+	}
+	if !strings.HasPrefix(blob, "masterdns1-etcd-") {
+		t.Fatalf("unexpected snapshot blob name %s", blob)
+	}
+
+	runner.inputs = nil
+	runner.commands = nil
+	erc = &etcdRestoreCmd{etcdCmd: newCmd("backups"), snapshot: blob}
+	if err = erc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running etcd restore: %s", err)
+	}
+	if string(runner.inputs[master][0]) != "snapshot" {
+		t.Fatalf("expected the snapshot to be copied to the master, got %q", runner.inputs[master][0])
+	}
+
+	erc = &etcdRestoreCmd{etcdCmd: newCmd("backups"), snapshot: "missing.db.gz"}
+	if err = erc.run(r, []string{}); err == nil || !strings.Contains(err.Error(), "failed to read etcd snapshot missing.db.gz") {
+		t.Fatalf("expected etcd restore to fail reading a missing snapshot, got %v", err)
+	}
+}
+
+func TestEtcdCmdRunKeyVaultSecretStore(t *testing.T) {
+	outdir, err := ioutil.TempDir("", "etcd")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(outdir)
+
+	apimodel, err := ioutil.ReadFile("../pkg/engine/testdata/simple/kubernetes.json")
+	if err != nil {
+		t.Fatalf("unable to read test api model: %s", err)
+	}
+	if err = ioutil.WriteFile(path.Join(outdir, apiModelFilename), apimodel, 0600); err != nil {
+		t.Fatalf("unable to write test api model: %s", err)
+	}
+
+	// move the secrets of the api model to Key Vault
+	client := &armhelpers.MockAKSEngineClient{}
+	apiloader := &api.Apiloader{Translator: &i18n.Translator{}}
+	cs, apiVersion, err := apiloader.LoadContainerServiceFromFile(path.Join(outdir, apiModelFilename), false, true, nil)
+	if err != nil {
+		t.Fatalf("unable to load the test api model: %s", err)
+	}
+	store := &api.KeyVaultSecretStore{VaultID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/vault", Client: client}
+	if err = apiloader.SaveContainerService(cs, apiVersion, outdir, apiModelFilename, store); err != nil {
+		t.Fatalf("unable to save the test api model secrets: %s", err)
+	}
+
+	ebc := &etcdBackupCmd{
+		etcdCmd: etcdCmd{
+			authProvider: &mockAuthProvider{
+				authArgs:      &authArgs{},
+				getClientMock: client,
+			},
+			location:            "westus",
+			resourceGroupName:   "testRG",
+			deploymentDirectory: outdir,
+			storageContainer:    defaultEtcdBackupContainer,
+			sshRunner:           &fakeRemoteRunner{outputs: map[string]string{"snapshot save": "snapshot"}},
+		},
+		outputPath: path.Join(outdir, "snapshot.db.gz"),
+	}
+	addAuthFlags(ebc.getAuthArgs(), (&cobra.Command{}).Flags())
+	fakeRawSubscriptionID := "6dc93fae-9a76-421f-bbe5-cc6460ea81cb"
+	fakeSubscriptionID, _ := uuid.FromString(fakeRawSubscriptionID)
+	ebc.getAuthArgs().SubscriptionID = fakeSubscriptionID
+	ebc.getAuthArgs().rawSubscriptionID = fakeRawSubscriptionID
+	ebc.getAuthArgs().rawClientID = "b829b379-ca1f-4f1d-91a2-0d26b244680d"
+	ebc.getAuthArgs().ClientSecret = "0se43bie-3zs5-303e-aav5-dcf231vb82ds"
+
+	if err = ebc.run(&cobra.Command{}, []string{}); err != nil {
+		t.Fatalf("unexpected error running etcd backup: %s", err)
+	}
+	if key := ebc.containerService.Properties.CertificateProfile.EtcdClientPrivateKey; key != "etcdClientPrivateKey" {
+		t.Fatalf("expected the etcd client private key to be read from Key Vault, got %q", key)
+	}
+}
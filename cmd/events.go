@@ -0,0 +1,34 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+// addOutputFormatFlag adds the --output-format flag of the commands reporting their progress as a stream of events
+func addOutputFormatFlag(format *string, f *flag.FlagSet) {
+	f.StringVar(format, "output-format", "human", fmt.Sprintf("Output format to use: %s. json writes one event per line to stdout as the command progresses", outputFormatOptions))
+}
+
+// validateOutputFormat accepts an empty format as human
+func validateOutputFormat(format string) error {
+	if format != "" && format != "human" && format != "json" {
+		return errors.Errorf("unsupported output format: %s", format)
+	}
+	return nil
+}
+
+// newEventStream returns the stream the events of a command are written to, or nil when they are not requested
+func newEventStream(format string, w io.Writer) *operations.EventStream {
+	if format != "json" {
+		return nil
+	}
+	return operations.NewEventStream(w)
+}
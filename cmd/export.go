@@ -0,0 +1,113 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	exportName             = "export"
+	exportShortDescription = "Export an api model without its secrets"
+	exportLongDescription  = "Export an api model with its certificates, private keys, AAD secrets, extension parameters and addon secrets blanked and its service principal secret and Windows admin password replaced by a placeholder, in any supported API version, so it can be shared and still validates"
+)
+
+type exportCmd struct {
+	apimodelPath string
+	apiVersion   string
+	outputFile   string
+
+	// derived
+	locale *gotext.Locale
+	out    io.Writer
+}
+
+func newExportCmd() *cobra.Command {
+	ec := exportCmd{
+		out: os.Stdout,
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   exportName,
+		Short: exportShortDescription,
+		Long:  exportLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := ec.validate(cmd, args); err != nil {
+				return errors.Wrap(err, "failed to validate export command")
+			}
+			return ec.run()
+		},
+	}
+
+	f := exportCmd.Flags()
+	f.StringVarP(&ec.apimodelPath, "api-model", "m", "", "path to the apimodel file")
+	f.StringVar(&ec.apiVersion, "api-version", "", "API version of the exported api model (default to the API version of the apimodel file)")
+	f.StringVar(&ec.outputFile, "output-file", "", "write the exported api model to this file instead of stdout")
+
+	return exportCmd
+}
+
+func (ec *exportCmd) validate(cmd *cobra.Command, args []string) error {
+	var err error
+
+	ec.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if ec.apimodelPath == "" {
+		if len(args) == 1 {
+			ec.apimodelPath = args[0]
+		} else if len(args) > 1 {
+			cmd.Usage()
+			return errors.New("too many arguments were provided to 'export'")
+		} else {
+			cmd.Usage()
+			return errors.New("--api-model was not supplied, nor was one specified as a positional argument")
+		}
+	}
+
+	if _, err := os.Stat(ec.apimodelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", ec.apimodelPath)
+	}
+
+	return nil
+}
+
+func (ec *exportCmd) run() error {
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: ec.locale,
+		},
+	}
+	// the api model is exported as it was written, it is validated when it is deployed or generated again
+	containerService, apiVersion, err := apiloader.LoadContainerServiceFromFile(ec.apimodelPath, false, false, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+	if ec.apiVersion != "" {
+		apiVersion = ec.apiVersion
+	}
+
+	b, err := apiloader.SerializeRedactedContainerService(containerService, apiVersion)
+	if err != nil {
+		return errors.Wrap(err, "error exporting the api model")
+	}
+
+	if ec.outputFile != "" {
+		return errors.Wrap(ioutil.WriteFile(ec.outputFile, b, 0600), "error writing the exported api model")
+	}
+	if _, err = ec.out.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err, "error writing output")
+	}
+	return nil
+}
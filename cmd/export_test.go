@@ -0,0 +1,122 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/spf13/cobra"
+)
+
+func TestNewExportCmd(t *testing.T) {
+	output := newExportCmd()
+	if output.Use != exportName || output.Short != exportShortDescription || output.Long != exportLongDescription {
+		t.Fatalf("export command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, exportName, output.Short, exportShortDescription, output.Long, exportLongDescription)
+	}
+
+	expectedFlags := []string{"api-model", "api-version", "output-file"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("export command should have flag %s", f)
+		}
+	}
+}
+
+func TestExportCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		args        []string
+		expectedErr string
+	}{
+		{
+			args:        []string{},
+			expectedErr: "--api-model was not supplied, nor was one specified as a positional argument",
+		},
+		{
+			args:        []string{"a.json", "b.json"},
+			expectedErr: "too many arguments were provided to 'export'",
+		},
+		{
+			args:        []string{"does-not-exist.json"},
+			expectedErr: "specified api model does not exist (does-not-exist.json)",
+		},
+		{
+			args: []string{"../pkg/engine/testdata/simple/kubernetes.json"},
+		},
+	}
+
+	for _, c := range cases {
+		ec := &exportCmd{}
+		err := ec.validate(r, c.args)
+		if c.expectedErr == "" {
+			if err != nil {
+				t.Fatalf("expected validate export command to return no error, but instead got %s", err.Error())
+			}
+		} else if err == nil || err.Error() != c.expectedErr {
+			t.Fatalf("expected validate export command to return error %s, but instead got %v", c.expectedErr, err)
+		}
+	}
+}
+
+func TestExportCmdRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cs := api.CreateMockContainerService("testcluster", "1.10.13", 3, 2, true)
+	cs.Properties.ServicePrincipalProfile.Secret = "serviceprincipalsecret"
+	cs.Properties.ExtensionProfiles = []*api.ExtensionProfile{{Name: "hello", Version: "v1", ExtensionParameters: "extensionsecret"}}
+	apiloader := &api.Apiloader{Translator: &i18n.Translator{}}
+	b, err := apiloader.SerializeContainerService(cs, "vlabs")
+	if err != nil {
+		t.Fatalf("unable to serialize the api model: %s", err)
+	}
+	apiModelPath := path.Join(dir, apiModelFilename)
+	if err = ioutil.WriteFile(apiModelPath, b, 0600); err != nil {
+		t.Fatalf("unable to write the api model: %s", err)
+	}
+
+	for _, apiVersion := range []string{"", "2017-07-01"} {
+		out := &bytes.Buffer{}
+		ec := &exportCmd{apimodelPath: apiModelPath, apiVersion: apiVersion, out: out}
+		if err = ec.run(); err != nil {
+			t.Fatalf("unexpected error exporting the api model in version %q: %s", apiVersion, err)
+		}
+		for _, secret := range []string{"serviceprincipalsecret", "cakey", "apiserverkey", "extensionsecret"} {
+			if strings.Contains(out.String(), secret) {
+				t.Fatalf("expected %s not to be exported in version %q", secret, apiVersion)
+			}
+		}
+		if !strings.Contains(out.String(), cs.Properties.MasterProfile.DNSPrefix) {
+			t.Fatalf("expected the rest of the api model to be exported in version %q", apiVersion)
+		}
+		if apiVersion != "" && !strings.Contains(out.String(), `"apiVersion": "2017-07-01"`) {
+			t.Fatalf("expected the api model to be exported in version %s, got %s", apiVersion, out.String())
+		}
+	}
+
+	// the exported api model can be loaded and exported again
+	exported := path.Join(dir, "exported.json")
+	ec := &exportCmd{apimodelPath: apiModelPath, outputFile: exported}
+	if err = ec.run(); err != nil {
+		t.Fatalf("unexpected error exporting the api model to a file: %s", err)
+	}
+	if _, _, err = apiloader.LoadContainerServiceFromFile(exported, true, false, nil); err != nil {
+		t.Fatalf("expected the exported api model to be valid, got %s", err)
+	}
+	ec = &exportCmd{apimodelPath: exported, out: &bytes.Buffer{}}
+	if err = ec.run(); err != nil {
+		t.Fatalf("unexpected error exporting the exported api model: %s", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/Azure/aks-engine/pkg/api"
 	"github.com/Azure/aks-engine/pkg/engine"
@@ -17,6 +18,7 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
 )
 
 const (
@@ -32,7 +34,10 @@ type generateCmd struct {
 	caPrivateKeyPath  string
 	noPrettyPrint     bool
 	parametersOnly    bool
-	set               []string
+	overrides         transform.APIModelOverrides
+	secrets           secretStoreArgs
+	redact            bool
+	apiModelFormat    string
 
 	// derived
 	containerService *api.ContainerService
@@ -69,9 +74,12 @@ func newGenerateCmd() *cobra.Command {
 	f.StringVarP(&gc.outputDirectory, "output-directory", "o", "", "output directory (derived from FQDN if absent)")
 	f.StringVar(&gc.caCertificatePath, "ca-certificate-path", "", "path to the CA certificate to use for Kubernetes PKI assets")
 	f.StringVar(&gc.caPrivateKeyPath, "ca-private-key-path", "", "path to the CA private key to use for Kubernetes PKI assets")
-	f.StringArrayVar(&gc.set, "set", []string{}, "set values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	addAPIModelOverrideFlags(&gc.overrides, f)
 	f.BoolVar(&gc.noPrettyPrint, "no-pretty-print", false, "skip pretty printing the output")
 	f.BoolVar(&gc.parametersOnly, "parameters-only", false, "only output parameters files")
+	f.BoolVar(&gc.redact, "redact", false, "also write the api model without its secrets to apimodel.redacted.json, for sharing")
+	addAPIModelFormatFlag(&gc.apiModelFormat, f)
+	addSecretStoreFlags(&gc.secrets, f)
 
 	return generateCmd
 }
@@ -100,22 +108,33 @@ func (gc *generateCmd) validate(cmd *cobra.Command, args []string) error {
 		return errors.Errorf("specified api model does not exist (%s)", gc.apimodelPath)
 	}
 
+	if err = validateAPIModelFormat(gc.apiModelFormat); err != nil {
+		return err
+	}
+
+	return gc.secrets.validate()
+}
+
+func addAPIModelFormatFlag(format *string, f *flag.FlagSet) {
+	f.StringVar(format, "api-model-format", api.APIModelFormatJSON, fmt.Sprintf("format to write the api model in to the output directory: %s", strings.Join(api.APIModelFormats, ", ")))
+}
+
+// validateAPIModelFormat accepts an empty format as json
+func validateAPIModelFormat(format string) error {
+	if format != "" && format != api.APIModelFormatJSON && format != api.APIModelFormatYAML {
+		return errors.Errorf("unsupported api model format: %s", format)
+	}
 	return nil
 }
 
 func (gc *generateCmd) mergeAPIModel() error {
-	var err error
-	// if --set flag has been used
-	if gc.set != nil && len(gc.set) > 0 {
-		m := make(map[string]transform.APIModelValue)
-		transform.MapValues(m, gc.set)
-
-		// overrides the api model and generates a new file
-		gc.apimodelPath, err = transform.MergeValuesWithAPIModel(gc.apimodelPath, m)
-		if err != nil {
-			return errors.Wrap(err, "error merging --set values with the api model")
-		}
-
+	// overlays, variables and --set flags generate a new api model file
+	apimodelPath, err := transform.MergeOverridesWithAPIModel(gc.apimodelPath, &gc.overrides)
+	if err != nil {
+		return errors.Wrap(err, "error merging overlays and --set values with the api model")
+	}
+	if apimodelPath != gc.apimodelPath {
+		gc.apimodelPath = apimodelPath
 		log.Infoln(fmt.Sprintf("new api model file has been generated during merge: %s", gc.apimodelPath))
 	}
 
@@ -202,10 +221,17 @@ func (gc *generateCmd) run() error {
 		}
 	}
 
+	secretStore, err := gc.secrets.secretStore(gc.containerService, nil)
+	if err != nil {
+		log.Fatalf("error selecting the secret store: %s \n", err.Error())
+	}
 	writer := &engine.ArtifactWriter{
 		Translator: &i18n.Translator{
 			Locale: gc.locale,
 		},
+		SecretStore:    secretStore,
+		Redact:         gc.redact,
+		APIModelFormat: gc.apiModelFormat,
 	}
 	if err = writer.WriteTLSArtifacts(gc.containerService, gc.apiVersion, template, parameters, gc.outputDirectory, certsGenerated, gc.parametersOnly); err != nil {
 		log.Fatalf("error writing artifacts: %s \n", err.Error())
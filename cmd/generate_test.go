@@ -4,8 +4,12 @@
 package cmd
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/i18n"
 	"github.com/spf13/cobra"
 )
 
@@ -15,7 +19,7 @@ func TestNewGenerateCmd(t *testing.T) {
 		t.Fatalf("generate command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, generateName, output.Short, generateShortDescription, output.Long, generateLongDescription)
 	}
 
-	expectedFlags := []string{"api-model", "output-directory", "ca-certificate-path", "ca-private-key-path", "set", "no-pretty-print", "parameters-only"}
+	expectedFlags := []string{"api-model", "output-directory", "ca-certificate-path", "ca-private-key-path", "set", "no-pretty-print", "parameters-only", "api-model-format", "set-json", "unset", "values-file"}
 	for _, f := range expectedFlags {
 		if output.Flags().Lookup(f) == nil {
 			t.Fatalf("generate command should have flag %s", f)
@@ -51,6 +55,21 @@ func TestGenerateCmdValidate(t *testing.T) {
 		t.Fatalf("expected error validating multiple args")
 	}
 
+	g = &generateCmd{}
+
+	// validate cmd with a YAML api model
+	err = g.validate(r, []string{"../pkg/engine/testdata/simple/kubernetes.yaml"})
+	if err != nil {
+		t.Fatalf("unexpected error validating a YAML api model: %s", err.Error())
+	}
+
+	g = &generateCmd{apiModelFormat: "xml"}
+
+	// validate cmd with an unsupported api model format
+	err = g.validate(r, []string{"../pkg/engine/testdata/simple/kubernetes.json"})
+	if err == nil || err.Error() != "unsupported api model format: xml" {
+		t.Fatalf("expected error validating an unsupported api model format, got %v", err)
+	}
 }
 
 func TestGenerateCmdMergeAPIModel(t *testing.T) {
@@ -63,7 +82,7 @@ func TestGenerateCmdMergeAPIModel(t *testing.T) {
 
 	g = &generateCmd{}
 	g.apimodelPath = "../pkg/engine/testdata/simple/kubernetes.json"
-	g.set = []string{"masterProfile.count=3,linuxProfile.adminUsername=testuser"}
+	g.overrides.Set = []string{"masterProfile.count=3,linuxProfile.adminUsername=testuser"}
 	err = g.mergeAPIModel()
 	if err != nil {
 		t.Fatalf("unexpected error calling mergeAPIModel with one --set flag: %s", err.Error())
@@ -71,7 +90,7 @@ func TestGenerateCmdMergeAPIModel(t *testing.T) {
 
 	g = &generateCmd{}
 	g.apimodelPath = "../pkg/engine/testdata/simple/kubernetes.json"
-	g.set = []string{"masterProfile.count=3", "linuxProfile.adminUsername=testuser"}
+	g.overrides.Set = []string{"masterProfile.count=3", "linuxProfile.adminUsername=testuser"}
 	err = g.mergeAPIModel()
 	if err != nil {
 		t.Fatalf("unexpected error calling mergeAPIModel with multiple --set flags: %s", err.Error())
@@ -79,7 +98,7 @@ func TestGenerateCmdMergeAPIModel(t *testing.T) {
 
 	g = &generateCmd{}
 	g.apimodelPath = "../pkg/engine/testdata/simple/kubernetes.json"
-	g.set = []string{"agentPoolProfiles[0].count=1"}
+	g.overrides.Set = []string{"agentPoolProfiles[0].count=1"}
 	err = g.mergeAPIModel()
 	if err != nil {
 		t.Fatalf("unexpected error calling mergeAPIModel with one --set flag to override an array property: %s", err.Error())
@@ -88,7 +107,7 @@ func TestGenerateCmdMergeAPIModel(t *testing.T) {
 	// test with an ssh key that contains == sign
 	g = &generateCmd{}
 	g.apimodelPath = "../pkg/engine/testdata/simple/kubernetes.json"
-	g.set = []string{"linuxProfile.ssh.publicKeys[0].keyData=\"ssh-rsa AAAAB3NO8b9== azureuser@cluster.local\",servicePrincipalProfile.clientId=\"123a4321-c6eb-4b61-9d6f-7db123e14a7a\",servicePrincipalProfile.secret=\"=#msRock5!t=\""}
+	g.overrides.Set = []string{"linuxProfile.ssh.publicKeys[0].keyData=\"ssh-rsa AAAAB3NO8b9== azureuser@cluster.local\",servicePrincipalProfile.clientId=\"123a4321-c6eb-4b61-9d6f-7db123e14a7a\",servicePrincipalProfile.secret=\"=#msRock5!t=\""}
 	err = g.mergeAPIModel()
 	if err != nil {
 		t.Fatalf("unexpected error calling mergeAPIModel with one --set flag to override an array property: %s", err.Error())
@@ -97,11 +116,45 @@ func TestGenerateCmdMergeAPIModel(t *testing.T) {
 	// test with simple quote
 	g = &generateCmd{}
 	g.apimodelPath = "../pkg/engine/testdata/simple/kubernetes.json"
-	g.set = []string{"servicePrincipalProfile.secret='=MsR0ck5!t='"}
+	g.overrides.Set = []string{"servicePrincipalProfile.secret='=MsR0ck5!t='"}
 	err = g.mergeAPIModel()
 	if err != nil {
 		t.Fatalf("unexpected error calling mergeAPIModel with one --set flag to override an array property: %s", err.Error())
 	}
+
+	valuesFile, err := ioutil.TempFile("", "values")
+	if err != nil {
+		t.Fatalf("unable to create values file: %s", err.Error())
+	}
+	defer os.Remove(valuesFile.Name())
+	if _, err = valuesFile.WriteString("masterProfile:\n  count: 3\n"); err != nil {
+		t.Fatalf("unable to write values file: %s", err.Error())
+	}
+	valuesFile.Close()
+
+	g = &generateCmd{}
+	g.apimodelPath = "../pkg/engine/testdata/simple/kubernetes.json"
+	g.overrides.ValuesFiles = []string{valuesFile.Name()}
+	g.overrides.SetJSON = []string{`agentPoolProfiles[name=agentpool1].customNodeLabels={"team": "x"}`}
+	g.overrides.Unset = []string{"certificateProfile"}
+	err = g.mergeAPIModel()
+	if err != nil {
+		t.Fatalf("unexpected error calling mergeAPIModel with --values-file, --set-json and --unset flags: %s", err.Error())
+	}
+	cs, _, err := (&api.Apiloader{Translator: &i18n.Translator{}}).LoadContainerServiceFromFile(g.apimodelPath, false, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error loading the merged api model: %s", err.Error())
+	}
+	if cs.Properties.MasterProfile.Count != 3 || cs.Properties.AgentPoolProfiles[0].CustomNodeLabels["team"] != "x" || cs.Properties.CertificateProfile != nil {
+		t.Fatalf("expected the --values-file, --set-json and --unset flags to be applied to the merged api model")
+	}
+
+	g = &generateCmd{}
+	g.apimodelPath = "../pkg/engine/testdata/simple/kubernetes.json"
+	g.overrides.Unset = []string{"agentPoolProfiles[x]"}
+	if err = g.mergeAPIModel(); err == nil {
+		t.Fatalf("expected an error calling mergeAPIModel with an invalid --unset path")
+	}
 }
 
 func TestGenerateCmdMLoadAPIModel(t *testing.T) {
@@ -109,7 +162,7 @@ func TestGenerateCmdMLoadAPIModel(t *testing.T) {
 	r := &cobra.Command{}
 
 	g.apimodelPath = "../pkg/engine/testdata/simple/kubernetes.json"
-	g.set = []string{"agentPoolProfiles[0].count=1"}
+	g.overrides.Set = []string{"agentPoolProfiles[0].count=1"}
 
 	g.validate(r, []string{"../pkg/engine/testdata/simple/kubernetes.json"})
 	g.mergeAPIModel()
@@ -0,0 +1,268 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/engine"
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/ghodss/yaml"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	getKubeConfigName             = "get-kubeconfig"
+	getKubeConfigShortDescription = "Generate a kubeconfig for an existing Kubernetes cluster"
+	getKubeConfigLongDescription  = "Generate a kubeconfig for an existing Kubernetes cluster from its api model, for the admin user, AAD or a named user with a short-lived client certificate, and print it or merge it into a kubeconfig file"
+)
+
+const (
+	// kubeConfigAdminUser authenticates with the admin client certificate of the cluster
+	kubeConfigAdminUser = "admin"
+	// kubeConfigAADUser authenticates with the AAD applications of the cluster
+	kubeConfigAADUser = "aad"
+)
+
+type getKubeConfigCmd struct {
+	// user input
+	apimodelPath    string
+	location        string
+	privateEndpoint bool
+	user            string
+	groups          []string
+	validity        time.Duration
+	merge           bool
+	kubeConfigPath  string
+
+	// derived
+	containerService *api.ContainerService
+	locale           *gotext.Locale
+}
+
+func newGetKubeConfigCmd() *cobra.Command {
+	gkc := getKubeConfigCmd{}
+
+	getKubeConfigCmd := &cobra.Command{
+		Use:   getKubeConfigName,
+		Short: getKubeConfigShortDescription,
+		Long:  getKubeConfigLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return gkc.run(cmd, args)
+		},
+	}
+
+	f := getKubeConfigCmd.Flags()
+	f.StringVarP(&gkc.apimodelPath, "api-model", "m", "", "path to the generated apimodel.json file (required)")
+	f.StringVarP(&gkc.location, "location", "l", "", "location the cluster is deployed in (defaults to the api model location)")
+	f.BoolVar(&gkc.privateEndpoint, "private-endpoint", false, "connect to the internal address of the masters, as is always done for private clusters")
+	f.StringVar(&gkc.user, "user", "", "admin, aad, or the name of a user to sign a short-lived client certificate for with the cluster CA (defaults to aad for clusters with an aadProfile, admin otherwise)")
+	f.StringSliceVar(&gkc.groups, "groups", nil, "groups of the named user")
+	f.DurationVar(&gkc.validity, "validity", 24*time.Hour, "how long the client certificate of the named user is valid for")
+	f.BoolVar(&gkc.merge, "merge", false, "merge the kubeconfig into the kubeconfig file and switch to its context instead of printing it")
+	f.StringVar(&gkc.kubeConfigPath, "kubeconfig", "", "the kubeconfig file to merge into (defaults to the first file of $KUBECONFIG, or ~/.kube/config)")
+
+	return getKubeConfigCmd
+}
+
+func (gkc *getKubeConfigCmd) validate(cmd *cobra.Command) error {
+	var err error
+
+	gkc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if gkc.apimodelPath == "" {
+		cmd.Usage()
+		return errors.New("--api-model must be specified")
+	}
+
+	if gkc.location != "" {
+		gkc.location = helpers.NormalizeAzureRegion(gkc.location)
+	}
+
+	switch gkc.user {
+	case "", kubeConfigAdminUser, kubeConfigAADUser:
+		if len(gkc.groups) > 0 {
+			cmd.Usage()
+			return errors.New("--groups can only be specified for a named --user")
+		}
+	default:
+		if gkc.validity <= 0 {
+			cmd.Usage()
+			return errors.New("--validity must be positive")
+		}
+	}
+
+	if gkc.kubeConfigPath == "" {
+		gkc.kubeConfigPath = clientcmd.RecommendedHomeFile
+		if env := filepath.SplitList(os.Getenv(clientcmd.RecommendedConfigPathEnvVar)); len(env) > 0 {
+			gkc.kubeConfigPath = env[0]
+		}
+	}
+	return nil
+}
+
+func (gkc *getKubeConfigCmd) load() error {
+	var err error
+
+	if _, err = os.Stat(gkc.apimodelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", gkc.apimodelPath)
+	}
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: gkc.locale,
+		},
+	}
+	gkc.containerService, _, err = apiloader.LoadContainerServiceFromFile(gkc.apimodelPath, true, true, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+
+	if gkc.location == "" {
+		if gkc.containerService.Location == "" {
+			return errors.New("--location must be specified as the api model has no location")
+		}
+		gkc.location = gkc.containerService.Location
+	}
+
+	if gkc.containerService.Properties.CertificateProfile == nil {
+		return errors.New("the api model has no certificateProfile, generate the cluster first")
+	}
+	return nil
+}
+
+func (gkc *getKubeConfigCmd) run(cmd *cobra.Command, args []string) error {
+	if err := gkc.validate(cmd); err != nil {
+		return errors.Wrap(err, "failed to validate get-kubeconfig command")
+	}
+	if err := gkc.load(); err != nil {
+		return errors.Wrap(err, "failed to load existing container service")
+	}
+
+	options, err := gkc.kubeConfigOptions()
+	if err != nil {
+		return err
+	}
+	kubeConfig, err := engine.GenerateKubeConfigWithOptions(gkc.containerService.Properties, gkc.location, options)
+	if err != nil {
+		return errors.Wrap(err, "error generating kubeconfig")
+	}
+
+	if !gkc.merge {
+		_, err = fmt.Fprint(cmd.OutOrStdout(), kubeConfig)
+		return err
+	}
+	return mergeKubeConfig(gkc.kubeConfigPath, kubeConfig)
+}
+
+// kubeConfigOptions returns the options of the kubeconfig of the user, signing a client certificate for named users
+func (gkc *getKubeConfigCmd) kubeConfigOptions() (engine.KubeConfigOptions, error) {
+	properties := gkc.containerService.Properties
+	options := engine.KubeConfigOptions{
+		PrivateEndpoint: gkc.privateEndpoint,
+		UserName:        gkc.user,
+	}
+
+	switch gkc.user {
+	case "":
+	case kubeConfigAdminUser:
+		options.ClientCertificate = properties.CertificateProfile.KubeConfigCertificate
+		options.ClientPrivateKey = properties.CertificateProfile.KubeConfigPrivateKey
+		if options.ClientCertificate == "" {
+			return options, errors.New("the api model has no admin client certificate")
+		}
+	case kubeConfigAADUser:
+		if properties.AADProfile == nil {
+			return options, errors.New("--user aad requires the cluster to have an aadProfile")
+		}
+	default:
+		if properties.CertificateProfile.CaPrivateKey == "" {
+			return options, errors.New("the api model has no CA private key to sign a client certificate with")
+		}
+		caPair := &helpers.PkiKeyCertPair{
+			CertificatePem: properties.CertificateProfile.CaCertificate,
+			PrivateKeyPem:  properties.CertificateProfile.CaPrivateKey,
+		}
+		clientPair, err := helpers.CreateClientCertificate(caPair, gkc.user, gkc.groups, gkc.validity)
+		if err != nil {
+			return options, errors.Wrapf(err, "failed to sign a client certificate for user %s", gkc.user)
+		}
+		options.ClientCertificate = clientPair.CertificatePem
+		options.ClientPrivateKey = clientPair.PrivateKeyPem
+	}
+	return options, nil
+}
+
+// mergeKubeConfig merges the clusters, users and contexts of the kubeconfig into the kubeconfig file, replacing
+// entries of the same name, and switches to its current context. The file is created if it does not exist.
+func mergeKubeConfig(path, kubeConfig string) error {
+	config := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(kubeConfig), &config); err != nil {
+		return errors.Wrap(err, "error parsing the generated kubeconfig")
+	}
+
+	existing := map[string]interface{}{}
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err = yaml.Unmarshal(b, &existing); err != nil {
+			return errors.Wrapf(err, "error parsing kubeconfig %s", path)
+		}
+	} else if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "error loading kubeconfig %s", path)
+	}
+	if len(existing) == 0 {
+		existing = map[string]interface{}{"apiVersion": "v1", "kind": "Config"}
+	}
+
+	for _, key := range []string{"clusters", "contexts", "users"} {
+		existing[key] = mergeNamedKubeConfigEntries(existing[key], config[key])
+	}
+	existing["current-context"] = config["current-context"]
+
+	if b, err = yaml.Marshal(existing); err != nil {
+		return errors.Wrap(err, "error serializing the merged kubeconfig")
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrapf(err, "error creating the directory of kubeconfig %s", path)
+	}
+	if err = ioutil.WriteFile(path, b, 0600); err != nil {
+		return errors.Wrapf(err, "error writing kubeconfig %s", path)
+	}
+	log.Infof("Merged context %s into %s", config["current-context"], path)
+	return nil
+}
+
+// mergeNamedKubeConfigEntries adds the named kubeconfig entries to the existing ones, replacing those of the same name
+func mergeNamedKubeConfigEntries(existing, entries interface{}) []interface{} {
+	merged, _ := existing.([]interface{})
+	added, _ := entries.([]interface{})
+	for _, entry := range added {
+		name := entry.(map[string]interface{})["name"]
+		replaced := false
+		for i, e := range merged {
+			if m, ok := e.(map[string]interface{}); ok && m["name"] == name {
+				merged[i] = entry
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,197 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestNewGetKubeConfigCmd(t *testing.T) {
+	output := newGetKubeConfigCmd()
+	if output.Use != getKubeConfigName || output.Short != getKubeConfigShortDescription || output.Long != getKubeConfigLongDescription {
+		t.Fatalf("get-kubeconfig command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, getKubeConfigName, output.Short, getKubeConfigShortDescription, output.Long, getKubeConfigLongDescription)
+	}
+
+	expectedFlags := []string{"api-model", "location", "private-endpoint", "user", "groups", "validity", "merge", "kubeconfig"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("get-kubeconfig command should have flag %s", f)
+		}
+	}
+}
+
+func TestGetKubeConfigCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		gkc         *getKubeConfigCmd
+		expectedErr error
+	}{
+		{
+			gkc:         &getKubeConfigCmd{},
+			expectedErr: errors.New("--api-model must be specified"),
+		},
+		{
+			gkc: &getKubeConfigCmd{
+				apimodelPath: "_output/test/apimodel.json",
+				user:         "admin",
+				groups:       []string{"developers"},
+			},
+			expectedErr: errors.New("--groups can only be specified for a named --user"),
+		},
+		{
+			gkc: &getKubeConfigCmd{
+				apimodelPath: "_output/test/apimodel.json",
+				user:         "alice",
+			},
+			expectedErr: errors.New("--validity must be positive"),
+		},
+		{
+			gkc: &getKubeConfigCmd{
+				apimodelPath: "_output/test/apimodel.json",
+				user:         "alice",
+				groups:       []string{"developers"},
+				validity:     time.Hour,
+			},
+			expectedErr: nil,
+		},
+	}
+
+	for _, c := range cases {
+		err := c.gkc.validate(r)
+		if err != nil && c.expectedErr != nil {
+			if err.Error() != c.expectedErr.Error() {
+				t.Fatalf("expected validate get-kubeconfig command to return error %s, but instead got %s", c.expectedErr.Error(), err.Error())
+			}
+		} else {
+			if c.expectedErr != nil {
+				t.Fatalf("expected validate get-kubeconfig command to return error %s, but instead got no error", c.expectedErr.Error())
+			} else if err != nil {
+				t.Fatalf("expected validate get-kubeconfig command to return no error, but instead got %s", err.Error())
+			}
+		}
+	}
+}
+
+// writeTestCertificateAPIModel writes the simple test api model with a cluster CA to the directory
+func writeTestCertificateAPIModel(t *testing.T, dir string) string {
+	apiloader := &api.Apiloader{Translator: &i18n.Translator{}}
+	cs, apiVersion, err := apiloader.LoadContainerServiceFromFile("../pkg/engine/testdata/simple/kubernetes.json", false, false, nil)
+	if err != nil {
+		t.Fatalf("unable to load test api model: %s", err)
+	}
+	caPair, err := helpers.CreatePkiKeyCertPair("ca")
+	if err != nil {
+		t.Fatalf("unable to create test CA: %s", err)
+	}
+	cs.Location = "westus"
+	cs.Properties.MasterProfile.FirstConsecutiveStaticIP = "10.239.255.239"
+	cs.Properties.CertificateProfile = &api.CertificateProfile{
+		CaCertificate:         caPair.CertificatePem,
+		CaPrivateKey:          caPair.PrivateKeyPem,
+		KubeConfigCertificate: "admincert",
+		KubeConfigPrivateKey:  "adminkey",
+	}
+	b, err := apiloader.SerializeContainerService(cs, apiVersion)
+	if err != nil {
+		t.Fatalf("unable to serialize test api model: %s", err)
+	}
+	apiModelPath := path.Join(dir, apiModelFilename)
+	if err = ioutil.WriteFile(apiModelPath, b, 0600); err != nil {
+		t.Fatalf("unable to write test api model: %s", err)
+	}
+	return apiModelPath
+}
+
+func TestGetKubeConfigCmdRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "get-kubeconfig")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	apiModelPath := writeTestCertificateAPIModel(t, dir)
+
+	out := &bytes.Buffer{}
+	r := &cobra.Command{}
+	r.SetOutput(out)
+	gkc := &getKubeConfigCmd{apimodelPath: apiModelPath, privateEndpoint: true}
+	if err = gkc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running get-kubeconfig: %s", err)
+	}
+	config, err := clientcmd.Load(out.Bytes())
+	if err != nil {
+		t.Fatalf("unable to parse the printed kubeconfig: %s", err)
+	}
+	if config.CurrentContext != "masterdns1" || string(config.AuthInfos["masterdns1-admin"].ClientCertificateData) != "admincert" {
+		t.Fatalf("expected the admin kubeconfig to be printed, got %s", out.String())
+	}
+	if config.Clusters["masterdns1"].Server != "https://10.239.255.239" {
+		t.Fatalf("expected the private endpoint of the masters, got %s", config.Clusters["masterdns1"].Server)
+	}
+
+	gkc = &getKubeConfigCmd{apimodelPath: apiModelPath, user: "aad"}
+	if err = gkc.run(r, []string{}); err == nil || err.Error() != "--user aad requires the cluster to have an aadProfile" {
+		t.Fatalf("expected --user aad to require an aadProfile, got %v", err)
+	}
+}
+
+func TestGetKubeConfigCmdRunMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "get-kubeconfig")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	apiModelPath := writeTestCertificateAPIModel(t, dir)
+	kubeConfigPath := path.Join(dir, ".kube", "config")
+
+	r := &cobra.Command{}
+	gkc := &getKubeConfigCmd{apimodelPath: apiModelPath, merge: true, kubeConfigPath: kubeConfigPath}
+	if err = gkc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running get-kubeconfig --merge: %s", err)
+	}
+	gkc = &getKubeConfigCmd{
+		apimodelPath:   apiModelPath,
+		user:           "alice",
+		groups:         []string{"developers"},
+		validity:       time.Hour,
+		merge:          true,
+		kubeConfigPath: kubeConfigPath,
+	}
+	if err = gkc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running get-kubeconfig --merge for a named user: %s", err)
+	}
+
+	config, err := clientcmd.LoadFromFile(kubeConfigPath)
+	if err != nil {
+		t.Fatalf("unable to load the merged kubeconfig: %s", err)
+	}
+	if len(config.Contexts) != 2 || config.CurrentContext != "masterdns1-alice" {
+		t.Fatalf("expected the admin and alice contexts with alice selected, got %v and %s", config.Contexts, config.CurrentContext)
+	}
+	block, _ := pem.Decode(config.AuthInfos["masterdns1-alice"].ClientCertificateData)
+	if block == nil {
+		t.Fatalf("expected a PEM client certificate for alice")
+	}
+	alice, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("unable to parse the client certificate of alice: %s", err)
+	}
+	if alice.Subject.CommonName != "alice" || alice.Subject.Organization[0] != "developers" {
+		t.Fatalf("expected a client certificate for alice in group developers, got %v", alice.Subject)
+	}
+}
@@ -0,0 +1,445 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf16"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/armhelpers/utils"
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/Azure/aks-engine/pkg/operations/kubernetesupgrade"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	getLogsName             = "get-logs"
+	getLogsShortDescription = "Collect logs from the nodes of an existing Kubernetes cluster"
+	getLogsLongDescription  = "Collect provisioning logs, journal units and container logs from every node of an existing Kubernetes cluster, writing a tarball per Linux node and a zip file per Windows node to the output directory. Windows nodes are reached over SSH when windowsProfile.sshEnabled is set, otherwise they are reported as not collected"
+)
+
+// getLogsConcurrency is how many nodes logs are collected from at the same time
+const getLogsConcurrency = 10
+
+// nodeLogFiles are the files and directories collected from every node, when they exist
+var nodeLogFiles = []string{
+	"/var/log/azure/cluster-provision.log",
+	"/var/log/azure/custom-script",
+	"/var/log/cloud-init.log",
+	"/var/log/cloud-init-output.log",
+	"/var/log/waagent.log",
+	"/var/log/syslog",
+	"/etc/kubernetes/manifests",
+	"/etc/kubernetes/addons",
+	"/etc/default/kubelet",
+}
+
+// nodeJournalUnits are the systemd units whose journal is collected from every node
+var nodeJournalUnits = []string{"kubelet", "docker", "etcd"}
+
+// windowsNodeLogFiles are the files collected from every Windows node, when they exist
+var windowsNodeLogFiles = []string{
+	`C:\AzureData\CustomDataSetupScript.log`,
+	`C:\k\*.log`,
+	`C:\k\*.err`,
+	`C:\WindowsAzure\Logs\*.log`,
+}
+
+type getLogsCmd struct {
+	authProvider
+
+	// user input
+	resourceGroupName   string
+	deploymentDirectory string
+	location            string
+	sshKeyPath          string
+	outputDirectory     string
+
+	// derived
+	containerService *api.ContainerService
+	locale           *gotext.Locale
+	client           armhelpers.AKSEngineClient
+	sshRunner        operations.RemoteRunner
+	masterFQDN       string
+	nameSuffix       string
+	logger           *log.Entry
+}
+
+func newGetLogsCmd() *cobra.Command {
+	glc := getLogsCmd{
+		authProvider: &authArgs{},
+	}
+
+	getLogsCmd := &cobra.Command{
+		Use:   getLogsName,
+		Short: getLogsShortDescription,
+		Long:  getLogsLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return glc.run(cmd, args)
+		},
+	}
+
+	f := getLogsCmd.Flags()
+	f.StringVarP(&glc.location, "location", "l", "", "location the cluster is deployed in (required)")
+	f.StringVarP(&glc.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed (required)")
+	f.StringVar(&glc.deploymentDirectory, "deployment-dir", "", "the location of the output from `generate` (required)")
+	f.StringVar(&glc.sshKeyPath, "ssh-key-path", "", "path to the private key used to SSH into the cluster nodes (defaults to <adminUsername>_rsa in the deployment directory)")
+	f.StringVarP(&glc.outputDirectory, "output-directory", "o", "", "directory the node log tarballs are written to (defaults to logs in the deployment directory)")
+	addAuthFlags(glc.getAuthArgs(), f)
+
+	return getLogsCmd
+}
+
+func (glc *getLogsCmd) validate(cmd *cobra.Command) error {
+	var err error
+
+	glc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if glc.resourceGroupName == "" {
+		cmd.Usage()
+		return errors.New("--resource-group must be specified")
+	}
+
+	if glc.location == "" {
+		cmd.Usage()
+		return errors.New("--location must be specified")
+	}
+	glc.location = helpers.NormalizeAzureRegion(glc.location)
+
+	if glc.deploymentDirectory == "" {
+		cmd.Usage()
+		return errors.New("--deployment-dir must be specified")
+	}
+
+	if glc.outputDirectory == "" {
+		glc.outputDirectory = path.Join(glc.deploymentDirectory, "logs")
+	}
+	return nil
+}
+
+func (glc *getLogsCmd) loadCluster() error {
+	var err error
+
+	glc.logger = log.New().WithField("source", "get-logs command line")
+
+	apiModelPath := api.FindAPIModelFile(glc.deploymentDirectory)
+	if _, err = os.Stat(apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", apiModelPath)
+	}
+
+	if err = glc.getAuthArgs().validateAuthArgs(); err != nil {
+		return err
+	}
+	if glc.client, err = glc.authProvider.getClient(); err != nil {
+		return errors.Wrap(err, "failed to get client")
+	}
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: glc.locale,
+		},
+		KeyVaultClient: glc.client,
+	}
+	glc.containerService, _, err = apiloader.LoadContainerServiceFromFile(apiModelPath, true, true, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+
+	if glc.containerService.Location == "" {
+		glc.containerService.Location = glc.location
+	} else if glc.containerService.Location != glc.location {
+		return errors.New("--location does not match api model location")
+	}
+
+	properties := glc.containerService.Properties
+	if !properties.OrchestratorProfile.IsKubernetes() || properties.MasterProfile == nil {
+		return errors.New("get-logs is only supported for Kubernetes clusters with a master profile")
+	}
+	if properties.MasterProfile.IsVirtualMachineScaleSets() {
+		return errors.New("get-logs is not supported for clusters with VirtualMachineScaleSets masters")
+	}
+	if properties.MasterProfile.Count > len(masterSSHPorts) {
+		return errors.Errorf("get-logs supports at most %d masters", len(masterSSHPorts))
+	}
+	if properties.LinuxProfile == nil {
+		return errors.New("get-logs requires a linuxProfile to SSH into the cluster nodes")
+	}
+	glc.masterFQDN = api.FormatAzureProdFQDNByLocation(properties.MasterProfile.DNSPrefix, glc.location)
+
+	// the name suffix identifies the VMs in the resource group that belong to this cluster
+	template, _, err := loadDeployedTemplate(glc.deploymentDirectory)
+	if err != nil {
+		return err
+	}
+	if glc.nameSuffix, err = templateNameSuffix(template); err != nil {
+		return err
+	}
+
+	if glc.sshRunner == nil {
+		if glc.sshRunner, err = newSSHRemoteRunner(properties.LinuxProfile, glc.deploymentDirectory, glc.sshKeyPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (glc *getLogsCmd) run(cmd *cobra.Command, args []string) error {
+	if err := glc.validate(cmd); err != nil {
+		return errors.Wrap(err, "failed to validate get-logs command")
+	}
+	if err := glc.loadCluster(); err != nil {
+		return errors.Wrap(err, "failed to load existing container service")
+	}
+
+	nodes, windowsNodes, err := glc.getNodeHosts()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(glc.outputDirectory, 0700); err != nil {
+		return errors.Wrap(err, "failed to create the output directory")
+	}
+
+	names := sortedHostNames(nodes)
+	errs := make([]error, len(names))
+	sem := make(chan struct{}, getLogsConcurrency)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if windowsNodes[name] {
+				errs[i] = glc.collectWindowsNodeLogs(name, nodes[name])
+			} else {
+				errs[i] = glc.collectNodeLogs(name, nodes[name])
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			glc.logger.Errorf("Failed to collect logs from %s: %v", names[i], err)
+			failed = append(failed, names[i])
+		}
+	}
+	var notCollected []string
+	for name := range windowsNodes {
+		if nodes[name] == nil {
+			notCollected = append(notCollected, name)
+		}
+	}
+	sort.Strings(notCollected)
+	glc.logger.Infof("Collected logs from %d of %d nodes into %s", len(names)-len(failed), len(names)+len(notCollected), glc.outputDirectory)
+	if len(notCollected) > 0 {
+		glc.logger.Warnf("Logs were not collected from the Windows nodes %s, which cannot be reached over SSH without windowsProfile.sshEnabled", strings.Join(notCollected, ", "))
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("failed to collect logs from %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// getNodeHosts returns the SSH endpoints of the VMs of the cluster, by computer name, and the names of its Windows
+// VMs. Masters are reached through the load balancer, agents by hopping through the first master. Windows VMs only
+// have an endpoint when windowsProfile.sshEnabled is set.
+func (glc *getLogsCmd) getNodeHosts() (map[string]*operations.RemoteHost, map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+
+	jumpbox := &operations.RemoteHost{Addr: glc.masterFQDN, Port: masterSSHPorts[0]}
+	nodes := make(map[string]*operations.RemoteHost)
+	windowsNodes := make(map[string]bool)
+	addWindowsNode := func(name string) {
+		windowsNodes[name] = true
+		if windowsProfile := glc.containerService.Properties.WindowsProfile; windowsProfile != nil && windowsProfile.SSHEnabled {
+			nodes[name] = &operations.RemoteHost{Addr: name, Port: 22, Jumpbox: jumpbox, User: windowsProfile.AdminUsername}
+		}
+	}
+	for page, err := glc.client.ListVirtualMachines(ctx, glc.resourceGroupName); page.NotDone(); err = page.Next() {
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to list virtual machines")
+		}
+		for _, vm := range page.Values() {
+			name := to.String(vm.Name)
+			if glc.inWindowsPool(vm.Tags) {
+				addWindowsNode(name)
+				continue
+			}
+			if !strings.Contains(name, glc.nameSuffix) {
+				continue
+			}
+			if strings.HasPrefix(name, kubernetesupgrade.MasterVMNamePrefix) {
+				_, _, index, err := utils.K8sLinuxVMNameParts(name)
+				if err != nil {
+					return nil, nil, err
+				}
+				if index >= len(masterSSHPorts) {
+					return nil, nil, errors.Errorf("master VM %s has no SSH port on the load balancer", name)
+				}
+				nodes[name] = &operations.RemoteHost{Addr: glc.masterFQDN, Port: masterSSHPorts[index]}
+				continue
+			}
+			nodes[name] = &operations.RemoteHost{Addr: name, Port: 22, Jumpbox: jumpbox}
+		}
+	}
+
+	for page, err := glc.client.ListVirtualMachineScaleSets(ctx, glc.resourceGroupName); page.NotDone(); err = page.Next() {
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to list virtual machine scale sets")
+		}
+		for _, vmss := range page.Values() {
+			vmssName := to.String(vmss.Name)
+			windows := glc.inWindowsPool(vmss.Tags)
+			if _, nameSuffix, err := utils.VmssNameParts(vmssName); !windows && (err != nil || nameSuffix != glc.nameSuffix) {
+				continue
+			}
+			for vmPage, err := glc.client.ListVirtualMachineScaleSetVMs(ctx, glc.resourceGroupName, vmssName); vmPage.NotDone(); err = vmPage.Next() {
+				if err != nil {
+					return nil, nil, errors.Wrapf(err, "failed to list the virtual machines of scale set %s", vmssName)
+				}
+				for _, vm := range vmPage.Values() {
+					if vm.VirtualMachineScaleSetVMProperties == nil || vm.OsProfile == nil {
+						continue
+					}
+					name := to.String(vm.OsProfile.ComputerName)
+					if windows {
+						addWindowsNode(name)
+						continue
+					}
+					nodes[name] = &operations.RemoteHost{Addr: name, Port: 22, Jumpbox: jumpbox}
+				}
+			}
+		}
+	}
+
+	if len(nodes) == 0 && len(windowsNodes) == 0 {
+		return nil, nil, errors.Errorf("found no VMs with name suffix %s in resource group %s", glc.nameSuffix, glc.resourceGroupName)
+	}
+	return nodes, windowsNodes, nil
+}
+
+// inWindowsPool returns true if the tags of a VM or a scale set place it in a Windows agent pool of the cluster.
+// Windows resources are tagged with the first 5 characters of the name suffix.
+func (glc *getLogsCmd) inWindowsPool(tags map[string]*string) bool {
+	if to.String(tags["resourceNameSuffix"]) != glc.nameSuffix[:5] {
+		return false
+	}
+	for _, agentPool := range glc.containerService.Properties.AgentPoolProfiles {
+		if agentPool.Name == to.String(tags["poolName"]) {
+			return agentPool.IsWindows()
+		}
+	}
+	return false
+}
+
+// collectNodeLogs collects the logs of a node and writes them to <output-directory>/<name>.tar.gz
+func (glc *getLogsCmd) collectNodeLogs(name string, host *operations.RemoteHost) error {
+	glc.logger.Infof("Collecting logs from %s (%s)", name, host)
+	out, err := glc.sshRunner.RunCommand(host, collectLogsCommand(name))
+	if err != nil {
+		return err
+	}
+	if len(out) == 0 {
+		return errors.New("the log archive is empty")
+	}
+	return ioutil.WriteFile(path.Join(glc.outputDirectory, name+".tar.gz"), []byte(out), 0600)
+}
+
+// collectWindowsNodeLogs collects the logs of a Windows node and writes them to <output-directory>/<name>.zip
+func (glc *getLogsCmd) collectWindowsNodeLogs(name string, host *operations.RemoteHost) error {
+	glc.logger.Infof("Collecting logs from Windows node %s (%s)", name, host)
+	out, err := glc.sshRunner.RunCommand(host, collectWindowsLogsCommand(name))
+	if err != nil {
+		return err
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(out))
+	if err != nil {
+		return errors.Wrap(err, "failed to decode the log archive")
+	}
+	if len(b) == 0 {
+		return errors.New("the log archive is empty")
+	}
+	return ioutil.WriteFile(path.Join(glc.outputDirectory, name+".zip"), b, 0600)
+}
+
+// collectWindowsLogsCommand returns a PowerShell command that copies the logs of a Windows node into a directory
+// named after it and writes a base64 encoded zip file of that directory to stdout. Files that do not exist are skipped.
+// The script is passed encoded, so it does not need to be quoted for the shell of the node.
+func collectWindowsLogsCommand(name string) string {
+	cmds := []string{
+		fmt.Sprintf("$d = Join-Path $env:TEMP '%s'", name),
+		"New-Item -ItemType Directory -Force -Path $d | Out-Null",
+	}
+	for _, f := range windowsNodeLogFiles {
+		cmds = append(cmds, fmt.Sprintf("if (Test-Path '%s') { Copy-Item -Force -Path '%s' -Destination $d }", f, f))
+	}
+	cmds = append(cmds,
+		"docker ps -a 2>&1 | Out-File (Join-Path $d 'docker-ps.txt')",
+		"$z = $d + '.zip'",
+		"Compress-Archive -Force -Path $d -DestinationPath $z",
+		"[Convert]::ToBase64String([IO.File]::ReadAllBytes($z))",
+		"Remove-Item -Recurse -Force $d, $z")
+	script := strings.Join(cmds, "; ")
+	// -EncodedCommand takes the base64 encoding of the UTF-16LE script
+	encoded := make([]byte, 0, 2*len(script))
+	for _, c := range utf16.Encode([]rune(script)) {
+		encoded = append(encoded, byte(c), byte(c>>8))
+	}
+	return "powershell -NoProfile -NonInteractive -EncodedCommand " + base64.StdEncoding.EncodeToString(encoded)
+}
+
+// collectLogsCommand returns a command that copies the logs of a node into a directory named after it
+// and writes a gzipped tarball of that directory to stdout. Files that do not exist are skipped.
+func collectLogsCommand(name string) string {
+	dir := fmt.Sprintf(`"$d"/%s`, name)
+	cmds := []string{
+		"d=$(mktemp -d)",
+		`trap 'sudo rm -rf "$d"' EXIT`,
+		fmt.Sprintf("mkdir -p %s/journal %s/containers", dir, dir),
+	}
+	for _, f := range nodeLogFiles {
+		cmds = append(cmds, fmt.Sprintf("(test ! -e %s || sudo cp -r --parents %s %s/)", f, f, dir))
+	}
+	for _, unit := range nodeJournalUnits {
+		cmds = append(cmds, fmt.Sprintf("(sudo journalctl -u %s --no-pager > %s/journal/%s.log 2>&1 || true)", unit, dir, unit))
+	}
+	cmds = append(cmds,
+		fmt.Sprintf("(sudo docker ps -a > %s/containers/docker-ps.txt 2>&1 || true)", dir),
+		fmt.Sprintf("for c in $(sudo docker ps -a --format '{{.Names}}' 2>/dev/null); do sudo docker logs $c > %s/containers/$c.log 2>&1; done", dir),
+		fmt.Sprintf("sudo tar -czf - -C \"$d\" %s", name))
+	return strings.Join(cmds, "; ")
+}
+
+// templateNameSuffix returns the default value of the nameSuffix parameter of an ARM template
+func templateNameSuffix(template map[string]interface{}) (string, error) {
+	parameters, _ := template["parameters"].(map[string]interface{})
+	nameSuffix, _ := parameters["nameSuffix"].(map[string]interface{})
+	value, ok := nameSuffix["defaultValue"].(string)
+	if !ok || len(value) < 5 {
+		return "", errors.New("error reading the nameSuffix parameter of the ARM template")
+	}
+	return value, nil
+}
@@ -0,0 +1,245 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/spf13/cobra"
+)
+
+func TestNewGetLogsCmd(t *testing.T) {
+	output := newGetLogsCmd()
+	if output.Use != getLogsName || output.Short != getLogsShortDescription || output.Long != getLogsLongDescription {
+		t.Fatalf("get-logs command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, getLogsName, output.Short, getLogsShortDescription, output.Long, getLogsLongDescription)
+	}
+
+	expectedFlags := []string{"location", "resource-group", "deployment-dir", "ssh-key-path", "output-directory", "subscription-id"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("get-logs command should have flag %s", f)
+		}
+	}
+}
+
+func TestGetLogsCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		glc         *getLogsCmd
+		expectedErr error
+	}{
+		{
+			glc: &getLogsCmd{
+				location:            "centralus",
+				deploymentDirectory: "_output/test",
+			},
+			expectedErr: errors.New("--resource-group must be specified"),
+		},
+		{
+			glc: &getLogsCmd{
+				resourceGroupName:   "testRG",
+				deploymentDirectory: "_output/test",
+			},
+			expectedErr: errors.New("--location must be specified"),
+		},
+		{
+			glc: &getLogsCmd{
+				location:          "centralus",
+				resourceGroupName: "testRG",
+			},
+			expectedErr: errors.New("--deployment-dir must be specified"),
+		},
+		{
+			glc: &getLogsCmd{
+				location:            "centralus",
+				resourceGroupName:   "testRG",
+				deploymentDirectory: "_output/test",
+			},
+			expectedErr: nil,
+		},
+	}
+
+	for _, c := range cases {
+		err := c.glc.validate(r)
+		if err != nil && c.expectedErr != nil {
+			if err.Error() != c.expectedErr.Error() {
+				t.Fatalf("expected validate get-logs command to return error %s, but instead got %s", c.expectedErr.Error(), err.Error())
+			}
+		} else {
+			if c.expectedErr != nil {
+				t.Fatalf("expected validate get-logs command to return error %s, but instead got no error", c.expectedErr.Error())
+			} else if err != nil {
+				t.Fatalf("expected validate get-logs command to return no error, but instead got %s", err.Error())
+			}
+		}
+	}
+
+	glc := &getLogsCmd{location: "centralus", resourceGroupName: "testRG", deploymentDirectory: "_output/test"}
+	if err := glc.validate(r); err != nil || glc.outputDirectory != "_output/test/logs" {
+		t.Fatalf("expected the output directory to default to _output/test/logs, got %s (%v)", glc.outputDirectory, err)
+	}
+}
+
+func TestCollectLogsCommand(t *testing.T) {
+	cmd := collectLogsCommand("k8s-agentpool1-12345678-0")
+
+	for _, expected := range []string{
+		`(test ! -e /var/log/azure/cluster-provision.log || sudo cp -r --parents /var/log/azure/cluster-provision.log "$d"/k8s-agentpool1-12345678-0/)`,
+		`sudo journalctl -u kubelet --no-pager > "$d"/k8s-agentpool1-12345678-0/journal/kubelet.log`,
+		`sudo docker logs $c > "$d"/k8s-agentpool1-12345678-0/containers/$c.log`,
+	} {
+		if !strings.Contains(cmd, expected) {
+			t.Fatalf("expected collect logs command to contain %q, got %s", expected, cmd)
+		}
+	}
+	if !strings.HasSuffix(cmd, `sudo tar -czf - -C "$d" k8s-agentpool1-12345678-0`) {
+		t.Fatalf("expected collect logs command to write the tarball to stdout, got %s", cmd)
+	}
+}
+
+func TestCollectWindowsLogsCommand(t *testing.T) {
+	cmd := collectWindowsLogsCommand("1234k8s9000")
+	prefix := "powershell -NoProfile -NonInteractive -EncodedCommand "
+	if !strings.HasPrefix(cmd, prefix) {
+		t.Fatalf("expected collect Windows logs command to run an encoded PowerShell script, got %s", cmd)
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(cmd, prefix))
+	if err != nil || len(b)%2 != 0 {
+		t.Fatalf("expected the script to be base64 encoded UTF-16, got %v", err)
+	}
+	script := make([]byte, 0, len(b)/2)
+	for i := 0; i < len(b); i += 2 {
+		script = append(script, b[i])
+	}
+
+	for _, expected := range []string{
+		"$d = Join-Path $env:TEMP '1234k8s9000'",
+		`if (Test-Path 'C:\AzureData\CustomDataSetupScript.log') { Copy-Item -Force -Path 'C:\AzureData\CustomDataSetupScript.log' -Destination $d }`,
+		"[Convert]::ToBase64String([IO.File]::ReadAllBytes($z))",
+	} {
+		if !strings.Contains(string(script), expected) {
+			t.Fatalf("expected collect Windows logs script to contain %q, got %s", expected, script)
+		}
+	}
+}
+
+func TestGetLogsInWindowsPool(t *testing.T) {
+	glc := &getLogsCmd{
+		nameSuffix: "12345678",
+		containerService: &api.ContainerService{Properties: &api.Properties{AgentPoolProfiles: []*api.AgentPoolProfile{
+			{Name: "agentpool1", OSType: api.Linux},
+			{Name: "winpool", OSType: api.Windows},
+		}}},
+	}
+	tags := func(nameSuffix, poolName string) map[string]*string {
+		return map[string]*string{"resourceNameSuffix": to.StringPtr(nameSuffix), "poolName": to.StringPtr(poolName)}
+	}
+	if !glc.inWindowsPool(tags("12345", "winpool")) {
+		t.Fatalf("expected a VM of the Windows pool to be in a Windows pool")
+	}
+	for _, vmTags := range []map[string]*string{tags("12345678", "agentpool1"), tags("54321", "winpool"), tags("12345", "otherpool"), nil} {
+		if glc.inWindowsPool(vmTags) {
+			t.Fatalf("expected VM tagged %v not to be in a Windows pool of the cluster", vmTags)
+		}
+	}
+}
+
+func TestGetLogsCmdRun(t *testing.T) {
+	outdir, err := ioutil.TempDir("", "get-logs")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(outdir)
+
+	apimodel, err := ioutil.ReadFile("../pkg/engine/testdata/simple/kubernetes.json")
+	if err != nil {
+		t.Fatalf("unable to read test api model: %s", err)
+	}
+	files := map[string]string{
+		apiModelFilename:   string(apimodel),
+		templateFilename:   `{"parameters": {"nameSuffix": {"defaultValue": "12345678"}}}`,
+		parametersFilename: `{"parameters": {}}`,
+	}
+	for name, contents := range files {
+		if err = ioutil.WriteFile(path.Join(outdir, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("unable to write %s: %s", name, err)
+		}
+	}
+
+	runner := &fakeRemoteRunner{outputs: map[string]string{"tar -czf": "logs"}}
+	glc := &getLogsCmd{
+		authProvider: &mockAuthProvider{
+			authArgs:      &authArgs{},
+			getClientMock: &armhelpers.MockAKSEngineClient{},
+		},
+		location:            "westus",
+		resourceGroupName:   "testRG",
+		deploymentDirectory: outdir,
+		sshRunner:           runner,
+	}
+	r := &cobra.Command{}
+	addAuthFlags(glc.getAuthArgs(), r.Flags())
+
+	fakeRawSubscriptionID := "6dc93fae-9a76-421f-bbe5-cc6460ea81cb"
+	fakeSubscriptionID, err := uuid.FromString(fakeRawSubscriptionID)
+	if err != nil {
+		t.Fatalf("Invalid SubscriptionId in Test: %s", err)
+	}
+	glc.getAuthArgs().SubscriptionID = fakeSubscriptionID
+	glc.getAuthArgs().rawSubscriptionID = fakeRawSubscriptionID
+	glc.getAuthArgs().rawClientID = "b829b379-ca1f-4f1d-91a2-0d26b244680d"
+	glc.getAuthArgs().ClientSecret = "0se43bie-3zs5-303e-aav5-dcf231vb82ds"
+
+	if err = glc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running get-logs: %s", err)
+	}
+
+	agent := "k8s-agentpool1-12345678-0:22 (via masterdns1.westus.cloudapp.azure.com:22)"
+	if len(runner.commands[agent]) != 1 {
+		t.Fatalf("expected logs to be collected from the agent through the master, got %v", runner.commands)
+	}
+	b, err := ioutil.ReadFile(path.Join(outdir, "logs", "k8s-agentpool1-12345678-0.tar.gz"))
+	if err != nil || string(b) != "logs" {
+		t.Fatalf("expected the agent logs to be written to the output directory, got %q (%v)", b, err)
+	}
+
+	glc.sshRunner = &fakeRemoteRunner{failOn: "tar -czf"}
+	glc.containerService = nil
+	if err = glc.run(r, []string{}); err == nil || err.Error() != "failed to collect logs from k8s-agentpool1-12345678-0" {
+		t.Fatalf("expected get-logs to report the node it failed to collect logs from, got %v", err)
+	}
+
+	// move the secrets of the api model to Key Vault
+	client := &armhelpers.MockAKSEngineClient{}
+	apiloader := &api.Apiloader{Translator: &i18n.Translator{}}
+	cs, apiVersion, err := apiloader.LoadContainerServiceFromFile(path.Join(outdir, apiModelFilename), false, true, nil)
+	if err != nil {
+		t.Fatalf("unable to load the test api model: %s", err)
+	}
+	store := &api.KeyVaultSecretStore{VaultID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/vault", Client: client}
+	if err = apiloader.SaveContainerService(cs, apiVersion, outdir, apiModelFilename, store); err != nil {
+		t.Fatalf("unable to save the test api model secrets: %s", err)
+	}
+	glc.authProvider = &mockAuthProvider{
+		authArgs:      glc.getAuthArgs(),
+		getClientMock: client,
+	}
+	glc.sshRunner = &fakeRemoteRunner{outputs: map[string]string{"tar -czf": "logs"}}
+	glc.containerService = nil
+	if err = glc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running get-logs on a cluster with its secrets in Key Vault: %s", err)
+	}
+}
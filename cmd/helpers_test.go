@@ -0,0 +1,49 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	uuid "github.com/satori/go.uuid"
+	"github.com/spf13/cobra"
+)
+
+// writeTestDeployment writes the simple test api model to dir, with the ARM template and parameters of a cluster
+// deployed with the name suffix 12345678, the suffix of the VMs listed by the mock client
+func writeTestDeployment(t *testing.T, dir string) {
+	apimodel, err := ioutil.ReadFile("../pkg/engine/testdata/simple/kubernetes.json")
+	if err != nil {
+		t.Fatalf("unable to read test api model: %s", err)
+	}
+	files := map[string]string{
+		apiModelFilename:   string(apimodel),
+		templateFilename:   `{"parameters": {"nameSuffix": {"defaultValue": "12345678"}}}`,
+		parametersFilename: `{"parameters": {}}`,
+	}
+	for name, contents := range files {
+		if err = ioutil.WriteFile(path.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("unable to write %s: %s", name, err)
+		}
+	}
+}
+
+// newTestAuthProvider returns an auth provider with fake credentials that returns client
+func newTestAuthProvider(client armhelpers.AKSEngineClient) *mockAuthProvider {
+	provider := &mockAuthProvider{
+		authArgs:      &authArgs{},
+		getClientMock: client,
+	}
+	addAuthFlags(provider.getAuthArgs(), (&cobra.Command{}).Flags())
+	fakeRawSubscriptionID := "6dc93fae-9a76-421f-bbe5-cc6460ea81cb"
+	fakeSubscriptionID, _ := uuid.FromString(fakeRawSubscriptionID)
+	provider.SubscriptionID = fakeSubscriptionID
+	provider.rawSubscriptionID = fakeRawSubscriptionID
+	provider.rawClientID = "b829b379-ca1f-4f1d-91a2-0d26b244680d"
+	provider.ClientSecret = "0se43bie-3zs5-303e-aav5-dcf231vb82ds"
+	return provider
+}
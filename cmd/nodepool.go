@@ -0,0 +1,598 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/engine"
+	"github.com/Azure/aks-engine/pkg/engine/transform"
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	nodePoolName             = "nodepool"
+	nodePoolShortDescription = "Add or remove agent pools of an existing Kubernetes cluster"
+	nodePoolLongDescription  = "Add a new agent pool to an existing Kubernetes cluster, or remove one of its agent pools with all of its nodes"
+
+	nodePoolAddName             = "add"
+	nodePoolAddShortDescription = "Add an agent pool to an existing Kubernetes cluster"
+	nodePoolAddLongDescription  = "Add an agent pool to an existing Kubernetes cluster by deploying only the resources of the new pool"
+
+	nodePoolDeleteName             = "delete"
+	nodePoolDeleteShortDescription = "Remove an agent pool from an existing Kubernetes cluster"
+	nodePoolDeleteLongDescription  = "Remove an agent pool from an existing Kubernetes cluster by draining every node before deleting its VMs, NICs, disks and availability set or scale set"
+)
+
+// nodePoolCmd holds the arguments shared by the nodepool subcommands
+type nodePoolCmd struct {
+	authProvider
+
+	// user input
+	resourceGroupName   string
+	deploymentDirectory string
+	location            string
+
+	// derived
+	containerService *api.ContainerService
+	apiVersion       string
+	apiModelPath     string
+	locale           *gotext.Locale
+	client           armhelpers.AKSEngineClient
+	nameSuffix       string
+	logger           *log.Entry
+}
+
+type nodePoolAddCmd struct {
+	nodePoolCmd
+
+	// user input
+	agentPoolPath       string
+	name                string
+	count               int
+	vmSize              string
+	osType              string
+	availabilityProfile string
+	vnetSubnetID        string
+}
+
+type nodePoolDeleteCmd struct {
+	nodePoolCmd
+
+	// user input
+	agentPoolToDelete string
+}
+
+func newNodePoolCmd() *cobra.Command {
+	nodePoolCmd := &cobra.Command{
+		Use:   nodePoolName,
+		Short: nodePoolShortDescription,
+		Long:  nodePoolLongDescription,
+	}
+	nodePoolCmd.AddCommand(newNodePoolAddCmd())
+	nodePoolCmd.AddCommand(newNodePoolDeleteCmd())
+	return nodePoolCmd
+}
+
+func newNodePoolAddCmd() *cobra.Command {
+	nac := nodePoolAddCmd{
+		nodePoolCmd: nodePoolCmd{
+			authProvider: &authArgs{},
+		},
+	}
+
+	addCmd := &cobra.Command{
+		Use:   nodePoolAddName,
+		Short: nodePoolAddShortDescription,
+		Long:  nodePoolAddLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return nac.run(cmd, args)
+		},
+	}
+
+	f := addCmd.Flags()
+	nac.addFlags(f)
+	f.StringVar(&nac.agentPoolPath, "agent-pool", "", "path to a JSON file holding the agentPoolProfile of the new pool")
+	f.StringVar(&nac.name, "name", "", "name of the new pool (overrides the agent pool file)")
+	f.IntVarP(&nac.count, "count", "c", 0, "number of nodes in the new pool (overrides the agent pool file)")
+	f.StringVar(&nac.vmSize, "vm-size", "", "VM size of the nodes in the new pool (overrides the agent pool file)")
+	f.StringVar(&nac.osType, "os-type", "", "OS of the nodes in the new pool, Linux or Windows (overrides the agent pool file)")
+	f.StringVar(&nac.availabilityProfile, "availability-profile", "", "AvailabilitySet or VirtualMachineScaleSets (overrides the agent pool file)")
+	f.StringVar(&nac.vnetSubnetID, "vnet-subnet-id", "", "ID of the custom VNET subnet of the new pool (overrides the agent pool file)")
+
+	return addCmd
+}
+
+func newNodePoolDeleteCmd() *cobra.Command {
+	ndc := nodePoolDeleteCmd{
+		nodePoolCmd: nodePoolCmd{
+			authProvider: &authArgs{},
+		},
+	}
+
+	deleteCmd := &cobra.Command{
+		Use:   nodePoolDeleteName,
+		Short: nodePoolDeleteShortDescription,
+		Long:  nodePoolDeleteLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ndc.run(cmd, args)
+		},
+	}
+
+	f := deleteCmd.Flags()
+	ndc.addFlags(f)
+	f.StringVar(&ndc.agentPoolToDelete, "node-pool", "", "name of the agent pool to remove (required)")
+
+	return deleteCmd
+}
+
+func (npc *nodePoolCmd) addFlags(f *pflag.FlagSet) {
+	f.StringVarP(&npc.location, "location", "l", "", "location the cluster is deployed in (required)")
+	f.StringVarP(&npc.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed (required)")
+	f.StringVar(&npc.deploymentDirectory, "deployment-dir", "", "the location of the output from `generate` (required)")
+	addAuthFlags(npc.getAuthArgs(), f)
+}
+
+func (npc *nodePoolCmd) validate(cmd *cobra.Command) error {
+	var err error
+
+	npc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if npc.resourceGroupName == "" {
+		cmd.Usage()
+		return errors.New("--resource-group must be specified")
+	}
+
+	if npc.location == "" {
+		cmd.Usage()
+		return errors.New("--location must be specified")
+	}
+	npc.location = helpers.NormalizeAzureRegion(npc.location)
+
+	if npc.deploymentDirectory == "" {
+		cmd.Usage()
+		return errors.New("--deployment-dir must be specified")
+	}
+	return nil
+}
+
+func (nac *nodePoolAddCmd) validate(cmd *cobra.Command) error {
+	if err := nac.nodePoolCmd.validate(cmd); err != nil {
+		return err
+	}
+	if nac.agentPoolPath == "" && nac.name == "" {
+		cmd.Usage()
+		return errors.New("--agent-pool or --name must be specified")
+	}
+	return nil
+}
+
+func (ndc *nodePoolDeleteCmd) validate(cmd *cobra.Command) error {
+	if err := ndc.nodePoolCmd.validate(cmd); err != nil {
+		return err
+	}
+	if ndc.agentPoolToDelete == "" {
+		cmd.Usage()
+		return errors.New("--node-pool must be specified")
+	}
+	return nil
+}
+
+func (npc *nodePoolCmd) load() error {
+	var err error
+
+	npc.logger = log.New().WithField("source", "nodepool command line")
+
+	if err = npc.getAuthArgs().validateAuthArgs(); err != nil {
+		return err
+	}
+	if npc.client, err = npc.authProvider.getClient(); err != nil {
+		return errors.Wrap(err, "failed to get client")
+	}
+
+	npc.apiModelPath = api.FindAPIModelFile(npc.deploymentDirectory)
+	if _, err = os.Stat(npc.apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", npc.apiModelPath)
+	}
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: npc.locale,
+		},
+		KeyVaultClient: npc.client,
+	}
+	npc.containerService, npc.apiVersion, err = apiloader.LoadContainerServiceFromFile(npc.apiModelPath, true, true, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+
+	if npc.containerService.Location == "" {
+		npc.containerService.Location = npc.location
+	} else if npc.containerService.Location != npc.location {
+		return errors.New("--location does not match api model location")
+	}
+
+	if !npc.containerService.Properties.OrchestratorProfile.IsKubernetes() {
+		return errors.New("agent pools can only be added to or removed from Kubernetes clusters")
+	}
+
+	template, _, err := loadDeployedTemplate(npc.deploymentDirectory)
+	if err != nil {
+		return err
+	}
+	if npc.nameSuffix, err = templateNameSuffix(template); err != nil {
+		return err
+	}
+	// name the resources of the pool after the deployed cluster
+	npc.containerService.Properties.ClusterID = npc.nameSuffix
+	return nil
+}
+
+// vmInNodePool returns true if the VM or scale set belongs to the agent pool, by its tags or by the VM name prefix of the pool
+func (npc *nodePoolCmd) vmInNodePool(pool *api.AgentPoolProfile, vmName string, tags map[string]*string) bool {
+	if tags != nil {
+		if poolName, ok := tags["poolName"]; ok {
+			// Windows agent pools are tagged with the prefix of the name suffix
+			return strings.EqualFold(*poolName, pool.Name) && tags["resourceNameSuffix"] != nil &&
+				operations.IsClusterResource(resources.GenericResource{Name: &vmName, Tags: tags}, npc.nameSuffix)
+		}
+	}
+	prefix := npc.containerService.Properties.GetAgentVMPrefix(pool)
+	return prefix != "" && strings.HasPrefix(strings.ToLower(vmName), strings.ToLower(prefix))
+}
+
+// saveAPIModel applies the change to the agent pools of the api model in the deployment directory and saves it
+func (npc *nodePoolCmd) saveAPIModel(update func(*api.Properties)) error {
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: npc.locale,
+		},
+		KeyVaultClient: npc.client,
+	}
+	containerService, apiVersion, err := apiloader.LoadContainerServiceFromFile(npc.apiModelPath, false, true, nil)
+	if err != nil {
+		return err
+	}
+	update(containerService.Properties)
+
+	return apiloader.SaveContainerService(containerService, apiVersion, npc.deploymentDirectory, path.Base(npc.apiModelPath), nil)
+}
+
+// agentPoolDefinition returns the agentPoolProfile of the new pool, read from --agent-pool and overridden by the other flags
+func (nac *nodePoolAddCmd) agentPoolDefinition() (map[string]interface{}, error) {
+	pool := map[string]interface{}{}
+	if nac.agentPoolPath != "" {
+		b, err := ioutil.ReadFile(nac.agentPoolPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read agent pool %s", nac.agentPoolPath)
+		}
+		if err = json.Unmarshal(b, &pool); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse agent pool %s", nac.agentPoolPath)
+		}
+	}
+
+	overrides := map[string]string{
+		"name":                nac.name,
+		"vmSize":              nac.vmSize,
+		"osType":              nac.osType,
+		"availabilityProfile": nac.availabilityProfile,
+		"vnetSubnetID":        nac.vnetSubnetID,
+	}
+	for k, v := range overrides {
+		if v != "" {
+			pool[k] = v
+		}
+	}
+	if nac.count != 0 {
+		pool["count"] = nac.count
+	}
+	if name, _ := pool["name"].(string); name == "" {
+		return nil, errors.New("the new agent pool must have a name")
+	}
+	return pool, nil
+}
+
+// withAgentPool returns the api model in the deployment directory, with its saved secrets, and the new pool
+// appended to its agent pools
+func (nac *nodePoolAddCmd) withAgentPool(pool map[string]interface{}) ([]byte, error) {
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: nac.locale,
+		},
+		KeyVaultClient: nac.client,
+	}
+	b, err := apiloader.ReadAPIModelFile(nac.apiModelPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the api model")
+	}
+	apimodel := map[string]interface{}{}
+	if err = json.Unmarshal(b, &apimodel); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the api model")
+	}
+	properties, ok := apimodel["properties"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("the api model has no properties")
+	}
+	pools, _ := properties["agentPoolProfiles"].([]interface{})
+	properties["agentPoolProfiles"] = append(pools, pool)
+	return json.Marshal(apimodel)
+}
+
+func (nac *nodePoolAddCmd) run(cmd *cobra.Command, args []string) error {
+	if err := nac.validate(cmd); err != nil {
+		return errors.Wrap(err, "failed to validate nodepool add command")
+	}
+	if err := nac.load(); err != nil {
+		return errors.Wrap(err, "failed to load existing container service")
+	}
+
+	poolDefinition, err := nac.agentPoolDefinition()
+	if err != nil {
+		return err
+	}
+	poolName := poolDefinition["name"].(string)
+	existingPools := []string{}
+	for _, pool := range nac.containerService.Properties.AgentPoolProfiles {
+		if strings.EqualFold(pool.Name, poolName) {
+			return errors.Errorf("agent pool %s already exists in the deployed api model", poolName)
+		}
+		existingPools = append(existingPools, pool.Name)
+	}
+
+	// validate the new pool together with the rest of the cluster
+	contents, err := nac.withAgentPool(poolDefinition)
+	if err != nil {
+		return err
+	}
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: nac.locale,
+		},
+	}
+	containerService, err := apiloader.LoadContainerService(contents, nac.apiVersion, true, true, nil)
+	if err != nil {
+		return errors.Wrapf(err, "agent pool %s is not valid for the cluster", poolName)
+	}
+	containerService.Location = nac.containerService.Location
+	containerService.Properties.ClusterID = nac.nameSuffix
+	properties := containerService.Properties
+	newPool := properties.AgentPoolProfiles[len(properties.AgentPoolProfiles)-1]
+
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	if err = nac.checkAgentPoolNotDeployed(ctx, newPool); err != nil {
+		return err
+	}
+
+	translator := engine.Context{
+		Translator: &i18n.Translator{
+			Locale: nac.locale,
+		},
+	}
+	templateGenerator, err := engine.InitializeTemplateGenerator(translator)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize template generator")
+	}
+	if _, err = containerService.SetPropertiesDefaults(false, true); err != nil {
+		return errors.Wrapf(err, "error in SetPropertiesDefaults template %s", nac.apiModelPath)
+	}
+	// the template holds every agent pool so the new pool is named after its index in the api model
+	template, parameters, err := templateGenerator.GenerateTemplate(containerService, engine.DefaultGeneratorCode, BuildTag)
+	if err != nil {
+		return errors.Wrapf(err, "error generating template %s", nac.apiModelPath)
+	}
+	if template, err = transform.PrettyPrintArmTemplate(template); err != nil {
+		return errors.Wrap(err, "error pretty printing template")
+	}
+
+	templateJSON := make(map[string]interface{})
+	parametersJSON := make(map[string]interface{})
+	if err = json.Unmarshal([]byte(template), &templateJSON); err != nil {
+		return errors.Wrap(err, "error unmarshaling template")
+	}
+	if err = json.Unmarshal([]byte(parameters), &parametersJSON); err != nil {
+		return errors.Wrap(err, "error unmarshaling parameters")
+	}
+
+	transformer := transform.Transformer{Translator: translator.Translator}
+	if err = transformer.NormalizeForK8sAgentPoolAddition(nac.logger, templateJSON, existingPools); err != nil {
+		return errors.Wrapf(err, "error transforming the template for adding agent pool %s", poolName)
+	}
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	deploymentSuffix := random.Int31()
+	nac.logger.Infof("Deploying agent pool %s with %d nodes", poolName, newPool.Count)
+	if _, err = nac.client.DeployTemplate(
+		ctx,
+		nac.resourceGroupName,
+		fmt.Sprintf("%s-%d", nac.resourceGroupName, deploymentSuffix),
+		templateJSON,
+		parametersJSON); err != nil {
+		return err
+	}
+
+	// save the pool as it was given, without the defaults set for generating the template
+	saved, err := apiloader.LoadContainerService(contents, nac.apiVersion, false, true, nil)
+	if err != nil {
+		return err
+	}
+	return nac.saveAPIModel(func(p *api.Properties) {
+		p.AgentPoolProfiles = append(p.AgentPoolProfiles, saved.Properties.AgentPoolProfiles[len(saved.Properties.AgentPoolProfiles)-1])
+	})
+}
+
+// checkAgentPoolNotDeployed returns an error if VMs or scale sets named after the new pool already exist
+func (nac *nodePoolAddCmd) checkAgentPoolNotDeployed(ctx context.Context, pool *api.AgentPoolProfile) error {
+	for vmsListPage, err := nac.client.ListVirtualMachines(ctx, nac.resourceGroupName); vmsListPage.NotDone(); err = vmsListPage.Next() {
+		if err != nil {
+			return errors.Wrap(err, "failed to get vms in the resource group")
+		}
+		for _, vm := range vmsListPage.Values() {
+			if nac.vmInNodePool(pool, *vm.Name, vm.Tags) {
+				return errors.Errorf("vm %s of agent pool %s already exists", *vm.Name, pool.Name)
+			}
+		}
+	}
+	for vmssListPage, err := nac.client.ListVirtualMachineScaleSets(ctx, nac.resourceGroupName); vmssListPage.NotDone(); err = vmssListPage.Next() {
+		if err != nil {
+			return errors.Wrap(err, "failed to get vmss list in the resource group")
+		}
+		for _, vmss := range vmssListPage.Values() {
+			if nac.vmInNodePool(pool, *vmss.Name, vmss.Tags) {
+				return errors.Errorf("scale set %s of agent pool %s already exists", *vmss.Name, pool.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (ndc *nodePoolDeleteCmd) run(cmd *cobra.Command, args []string) error {
+	if err := ndc.validate(cmd); err != nil {
+		return errors.Wrap(err, "failed to validate nodepool delete command")
+	}
+	if err := ndc.load(); err != nil {
+		return errors.Wrap(err, "failed to load existing container service")
+	}
+
+	properties := ndc.containerService.Properties
+	var pool *api.AgentPoolProfile
+	poolIndex := -1
+	for i, p := range properties.AgentPoolProfiles {
+		if strings.EqualFold(p.Name, ndc.agentPoolToDelete) {
+			pool, poolIndex = p, i
+		}
+	}
+	if pool == nil {
+		return errors.Errorf("node pool %s was not found in the deployed api model", ndc.agentPoolToDelete)
+	}
+	if len(properties.AgentPoolProfiles) == 1 {
+		return errors.Errorf("node pool %s is the only agent pool of the cluster and cannot be removed", pool.Name)
+	}
+	// the VMs of Windows pools are named after the index of their pool, which removing an earlier pool would shift
+	for _, p := range properties.AgentPoolProfiles[poolIndex+1:] {
+		if p.IsWindows() {
+			return errors.Errorf("node pool %s cannot be removed: the VM names of the Windows pool %s after it depend on its position in the api model", pool.Name, p.Name)
+		}
+	}
+
+	kubeConfig, err := engine.GenerateKubeConfig(properties, ndc.location)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate kube config")
+	}
+	masterFQDN := api.FormatAzureProdFQDNByLocation(properties.MasterProfile.DNSPrefix, ndc.location)
+
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	if pool.IsAvailabilitySets() {
+		err = ndc.deleteAvailabilitySetPool(ctx, pool, masterFQDN, kubeConfig)
+	} else {
+		err = ndc.deleteScaleSetPool(ctx, pool, masterFQDN, kubeConfig)
+	}
+	if err != nil {
+		return err
+	}
+
+	return ndc.saveAPIModel(func(p *api.Properties) {
+		pools := make([]*api.AgentPoolProfile, 0, len(p.AgentPoolProfiles)-1)
+		for _, agentPool := range p.AgentPoolProfiles {
+			if !strings.EqualFold(agentPool.Name, pool.Name) {
+				pools = append(pools, agentPool)
+			}
+		}
+		p.AgentPoolProfiles = pools
+	})
+}
+
+// deleteAvailabilitySetPool drains and deletes every VM of the pool, with its NIC and disks, then deletes the availability set
+func (ndc *nodePoolDeleteCmd) deleteAvailabilitySetPool(ctx context.Context, pool *api.AgentPoolProfile, masterFQDN, kubeConfig string) error {
+	vmNames := []string{}
+	for vmsListPage, err := ndc.client.ListVirtualMachines(ctx, ndc.resourceGroupName); vmsListPage.NotDone(); err = vmsListPage.Next() {
+		if err != nil {
+			return errors.Wrap(err, "failed to get vms in the resource group")
+		}
+		for _, vm := range vmsListPage.Values() {
+			if ndc.vmInNodePool(pool, *vm.Name, vm.Tags) {
+				vmNames = append(vmNames, *vm.Name)
+			}
+		}
+	}
+
+	if len(vmNames) > 0 {
+		ndc.logger.Infof("Draining nodes %s of agent pool %s", strings.Join(vmNames, ", "), pool.Name)
+		if err := drainNodes(ndc.client, ndc.logger, nil, masterFQDN, kubeConfig, pool.Name, vmNames); err != nil {
+			return errors.Wrap(err, "Got error while draining the nodes to be deleted")
+		}
+		if errList := operations.ScaleDownVMs(ndc.client, ndc.logger, ndc.getAuthArgs().SubscriptionID.String(), ndc.resourceGroupName, vmNames...); errList != nil {
+			return vmScalingError(errList)
+		}
+	}
+
+	availabilitySet := fmt.Sprintf("%s-availabilitySet-%s", pool.Name, ndc.nameSuffix)
+	if err := ndc.client.DeleteAvailabilitySet(ctx, ndc.resourceGroupName, availabilitySet); err != nil {
+		return errors.Wrapf(err, "failed to delete availability set %s", availabilitySet)
+	}
+	return nil
+}
+
+// deleteScaleSetPool drains every instance of the pool's scale set, then deletes the scale set
+func (ndc *nodePoolDeleteCmd) deleteScaleSetPool(ctx context.Context, pool *api.AgentPoolProfile, masterFQDN, kubeConfig string) error {
+	var scaleSets []string
+	for vmssListPage, err := ndc.client.ListVirtualMachineScaleSets(ctx, ndc.resourceGroupName); vmssListPage.NotDone(); err = vmssListPage.Next() {
+		if err != nil {
+			return errors.Wrap(err, "failed to get vmss list in the resource group")
+		}
+		for _, vmss := range vmssListPage.Values() {
+			if ndc.vmInNodePool(pool, *vmss.Name, vmss.Tags) {
+				scaleSets = append(scaleSets, *vmss.Name)
+			}
+		}
+	}
+
+	for _, vmssName := range scaleSets {
+		var instances []compute.VirtualMachineScaleSetVM
+		for vmsListPage, err := ndc.client.ListVirtualMachineScaleSetVMs(ctx, ndc.resourceGroupName, vmssName); vmsListPage.NotDone(); err = vmsListPage.Next() {
+			if err != nil {
+				return errors.Wrapf(err, "failed to get the vms of scale set %s", vmssName)
+			}
+			instances = append(instances, vmsListPage.Values()...)
+		}
+		nodeNames := make([]string, 0, len(instances))
+		for _, vm := range instances {
+			nodeNames = append(nodeNames, scaleSetVMNodeName(vm))
+		}
+
+		if len(nodeNames) > 0 {
+			ndc.logger.Infof("Draining nodes %s of agent pool %s", strings.Join(nodeNames, ", "), pool.Name)
+			if err := drainNodes(ndc.client, ndc.logger, nil, masterFQDN, kubeConfig, pool.Name, nodeNames); err != nil {
+				return errors.Wrap(err, "Got error while draining the nodes to be deleted")
+			}
+		}
+		if err := ndc.client.DeleteVirtualMachineScaleSet(ctx, ndc.resourceGroupName, vmssName); err != nil {
+			return errors.Wrapf(err, "failed to delete scale set %s", vmssName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,423 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func TestNewNodePoolCmd(t *testing.T) {
+	output := newNodePoolCmd()
+	if output.Use != nodePoolName || output.Short != nodePoolShortDescription || output.Long != nodePoolLongDescription {
+		t.Fatalf("nodepool command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, nodePoolName, output.Short, nodePoolShortDescription, output.Long, nodePoolLongDescription)
+	}
+
+	expectedCommands := []*cobra.Command{newNodePoolAddCmd(), newNodePoolDeleteCmd()}
+	subcommands := output.Commands()
+	if len(subcommands) != len(expectedCommands) {
+		t.Fatalf("nodepool command should have %d subcommands, got %d", len(expectedCommands), len(subcommands))
+	}
+	for i, c := range expectedCommands {
+		if subcommands[i].Use != c.Use {
+			t.Fatalf("nodepool command should have command %s", c.Use)
+		}
+	}
+
+	expectedFlags := []string{"location", "resource-group", "deployment-dir", "subscription-id"}
+	for _, c := range subcommands {
+		for _, f := range expectedFlags {
+			if c.Flags().Lookup(f) == nil {
+				t.Fatalf("nodepool %s command should have flag %s", c.Use, f)
+			}
+		}
+	}
+	for _, f := range []string{"agent-pool", "name", "count", "vm-size", "os-type", "availability-profile", "vnet-subnet-id"} {
+		if newNodePoolAddCmd().Flags().Lookup(f) == nil {
+			t.Fatalf("nodepool add command should have flag %s", f)
+		}
+	}
+	if newNodePoolDeleteCmd().Flags().Lookup("node-pool") == nil {
+		t.Fatalf("nodepool delete command should have flag node-pool")
+	}
+}
+
+func TestNodePoolCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		validate    func(*cobra.Command) error
+		expectedErr error
+	}{
+		{
+			validate: (&nodePoolAddCmd{
+				nodePoolCmd: nodePoolCmd{
+					location:            "centralus",
+					deploymentDirectory: "_output/test",
+				},
+				name: "gpupool",
+			}).validate,
+			expectedErr: errors.New("--resource-group must be specified"),
+		},
+		{
+			validate: (&nodePoolAddCmd{
+				nodePoolCmd: nodePoolCmd{
+					resourceGroupName:   "testRG",
+					deploymentDirectory: "_output/test",
+				},
+				name: "gpupool",
+			}).validate,
+			expectedErr: errors.New("--location must be specified"),
+		},
+		{
+			validate: (&nodePoolAddCmd{
+				nodePoolCmd: nodePoolCmd{
+					location:          "centralus",
+					resourceGroupName: "testRG",
+				},
+				name: "gpupool",
+			}).validate,
+			expectedErr: errors.New("--deployment-dir must be specified"),
+		},
+		{
+			validate: (&nodePoolAddCmd{
+				nodePoolCmd: nodePoolCmd{
+					location:            "centralus",
+					resourceGroupName:   "testRG",
+					deploymentDirectory: "_output/test",
+				},
+			}).validate,
+			expectedErr: errors.New("--agent-pool or --name must be specified"),
+		},
+		{
+			validate: (&nodePoolAddCmd{
+				nodePoolCmd: nodePoolCmd{
+					location:            "centralus",
+					resourceGroupName:   "testRG",
+					deploymentDirectory: "_output/test",
+				},
+				agentPoolPath: "gpupool.json",
+			}).validate,
+			expectedErr: nil,
+		},
+		{
+			validate: (&nodePoolDeleteCmd{
+				nodePoolCmd: nodePoolCmd{
+					location:            "centralus",
+					resourceGroupName:   "testRG",
+					deploymentDirectory: "_output/test",
+				},
+			}).validate,
+			expectedErr: errors.New("--node-pool must be specified"),
+		},
+		{
+			validate: (&nodePoolDeleteCmd{
+				nodePoolCmd: nodePoolCmd{
+					location:            "centralus",
+					resourceGroupName:   "testRG",
+					deploymentDirectory: "_output/test",
+				},
+				agentPoolToDelete: "agentpool1",
+			}).validate,
+			expectedErr: nil,
+		},
+	}
+
+	for _, c := range cases {
+		err := c.validate(r)
+		if err != nil && c.expectedErr != nil {
+			if err.Error() != c.expectedErr.Error() {
+				t.Fatalf("expected validate nodepool command to return error %s, but instead got %s", c.expectedErr.Error(), err.Error())
+			}
+		} else {
+			if c.expectedErr != nil {
+				t.Fatalf("expected validate nodepool command to return error %s, but instead got no error", c.expectedErr.Error())
+			} else if err != nil {
+				t.Fatalf("expected validate nodepool command to return no error, but instead got %s", err.Error())
+			}
+		}
+	}
+}
+
+func TestNodePoolAddAgentPoolDefinition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nodepool")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	poolPath := path.Join(dir, "pool.json")
+	if err = ioutil.WriteFile(poolPath, []byte(`{"name": "gpupool", "count": 2, "vmSize": "Standard_NC6", "availabilityProfile": "AvailabilitySet"}`), 0600); err != nil {
+		t.Fatalf("unable to write agent pool: %s", err)
+	}
+
+	nac := &nodePoolAddCmd{agentPoolPath: poolPath, count: 3, osType: "Windows"}
+	pool, err := nac.agentPoolDefinition()
+	if err != nil {
+		t.Fatalf("unexpected error reading the agent pool definition: %s", err)
+	}
+	if pool["name"] != "gpupool" || pool["vmSize"] != "Standard_NC6" || pool["count"] != 3 || pool["osType"] != "Windows" {
+		t.Fatalf("expected the flags to override the agent pool file, got %v", pool)
+	}
+
+	nac = &nodePoolAddCmd{count: 3}
+	if _, err = nac.agentPoolDefinition(); err == nil || err.Error() != "the new agent pool must have a name" {
+		t.Fatalf("expected an agent pool without a name to be rejected, got %v", err)
+	}
+}
+
+// newTestNodePoolCmd returns a nodePoolCmd for the test deployment written to dir
+func newTestNodePoolCmd(t *testing.T, dir string, client armhelpers.AKSEngineClient) nodePoolCmd {
+	writeTestDeployment(t, dir)
+	return nodePoolCmd{
+		authProvider:        newTestAuthProvider(client),
+		location:            "westus",
+		resourceGroupName:   "testRG",
+		deploymentDirectory: dir,
+	}
+}
+
+func loadTestAgentPoolNames(t *testing.T, dir string) []string {
+	apiloader := &api.Apiloader{Translator: &i18n.Translator{}}
+	cs, _, err := apiloader.LoadContainerServiceFromFile(path.Join(dir, apiModelFilename), false, true, nil)
+	if err != nil {
+		t.Fatalf("unable to load the saved api model: %s", err)
+	}
+	names := []string{}
+	for _, pool := range cs.Properties.AgentPoolProfiles {
+		names = append(names, pool.Name)
+	}
+	return names
+}
+
+func TestNodePoolVMInNodePool(t *testing.T) {
+	npc := &nodePoolCmd{
+		containerService: &api.ContainerService{Properties: &api.Properties{
+			OrchestratorProfile: &api.OrchestratorProfile{OrchestratorType: api.Kubernetes},
+			AgentPoolProfiles:   []*api.AgentPoolProfile{{Name: "winpool", OSType: api.Windows}},
+		}},
+		nameSuffix: "12345678",
+	}
+	pool := npc.containerService.Properties.AgentPoolProfiles[0]
+	tags := func(poolName, nameSuffix string) map[string]*string {
+		return map[string]*string{"poolName": &poolName, "resourceNameSuffix": &nameSuffix}
+	}
+
+	cases := []struct {
+		tags     map[string]*string
+		expected bool
+	}{
+		{tags: tags("winpool", "12345678"), expected: true},
+		// Windows VMs are tagged with the first 5 characters of the name suffix
+		{tags: tags("WinPool", "12345"), expected: true},
+		// the tag of another cluster that is a substring of the name suffix
+		{tags: tags("winpool", "34567"), expected: false},
+		{tags: tags("winpool", "1234"), expected: false},
+		{tags: tags("winpool", "87654321"), expected: false},
+		{tags: tags("otherpool", "12345678"), expected: false},
+		{tags: map[string]*string{"poolName": &pool.Name}, expected: false},
+	}
+	for _, c := range cases {
+		if got := npc.vmInNodePool(pool, "1234k8s010", c.tags); got != c.expected {
+			t.Errorf("expected vmInNodePool of a VM tagged %s/%s to be %t, got %t", *c.tags["poolName"], to.String(c.tags["resourceNameSuffix"]), c.expected, got)
+		}
+	}
+}
+
+func TestNodePoolAddCmdRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nodepool")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := &cobra.Command{}
+	nac := &nodePoolAddCmd{
+		nodePoolCmd:         newTestNodePoolCmd(t, dir, &armhelpers.MockAKSEngineClient{}),
+		name:                "gpupool",
+		count:               2,
+		vmSize:              "Standard_NC6",
+		availabilityProfile: api.AvailabilitySet,
+	}
+	if err = nac.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running nodepool add: %s", err)
+	}
+	if names := loadTestAgentPoolNames(t, dir); strings.Join(names, ",") != "agentpool1,agentpool2,gpupool" {
+		t.Fatalf("expected the new agent pool to be saved in the api model, got %v", names)
+	}
+
+	nac.containerService = nil
+	if err = nac.run(r, []string{}); err == nil || err.Error() != "agent pool gpupool already exists in the deployed api model" {
+		t.Fatalf("expected adding an existing agent pool to fail, got %v", err)
+	}
+
+	nac = &nodePoolAddCmd{
+		nodePoolCmd:         newTestNodePoolCmd(t, dir, &armhelpers.MockAKSEngineClient{}),
+		name:                "winpool",
+		count:               2,
+		vmSize:              "Standard_D2_v2",
+		osType:              "Windows",
+		availabilityProfile: api.AvailabilitySet,
+	}
+	if err = nac.run(r, []string{}); err == nil || !strings.Contains(err.Error(), "WindowsProfile is required") {
+		t.Fatalf("expected adding a Windows pool to a cluster without a windowsProfile to fail, got %v", err)
+	}
+}
+
+func TestNodePoolAddCmdRunSecretStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nodepool")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	nac := &nodePoolAddCmd{
+		nodePoolCmd:         newTestNodePoolCmd(t, dir, &armhelpers.MockAKSEngineClient{}),
+		name:                "gpupool",
+		count:               2,
+		vmSize:              "Standard_NC6",
+		availabilityProfile: api.AvailabilitySet,
+	}
+	// move the secrets of the api model to a file secret store
+	apiloader := &api.Apiloader{Translator: &i18n.Translator{}}
+	cs, apiVersion, err := apiloader.LoadContainerServiceFromFile(path.Join(dir, apiModelFilename), false, true, nil)
+	if err != nil {
+		t.Fatalf("unable to load the test api model: %s", err)
+	}
+	if err = apiloader.SaveContainerService(cs, apiVersion, dir, apiModelFilename, &api.FileSecretStore{}); err != nil {
+		t.Fatalf("unable to save the test api model secrets: %s", err)
+	}
+	if err = nac.load(); err != nil {
+		t.Fatalf("unexpected error loading the cluster: %s", err)
+	}
+
+	contents, err := nac.withAgentPool(map[string]interface{}{"name": "gpupool"})
+	if err != nil {
+		t.Fatalf("unexpected error adding the agent pool to the api model: %s", err)
+	}
+	for _, secret := range []string{"myServicePrincipalClientSecret", "caPrivateKey", "etcdClientPrivateKey", "etcdPeerPrivateKey0"} {
+		if !strings.Contains(string(contents), secret) {
+			t.Fatalf("expected the api model of the new pool to hold the stored secret %s, got %s", secret, contents)
+		}
+	}
+
+	nac.containerService = nil
+	if err = nac.run(&cobra.Command{}, []string{}); err != nil {
+		t.Fatalf("unexpected error running nodepool add: %s", err)
+	}
+	if names := loadTestAgentPoolNames(t, dir); strings.Join(names, ",") != "agentpool1,agentpool2,gpupool" {
+		t.Fatalf("expected the new agent pool to be saved in the api model, got %v", names)
+	}
+}
+
+func TestNodePoolAddCmdRunExistingVMs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nodepool")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the mock client lists the VM k8s-agentpool1-12345678-0, tagged as a node of agentpool1
+	nac := &nodePoolAddCmd{
+		nodePoolCmd: newTestNodePoolCmd(t, dir, &armhelpers.MockAKSEngineClient{}),
+		name:        "gpupool",
+		count:       2,
+		vmSize:      "Standard_NC6",
+	}
+	if err = nac.load(); err != nil {
+		t.Fatalf("unexpected error loading the cluster: %s", err)
+	}
+	pool := &api.AgentPoolProfile{Name: "agentpool1"}
+	nac.containerService.Properties.AgentPoolProfiles = []*api.AgentPoolProfile{pool}
+	err = nac.checkAgentPoolNotDeployed(context.Background(), pool)
+	if err == nil || err.Error() != "vm k8s-agentpool1-12345678-0 of agent pool agentpool1 already exists" {
+		t.Fatalf("expected the existing VMs of the pool to be found, got %v", err)
+	}
+}
+
+func TestNodePoolDeleteCmdRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nodepool")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := &cobra.Command{}
+	client := &armhelpers.MockAKSEngineClient{}
+	ndc := &nodePoolDeleteCmd{
+		nodePoolCmd:       newTestNodePoolCmd(t, dir, client),
+		agentPoolToDelete: "agentpool1",
+	}
+
+	client.FailDeleteAvailabilitySet = true
+	if err = ndc.run(r, []string{}); err == nil || err.Error() != "failed to delete availability set agentpool1-availabilitySet-12345678: DeleteAvailabilitySet failed" {
+		t.Fatalf("expected nodepool delete to fail deleting the availability set, got %v", err)
+	}
+	if names := loadTestAgentPoolNames(t, dir); strings.Join(names, ",") != "agentpool1,agentpool2" {
+		t.Fatalf("expected the api model to be unchanged after a failure, got %v", names)
+	}
+
+	client.FailDeleteAvailabilitySet = false
+	if err = ndc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running nodepool delete: %s", err)
+	}
+	if names := loadTestAgentPoolNames(t, dir); strings.Join(names, ",") != "agentpool2" {
+		t.Fatalf("expected the agent pool to be removed from the api model, got %v", names)
+	}
+
+	ndc.agentPoolToDelete = "agentpool2"
+	if err = ndc.run(r, []string{}); err == nil || err.Error() != "node pool agentpool2 is the only agent pool of the cluster and cannot be removed" {
+		t.Fatalf("expected removing the last agent pool to fail, got %v", err)
+	}
+}
+
+func TestNodePoolDeleteCmdRunBeforeWindowsPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nodepool")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := &cobra.Command{}
+	ndc := &nodePoolDeleteCmd{
+		nodePoolCmd:       newTestNodePoolCmd(t, dir, &armhelpers.MockAKSEngineClient{}),
+		agentPoolToDelete: "AgentPool1",
+	}
+	apimodel, err := ioutil.ReadFile(path.Join(dir, apiModelFilename))
+	if err != nil {
+		t.Fatalf("unable to read test api model: %s", err)
+	}
+	apimodel = []byte(strings.Replace(string(apimodel), `"name": "agentpool2",`, `"name": "agentpool2", "osType": "Windows",`, 1))
+	apimodel = []byte(strings.Replace(string(apimodel), `"linuxProfile": {`, `"windowsProfile": {"adminUsername": "azureuser", "adminPassword": "replacepassword1234$"}, "linuxProfile": {`, 1))
+	if err = ioutil.WriteFile(path.Join(dir, apiModelFilename), apimodel, 0600); err != nil {
+		t.Fatalf("unable to write test api model: %s", err)
+	}
+
+	// the pool is found whatever the case of its name, but the Windows pool after it would be renumbered
+	if err = ndc.run(r, []string{}); err == nil || err.Error() != "node pool agentpool1 cannot be removed: the VM names of the Windows pool agentpool2 after it depend on its position in the api model" {
+		t.Fatalf("expected removing a pool before a Windows pool to fail, got %v", err)
+	}
+	if names := loadTestAgentPoolNames(t, dir); strings.Join(names, ",") != "agentpool1,agentpool2" {
+		t.Fatalf("expected the api model to be unchanged, got %v", names)
+	}
+
+	ndc.agentPoolToDelete = "AGENTPOOL2"
+	if err = ndc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error removing the last Windows pool: %s", err)
+	}
+	if names := loadTestAgentPoolNames(t, dir); strings.Join(names, ",") != "agentpool1" {
+		t.Fatalf("expected the Windows pool to be removed from the api model, got %v", names)
+	}
+}
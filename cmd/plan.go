@@ -0,0 +1,47 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/pkg/errors"
+)
+
+const (
+	templateFilename   = "azuredeploy.json"
+	parametersFilename = "azuredeploy.parameters.json"
+)
+
+// loadDeployedTemplate reads the ARM template and parameters the cluster was deployed with from the deployment directory
+func loadDeployedTemplate(deploymentDirectory string) (map[string]interface{}, map[string]interface{}, error) {
+	template := map[string]interface{}{}
+	parameters := map[string]interface{}{}
+	for name, m := range map[string]*map[string]interface{}{templateFilename: &template, parametersFilename: &parameters} {
+		contents, err := ioutil.ReadFile(path.Join(deploymentDirectory, name))
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "error reading %s", name)
+		}
+		if err = json.Unmarshal(contents, m); err != nil {
+			return nil, nil, errors.Wrapf(err, "error parsing %s", name)
+		}
+	}
+	return template, parameters, nil
+}
+
+// printPlan writes a plan as indented JSON
+func printPlan(w io.Writer, plan *operations.Plan) error {
+	b, err := helpers.JSONMarshalIndent(plan, "", "  ", false)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal plan")
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
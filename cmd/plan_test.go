@@ -0,0 +1,57 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/operations"
+)
+
+func TestLoadDeployedTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deployed-template")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, _, err = loadDeployedTemplate(dir); err == nil {
+		t.Fatalf("expected an error loading a missing template")
+	}
+
+	ioutil.WriteFile(path.Join(dir, templateFilename), []byte(`{"resources": []}`), 0600)
+	ioutil.WriteFile(path.Join(dir, parametersFilename), []byte(`{"parameters": {"foo": {"value": "bar"}}}`), 0600)
+	template, parameters, err := loadDeployedTemplate(dir)
+	if err != nil {
+		t.Fatalf("unexpected error loading the deployed template: %s", err)
+	}
+	if _, ok := template["resources"]; !ok {
+		t.Fatalf("expected the template to be loaded, got %v", template)
+	}
+	if _, ok := parameters["parameters"]; !ok {
+		t.Fatalf("expected the parameters to be loaded, got %v", parameters)
+	}
+}
+
+func TestPrintPlan(t *testing.T) {
+	plan := operations.NewPlan("scale", "Scale agent pool agentpool1 from 1 to 2 nodes", "rg")
+	plan.AddStep(operations.PlanActionCreate, "agentpool1", "k8s-agentpool1-12345678-1", "index 1")
+
+	var out bytes.Buffer
+	if err := printPlan(&out, plan); err != nil {
+		t.Fatalf("unexpected error printing plan: %s", err)
+	}
+	printed := &operations.Plan{}
+	if err := json.Unmarshal(out.Bytes(), printed); err != nil {
+		t.Fatalf("expected the plan to be printed as JSON, got %s", out.String())
+	}
+	if printed.Operation != "scale" || len(printed.Steps) != 1 || printed.Steps[0].Target != "k8s-agentpool1-12345678-1" {
+		t.Fatalf("unexpected printed plan %+v", printed)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/engine/transform"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	renderName             = "render"
+	renderShortDescription = "Print the api model merged with its overlays, variables and values"
+	renderLongDescription  = "Print the api model deploy and generate would load, once merged with its overlays, variables, values files and --set values"
+)
+
+type renderCmd struct {
+	apimodelPath   string
+	overrides      transform.APIModelOverrides
+	apiModelFormat string
+	outputFile     string
+
+	// derived
+	out io.Writer
+}
+
+func newRenderCmd() *cobra.Command {
+	rc := renderCmd{
+		out: os.Stdout,
+	}
+
+	renderCmd := &cobra.Command{
+		Use:   renderName,
+		Short: renderShortDescription,
+		Long:  renderLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := rc.validate(cmd, args); err != nil {
+				return err
+			}
+			return rc.run()
+		},
+	}
+
+	f := renderCmd.Flags()
+	f.StringVarP(&rc.apimodelPath, "api-model", "m", "", "path to the apimodel file")
+	f.StringVar(&rc.outputFile, "output-file", "", "write the api model to this file instead of stdout")
+	addAPIModelOverrideFlags(&rc.overrides, f)
+	f.StringVar(&rc.apiModelFormat, "api-model-format", api.APIModelFormatJSON, "format to write the api model in: json or yaml")
+
+	return renderCmd
+}
+
+// addAPIModelOverrideFlags adds the flags changing the api model before it is loaded
+func addAPIModelOverrideFlags(o *transform.APIModelOverrides, f *flag.FlagSet) {
+	f.StringArrayVar(&o.Overlays, "overlay", []string{}, "merge an overlay file, or the overlay of that name in the overlays directory next to the api model (can specify multiple, merged in order)")
+	f.StringArrayVar(&o.VarsFiles, "vars-file", []string{}, "substitute the variables of a JSON or YAML file for ${name} in the api model, before environment variables (can specify multiple)")
+	f.BoolVar(&o.EnvVars, "env-vars", false, "substitute the environment variables for ${name} in the api model, as strings")
+	f.StringArrayVar(&o.ValuesFiles, "values-file", []string{}, "merge the values of a JSON or YAML file before --set (can specify multiple, merged in order)")
+	f.StringArrayVar(&o.Set, "set", []string{}, "set values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	f.StringArrayVar(&o.SetJSON, "set-json", []string{}, "set values written as JSON literals on the command line (can specify multiple: key1={\"a\":1})")
+	f.StringArrayVar(&o.Unset, "unset", []string{}, "remove keys on the command line (can specify multiple)")
+}
+
+func (rc *renderCmd) validate(cmd *cobra.Command, args []string) error {
+	if rc.apimodelPath == "" {
+		if len(args) == 1 {
+			rc.apimodelPath = args[0]
+		} else if len(args) > 1 {
+			cmd.Usage()
+			return errors.New("too many arguments were provided to 'render'")
+		} else {
+			cmd.Usage()
+			return errors.New("--api-model was not supplied, nor was one specified as a positional argument")
+		}
+	}
+
+	if _, err := os.Stat(rc.apimodelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", rc.apimodelPath)
+	}
+
+	return validateAPIModelFormat(rc.apiModelFormat)
+}
+
+func (rc *renderCmd) run() error {
+	apiModel, _, err := transform.RenderAPIModel(rc.apimodelPath, &rc.overrides)
+	if err != nil {
+		return errors.Wrap(err, "error rendering the api model")
+	}
+	b, err := json.MarshalIndent(apiModel, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error serializing the api model")
+	}
+
+	// the rendered api model must load, so that unknown keys are found before deploy or generate
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{},
+	}
+	if _, _, err = apiloader.DeserializeContainerService(b, false, false, nil); err != nil {
+		return errors.Wrap(err, "error loading the rendered api model")
+	}
+
+	if b, err = api.FormatAPIModel(api.APIModelFilename(rc.apiModelFormat), append(b, '\n')); err != nil {
+		return err
+	}
+	if rc.outputFile != "" {
+		return errors.Wrap(ioutil.WriteFile(rc.outputFile, b, 0600), "error writing the api model")
+	}
+	if _, err = rc.out.Write(b); err != nil {
+		return errors.Wrap(err, "error writing output")
+	}
+	return nil
+}
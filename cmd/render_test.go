@@ -0,0 +1,103 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestNewRenderCmd(t *testing.T) {
+	output := newRenderCmd()
+	if output.Use != renderName || output.Short != renderShortDescription || output.Long != renderLongDescription {
+		t.Fatalf("render command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, renderName, output.Short, renderShortDescription, output.Long, renderLongDescription)
+	}
+	expectedFlags := []string{"api-model", "output-file", "api-model-format", "overlay", "vars-file", "env-vars", "values-file", "set", "set-json", "unset"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("render command should have flag %s", f)
+		}
+	}
+}
+
+func TestRenderCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	rc := &renderCmd{}
+	if err := rc.validate(r, []string{}); err == nil {
+		t.Fatalf("expected an error validating render without an api model")
+	}
+
+	rc = &renderCmd{}
+	if err := rc.validate(r, []string{"../pkg/engine/testdata/simple/kubernetes.json", "extra"}); err == nil {
+		t.Fatalf("expected an error validating render with too many arguments")
+	}
+
+	rc = &renderCmd{}
+	if err := rc.validate(r, []string{"../pkg/engine/testdata/simple/missing.json"}); err == nil {
+		t.Fatalf("expected an error validating render with an api model that does not exist")
+	}
+
+	rc = &renderCmd{apiModelFormat: "xml"}
+	if err := rc.validate(r, []string{"../pkg/engine/testdata/simple/kubernetes.json"}); err == nil {
+		t.Fatalf("expected an error validating render with an invalid --api-model-format")
+	}
+
+	rc = &renderCmd{}
+	if err := rc.validate(r, []string{"../pkg/engine/testdata/simple/kubernetes.json"}); err != nil {
+		t.Fatalf("unexpected error validating render: %s", err)
+	}
+	if rc.apimodelPath != "../pkg/engine/testdata/simple/kubernetes.json" {
+		t.Fatalf("expected the positional argument to be the api model, got %s", rc.apimodelPath)
+	}
+}
+
+func TestRenderCmdRun(t *testing.T) {
+	out := &bytes.Buffer{}
+	rc := &renderCmd{
+		apimodelPath: "../pkg/engine/testdata/simple/kubernetes.json",
+		out:          out,
+	}
+	rc.overrides.Set = []string{"agentPoolProfiles[name=agentpool2].count=5"}
+	if err := rc.run(); err != nil {
+		t.Fatalf("unexpected error rendering the api model: %s", err)
+	}
+	var apiModel struct {
+		Properties struct {
+			AgentPoolProfiles []struct {
+				Name  string
+				Count int
+			}
+		}
+	}
+	if err := json.Unmarshal(out.Bytes(), &apiModel); err != nil {
+		t.Fatalf("expected the rendered api model to be JSON: %s", err)
+	}
+	if len(apiModel.Properties.AgentPoolProfiles) != 2 || apiModel.Properties.AgentPoolProfiles[1].Count != 5 {
+		t.Fatalf("expected the --set value to be rendered, got %s", out.String())
+	}
+
+	out.Reset()
+	rc.apiModelFormat = "yaml"
+	if err := rc.run(); err != nil {
+		t.Fatalf("unexpected error rendering the api model as YAML: %s", err)
+	}
+	if !strings.HasPrefix(out.String(), "apiVersion: vlabs\n") {
+		t.Fatalf("expected the api model to be rendered as YAML, got %s", out.String())
+	}
+
+	// unknown keys are rejected as deploy and generate would
+	rc = &renderCmd{
+		apimodelPath: "../pkg/engine/testdata/simple/kubernetes.json",
+		out:          out,
+	}
+	rc.overrides.Set = []string{"masterProfile.vmSzie=Standard_D2_v2"}
+	if err := rc.run(); err == nil || !strings.Contains(err.Error(), "vmSzie") {
+		t.Fatalf("expected an error rendering an api model with an unknown key, got %v", err)
+	}
+}
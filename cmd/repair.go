@@ -0,0 +1,195 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/engine"
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/Azure/aks-engine/pkg/operations/kubernetesupgrade"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	repairName             = "repair"
+	repairShortDescription = "Recreate the missing and unhealthy nodes of an existing Kubernetes cluster"
+	repairLongDescription  = "Recreate the masters and availability set agents of an existing Kubernetes cluster whose VM was deleted or whose node is not Ready, at their own index so node names and etcd membership do not change. VirtualMachineScaleSets agent pools are reported as not repaired"
+)
+
+type repairCmd struct {
+	authProvider
+
+	// user input
+	resourceGroupName   string
+	deploymentDirectory string
+	location            string
+	timeoutInMinutes    int
+	dryRun              bool
+	skipHealthChecks    bool
+
+	// derived
+	containerService *api.ContainerService
+	locale           *gotext.Locale
+	client           armhelpers.AKSEngineClient
+	nameSuffix       string
+	timeout          *time.Duration
+	logger           *log.Entry
+}
+
+func newRepairCmd() *cobra.Command {
+	rc := repairCmd{
+		authProvider: &authArgs{},
+	}
+
+	repairCmd := &cobra.Command{
+		Use:   repairName,
+		Short: repairShortDescription,
+		Long:  repairLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rc.run(cmd, args)
+		},
+	}
+
+	f := repairCmd.Flags()
+	f.StringVarP(&rc.location, "location", "l", "", "location the cluster is deployed in (required)")
+	f.StringVarP(&rc.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed (required)")
+	f.StringVar(&rc.deploymentDirectory, "deployment-dir", "", "the location of the output from `generate` (required)")
+	f.IntVar(&rc.timeoutInMinutes, "vm-timeout", -1, "how long to wait for each vm to be recreated in minutes")
+	f.BoolVar(&rc.dryRun, "dry-run", false, "print the repair plan as JSON without making any changes")
+	f.BoolVar(&rc.skipHealthChecks, "skip-health-checks", false, "do not check the health of the cluster once it is repaired")
+	addAuthFlags(rc.getAuthArgs(), f)
+
+	return repairCmd
+}
+
+func (rc *repairCmd) validate(cmd *cobra.Command) error {
+	var err error
+
+	rc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if rc.resourceGroupName == "" {
+		cmd.Usage()
+		return errors.New("--resource-group must be specified")
+	}
+
+	if rc.location == "" {
+		cmd.Usage()
+		return errors.New("--location must be specified")
+	}
+	rc.location = helpers.NormalizeAzureRegion(rc.location)
+
+	if rc.deploymentDirectory == "" {
+		cmd.Usage()
+		return errors.New("--deployment-dir must be specified")
+	}
+
+	if rc.timeoutInMinutes != -1 {
+		timeout := time.Duration(rc.timeoutInMinutes) * time.Minute
+		rc.timeout = &timeout
+	}
+	return nil
+}
+
+func (rc *repairCmd) load() error {
+	var err error
+
+	rc.logger = log.New().WithField("source", "repair command line")
+
+	if err = rc.getAuthArgs().validateAuthArgs(); err != nil {
+		return err
+	}
+	if rc.client, err = rc.authProvider.getClient(); err != nil {
+		return errors.Wrap(err, "failed to get client")
+	}
+
+	apiModelPath := api.FindAPIModelFile(rc.deploymentDirectory)
+	if _, err = os.Stat(apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", apiModelPath)
+	}
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: rc.locale,
+		},
+		KeyVaultClient: rc.client,
+	}
+	rc.containerService, _, err = apiloader.LoadContainerServiceFromFile(apiModelPath, true, true, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+
+	if rc.containerService.Location == "" {
+		rc.containerService.Location = rc.location
+	} else if rc.containerService.Location != rc.location {
+		return errors.New("--location does not match api model location")
+	}
+
+	if rc.containerService.Properties.OrchestratorProfile == nil || !rc.containerService.Properties.OrchestratorProfile.IsKubernetes() {
+		return errors.New("only Kubernetes clusters can be repaired")
+	}
+
+	template, _, err := loadDeployedTemplate(rc.deploymentDirectory)
+	if err != nil {
+		return err
+	}
+	if rc.nameSuffix, err = templateNameSuffix(template); err != nil {
+		return err
+	}
+	// the VM names of the recreated nodes are derived from the cluster ID
+	rc.containerService.Properties.ClusterID = rc.nameSuffix
+	return nil
+}
+
+func (rc *repairCmd) run(cmd *cobra.Command, args []string) error {
+	if err := rc.validate(cmd); err != nil {
+		return errors.Wrap(err, "failed to validate repair command")
+	}
+	if err := rc.load(); err != nil {
+		return errors.Wrap(err, "failed to load existing container service")
+	}
+
+	repairCluster := kubernetesupgrade.UpgradeCluster{
+		Translator: &i18n.Translator{
+			Locale: rc.locale,
+		},
+		Logger:      rc.logger,
+		Client:      rc.client,
+		StepTimeout: rc.timeout,
+	}
+	repairCluster.ClusterTopology = kubernetesupgrade.ClusterTopology{}
+	repairCluster.SubscriptionID = rc.getAuthArgs().SubscriptionID.String()
+	repairCluster.ResourceGroup = rc.resourceGroupName
+	repairCluster.DataModel = rc.containerService
+	repairCluster.NameSuffix = rc.nameSuffix
+	if rc.skipHealthChecks {
+		repairCluster.HealthChecks = []operations.HealthCheck{}
+	}
+
+	kubeConfig, err := engine.GenerateKubeConfig(rc.containerService.Properties, rc.location)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate kube config")
+	}
+
+	if rc.dryRun {
+		plan, err := repairCluster.PlanRepair(rc.client, kubeConfig, BuildTag)
+		if err != nil {
+			return errors.Wrap(err, "error planning repair")
+		}
+		return printPlan(cmd.OutOrStdout(), plan)
+	}
+
+	return errors.Wrap(repairCluster.RepairCluster(rc.client, kubeConfig, BuildTag), "error repairing cluster")
+}
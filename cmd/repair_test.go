@@ -0,0 +1,147 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewRepairCmd(t *testing.T) {
+	output := newRepairCmd()
+	if output.Use != repairName || output.Short != repairShortDescription || output.Long != repairLongDescription {
+		t.Fatalf("repair command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, repairName, output.Short, repairShortDescription, output.Long, repairLongDescription)
+	}
+
+	expectedFlags := []string{"location", "resource-group", "deployment-dir", "vm-timeout", "dry-run", "skip-health-checks", "subscription-id"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("repair command should have flag %s", f)
+		}
+	}
+}
+
+func TestRepairCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		rc          *repairCmd
+		expectedErr error
+	}{
+		{
+			rc: &repairCmd{
+				location:            "centralus",
+				deploymentDirectory: "_output/test",
+				timeoutInMinutes:    -1,
+			},
+			expectedErr: errors.New("--resource-group must be specified"),
+		},
+		{
+			rc: &repairCmd{
+				resourceGroupName:   "testRG",
+				deploymentDirectory: "_output/test",
+				timeoutInMinutes:    -1,
+			},
+			expectedErr: errors.New("--location must be specified"),
+		},
+		{
+			rc: &repairCmd{
+				resourceGroupName: "testRG",
+				location:          "centralus",
+				timeoutInMinutes:  -1,
+			},
+			expectedErr: errors.New("--deployment-dir must be specified"),
+		},
+		{
+			rc: &repairCmd{
+				resourceGroupName:   "testRG",
+				location:            "centralus",
+				deploymentDirectory: "_output/test",
+				timeoutInMinutes:    -1,
+			},
+			expectedErr: nil,
+		},
+	}
+
+	for _, c := range cases {
+		err := c.rc.validate(r)
+		if err != nil && c.expectedErr != nil {
+			if err.Error() != c.expectedErr.Error() {
+				t.Fatalf("expected validate repair command to return error %s, but instead got %s", c.expectedErr.Error(), err.Error())
+			}
+		} else {
+			if c.expectedErr != nil {
+				t.Fatalf("expected validate repair command to return error %s, but instead got no error", c.expectedErr.Error())
+			} else if err != nil {
+				t.Fatalf("expected validate repair command to return no error, but instead got %s", err.Error())
+			}
+		}
+	}
+}
+
+func TestRepairCmdDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repair")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the mock client lists the VM k8s-agentpool1-12345678-0, whose node is not Ready
+	node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "k8s-agentpool1-12345678-0"}}
+	node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+	client := &armhelpers.MockAKSEngineClient{
+		MockKubernetesClient: &armhelpers.MockKubernetesClient{NodesList: &v1.NodeList{Items: []v1.Node{node}}},
+		FailDeployTemplate:   true,
+	}
+
+	writeTestDeployment(t, dir)
+	rc := &repairCmd{
+		authProvider:        newTestAuthProvider(client),
+		location:            "westus",
+		resourceGroupName:   "testRG",
+		deploymentDirectory: dir,
+		timeoutInMinutes:    -1,
+		dryRun:              true,
+	}
+	out := &bytes.Buffer{}
+	r := &cobra.Command{}
+	r.SetOutput(out)
+	if err = rc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error planning the repair: %s", err)
+	}
+
+	plan := operations.Plan{}
+	if err = json.Unmarshal(out.Bytes(), &plan); err != nil {
+		t.Fatalf("unable to parse the repair plan: %s", err)
+	}
+	expected := []operations.PlanStep{
+		{Action: operations.PlanActionCreate, Pool: "master", Target: "k8s-master-12345678-0", Detail: "index 0"},
+		{Action: operations.PlanActionDrain, Pool: "agentpool1", Target: "k8s-agentpool1-12345678-0"},
+		{Action: operations.PlanActionDelete, Pool: "agentpool1", Target: "k8s-agentpool1-12345678-0"},
+		{Action: operations.PlanActionCreate, Pool: "agentpool1", Target: "k8s-agentpool1-12345678-0", Detail: "index 0"},
+		{Action: operations.PlanActionCreate, Pool: "agentpool1", Target: "k8s-agentpool1-12345678-1", Detail: "index 1"},
+		{Action: operations.PlanActionCreate, Pool: "agentpool1", Target: "k8s-agentpool1-12345678-2", Detail: "index 2"},
+		{Action: operations.PlanActionCreate, Pool: "agentpool2", Target: "k8s-agentpool2-12345678-0", Detail: "index 0"},
+		{Action: operations.PlanActionCreate, Pool: "agentpool2", Target: "k8s-agentpool2-12345678-1", Detail: "index 1"},
+		{Action: operations.PlanActionCreate, Pool: "agentpool2", Target: "k8s-agentpool2-12345678-2", Detail: "index 2"},
+	}
+	if len(plan.Steps) != len(expected) {
+		t.Fatalf("expected %d steps, got %v", len(expected), plan.Steps)
+	}
+	for i, step := range expected {
+		if plan.Steps[i] != step {
+			t.Fatalf("expected step %d to be %v, got %v", i, step, plan.Steps[i])
+		}
+	}
+}
@@ -64,6 +64,20 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(newOrchestratorsCmd())
 	rootCmd.AddCommand(newUpgradeCmd())
 	rootCmd.AddCommand(newScaleCmd())
+	rootCmd.AddCommand(newRotateCertsCmd())
+	rootCmd.AddCommand(newValidateCmd())
+	rootCmd.AddCommand(newDiffCmd())
+	rootCmd.AddCommand(newEtcdCmd())
+	rootCmd.AddCommand(newGetLogsCmd())
+	rootCmd.AddCommand(newNodePoolCmd())
+	rootCmd.AddCommand(newDeleteCmd())
+	rootCmd.AddCommand(newGetKubeConfigCmd())
+	rootCmd.AddCommand(newStatusCmd())
+	rootCmd.AddCommand(newRepairCmd())
+	rootCmd.AddCommand(newExportCmd())
+	rootCmd.AddCommand(newConvertCmd())
+	rootCmd.AddCommand(newSchemaCmd())
+	rootCmd.AddCommand(newRenderCmd())
 	rootCmd.AddCommand(getCompletionCmd(rootCmd))
 
 	return rootCmd
@@ -0,0 +1,542 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/engine"
+	"github.com/Azure/aks-engine/pkg/engine/transform"
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/Azure/aks-engine/pkg/operations/kubernetesupgrade"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	rotateCertsName             = "rotate-certs"
+	rotateCertsShortDescription = "Rotate the certificates of an existing Kubernetes cluster"
+	rotateCertsLongDescription  = "Regenerate the CA, apiserver, client and etcd certificates of an existing Kubernetes cluster and roll them onto every node"
+)
+
+const (
+	// remoteCertsDir is the location of the cluster PKI on every Linux node
+	remoteCertsDir = "/etc/kubernetes/certs"
+	// remoteKubeletKubeConfig is a node-local kubeconfig authenticated with the cluster client certificate
+	remoteKubeletKubeConfig = "/var/lib/kubelet/kubeconfig"
+	// rotateCertsRetryInterval is how often the apiserver is polled while the cluster restarts
+	rotateCertsRetryInterval = 10 * time.Second
+)
+
+// masterSSHPorts are the load balancer NAT ports that forward to each master's SSH port, by master index
+var masterSSHPorts = []int{22, 2201, 2202, 2203, 2204}
+
+type rotateCertsCmd struct {
+	authProvider
+
+	// user input
+	resourceGroupName   string
+	deploymentDirectory string
+	location            string
+	sshKeyPath          string
+
+	// derived
+	containerService *api.ContainerService
+	apiVersion       string
+	apiModelPath     string
+	locale           *gotext.Locale
+	client           armhelpers.AKSEngineClient
+	kubeClient       armhelpers.KubernetesClient
+	sshRunner        operations.RemoteRunner
+	masterFQDN       string
+	logger           *log.Entry
+	template         string
+	parameters       string
+}
+
+// certFile is a single PKI asset as installed on a node
+type certFile struct {
+	name    string
+	content string
+	private bool
+	owner   string
+}
+
+func newRotateCertsCmd() *cobra.Command {
+	rcc := rotateCertsCmd{
+		authProvider: &authArgs{},
+	}
+
+	rotateCertsCmd := &cobra.Command{
+		Use:   rotateCertsName,
+		Short: rotateCertsShortDescription,
+		Long:  rotateCertsLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rcc.run(cmd, args)
+		},
+	}
+
+	f := rotateCertsCmd.Flags()
+	f.StringVarP(&rcc.location, "location", "l", "", "location the cluster is deployed in (required)")
+	f.StringVarP(&rcc.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed (required)")
+	f.StringVar(&rcc.deploymentDirectory, "deployment-dir", "", "the location of the output from `generate` (required)")
+	f.StringVar(&rcc.sshKeyPath, "ssh-key-path", "", "path to the private key used to SSH into the cluster nodes (defaults to <adminUsername>_rsa in the deployment directory)")
+	addAuthFlags(rcc.getAuthArgs(), f)
+
+	return rotateCertsCmd
+}
+
+func (rcc *rotateCertsCmd) validate(cmd *cobra.Command) error {
+	var err error
+
+	rcc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if rcc.resourceGroupName == "" {
+		cmd.Usage()
+		return errors.New("--resource-group must be specified")
+	}
+
+	if rcc.location == "" {
+		cmd.Usage()
+		return errors.New("--location must be specified")
+	}
+	rcc.location = helpers.NormalizeAzureRegion(rcc.location)
+
+	if rcc.deploymentDirectory == "" {
+		cmd.Usage()
+		return errors.New("--deployment-dir must be specified")
+	}
+
+	return nil
+}
+
+func (rcc *rotateCertsCmd) loadCluster() error {
+	var err error
+
+	rcc.logger = log.New().WithField("source", "rotate-certs command line")
+
+	rcc.apiModelPath = api.FindAPIModelFile(rcc.deploymentDirectory)
+	if _, err = os.Stat(rcc.apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", rcc.apiModelPath)
+	}
+
+	if err = rcc.getAuthArgs().validateAuthArgs(); err != nil {
+		return err
+	}
+	if rcc.client, err = rcc.authProvider.getClient(); err != nil {
+		return errors.Wrap(err, "failed to get client")
+	}
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: rcc.locale,
+		},
+		KeyVaultClient: rcc.client,
+	}
+	rcc.containerService, rcc.apiVersion, err = apiloader.LoadContainerServiceFromFile(rcc.apiModelPath, true, true, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+
+	if rcc.containerService.Location == "" {
+		rcc.containerService.Location = rcc.location
+	} else if rcc.containerService.Location != rcc.location {
+		return errors.New("--location does not match api model location")
+	}
+
+	properties := rcc.containerService.Properties
+	if !properties.OrchestratorProfile.IsKubernetes() || properties.MasterProfile == nil {
+		return errors.New("rotate-certs is only supported for Kubernetes clusters with a master profile")
+	}
+	if properties.MasterProfile.IsVirtualMachineScaleSets() {
+		return errors.New("rotate-certs is not supported for clusters with VirtualMachineScaleSets masters")
+	}
+	if properties.MasterProfile.Count > len(masterSSHPorts) {
+		return errors.Errorf("rotate-certs supports at most %d masters", len(masterSSHPorts))
+	}
+	if properties.LinuxProfile == nil {
+		return errors.New("rotate-certs requires a linuxProfile to SSH into the cluster nodes")
+	}
+	// Windows nodes cannot be reached over SSH, and would lose trust in the apiserver once the CA is replaced
+	if properties.HasWindows() {
+		return errors.New("rotate-certs is not supported for clusters with Windows agent pools")
+	}
+	rcc.masterFQDN = api.FormatAzureProdFQDNByLocation(properties.MasterProfile.DNSPrefix, rcc.location)
+
+	if rcc.sshRunner == nil {
+		if rcc.sshRunner, err = newSSHRemoteRunner(properties.LinuxProfile, rcc.deploymentDirectory, rcc.sshKeyPath); err != nil {
+			return err
+		}
+	}
+
+	// the current certificates are needed to talk to the cluster before it is rotated
+	kubeConfig, err := engine.GenerateKubeConfig(properties, rcc.location)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate kube config")
+	}
+	rcc.kubeClient, err = rcc.client.GetKubernetesClient("https://"+rcc.masterFQDN, kubeConfig, rotateCertsRetryInterval, armhelpers.DefaultARMOperationTimeout)
+	if err != nil {
+		return errors.Wrap(err, "failed to get a Kubernetes client")
+	}
+
+	return nil
+}
+
+func (rcc *rotateCertsCmd) run(cmd *cobra.Command, args []string) error {
+	if err := rcc.validate(cmd); err != nil {
+		return errors.Wrap(err, "failed to validate rotate-certs command")
+	}
+	if err := rcc.loadCluster(); err != nil {
+		return errors.Wrap(err, "failed to load existing container service")
+	}
+
+	masters := rcc.getMasterHosts()
+	agents, err := rcc.getAgentHosts(masters[0])
+	if err != nil {
+		return err
+	}
+
+	if err := rcc.backupAPIModel(); err != nil {
+		return err
+	}
+	if err := rcc.rotateCerts(); err != nil {
+		return err
+	}
+	if err := rcc.distributeCerts(masters, agents); err != nil {
+		return err
+	}
+	// the api model is only written once every node has the new certificates,
+	// so that it still matches the cluster if the distribution fails
+	if err := rcc.writeArtifacts(); err != nil {
+		return err
+	}
+	if err := rcc.restartCluster(masters, agents); err != nil {
+		return err
+	}
+
+	rcc.logger.Infof("Successfully rotated the certificates of %d masters and %d agents", len(masters), len(agents))
+	return nil
+}
+
+// getMasterHosts returns the SSH endpoints of every master, in index order
+func (rcc *rotateCertsCmd) getMasterHosts() []*operations.RemoteHost {
+	return masterHosts(rcc.masterFQDN, rcc.containerService.Properties.MasterProfile.Count)
+}
+
+// getAgentHosts returns the SSH endpoints of the agent nodes, reached through the given master
+func (rcc *rotateCertsCmd) getAgentHosts(jumpbox *operations.RemoteHost) (map[string]*operations.RemoteHost, error) {
+	nodes, err := rcc.kubeClient.ListNodes()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the cluster nodes")
+	}
+
+	agents := make(map[string]*operations.RemoteHost)
+	for _, node := range nodes.Items {
+		if strings.HasPrefix(node.Name, kubernetesupgrade.MasterVMNamePrefix) {
+			continue
+		}
+		if strings.EqualFold(node.Status.NodeInfo.OperatingSystem, "windows") {
+			return nil, errors.Errorf("node %s runs Windows, rotate-certs is not supported for clusters with Windows nodes", node.Name)
+		}
+		var addr string
+		for _, a := range node.Status.Addresses {
+			if a.Type == v1.NodeInternalIP {
+				addr = a.Address
+				break
+			}
+		}
+		if addr == "" {
+			return nil, errors.Errorf("node %s does not report an internal IP address", node.Name)
+		}
+		agents[node.Name] = &operations.RemoteHost{Addr: addr, Port: 22, Jumpbox: jumpbox}
+	}
+	return agents, nil
+}
+
+func (rcc *rotateCertsCmd) backupAPIModel() error {
+	b, err := ioutil.ReadFile(rcc.apiModelPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to read the api model")
+	}
+	f := helpers.FileSaver{
+		Translator: &i18n.Translator{
+			Locale: rcc.locale,
+		},
+	}
+	// the backup holds the api model as it was before the last certificate rotation, in the same format
+	if err = f.SaveFile(rcc.deploymentDirectory, path.Base(rcc.apiModelPath)+".bak", b); err != nil {
+		return err
+	}
+
+	// the certificates of an api model whose secrets are kept out of it are in its secrets manifest
+	b, err = ioutil.ReadFile(path.Join(rcc.deploymentDirectory, api.SecretsFilename))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "failed to read the api model secrets")
+	}
+	return f.SaveFile(rcc.deploymentDirectory, api.SecretsFilename+".bak", b)
+}
+
+// rotateCerts replaces the whole CertificateProfile with a freshly generated PKI and generates
+// the ARM template matching it
+func (rcc *rotateCertsCmd) rotateCerts() error {
+	ctx := engine.Context{
+		Translator: &i18n.Translator{
+			Locale: rcc.locale,
+		},
+	}
+	templateGenerator, err := engine.InitializeTemplateGenerator(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize template generator")
+	}
+	if _, err = rcc.containerService.SetPropertiesDefaults(false, true); err != nil {
+		return errors.Wrapf(err, "error in SetPropertiesDefaults template %s", rcc.apiModelPath)
+	}
+
+	// the whole PKI is replaced, including the CA, so every certificate is signed again
+	rcc.logger.Info("Generating new certificates")
+	rcc.containerService.Properties.CertificateProfile = &api.CertificateProfile{}
+	if _, err = rcc.containerService.SetDefaultCerts(); err != nil {
+		return errors.Wrap(err, "failed to generate new certificates")
+	}
+
+	template, parameters, err := templateGenerator.GenerateTemplate(rcc.containerService, engine.DefaultGeneratorCode, BuildTag)
+	if err != nil {
+		return errors.Wrapf(err, "error generating template %s", rcc.apiModelPath)
+	}
+	if template, err = transform.PrettyPrintArmTemplate(template); err != nil {
+		return errors.Wrap(err, "error pretty printing template")
+	}
+	if parameters, err = transform.BuildAzureParametersFile(parameters); err != nil {
+		return errors.Wrap(err, "error pretty printing template parameters")
+	}
+	rcc.template, rcc.parameters = template, parameters
+	return nil
+}
+
+// writeArtifacts writes the updated apimodel, ARM template, certificates and kubeconfigs to the deployment directory
+func (rcc *rotateCertsCmd) writeArtifacts() error {
+	writer := &engine.ArtifactWriter{
+		Translator: &i18n.Translator{
+			Locale: rcc.locale,
+		},
+		KeyVaultClient: rcc.client,
+	}
+	if api.IsYAMLFile(rcc.apiModelPath) {
+		writer.APIModelFormat = api.APIModelFormatYAML
+	}
+	if err := writer.WriteTLSArtifacts(rcc.containerService, rcc.apiVersion, rcc.template, rcc.parameters, rcc.deploymentDirectory, true, false); err != nil {
+		return errors.Wrap(err, "error writing artifacts")
+	}
+	return nil
+}
+
+func (rcc *rotateCertsCmd) masterCertFiles(index int) []certFile {
+	cp := rcc.containerService.Properties.CertificateProfile
+	return []certFile{
+		{name: "ca.crt", content: cp.CaCertificate},
+		{name: "ca.key", content: cp.CaPrivateKey, private: true},
+		{name: "apiserver.crt", content: cp.APIServerCertificate},
+		{name: "apiserver.key", content: cp.APIServerPrivateKey, private: true},
+		{name: "client.crt", content: cp.ClientCertificate},
+		{name: "client.key", content: cp.ClientPrivateKey, private: true},
+		{name: "etcdserver.crt", content: cp.EtcdServerCertificate},
+		{name: "etcdserver.key", content: cp.EtcdServerPrivateKey, private: true, owner: "etcd"},
+		{name: "etcdclient.crt", content: cp.EtcdClientCertificate},
+		{name: "etcdclient.key", content: cp.EtcdClientPrivateKey, private: true},
+		{name: fmt.Sprintf("etcdpeer%d.crt", index), content: cp.EtcdPeerCertificates[index]},
+		{name: fmt.Sprintf("etcdpeer%d.key", index), content: cp.EtcdPeerPrivateKeys[index], private: true, owner: "etcd"},
+	}
+}
+
+func (rcc *rotateCertsCmd) agentCertFiles() []certFile {
+	cp := rcc.containerService.Properties.CertificateProfile
+	return []certFile{
+		{name: "ca.crt", content: cp.CaCertificate},
+		{name: "apiserver.crt", content: cp.APIServerCertificate},
+		{name: "client.crt", content: cp.ClientCertificate},
+		{name: "client.key", content: cp.ClientPrivateKey, private: true},
+	}
+}
+
+// certsArchive returns the archive of the certificate files, extracted on the node by installCertsCommand
+func certsArchive(files []certFile) (*bytes.Buffer, error) {
+	remoteFiles := []operations.RemoteFile{}
+	for _, f := range files {
+		mode := int64(0644)
+		if f.private {
+			mode = 0600
+		}
+		remoteFiles = append(remoteFiles, operations.RemoteFile{Name: f.name, Content: f.content, Mode: mode})
+	}
+	return operations.FilesArchive(remoteFiles)
+}
+
+// installCertsCommand returns a shell command that backs up the current PKI of a node, stages the new files
+// extracted from the archive read on its standard input and then moves them into place together
+func installCertsCommand(files []certFile) string {
+	staging := remoteCertsDir + "/.rotate"
+	cmds := []string{
+		// the PKI of the previous rotation is replaced, cp would otherwise copy into the existing backup
+		fmt.Sprintf("sudo rm -rf %s.bak", remoteCertsDir),
+		fmt.Sprintf("sudo cp -a %s %s.bak", remoteCertsDir, remoteCertsDir),
+		fmt.Sprintf("sudo rm -rf %s", staging),
+		fmt.Sprintf("sudo mkdir -p %s", staging),
+		fmt.Sprintf("sudo tar -xf - -C %s --no-same-owner", staging),
+	}
+	for _, f := range files {
+		if f.owner != "" {
+			// the etcd user does not exist when etcd is backed by Cosmos DB
+			owner := fmt.Sprintf("$(id -u %s > /dev/null 2>&1 && echo %s || echo root)", f.owner, f.owner)
+			cmds = append(cmds, fmt.Sprintf("sudo chown %s:%s %s", owner, owner, path.Join(staging, f.name)))
+		}
+	}
+	cmds = append(cmds,
+		fmt.Sprintf("sudo mv -f %s/* %s/", staging, remoteCertsDir),
+		fmt.Sprintf("sudo rm -rf %s", staging))
+	return strings.Join(cmds, " && ")
+}
+
+// installCerts runs installCertsCommand on host with the archive of the files as its standard input
+func (rcc *rotateCertsCmd) installCerts(host *operations.RemoteHost, files []certFile) error {
+	archive, err := certsArchive(files)
+	if err != nil {
+		return err
+	}
+	_, err = rcc.sshRunner.RunCommandWithInput(host, installCertsCommand(files), archive)
+	return err
+}
+
+func (rcc *rotateCertsCmd) distributeCerts(masters []*operations.RemoteHost, agents map[string]*operations.RemoteHost) error {
+	for i, host := range masters {
+		rcc.logger.Infof("Installing new certificates on master %d (%s)", i, host)
+		if err := rcc.installCerts(host, rcc.masterCertFiles(i)); err != nil {
+			return errors.Wrapf(err, "failed to install certificates on master %d", i)
+		}
+	}
+	for _, name := range sortedHostNames(agents) {
+		rcc.logger.Infof("Installing new certificates on agent %s", name)
+		if err := rcc.installCerts(agents[name], rcc.agentCertFiles()); err != nil {
+			return errors.Wrapf(err, "failed to install certificates on agent %s", name)
+		}
+	}
+	return nil
+}
+
+// restartCluster restarts the cluster components so they pick up the new certificates.
+// etcd members are restarted together since peers signed by different CAs cannot talk to each other,
+// then the control plane is restarted one master at a time, then the agents' kubelets.
+func (rcc *rotateCertsCmd) restartCluster(masters []*operations.RemoteHost, agents map[string]*operations.RemoteHost) error {
+	rcc.logger.Info("Restarting etcd on all masters")
+	errChan := make(chan error, len(masters))
+	for i, host := range masters {
+		go func(i int, host *operations.RemoteHost) {
+			_, err := rcc.sshRunner.RunCommand(host, "sudo systemctl restart etcd")
+			errChan <- errors.Wrapf(err, "failed to restart etcd on master %d", i)
+		}(i, host)
+	}
+	for range masters {
+		if err := <-errChan; err != nil {
+			return err
+		}
+	}
+
+	restartControlPlane := strings.Join([]string{
+		"sudo systemctl restart kubelet",
+		"for c in kube-apiserver kube-controller-manager kube-scheduler kube-addon-manager; do sudo docker ps -q --filter name=k8s_${c} | xargs -r sudo docker restart; done",
+		fmt.Sprintf("for i in $(seq 1 60); do sudo kubectl --kubeconfig %s get --raw /healthz && break; sleep 5; done", remoteKubeletKubeConfig),
+	}, " && ")
+	for i, host := range masters {
+		rcc.logger.Infof("Restarting the control plane on master %d", i)
+		if _, err := rcc.sshRunner.RunCommand(host, restartControlPlane); err != nil {
+			return errors.Wrapf(err, "failed to restart the control plane on master %d", i)
+		}
+	}
+
+	for _, name := range sortedHostNames(agents) {
+		rcc.logger.Infof("Restarting kubelet on agent %s", name)
+		if _, err := rcc.sshRunner.RunCommand(agents[name], "sudo systemctl restart kubelet"); err != nil {
+			return errors.Wrapf(err, "failed to restart kubelet on agent %s", name)
+		}
+	}
+
+	// service account tokens are signed with the apiserver key, so they have to be reissued
+	rcc.logger.Info("Deleting service account tokens and kube-system pods so they are recreated with the new certificates")
+	kubectl := fmt.Sprintf("sudo kubectl --kubeconfig %s", remoteKubeletKubeConfig)
+	refreshTokens := strings.Join([]string{
+		fmt.Sprintf("%s get secrets --all-namespaces --field-selector type=kubernetes.io/service-account-token -o jsonpath='{range .items[*]}{.metadata.namespace} {.metadata.name}{\"\\n\"}{end}' | while read ns name; do %s delete secret -n $ns $name; done", kubectl, kubectl),
+		fmt.Sprintf("%s delete pods -n kube-system --all --wait=false", kubectl),
+	}, " && ")
+	if _, err := rcc.sshRunner.RunCommand(masters[0], refreshTokens); err != nil {
+		return errors.Wrap(err, "failed to reissue service account tokens")
+	}
+
+	return rcc.waitForNodesReady(len(masters) + len(agents))
+}
+
+func (rcc *rotateCertsCmd) waitForNodesReady(expected int) error {
+	kubeConfig, err := engine.GenerateKubeConfig(rcc.containerService.Properties, rcc.location)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate kube config")
+	}
+	client, err := rcc.client.GetKubernetesClient("https://"+rcc.masterFQDN, kubeConfig, rotateCertsRetryInterval, armhelpers.DefaultARMOperationTimeout)
+	if err != nil {
+		return errors.Wrap(err, "failed to get a Kubernetes client with the new certificates")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	for {
+		nodes, err := client.ListNodes()
+		if err == nil {
+			ready := 0
+			for _, node := range nodes.Items {
+				for _, c := range node.Status.Conditions {
+					if c.Type == v1.NodeReady && c.Status == v1.ConditionTrue {
+						ready++
+					}
+				}
+			}
+			if ready >= expected {
+				return nil
+			}
+			rcc.logger.Infof("%d of %d nodes are ready", ready, expected)
+		} else {
+			rcc.logger.Infof("Waiting for the apiserver to accept the new certificates: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return errors.New("timed out waiting for nodes to become ready with the new certificates")
+		case <-time.After(rotateCertsRetryInterval):
+		}
+	}
+}
+
+func sortedHostNames(hosts map[string]*operations.RemoteHost) []string {
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
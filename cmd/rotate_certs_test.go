@@ -0,0 +1,318 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeRemoteRunner records the commands run on every host instead of connecting to it.
+// Commands containing a key of outputs return its value. The standard input of the commands is kept in inputs, in order.
+type fakeRemoteRunner struct {
+	mu       sync.Mutex
+	commands map[string][]string
+	inputs   map[string][][]byte
+	outputs  map[string]string
+	failOn   string
+}
+
+func (r *fakeRemoteRunner) RunCommand(host *operations.RemoteHost, cmd string) (string, error) {
+	return r.RunCommandWithInput(host, cmd, nil)
+}
+
+func (r *fakeRemoteRunner) RunCommandWithInput(host *operations.RemoteHost, cmd string, stdin io.Reader) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.commands == nil {
+		r.commands = make(map[string][]string)
+		r.inputs = make(map[string][][]byte)
+	}
+	r.commands[host.String()] = append(r.commands[host.String()], cmd)
+	if stdin != nil {
+		b, _ := ioutil.ReadAll(stdin)
+		r.inputs[host.String()] = append(r.inputs[host.String()], b)
+	}
+	if r.failOn != "" && strings.Contains(cmd, r.failOn) {
+		return "", errors.Errorf("command failed on %s", host)
+	}
+	for k, out := range r.outputs {
+		if strings.Contains(cmd, k) {
+			return out, nil
+		}
+	}
+	return "", nil
+}
+
+func readyNode(name, internalIP, os string) v1.Node {
+	return v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			NodeInfo:   v1.NodeSystemInfo{OperatingSystem: os},
+			Addresses:  []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: internalIP}},
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+		},
+	}
+}
+
+func TestNewRotateCertsCmd(t *testing.T) {
+	output := newRotateCertsCmd()
+	if output.Use != rotateCertsName || output.Short != rotateCertsShortDescription || output.Long != rotateCertsLongDescription {
+		t.Fatalf("rotate-certs command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, rotateCertsName, output.Short, rotateCertsShortDescription, output.Long, rotateCertsLongDescription)
+	}
+
+	expectedFlags := []string{"location", "resource-group", "deployment-dir", "ssh-key-path", "subscription-id"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("rotate-certs command should have flag %s", f)
+		}
+	}
+}
+
+func TestRotateCertsCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		rcc         *rotateCertsCmd
+		expectedErr error
+	}{
+		{
+			rcc: &rotateCertsCmd{
+				location:            "centralus",
+				deploymentDirectory: "_output/test",
+			},
+			expectedErr: errors.New("--resource-group must be specified"),
+		},
+		{
+			rcc: &rotateCertsCmd{
+				resourceGroupName:   "testRG",
+				deploymentDirectory: "_output/test",
+			},
+			expectedErr: errors.New("--location must be specified"),
+		},
+		{
+			rcc: &rotateCertsCmd{
+				location:          "centralus",
+				resourceGroupName: "testRG",
+			},
+			expectedErr: errors.New("--deployment-dir must be specified"),
+		},
+		{
+			rcc: &rotateCertsCmd{
+				location:            "centralus",
+				resourceGroupName:   "testRG",
+				deploymentDirectory: "_output/test",
+			},
+			expectedErr: nil,
+		},
+	}
+
+	for _, c := range cases {
+		err := c.rcc.validate(r)
+		if err != nil && c.expectedErr != nil {
+			if err.Error() != c.expectedErr.Error() {
+				t.Fatalf("expected validate rotate-certs command to return error %s, but instead got %s", c.expectedErr.Error(), err.Error())
+			}
+		} else {
+			if c.expectedErr != nil {
+				t.Fatalf("expected validate rotate-certs command to return error %s, but instead got no error", c.expectedErr.Error())
+			} else if err != nil {
+				t.Fatalf("expected validate rotate-certs command to return no error, but instead got %s", err.Error())
+			}
+		}
+	}
+}
+
+// archivedFiles returns the contents and modes of the files in a tar archive, by name
+func archivedFiles(t *testing.T, b []byte) (map[string]string, map[string]int64) {
+	contents, modes := map[string]string{}, map[string]int64{}
+	tr := tar.NewReader(bytes.NewReader(b))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to read the archive: %s", err)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("unable to read %s from the archive: %s", header.Name, err)
+		}
+		contents[header.Name] = string(content)
+		modes[header.Name] = header.Mode
+	}
+	return contents, modes
+}
+
+func TestInstallCertsCommand(t *testing.T) {
+	files := []certFile{
+		{name: "ca.crt", content: "cacertificate"},
+		{name: "etcdserver.key", content: "etcdserverkey", private: true, owner: "etcd"},
+	}
+	cmd := installCertsCommand(files)
+
+	for _, expected := range []string{
+		"sudo rm -rf /etc/kubernetes/certs.bak && sudo cp -a /etc/kubernetes/certs /etc/kubernetes/certs.bak",
+		"sudo tar -xf - -C /etc/kubernetes/certs/.rotate --no-same-owner",
+		"echo etcd || echo root):$(id -u etcd > /dev/null 2>&1 && echo etcd || echo root) /etc/kubernetes/certs/.rotate/etcdserver.key",
+		"sudo mv -f /etc/kubernetes/certs/.rotate/* /etc/kubernetes/certs/",
+	} {
+		if !strings.Contains(cmd, expected) {
+			t.Fatalf("expected install command to contain %q, got %s", expected, cmd)
+		}
+	}
+	if strings.Contains(cmd, "cacertificate") || strings.Contains(cmd, "etcdserverkey") {
+		t.Fatalf("expected install command not to contain the file contents, got %s", cmd)
+	}
+
+	archive, err := certsArchive(files)
+	if err != nil {
+		t.Fatalf("unexpected error archiving the certificates: %s", err)
+	}
+	contents, modes := archivedFiles(t, archive.Bytes())
+	if contents["ca.crt"] != "cacertificate" || modes["ca.crt"] != 0644 {
+		t.Fatalf("expected ca.crt to be archived readable by everyone, got %q (%o)", contents["ca.crt"], modes["ca.crt"])
+	}
+	if contents["etcdserver.key"] != "etcdserverkey" || modes["etcdserver.key"] != 0600 {
+		t.Fatalf("expected etcdserver.key to be archived readable by its owner only, got %q (%o)", contents["etcdserver.key"], modes["etcdserver.key"])
+	}
+}
+
+func TestRotateCertsCmdRun(t *testing.T) {
+	outdir, err := ioutil.TempDir("", "rotate-certs")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(outdir)
+
+	apimodel, err := ioutil.ReadFile("../pkg/engine/testdata/simple/kubernetes.json")
+	if err != nil {
+		t.Fatalf("unable to read test api model: %s", err)
+	}
+	if err = ioutil.WriteFile(path.Join(outdir, apiModelFilename), apimodel, 0600); err != nil {
+		t.Fatalf("unable to write test api model: %s", err)
+	}
+
+	client := &armhelpers.MockAKSEngineClient{
+		MockKubernetesClient: &armhelpers.MockKubernetesClient{
+			NodesList: &v1.NodeList{
+				Items: []v1.Node{
+					readyNode("k8s-master-12345678-0", "10.255.255.5", "linux"),
+					readyNode("k8s-agentpool1-12345678-0", "10.240.0.4", "linux"),
+				},
+			},
+		},
+	}
+	runner := &fakeRemoteRunner{}
+	rcc := &rotateCertsCmd{
+		authProvider: &mockAuthProvider{
+			authArgs:      &authArgs{},
+			getClientMock: client,
+		},
+		location:            "westus",
+		resourceGroupName:   "testRG",
+		deploymentDirectory: outdir,
+		sshRunner:           runner,
+	}
+	r := &cobra.Command{}
+	addAuthFlags(rcc.getAuthArgs(), r.Flags())
+
+	fakeRawSubscriptionID := "6dc93fae-9a76-421f-bbe5-cc6460ea81cb"
+	fakeSubscriptionID, err := uuid.FromString(fakeRawSubscriptionID)
+	if err != nil {
+		t.Fatalf("Invalid SubscriptionId in Test: %s", err)
+	}
+	rcc.getAuthArgs().SubscriptionID = fakeSubscriptionID
+	rcc.getAuthArgs().rawSubscriptionID = fakeRawSubscriptionID
+	rcc.getAuthArgs().rawClientID = "b829b379-ca1f-4f1d-91a2-0d26b244680d"
+	rcc.getAuthArgs().ClientSecret = "0se43bie-3zs5-303e-aav5-dcf231vb82ds"
+
+	if err = rcc.run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running rotate-certs: %s", err)
+	}
+
+	if _, err = os.Stat(path.Join(outdir, apiModelFilename+".bak")); err != nil {
+		t.Fatalf("expected the original api model to be backed up: %s", err)
+	}
+	if rcc.containerService.Properties.CertificateProfile.CaCertificate == "caCertificate" {
+		t.Fatalf("expected a new CA certificate to be generated")
+	}
+
+	master := "masterdns1.westus.cloudapp.azure.com:22"
+	agent := "10.240.0.4:22 (via " + master + ")"
+	if len(runner.commands) != 2 {
+		t.Fatalf("expected commands to run on 2 hosts, got %v", runner.commands)
+	}
+	if len(runner.commands[master]) != 4 {
+		t.Fatalf("expected 4 commands to run on the master, got %d", len(runner.commands[master]))
+	}
+	cp := rcc.containerService.Properties.CertificateProfile
+	masterFiles, _ := archivedFiles(t, runner.inputs[master][0])
+	if masterFiles["etcdpeer0.key"] != cp.EtcdPeerPrivateKeys[0] {
+		t.Fatalf("expected the master to receive its etcd peer key")
+	}
+	if strings.Contains(runner.commands[master][0], cp.CaPrivateKey) {
+		t.Fatalf("expected the CA private key not to be on the command line of the master")
+	}
+	if len(runner.commands[agent]) != 2 {
+		t.Fatalf("expected 2 commands to run on the agent, got %d", len(runner.commands[agent]))
+	}
+	agentFiles, _ := archivedFiles(t, runner.inputs[agent][0])
+	if _, ok := agentFiles["ca.key"]; ok {
+		t.Fatalf("expected the agent not to receive the CA private key")
+	}
+	if agentFiles["client.key"] != cp.ClientPrivateKey {
+		t.Fatalf("expected the agent to receive the client private key")
+	}
+
+	// the api model is left untouched when the certificates cannot be distributed
+	rotated, err := ioutil.ReadFile(path.Join(outdir, apiModelFilename))
+	if err != nil {
+		t.Fatalf("unable to read the rotated api model: %s", err)
+	}
+	runner = &fakeRemoteRunner{failOn: "tar -xf"}
+	rcc.sshRunner = runner
+	rcc.containerService = nil
+	if err = rcc.run(r, []string{}); err == nil || !strings.Contains(err.Error(), "failed to install certificates on master 0") {
+		t.Fatalf("expected rotate-certs to fail installing certificates, got %v", err)
+	}
+	if b, _ := ioutil.ReadFile(path.Join(outdir, apiModelFilename)); string(b) != string(rotated) {
+		t.Fatalf("expected the api model not to be written when the certificates cannot be distributed")
+	}
+
+	runner = &fakeRemoteRunner{failOn: "restart etcd"}
+	rcc.sshRunner = runner
+	rcc.containerService = nil
+	if err = rcc.run(r, []string{}); err == nil || !strings.Contains(err.Error(), "failed to restart etcd on master 0") {
+		t.Fatalf("expected rotate-certs to fail restarting etcd, got %v", err)
+	}
+
+	// Windows nodes cannot be rotated, so the rotation is refused before anything is changed
+	client.MockKubernetesClient.NodesList.Items = append(client.MockKubernetesClient.NodesList.Items, readyNode("1234k8s9000", "10.240.0.5", "windows"))
+	runner = &fakeRemoteRunner{}
+	rcc.sshRunner = runner
+	rcc.containerService = nil
+	if err = rcc.run(r, []string{}); err == nil || !strings.Contains(err.Error(), "node 1234k8s9000 runs Windows") {
+		t.Fatalf("expected rotate-certs to refuse a cluster with Windows nodes, got %v", err)
+	}
+	if len(runner.commands) != 0 {
+		t.Fatalf("expected no command to run on a cluster with Windows nodes, got %v", runner.commands)
+	}
+}
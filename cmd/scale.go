@@ -4,6 +4,7 @@
 package cmd
 
 import (
+	"container/list"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"os"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,6 +25,8 @@ import (
 	"github.com/Azure/aks-engine/pkg/helpers"
 	"github.com/Azure/aks-engine/pkg/i18n"
 	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/leonelquinteros/gotext"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -39,6 +43,9 @@ type scaleCmd struct {
 	location             string
 	agentPoolToScale     string
 	masterFQDN           string
+	nodesToDelete        []string
+	dryRun               bool
+	outputFormat         string
 
 	// derived
 	containerService *api.ContainerService
@@ -49,7 +56,9 @@ type scaleCmd struct {
 	locale           *gotext.Locale
 	nameSuffix       string
 	agentPoolIndex   int
+	agentPoolNames   []string
 	logger           *log.Entry
+	events           *operations.EventStream
 }
 
 const (
@@ -79,7 +88,10 @@ func newScaleCmd() *cobra.Command {
 	f.IntVarP(&sc.newDesiredAgentCount, "new-node-count", "c", 0, "desired number of nodes")
 	f.StringVar(&sc.agentPoolToScale, "node-pool", "", "node pool to scale")
 	f.StringVar(&sc.masterFQDN, "master-FQDN", "", "FQDN for the master load balancer, Needed to scale down Kubernetes agent pools")
+	f.StringSliceVar(&sc.nodesToDelete, "nodes-to-delete", nil, "comma-separated names of the nodes to remove when scaling down (defaults to the newest nodes)")
+	f.BoolVar(&sc.dryRun, "dry-run", false, "print the scaling plan as JSON without making any changes")
 
+	addOutputFormatFlag(&sc.outputFormat, f)
 	addAuthFlags(&sc.authArgs, f)
 
 	return scaleCmd
@@ -116,6 +128,15 @@ func (sc *scaleCmd) validate(cmd *cobra.Command) error {
 		return errors.New("--deployment-dir must be specified")
 	}
 
+	if err = validateOutputFormat(sc.outputFormat); err != nil {
+		cmd.Usage()
+		return err
+	}
+	if sc.dryRun && sc.outputFormat == "json" {
+		cmd.Usage()
+		return errors.New("--dry-run already prints JSON and cannot be used with --output-format json")
+	}
+
 	return nil
 }
 
@@ -131,15 +152,17 @@ func (sc *scaleCmd) load(cmd *cobra.Command) error {
 		return errors.Wrap(err, "failed to get client")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
-	defer cancel()
-	_, err = sc.client.EnsureResourceGroup(ctx, sc.resourceGroupName, sc.location, nil)
-	if err != nil {
-		return err
+	if !sc.dryRun {
+		ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+		defer cancel()
+		_, err = sc.client.EnsureResourceGroup(ctx, sc.resourceGroupName, sc.location, nil)
+		if err != nil {
+			return err
+		}
 	}
 
 	// load apimodel from the deployment directory
-	sc.apiModelPath = path.Join(sc.deploymentDirectory, apiModelFilename)
+	sc.apiModelPath = api.FindAPIModelFile(sc.deploymentDirectory)
 
 	if _, err = os.Stat(sc.apiModelPath); os.IsNotExist(err) {
 		return errors.Errorf("specified api model does not exist (%s)", sc.apiModelPath)
@@ -149,6 +172,7 @@ func (sc *scaleCmd) load(cmd *cobra.Command) error {
 		Translator: &i18n.Translator{
 			Locale: sc.locale,
 		},
+		KeyVaultClient: sc.client,
 	}
 	sc.containerService, sc.apiVersion, err = apiloader.LoadContainerServiceFromFile(sc.apiModelPath, true, true, nil)
 	if err != nil {
@@ -161,6 +185,10 @@ func (sc *scaleCmd) load(cmd *cobra.Command) error {
 		return errors.New("--location does not match api model location")
 	}
 
+	for _, pool := range sc.containerService.Properties.AgentPoolProfiles {
+		sc.agentPoolNames = append(sc.agentPoolNames, pool.Name)
+	}
+
 	if sc.agentPoolToScale == "" {
 		agentPoolCount := len(sc.containerService.Properties.AgentPoolProfiles)
 		if agentPoolCount > 1 {
@@ -201,11 +229,15 @@ func (sc *scaleCmd) load(cmd *cobra.Command) error {
 	return nil
 }
 
-func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
+func (sc *scaleCmd) run(cmd *cobra.Command, args []string) (err error) {
 	if err := sc.validate(cmd); err != nil {
 		return errors.Wrap(err, "failed to validate scale command")
 	}
-	if err := sc.load(cmd); err != nil {
+	sc.events = newEventStream(sc.outputFormat, cmd.OutOrStdout())
+	defer func() {
+		sc.events.Finish(err)
+	}()
+	if err := sc.events.Phase("load-cluster", func() error { return sc.load(cmd) }); err != nil {
 		return errors.Wrap(err, "failed to load existing container service")
 	}
 
@@ -248,24 +280,54 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 		indexes = []int(sortedIndexes)
 		currentNodeCount = len(indexes)
 
+		poolNodes := make([]string, 0, len(indexToVM))
+		for _, vmName := range indexToVM {
+			poolNodes = append(poolNodes, vmName)
+		}
+		if err := sc.validateNodesToDelete(currentNodeCount, poolNodes); err != nil {
+			cmd.Usage()
+			return err
+		}
+
 		if currentNodeCount == sc.newDesiredAgentCount {
 			log.Info("Cluster is currently at the desired agent count.")
+			if sc.dryRun {
+				return printPlan(cmd.OutOrStdout(), sc.newPlan(currentNodeCount))
+			}
 			return nil
 		}
 		highestUsedIndex = indexes[len(indexes)-1]
 
 		// Scale down Scenario
 		if currentNodeCount > sc.newDesiredAgentCount {
-			if sc.masterFQDN == "" {
-				cmd.Usage()
-				return errors.New("master-FQDN is required to scale down a kubernetes cluster's agent pool")
-			}
-
 			vmsToDelete := make([]string, 0)
 			for i := currentNodeCount - 1; i >= sc.newDesiredAgentCount; i-- {
 				index = indexes[i]
 				vmsToDelete = append(vmsToDelete, indexToVM[index])
 			}
+			if len(sc.nodesToDelete) > 0 {
+				var err error
+				if vmsToDelete, err = selectNamedVMs(indexToVM, sc.nodesToDelete); err != nil {
+					return err
+				}
+			}
+
+			if sc.dryRun {
+				plan := sc.newPlan(currentNodeCount)
+				for _, vmName := range vmsToDelete {
+					if orchestratorInfo.OrchestratorType == api.Kubernetes {
+						plan.AddStep(operations.PlanActionDrain, sc.agentPoolToScale, vmName, "")
+					}
+					plan.AddStep(operations.PlanActionDelete, sc.agentPoolToScale, vmName, "")
+				}
+				return printPlan(cmd.OutOrStdout(), plan)
+			}
+
+			// the dry run above does not drain nodes, so it does not need the master FQDN
+			if sc.masterFQDN == "" {
+				cmd.Usage()
+				return errors.New("master-FQDN is required to scale down a kubernetes cluster's agent pool")
+			}
 
 			switch orchestratorInfo.OrchestratorType {
 			case api.Kubernetes:
@@ -273,32 +335,28 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 				if err != nil {
 					return errors.Wrap(err, "failed to generate kube config")
 				}
-				err = sc.drainNodes(kubeConfig, vmsToDelete)
+				err = sc.events.Phase("drain-nodes", func() error { return sc.drainNodes(kubeConfig, vmsToDelete) })
 				if err != nil {
 					return errors.Wrap(err, "Got error while draining the nodes to be deleted")
 				}
 			}
 
-			errList := operations.ScaleDownVMs(sc.client, sc.logger, sc.SubscriptionID.String(), sc.resourceGroupName, vmsToDelete...)
-			if errList != nil {
-				var err error
-				format := "Node '%s' failed to delete with error: '%s'"
-				for element := errList.Front(); element != nil; element = element.Next() {
-					vmError, ok := element.Value.(*operations.VMScalingErrorDetails)
-					if ok {
-						if err == nil {
-							err = errors.Errorf(format, vmError.Name, vmError.Error.Error())
-						} else {
-							err = errors.Wrapf(err, format, vmError.Name, vmError.Error.Error())
-						}
-					}
+			err = sc.events.Phase("delete-vms", func() error {
+				errList := operations.ScaleDownVMs(sc.client, sc.logger, sc.SubscriptionID.String(), sc.resourceGroupName, vmsToDelete...)
+				if errList != nil {
+					return vmScalingError(errList)
 				}
+				sc.emitVMsDeleted(vmsToDelete)
+				return nil
+			})
+			if err != nil {
 				return err
 			}
 
-			return sc.saveAPIModel()
+			return sc.events.Phase("save-api-model", sc.saveAPIModel)
 		}
 	} else {
+		var scaleSet *compute.VirtualMachineScaleSet
 		for vmssListPage, err := sc.client.ListVirtualMachineScaleSets(ctx, sc.resourceGroupName); vmssListPage.NotDone(); vmssListPage.Next() {
 			if err != nil {
 				return errors.Wrap(err, "failed to get vmss list in the resource group")
@@ -317,8 +375,35 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 
 				currentNodeCount = int(*vmss.Sku.Capacity)
 				highestUsedIndex = 0
+				matched := vmss
+				scaleSet = &matched
+			}
+		}
+
+		var instances []compute.VirtualMachineScaleSetVM
+		poolNodes := []string{}
+		if scaleSet != nil && (len(sc.nodesToDelete) > 0 || currentNodeCount > sc.newDesiredAgentCount) {
+			vmssName := *scaleSet.Name
+			for vmsListPage, err := sc.client.ListVirtualMachineScaleSetVMs(ctx, sc.resourceGroupName, vmssName); vmsListPage.NotDone(); err = vmsListPage.Next() {
+				if err != nil {
+					return errors.Wrapf(err, "failed to get the vms of scale set %s", vmssName)
+				}
+				instances = append(instances, vmsListPage.Values()...)
+			}
+			for _, vm := range instances {
+				poolNodes = append(poolNodes, scaleSetVMNodeName(vm))
 			}
 		}
+
+		if err := sc.validateNodesToDelete(currentNodeCount, poolNodes); err != nil {
+			cmd.Usage()
+			return err
+		}
+
+		// Scale down Scenario
+		if scaleSet != nil && currentNodeCount > sc.newDesiredAgentCount {
+			return sc.scaleDownScaleSet(ctx, cmd, scaleSet, instances, currentNodeCount)
+		}
 	}
 
 	translator := engine.Context{
@@ -383,20 +468,85 @@ func (sc *scaleCmd) run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if sc.dryRun {
+		plan, err := sc.scaleUpPlan(currentNodeCount, highestUsedIndex, templateJSON, parametersJSON)
+		if err != nil {
+			return err
+		}
+		return printPlan(cmd.OutOrStdout(), plan)
+	}
+
 	random := rand.New(rand.NewSource(time.Now().UnixNano()))
 	deploymentSuffix := random.Int31()
-
-	_, err = sc.client.DeployTemplate(
-		ctx,
-		sc.resourceGroupName,
-		fmt.Sprintf("%s-%d", sc.resourceGroupName, deploymentSuffix),
-		templateJSON,
-		parametersJSON)
+	deploymentName := fmt.Sprintf("%s-%d", sc.resourceGroupName, deploymentSuffix)
+
+	err = sc.events.Phase("deploy", func() error {
+		_, err := sc.client.DeployTemplate(
+			ctx,
+			sc.resourceGroupName,
+			deploymentName,
+			templateJSON,
+			parametersJSON)
+		if opErr := sc.events.EmitDeploymentOperations(sc.client, sc.resourceGroupName, deploymentName); opErr != nil {
+			log.Warnf("Unable to report the deployment operations: %v", opErr)
+		}
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
-	return sc.saveAPIModel()
+	return sc.events.Phase("save-api-model", sc.saveAPIModel)
+}
+
+// emitVMsDeleted reports the nodes removed by scaling down
+func (sc *scaleCmd) emitVMsDeleted(nodeNames []string) {
+	for _, nodeName := range nodeNames {
+		sc.events.Emit(operations.Event{Type: operations.EventVMDeleted, Pool: sc.agentPoolToScale, Node: nodeName})
+	}
+}
+
+// newPlan returns an empty scaling plan that leaves every other agent pool untouched
+func (sc *scaleCmd) newPlan(currentNodeCount int) *operations.Plan {
+	plan := operations.NewPlan("scale", fmt.Sprintf("Scale agent pool %s from %d to %d nodes", sc.agentPoolToScale, currentNodeCount, sc.newDesiredAgentCount), sc.resourceGroupName)
+	for _, name := range sc.agentPoolNames {
+		if name != sc.agentPoolToScale {
+			plan.UntouchedAgentPools = append(plan.UntouchedAgentPools, name)
+		}
+	}
+	return plan
+}
+
+// scaleUpPlan returns the plan for deploying the scaling template in place of a deployment
+func (sc *scaleCmd) scaleUpPlan(currentNodeCount, highestUsedIndex int, templateJSON, parametersJSON map[string]interface{}) (*operations.Plan, error) {
+	plan := sc.newPlan(currentNodeCount)
+
+	deployedTemplate, deployedParameters, err := loadDeployedTemplate(sc.deploymentDirectory)
+	if err != nil {
+		return nil, err
+	}
+	if sc.containerService.Properties.OrchestratorProfile.OrchestratorType == api.Kubernetes {
+		transformer := transform.Transformer{Translator: &i18n.Translator{Locale: sc.locale}}
+		if err = transformer.NormalizeForK8sVMASScalingUp(sc.logger, deployedTemplate); err != nil {
+			return nil, errors.Wrap(err, "error transforming the deployed template")
+		}
+	}
+	plan.AddResources(operations.DiffTemplateResources(deployedTemplate, deployedParameters, templateJSON, parametersJSON))
+
+	if !sc.agentPool.IsAvailabilitySets() {
+		plan.AddStep(operations.PlanActionDeploy, sc.agentPoolToScale, "scaling template", fmt.Sprintf("set scale set capacity to %d", sc.newDesiredAgentCount))
+		return plan, nil
+	}
+	plan.AddStep(operations.PlanActionDeploy, sc.agentPoolToScale, "scaling template", fmt.Sprintf("add %d nodes", sc.newDesiredAgentCount-currentNodeCount))
+	for i := 1; i <= sc.newDesiredAgentCount-currentNodeCount; i++ {
+		index := highestUsedIndex + i
+		vmName, err := utils.GetK8sVMName(sc.containerService.Properties, sc.agentPool, index)
+		if err != nil {
+			return nil, err
+		}
+		plan.AddStep(operations.PlanActionCreate, sc.agentPoolToScale, vmName, fmt.Sprintf("index %d", index))
+	}
+	return plan, nil
 }
 
 func (sc *scaleCmd) saveAPIModel() error {
@@ -405,6 +555,7 @@ func (sc *scaleCmd) saveAPIModel() error {
 		Translator: &i18n.Translator{
 			Locale: sc.locale,
 		},
+		KeyVaultClient: sc.client,
 	}
 	var apiVersion string
 	sc.containerService, apiVersion, err = apiloader.LoadContainerServiceFromFile(sc.apiModelPath, false, true, nil)
@@ -413,19 +564,190 @@ func (sc *scaleCmd) saveAPIModel() error {
 	}
 	sc.containerService.Properties.AgentPoolProfiles[sc.agentPoolIndex].Count = sc.newDesiredAgentCount
 
-	b, err := apiloader.SerializeContainerService(sc.containerService, apiVersion)
+	return apiloader.SaveContainerService(sc.containerService, apiVersion, sc.deploymentDirectory, path.Base(sc.apiModelPath), nil)
+}
+
+// validateNodesToDelete checks --nodes-to-delete names as many distinct nodes of the agent pool as scaling down removes
+func (sc *scaleCmd) validateNodesToDelete(currentNodeCount int, poolNodes []string) error {
+	if len(sc.nodesToDelete) == 0 {
+		return nil
+	}
+	if currentNodeCount <= sc.newDesiredAgentCount {
+		return errors.New("--nodes-to-delete can only be used to scale down")
+	}
+	seen := make(map[string]bool, len(sc.nodesToDelete))
+	for _, name := range sc.nodesToDelete {
+		if seen[strings.ToLower(name)] {
+			return errors.Errorf("--nodes-to-delete names node %s more than once", name)
+		}
+		seen[strings.ToLower(name)] = true
+		found := false
+		for _, poolNode := range poolNodes {
+			if strings.EqualFold(poolNode, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("--nodes-to-delete: node %s was not found in the agent pool", name)
+		}
+	}
+	if len(sc.nodesToDelete) != currentNodeCount-sc.newDesiredAgentCount {
+		return errors.Errorf("--nodes-to-delete names %d nodes, but scaling from %d to %d nodes removes %d",
+			len(sc.nodesToDelete), currentNodeCount, sc.newDesiredAgentCount, currentNodeCount-sc.newDesiredAgentCount)
+	}
+	return nil
+}
 
+// scaleDownScaleSet removes nodes from a VirtualMachineScaleSets agent pool. The removed instances are drained and
+// deleted before the capacity of the scale set is lowered, so Azure does not pick which instances go away.
+func (sc *scaleCmd) scaleDownScaleSet(ctx context.Context, cmd *cobra.Command, vmss *compute.VirtualMachineScaleSet, instances []compute.VirtualMachineScaleSetVM, currentNodeCount int) error {
+	vmssName := *vmss.Name
+	toDelete, err := selectScaleSetVMsToDelete(instances, currentNodeCount-sc.newDesiredAgentCount, sc.nodesToDelete)
 	if err != nil {
 		return err
 	}
+	nodeNames := make([]string, 0, len(toDelete))
+	instanceIDs := make([]string, 0, len(toDelete))
+	for _, vm := range toDelete {
+		nodeNames = append(nodeNames, scaleSetVMNodeName(vm))
+		instanceIDs = append(instanceIDs, *vm.InstanceID)
+	}
 
-	f := helpers.FileSaver{
-		Translator: &i18n.Translator{
-			Locale: sc.locale,
-		},
+	orchestratorInfo := sc.containerService.Properties.OrchestratorProfile
+	if sc.dryRun {
+		plan := sc.newPlan(currentNodeCount)
+		for i, nodeName := range nodeNames {
+			if orchestratorInfo.OrchestratorType == api.Kubernetes {
+				plan.AddStep(operations.PlanActionDrain, sc.agentPoolToScale, nodeName, "")
+			}
+			plan.AddStep(operations.PlanActionDelete, sc.agentPoolToScale, nodeName, fmt.Sprintf("instance %s of scale set %s", instanceIDs[i], vmssName))
+		}
+		plan.AddStep(operations.PlanActionSetCapacity, sc.agentPoolToScale, vmssName, fmt.Sprintf("set scale set capacity to %d", sc.newDesiredAgentCount))
+		return printPlan(cmd.OutOrStdout(), plan)
+	}
+
+	// the dry run above does not drain nodes, so it does not need the master FQDN
+	if sc.masterFQDN == "" {
+		cmd.Usage()
+		return errors.New("master-FQDN is required to scale down a kubernetes cluster's agent pool")
+	}
+
+	switch orchestratorInfo.OrchestratorType {
+	case api.Kubernetes:
+		kubeConfig, err := engine.GenerateKubeConfig(sc.containerService.Properties, sc.location)
+		if err != nil {
+			return errors.Wrap(err, "failed to generate kube config")
+		}
+		err = sc.events.Phase("drain-nodes", func() error { return sc.drainNodes(kubeConfig, nodeNames) })
+		if err != nil {
+			return errors.Wrap(err, "Got error while draining the nodes to be deleted")
+		}
 	}
 
-	return f.SaveFile(sc.deploymentDirectory, apiModelFilename, b)
+	err = sc.events.Phase("delete-vms", func() error {
+		errList := operations.ScaleDownScaleSetVMs(sc.client, sc.logger, sc.resourceGroupName, vmssName, instanceIDs...)
+		if errList != nil {
+			return vmScalingError(errList)
+		}
+		sc.emitVMsDeleted(nodeNames)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sku := *vmss.Sku
+	sku.Capacity = to.Int64Ptr(int64(sc.newDesiredAgentCount))
+	err = sc.events.Phase("set-capacity", func() error {
+		return sc.client.SetVirtualMachineScaleSetCapacity(ctx, sc.resourceGroupName, vmssName, sku, *vmss.Location)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to set the capacity of scale set %s", vmssName)
+	}
+
+	return sc.events.Phase("save-api-model", sc.saveAPIModel)
+}
+
+// selectNamedVMs returns the VMs of an availability set agent pool named by --nodes-to-delete
+func selectNamedVMs(indexToVM map[int]string, names []string) ([]string, error) {
+	vms := make([]string, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, vmName := range indexToVM {
+			if strings.EqualFold(vmName, name) {
+				vms = append(vms, vmName)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("node %s was not found in the agent pool", name)
+		}
+	}
+	return vms, nil
+}
+
+// selectScaleSetVMsToDelete returns the count newest instances of a scale set, or the instances running the named nodes
+func selectScaleSetVMsToDelete(vms []compute.VirtualMachineScaleSetVM, count int, names []string) ([]compute.VirtualMachineScaleSetVM, error) {
+	if len(names) > 0 {
+		selected := make([]compute.VirtualMachineScaleSetVM, 0, len(names))
+		for _, name := range names {
+			found := false
+			for _, vm := range vms {
+				if strings.EqualFold(scaleSetVMNodeName(vm), name) {
+					selected = append(selected, vm)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, errors.Errorf("node %s was not found in the agent pool", name)
+			}
+		}
+		return selected, nil
+	}
+
+	if count > len(vms) {
+		return nil, errors.Errorf("cannot remove %d nodes from a scale set with %d instances", count, len(vms))
+	}
+	sorted := make([]compute.VirtualMachineScaleSetVM, len(vms))
+	copy(sorted, vms)
+	// instance IDs increase as instances are created, so the highest are the newest
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, errA := strconv.Atoi(to.String(sorted[i].InstanceID))
+		b, errB := strconv.Atoi(to.String(sorted[j].InstanceID))
+		if errA != nil || errB != nil {
+			return to.String(sorted[i].InstanceID) > to.String(sorted[j].InstanceID)
+		}
+		return a > b
+	})
+	return sorted[:count], nil
+}
+
+// scaleSetVMNodeName returns the name of the Kubernetes node running on a scale set instance
+func scaleSetVMNodeName(vm compute.VirtualMachineScaleSetVM) string {
+	if vm.VirtualMachineScaleSetVMProperties != nil && vm.OsProfile != nil && vm.OsProfile.ComputerName != nil {
+		return strings.ToLower(*vm.OsProfile.ComputerName)
+	}
+	return to.String(vm.Name)
+}
+
+// vmScalingError combines the errors of the VMs that failed to delete
+func vmScalingError(errList *list.List) error {
+	var err error
+	format := "Node '%s' failed to delete with error: '%s'"
+	for element := errList.Front(); element != nil; element = element.Next() {
+		vmError, ok := element.Value.(*operations.VMScalingErrorDetails)
+		if ok {
+			if err == nil {
+				err = errors.Errorf(format, vmError.Name, vmError.Error.Error())
+			} else {
+				err = errors.Wrapf(err, format, vmError.Name, vmError.Error.Error())
+			}
+		}
+	}
+	return err
 }
 
 func (sc *scaleCmd) vmInAgentPool(vmName string, tags map[string]*string) bool {
@@ -455,7 +777,13 @@ func addValue(m paramsMap, k string, v interface{}) {
 }
 
 func (sc *scaleCmd) drainNodes(kubeConfig string, vmsToDelete []string) error {
-	masterURL := sc.masterFQDN
+	return drainNodes(sc.client, sc.logger, sc.events, sc.masterFQDN, kubeConfig, sc.agentPoolToScale, vmsToDelete)
+}
+
+// drainNodes safely drains the named nodes of a pool concurrently, returning the first error.
+// Every drained node is reported to events.
+func drainNodes(client armhelpers.AKSEngineClient, logger *log.Entry, events *operations.EventStream, masterFQDN, kubeConfig, poolName string, vmsToDelete []string) error {
+	masterURL := masterFQDN
 	if !strings.HasPrefix(masterURL, "https://") {
 		masterURL = fmt.Sprintf("https://%s", masterURL)
 	}
@@ -464,13 +792,14 @@ func (sc *scaleCmd) drainNodes(kubeConfig string, vmsToDelete []string) error {
 	defer close(errChan)
 	for _, vmName := range vmsToDelete {
 		go func(vmName string) {
-			err := operations.SafelyDrainNode(sc.client, sc.logger,
+			err := operations.SafelyDrainNode(client, logger,
 				masterURL, kubeConfig, vmName, time.Duration(60)*time.Minute)
 			if err != nil {
 				log.Errorf("Failed to drain node %s, got error %v", vmName, err)
 				errChan <- &operations.VMScalingErrorDetails{Error: err, Name: vmName}
 				return
 			}
+			events.Emit(operations.Event{Type: operations.EventNodeDrained, Pool: poolName, Node: vmName})
 			errChan <- nil
 		}(vmName)
 	}
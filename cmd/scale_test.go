@@ -4,8 +4,15 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"testing"
 
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -16,7 +23,7 @@ func TestNewScaleCmd(t *testing.T) {
 		t.Fatalf("scale command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, scaleName, output.Short, scaleShortDescription, output.Long, scaleLongDescription)
 	}
 
-	expectedFlags := []string{"location", "resource-group", "deployment-dir", "new-node-count", "node-pool", "master-FQDN"}
+	expectedFlags := []string{"location", "resource-group", "deployment-dir", "new-node-count", "node-pool", "master-FQDN", "nodes-to-delete", "dry-run", "output-format"}
 	for _, f := range expectedFlags {
 		if output.Flags().Lookup(f) == nil {
 			t.Fatalf("scale command should have flag %s", f)
@@ -85,6 +92,18 @@ func TestScaleCmdValidate(t *testing.T) {
 			},
 			expectedErr: nil,
 		},
+		{
+			sc: &scaleCmd{
+				location:             "centralus",
+				resourceGroupName:    "testRG",
+				deploymentDirectory:  "_output/test",
+				agentPoolToScale:     "agentpool1",
+				newDesiredAgentCount: 5,
+				dryRun:               true,
+				outputFormat:         "json",
+			},
+			expectedErr: errors.New("--dry-run already prints JSON and cannot be used with --output-format json"),
+		},
 	}
 
 	for _, c := range cases {
@@ -102,3 +121,119 @@ func TestScaleCmdValidate(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateNodesToDelete(t *testing.T) {
+	cases := []struct {
+		nodesToDelete    []string
+		currentNodeCount int
+		expectedErr      error
+	}{
+		{nil, 5, nil},
+		{[]string{"k8s-agentpool1-12345678-3", "k8s-agentpool1-12345678-4"}, 5, nil},
+		{[]string{"k8s-agentpool1-12345678-4"}, 5, errors.New("--nodes-to-delete names 1 nodes, but scaling from 5 to 3 nodes removes 2")},
+		{[]string{"k8s-agentpool1-12345678-4"}, 2, errors.New("--nodes-to-delete can only be used to scale down")},
+		{[]string{"k8s-agentpool1-12345678-4", "K8S-AGENTPOOL1-12345678-4"}, 5, errors.New("--nodes-to-delete names node K8S-AGENTPOOL1-12345678-4 more than once")},
+		{[]string{"k8s-agentpool1-12345678-4", "k8s-agentpool1-12345678-7"}, 5, errors.New("--nodes-to-delete: node k8s-agentpool1-12345678-7 was not found in the agent pool")},
+	}
+	poolNodes := []string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-1", "k8s-agentpool1-12345678-2", "k8s-agentpool1-12345678-3", "k8s-agentpool1-12345678-4"}
+	for _, c := range cases {
+		sc := &scaleCmd{newDesiredAgentCount: 3, nodesToDelete: c.nodesToDelete}
+		err := sc.validateNodesToDelete(c.currentNodeCount, poolNodes)
+		if c.expectedErr == nil && err != nil {
+			t.Fatalf("expected no error validating --nodes-to-delete %v, got %s", c.nodesToDelete, err)
+		}
+		if c.expectedErr != nil && (err == nil || err.Error() != c.expectedErr.Error()) {
+			t.Fatalf("expected error %s validating --nodes-to-delete %v, got %v", c.expectedErr, c.nodesToDelete, err)
+		}
+	}
+}
+
+func TestSelectScaleSetVMsToDelete(t *testing.T) {
+	vm := func(instanceID string) compute.VirtualMachineScaleSetVM {
+		return compute.VirtualMachineScaleSetVM{
+			InstanceID: to.StringPtr(instanceID),
+			VirtualMachineScaleSetVMProperties: &compute.VirtualMachineScaleSetVMProperties{
+				OsProfile: &compute.OSProfile{ComputerName: to.StringPtr("k8s-agentpool1-12345678-vmss00000" + instanceID)},
+			},
+		}
+	}
+	vms := []compute.VirtualMachineScaleSetVM{vm("2"), vm("10"), vm("0"), vm("9")}
+
+	selected, err := selectScaleSetVMsToDelete(vms, 2, nil)
+	if err != nil {
+		t.Fatalf("unexpected error selecting scale set vms: %s", err)
+	}
+	if len(selected) != 2 || *selected[0].InstanceID != "10" || *selected[1].InstanceID != "9" {
+		t.Fatalf("expected the newest instances 10 and 9 to be selected, got %v", selected)
+	}
+
+	selected, err = selectScaleSetVMsToDelete(vms, 1, []string{"K8S-AGENTPOOL1-12345678-VMSS000000"})
+	if err != nil {
+		t.Fatalf("unexpected error selecting scale set vms: %s", err)
+	}
+	if len(selected) != 1 || *selected[0].InstanceID != "0" {
+		t.Fatalf("expected the named instance 0 to be selected, got %v", selected)
+	}
+	if scaleSetVMNodeName(selected[0]) != "k8s-agentpool1-12345678-vmss000000" {
+		t.Fatalf("unexpected node name %s", scaleSetVMNodeName(selected[0]))
+	}
+
+	if _, err = selectScaleSetVMsToDelete(vms, 1, []string{"k8s-agentpool1-12345678-vmss000005"}); err == nil {
+		t.Fatalf("expected an error selecting a node that is not in the scale set")
+	}
+	if _, err = selectScaleSetVMsToDelete(vms, 5, nil); err == nil {
+		t.Fatalf("expected an error removing more nodes than the scale set has")
+	}
+}
+
+func TestScaleDownScaleSetDryRun(t *testing.T) {
+	vm := func(instanceID string) compute.VirtualMachineScaleSetVM {
+		return compute.VirtualMachineScaleSetVM{
+			InstanceID: to.StringPtr(instanceID),
+			VirtualMachineScaleSetVMProperties: &compute.VirtualMachineScaleSetVMProperties{
+				OsProfile: &compute.OSProfile{ComputerName: to.StringPtr("k8s-agentpool1-12345678-vmss00000" + instanceID)},
+			},
+		}
+	}
+	vmss := &compute.VirtualMachineScaleSet{Name: to.StringPtr("k8s-agentpool1-12345678-vmss")}
+	sc := &scaleCmd{
+		resourceGroupName:    "testRG",
+		agentPoolToScale:     "agentpool1",
+		newDesiredAgentCount: 1,
+		dryRun:               true,
+		containerService: &api.ContainerService{Properties: &api.Properties{
+			OrchestratorProfile: &api.OrchestratorProfile{OrchestratorType: api.Kubernetes},
+		}},
+	}
+
+	// a dry run does not drain nodes, so it does not need --master-FQDN
+	out := &bytes.Buffer{}
+	r := &cobra.Command{}
+	r.SetOutput(out)
+	if err := sc.scaleDownScaleSet(context.Background(), r, vmss, []compute.VirtualMachineScaleSetVM{vm("0"), vm("1")}, 2); err != nil {
+		t.Fatalf("unexpected error planning the scale down: %s", err)
+	}
+	plan := operations.Plan{}
+	if err := json.Unmarshal(out.Bytes(), &plan); err != nil {
+		t.Fatalf("unable to parse the plan: %s", err)
+	}
+	if len(plan.Steps) != 3 || plan.Steps[0].Target != "k8s-agentpool1-12345678-vmss000001" {
+		t.Fatalf("expected the newest instance to be drained and deleted, got %v", plan.Steps)
+	}
+
+	sc.dryRun = false
+	if err := sc.scaleDownScaleSet(context.Background(), r, vmss, []compute.VirtualMachineScaleSetVM{vm("0"), vm("1")}, 2); err == nil || err.Error() != "master-FQDN is required to scale down a kubernetes cluster's agent pool" {
+		t.Fatalf("expected scaling down without --master-FQDN to fail, got %v", err)
+	}
+}
+
+func TestSelectNamedVMs(t *testing.T) {
+	indexToVM := map[int]string{0: "k8s-agentpool1-12345678-0", 1: "k8s-agentpool1-12345678-1", 2: "k8s-agentpool1-12345678-2"}
+	vms, err := selectNamedVMs(indexToVM, []string{"k8s-agentpool1-12345678-0"})
+	if err != nil || len(vms) != 1 || vms[0] != "k8s-agentpool1-12345678-0" {
+		t.Fatalf("expected the named vm to be selected, got %v (%v)", vms, err)
+	}
+	if _, err = selectNamedVMs(indexToVM, []string{"k8s-agentpool1-12345678-5"}); err == nil {
+		t.Fatalf("expected an error selecting a vm that is not in the agent pool")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/Azure/aks-engine/pkg/api/vlabs"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	schemaName             = "schema"
+	schemaShortDescription = "Print the JSON Schema of the api model"
+	schemaLongDescription  = "Print the JSON Schema of the vlabs api model, for editors and tools validating api models before they are deployed"
+)
+
+type schemaCmd struct {
+	outputFile string
+
+	// derived
+	out io.Writer
+}
+
+func newSchemaCmd() *cobra.Command {
+	sc := schemaCmd{
+		out: os.Stdout,
+	}
+
+	schemaCmd := &cobra.Command{
+		Use:   schemaName,
+		Short: schemaShortDescription,
+		Long:  schemaLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				cmd.Usage()
+				return errors.New("'schema' does not take any arguments")
+			}
+			return sc.run()
+		},
+	}
+
+	f := schemaCmd.Flags()
+	f.StringVar(&sc.outputFile, "output-file", "", "write the schema to this file instead of stdout")
+
+	return schemaCmd
+}
+
+func (sc *schemaCmd) run() error {
+	b, err := vlabs.MarshalSchema()
+	if err != nil {
+		return errors.Wrap(err, "error generating the api model schema")
+	}
+	b = append(b, '\n')
+
+	if sc.outputFile != "" {
+		return errors.Wrap(ioutil.WriteFile(sc.outputFile, b, 0644), "error writing the api model schema")
+	}
+	if _, err = sc.out.Write(b); err != nil {
+		return errors.Wrap(err, "error writing output")
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNewSchemaCmd(t *testing.T) {
+	output := newSchemaCmd()
+	if output.Use != schemaName || output.Short != schemaShortDescription || output.Long != schemaLongDescription {
+		t.Fatalf("schema command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, schemaName, output.Short, schemaShortDescription, output.Long, schemaLongDescription)
+	}
+	if output.Flags().Lookup("output-file") == nil {
+		t.Fatalf("schema command should have flag output-file")
+	}
+}
+
+func TestSchemaCmdRun(t *testing.T) {
+	out := &bytes.Buffer{}
+	sc := &schemaCmd{out: out}
+	if err := sc.run(); err != nil {
+		t.Fatalf("unexpected error printing the schema: %s", err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &schema); err != nil {
+		t.Fatalf("expected the schema to be JSON: %s", err)
+	}
+	if _, ok := schema["definitions"].(map[string]interface{})["KubernetesConfig"]; !ok {
+		t.Fatalf("expected the schema to define KubernetesConfig")
+	}
+
+	// the published schema is the output of the command
+	published, err := ioutil.ReadFile("../pkg/api/vlabs/apimodel.schema.json")
+	if err != nil {
+		t.Fatalf("unable to read the published schema: %s", err)
+	}
+	if !bytes.Equal(out.Bytes(), published) {
+		t.Fatalf("expected the published schema to be the output of the schema command")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+// secretStoreArgs selects where the generated artifacts keep the secrets of the api model
+type secretStoreArgs struct {
+	store   string
+	keyFile string
+	vaultID string
+}
+
+func addSecretStoreFlags(s *secretStoreArgs, f *flag.FlagSet) {
+	f.StringVar(&s.store, "secret-store", "", "keep the secrets of the api model out of apimodel.json, the secure parameters of azuredeploy.parameters.json and the private key files, in a `file`, an `encrypted` file or `keyvault`")
+	f.StringVar(&s.keyFile, "secret-key-file", "", "path to the key encrypting the secrets with --secret-store=encrypted, created if it does not exist (default ~/.acsengine/secrets.key)")
+	f.StringVar(&s.vaultID, "secret-vault-id", "", "resource ID of the Key Vault keeping the secrets with --secret-store=keyvault")
+}
+
+func (s *secretStoreArgs) validate() error {
+	switch s.store {
+	case "", api.FileSecretStoreKind, api.EncryptedFileSecretStoreKind:
+	case api.KeyVaultSecretStoreKind:
+		if s.vaultID == "" {
+			return errors.New("--secret-vault-id must be specified when --secret-store=keyvault")
+		}
+	default:
+		return errors.Errorf("--secret-store: unsupported store %q", s.store)
+	}
+	return nil
+}
+
+// secretStore returns the selected store, or nil when the secrets are kept in apimodel.json.
+// Key Vault secrets are named after the cluster's DNS prefix and written with client.
+func (s *secretStoreArgs) secretStore(containerService *api.ContainerService, client api.KeyVaultClient) (api.SecretStore, error) {
+	switch s.store {
+	case api.FileSecretStoreKind:
+		return &api.FileSecretStore{}, nil
+	case api.EncryptedFileSecretStoreKind:
+		keyFile := s.keyFile
+		if keyFile == "" {
+			keyFile = filepath.Join(helpers.GetHomeDir(), armhelpers.ApplicationDir, "secrets.key")
+		}
+		return &api.EncryptedFileSecretStore{KeyFile: keyFile}, nil
+	case api.KeyVaultSecretStoreKind:
+		if client == nil {
+			return nil, errors.New("--secret-store=keyvault needs Azure credentials, use deploy instead")
+		}
+		namePrefix := containerService.Name
+		if containerService.Properties.MasterProfile != nil {
+			namePrefix = containerService.Properties.MasterProfile.DNSPrefix
+		}
+		return &api.KeyVaultSecretStore{VaultID: s.vaultID, NamePrefix: namePrefix, Client: client}, nil
+	}
+	return nil, nil
+}
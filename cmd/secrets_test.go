@@ -0,0 +1,67 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+)
+
+func TestSecretStoreArgs(t *testing.T) {
+	cs := api.CreateMockContainerService("testcluster", "1.10.13", 1, 1, false)
+
+	cases := []struct {
+		args          secretStoreArgs
+		client        api.KeyVaultClient
+		expectedErr   string
+		expectedStore api.SecretStore
+	}{
+		{args: secretStoreArgs{}},
+		{args: secretStoreArgs{store: "file"}, expectedStore: &api.FileSecretStore{}},
+		{args: secretStoreArgs{store: "encrypted", keyFile: "/tmp/secrets.key"}, expectedStore: &api.EncryptedFileSecretStore{KeyFile: "/tmp/secrets.key"}},
+		{args: secretStoreArgs{store: "keyvault"}, expectedErr: "--secret-vault-id must be specified when --secret-store=keyvault"},
+		{args: secretStoreArgs{store: "keyvault", vaultID: "vault"}, expectedErr: "--secret-store=keyvault needs Azure credentials, use deploy instead"},
+		{args: secretStoreArgs{store: "keyvault", vaultID: "vault"}, client: &armhelpers.MockAKSEngineClient{}},
+		{args: secretStoreArgs{store: "vault"}, expectedErr: `--secret-store: unsupported store "vault"`},
+	}
+
+	for _, c := range cases {
+		err := c.args.validate()
+		var store api.SecretStore
+		if err == nil {
+			store, err = c.args.secretStore(cs, c.client)
+		}
+		if c.expectedErr != "" {
+			if err == nil || err.Error() != c.expectedErr {
+				t.Fatalf("expected error %q for %+v, got %v", c.expectedErr, c.args, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for %+v: %s", c.args, err)
+		}
+		switch expected := c.expectedStore.(type) {
+		case nil:
+			if c.args.store == "" && store != nil {
+				t.Fatalf("expected no secret store without --secret-store, got %v", store)
+			}
+		case *api.EncryptedFileSecretStore:
+			if s, ok := store.(*api.EncryptedFileSecretStore); !ok || s.KeyFile != expected.KeyFile {
+				t.Fatalf("expected secret store %v, got %v", expected, store)
+			}
+		case *api.FileSecretStore:
+			if _, ok := store.(*api.FileSecretStore); !ok {
+				t.Fatalf("expected secret store %v, got %v", expected, store)
+			}
+		}
+		if c.args.store == "keyvault" {
+			s, ok := store.(*api.KeyVaultSecretStore)
+			if !ok || s.VaultID != "vault" || s.NamePrefix != cs.Properties.MasterProfile.DNSPrefix {
+				t.Fatalf("expected a Key Vault secret store named after the DNS prefix, got %v", store)
+			}
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/armhelpers/utils"
+	"github.com/Azure/aks-engine/pkg/engine"
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	statusName             = "status"
+	statusShortDescription = "Report the state of an existing Kubernetes cluster"
+	statusLongDescription  = "List the virtual machines and scale set instances of an existing Kubernetes cluster with their Kubernetes nodes, and report where the cluster has drifted from its api model"
+)
+
+// statusKubernetesInterval is how often the apiserver is polled when waiting on it
+const statusKubernetesInterval = 10 * time.Second
+
+type statusCmd struct {
+	authProvider
+
+	// user input
+	resourceGroupName   string
+	deploymentDirectory string
+	location            string
+	outputFormat        string
+
+	// derived
+	containerService *api.ContainerService
+	locale           *gotext.Locale
+	client           armhelpers.AKSEngineClient
+	kubeClient       armhelpers.KubernetesClient
+	nameSuffix       string
+	logger           *log.Entry
+}
+
+func newStatusCmd() *cobra.Command {
+	sc := statusCmd{
+		authProvider: &authArgs{},
+	}
+
+	statusCmd := &cobra.Command{
+		Use:   statusName,
+		Short: statusShortDescription,
+		Long:  statusLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return sc.run(cmd, args)
+		},
+	}
+
+	f := statusCmd.Flags()
+	f.StringVarP(&sc.location, "location", "l", "", "location the cluster is deployed in (required)")
+	f.StringVarP(&sc.resourceGroupName, "resource-group", "g", "", "the resource group where the cluster is deployed (required)")
+	f.StringVar(&sc.deploymentDirectory, "deployment-dir", "", "the location of the output from `generate` (required)")
+	f.StringVarP(&sc.outputFormat, "output", "o", "human", fmt.Sprintf("Output format to use: %s", outputFormatOptions))
+	addAuthFlags(sc.getAuthArgs(), f)
+
+	return statusCmd
+}
+
+func (sc *statusCmd) validate(cmd *cobra.Command) error {
+	var err error
+
+	sc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if sc.resourceGroupName == "" {
+		cmd.Usage()
+		return errors.New("--resource-group must be specified")
+	}
+
+	if sc.location == "" {
+		cmd.Usage()
+		return errors.New("--location must be specified")
+	}
+	sc.location = helpers.NormalizeAzureRegion(sc.location)
+
+	if sc.deploymentDirectory == "" {
+		cmd.Usage()
+		return errors.New("--deployment-dir must be specified")
+	}
+
+	if sc.outputFormat != "human" && sc.outputFormat != "json" {
+		cmd.Usage()
+		return errors.Errorf("unsupported output format: %s", sc.outputFormat)
+	}
+	return nil
+}
+
+func (sc *statusCmd) load() error {
+	var err error
+
+	sc.logger = log.New().WithField("source", "status command line")
+
+	if err = sc.getAuthArgs().validateAuthArgs(); err != nil {
+		return err
+	}
+	if sc.client, err = sc.authProvider.getClient(); err != nil {
+		return errors.Wrap(err, "failed to get client")
+	}
+
+	apiModelPath := api.FindAPIModelFile(sc.deploymentDirectory)
+	if _, err = os.Stat(apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", apiModelPath)
+	}
+
+	apiloader := &api.Apiloader{
+		Translator: &i18n.Translator{
+			Locale: sc.locale,
+		},
+		KeyVaultClient: sc.client,
+	}
+	sc.containerService, _, err = apiloader.LoadContainerServiceFromFile(apiModelPath, true, true, nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing the api model")
+	}
+
+	if sc.containerService.Location == "" {
+		sc.containerService.Location = sc.location
+	} else if sc.containerService.Location != sc.location {
+		return errors.New("--location does not match api model location")
+	}
+
+	template, _, err := loadDeployedTemplate(sc.deploymentDirectory)
+	if err != nil {
+		return err
+	}
+	if sc.nameSuffix, err = templateNameSuffix(template); err != nil {
+		return err
+	}
+	sc.containerService.Properties.ClusterID = sc.nameSuffix
+
+	properties := sc.containerService.Properties
+	kubeConfig, err := engine.GenerateKubeConfig(properties, sc.location)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate kube config")
+	}
+	masterURL := "https://" + api.FormatAzureProdFQDNByLocation(properties.MasterProfile.DNSPrefix, sc.location)
+	if sc.kubeClient, err = sc.client.GetKubernetesClient(masterURL, kubeConfig, statusKubernetesInterval, armhelpers.DefaultARMOperationTimeout); err != nil {
+		return errors.Wrap(err, "failed to get a Kubernetes client")
+	}
+	return nil
+}
+
+func (sc *statusCmd) run(cmd *cobra.Command, args []string) error {
+	if err := sc.validate(cmd); err != nil {
+		return errors.Wrap(err, "failed to validate status command")
+	}
+	if err := sc.load(); err != nil {
+		return errors.Wrap(err, "failed to load existing container service")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+
+	machines, err := sc.clusterMachines(ctx)
+	if err != nil {
+		return err
+	}
+	nodes, err := sc.kubeClient.ListNodes()
+	if err != nil {
+		return errors.Wrap(err, "failed to list the nodes of the cluster")
+	}
+	inventory := operations.NewClusterInventory(sc.containerService.Properties, machines, nodes.Items)
+
+	if sc.outputFormat == "json" {
+		b, err := helpers.JSONMarshalIndent(inventory, "", "  ", false)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal cluster status")
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(b))
+		return nil
+	}
+	printInventory(cmd.OutOrStdout(), inventory)
+	return nil
+}
+
+// clusterMachines returns the VMs and scale set instances of the cluster, with the pool and index parsed from
+// their name and the version of their orchestrator tag
+func (sc *statusCmd) clusterMachines(ctx context.Context) ([]operations.InventoryMachine, error) {
+	machines := []operations.InventoryMachine{}
+	for page, err := sc.client.ListVirtualMachines(ctx, sc.resourceGroupName); page.NotDone(); err = page.Next() {
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list virtual machines")
+		}
+		for _, vm := range page.Values() {
+			if !operations.IsClusterResource(resources.GenericResource{Name: vm.Name, Tags: vm.Tags}, sc.nameSuffix) {
+				continue
+			}
+			name := to.String(vm.Name)
+			machine := operations.InventoryMachine{
+				Name:                name,
+				Pool:                tagValue(vm.Tags, "poolName"),
+				OrchestratorVersion: orchestratorTagVersion(vm.Tags),
+				NodeName:            strings.ToLower(name),
+			}
+			if pool, _, index, err := utils.K8sLinuxVMNameParts(name); err == nil {
+				machine.Pool, machine.Index = pool, index
+			} else if _, _, poolIndex, index, err := utils.WindowsVMNameParts(name); err == nil {
+				machine.Index = index
+				if poolIndex < len(sc.containerService.Properties.AgentPoolProfiles) {
+					machine.Pool = sc.containerService.Properties.AgentPoolProfiles[poolIndex].Name
+				}
+			} else {
+				sc.logger.Warnf("Skipping VM %s, its name does not identify a node of the cluster", name)
+				continue
+			}
+			machines = append(machines, machine)
+		}
+	}
+
+	for page, err := sc.client.ListVirtualMachineScaleSets(ctx, sc.resourceGroupName); page.NotDone(); err = page.Next() {
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list virtual machine scale sets")
+		}
+		for _, vmss := range page.Values() {
+			if !operations.IsClusterResource(resources.GenericResource{Name: vmss.Name, Tags: vmss.Tags}, sc.nameSuffix) {
+				continue
+			}
+			vmssName := to.String(vmss.Name)
+			pool := tagValue(vmss.Tags, "poolName")
+			if pool == "" {
+				pool, _, _ = utils.VmssNameParts(vmssName)
+			}
+			for vmPage, err := sc.client.ListVirtualMachineScaleSetVMs(ctx, sc.resourceGroupName, vmssName); vmPage.NotDone(); err = vmPage.Next() {
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to list the virtual machines of scale set %s", vmssName)
+				}
+				for _, vm := range vmPage.Values() {
+					index, _ := strconv.Atoi(to.String(vm.InstanceID))
+					machines = append(machines, operations.InventoryMachine{
+						Name:                to.String(vm.Name),
+						Pool:                pool,
+						Index:               index,
+						ScaleSet:            vmssName,
+						OrchestratorVersion: orchestratorTagVersion(vmss.Tags),
+						NodeName:            scaleSetVMNodeName(vm),
+					})
+				}
+			}
+		}
+	}
+	return machines, nil
+}
+
+// tagValue returns the value of the tag, or an empty string if it is not set
+func tagValue(tags map[string]*string, key string) string {
+	if value, ok := tags[key]; ok {
+		return to.String(value)
+	}
+	return ""
+}
+
+// orchestratorTagVersion returns the version of the orchestrator tag, formatted as Kubernetes:1.11.6
+func orchestratorTagVersion(tags map[string]*string) string {
+	parts := strings.SplitN(tagValue(tags, "orchestrator"), ":", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+func printInventory(w io.Writer, inventory *operations.ClusterInventory) {
+	fmt.Fprintf(w, "Orchestrator version: %s\n\n", inventory.OrchestratorVersion)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "POOL\tEXPECTED\tFOUND")
+	for _, pool := range inventory.Pools {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", pool.Name, pool.Expected, pool.Found)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPOOL\tINDEX\tVERSION\tNODE\tSTATUS\tKUBELET")
+	for _, m := range inventory.Machines {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", m.Name, m.Pool, m.Index, m.OrchestratorVersion, m.NodeName, m.NodeStatus, m.KubeletVersion)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	if len(inventory.Drift) == 0 {
+		fmt.Fprintln(w, "No drift found")
+		return
+	}
+	fmt.Fprintln(w, "Drift:")
+	for _, d := range inventory.Drift {
+		fmt.Fprintf(w, "  %s %s: %s\n", d.Kind, d.Target, d.Detail)
+	}
+}
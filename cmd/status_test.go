@@ -0,0 +1,180 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewStatusCmd(t *testing.T) {
+	output := newStatusCmd()
+	if output.Use != statusName || output.Short != statusShortDescription || output.Long != statusLongDescription {
+		t.Fatalf("status command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, statusName, output.Short, statusShortDescription, output.Long, statusLongDescription)
+	}
+
+	expectedFlags := []string{"location", "resource-group", "deployment-dir", "output", "subscription-id"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("status command should have flag %s", f)
+		}
+	}
+}
+
+func TestStatusCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		sc          *statusCmd
+		expectedErr error
+	}{
+		{
+			sc: &statusCmd{
+				location:            "centralus",
+				deploymentDirectory: "_output/test",
+				outputFormat:        "human",
+			},
+			expectedErr: errors.New("--resource-group must be specified"),
+		},
+		{
+			sc: &statusCmd{
+				resourceGroupName:   "testRG",
+				deploymentDirectory: "_output/test",
+				outputFormat:        "human",
+			},
+			expectedErr: errors.New("--location must be specified"),
+		},
+		{
+			sc: &statusCmd{
+				resourceGroupName: "testRG",
+				location:          "centralus",
+				outputFormat:      "human",
+			},
+			expectedErr: errors.New("--deployment-dir must be specified"),
+		},
+		{
+			sc: &statusCmd{
+				resourceGroupName:   "testRG",
+				location:            "centralus",
+				deploymentDirectory: "_output/test",
+				outputFormat:        "yaml",
+			},
+			expectedErr: errors.New("unsupported output format: yaml"),
+		},
+		{
+			sc: &statusCmd{
+				resourceGroupName:   "testRG",
+				location:            "centralus",
+				deploymentDirectory: "_output/test",
+				outputFormat:        "json",
+			},
+			expectedErr: nil,
+		},
+	}
+
+	for _, c := range cases {
+		err := c.sc.validate(r)
+		if err != nil && c.expectedErr != nil {
+			if err.Error() != c.expectedErr.Error() {
+				t.Fatalf("expected validate status command to return error %s, but instead got %s", c.expectedErr.Error(), err.Error())
+			}
+		} else {
+			if c.expectedErr != nil {
+				t.Fatalf("expected validate status command to return error %s, but instead got no error", c.expectedErr.Error())
+			} else if err != nil {
+				t.Fatalf("expected validate status command to return no error, but instead got %s", err.Error())
+			}
+		}
+	}
+}
+
+// newTestStatusCmd returns a statusCmd reporting the status of the test deployment written to dir in outputFormat
+func newTestStatusCmd(t *testing.T, dir string, client armhelpers.AKSEngineClient, outputFormat string) *statusCmd {
+	writeTestDeployment(t, dir)
+	return &statusCmd{
+		authProvider:        newTestAuthProvider(client),
+		location:            "westus",
+		resourceGroupName:   "testRG",
+		deploymentDirectory: dir,
+		outputFormat:        outputFormat,
+	}
+}
+
+func TestStatusCmdRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "status")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the mock client lists the VM k8s-agentpool1-12345678-0, tagged with Kubernetes 1.7.9
+	node := func(name string) v1.Node {
+		n := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		n.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+		n.Status.NodeInfo.KubeletVersion = "v1.7.9"
+		return n
+	}
+	client := &armhelpers.MockAKSEngineClient{
+		MockKubernetesClient: &armhelpers.MockKubernetesClient{
+			NodesList: &v1.NodeList{Items: []v1.Node{node("k8s-agentpool1-12345678-0"), node("k8s-agentpool2-12345678-0")}},
+		},
+	}
+
+	out := &bytes.Buffer{}
+	r := &cobra.Command{}
+	r.SetOutput(out)
+	if err = newTestStatusCmd(t, dir, client, "json").run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running status: %s", err)
+	}
+	inventory := operations.ClusterInventory{}
+	if err = json.Unmarshal(out.Bytes(), &inventory); err != nil {
+		t.Fatalf("unable to parse the status: %s", err)
+	}
+	if len(inventory.Machines) != 1 || inventory.Machines[0].Pool != "agentpool1" || inventory.Machines[0].NodeStatus != operations.NodeStatusReady {
+		t.Fatalf("expected the agentpool1 VM and its ready node, got %v", inventory.Machines)
+	}
+	missingVM := false
+	for _, d := range inventory.Drift {
+		if d.Kind == operations.DriftMissingVM && d.Target == "k8s-agentpool2-12345678-0" {
+			missingVM = true
+		}
+	}
+	if !missingVM {
+		t.Fatalf("expected the node without VM to be reported, got %v", inventory.Drift)
+	}
+
+	out.Reset()
+	if err = newTestStatusCmd(t, dir, client, "human").run(r, []string{}); err != nil {
+		t.Fatalf("unexpected error running status: %s", err)
+	}
+	if !strings.Contains(out.String(), "k8s-agentpool1-12345678-0  agentpool1  0") || !strings.Contains(out.String(), "missingVM k8s-agentpool2-12345678-0") {
+		t.Fatalf("unexpected status table:\n%s", out.String())
+	}
+
+	client.MockKubernetesClient.FailListNodes = true
+	if err = newTestStatusCmd(t, dir, client, "json").run(r, []string{}); err == nil || !strings.Contains(err.Error(), "ListNodes failed") {
+		t.Fatalf("expected failing to list nodes to be reported, got %v", err)
+	}
+}
+
+func TestOrchestratorTagVersion(t *testing.T) {
+	tag := "Kubernetes:1.11.6"
+	if version := orchestratorTagVersion(map[string]*string{"orchestrator": &tag}); version != "1.11.6" {
+		t.Fatalf("expected version 1.11.6, got %s", version)
+	}
+	if version := orchestratorTagVersion(map[string]*string{}); version != "" {
+		t.Fatalf("expected no version without orchestrator tag, got %s", version)
+	}
+}
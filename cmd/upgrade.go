@@ -17,6 +17,7 @@ import (
 	"github.com/Azure/aks-engine/pkg/engine"
 	"github.com/Azure/aks-engine/pkg/helpers"
 	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/aks-engine/pkg/operations"
 	"github.com/Azure/aks-engine/pkg/operations/kubernetesupgrade"
 	"github.com/leonelquinteros/gotext"
 	"github.com/pkg/errors"
@@ -40,15 +41,31 @@ type upgradeCmd struct {
 	upgradeVersion      string
 	location            string
 	timeoutInMinutes    int
+	maxSurge            int
+	maxUnavailable      int
+	dryRun              bool
+	resume              bool
+	discardCheckpoint   bool
+	rollback            bool
+	skipHealthChecks    bool
+	skipEtcdBackup      bool
+	sshKeyPath          string
+	outputFormat        string
 
 	// derived
 	containerService    *api.ContainerService
 	apiVersion          string
+	apiModelPath        string
 	client              armhelpers.AKSEngineClient
 	locale              *gotext.Locale
 	nameSuffix          string
 	agentPoolsToUpgrade map[string]bool
 	timeout             *time.Duration
+	maxSurgeOverride    *int
+	maxUnavailOverride  *int
+	rollbackSnapshot    *kubernetesupgrade.RollbackSnapshot
+	sshRunner           operations.RemoteRunner
+	events              *operations.EventStream
 }
 
 func newUpgradeCmd() *cobra.Command {
@@ -69,6 +86,16 @@ func newUpgradeCmd() *cobra.Command {
 	f.StringVar(&uc.deploymentDirectory, "deployment-dir", "", "the location of the output from `generate` (required)")
 	f.StringVarP(&uc.upgradeVersion, "upgrade-version", "k", "", "desired kubernetes version (required)")
 	f.IntVar(&uc.timeoutInMinutes, "vm-timeout", -1, "how long to wait for each vm to be upgraded in minutes")
+	f.IntVar(&uc.maxSurge, "max-surge", -1, "how many nodes above its count each agent pool may grow to while upgrading, overrides the agent pool maxSurge (default 1, AvailabilitySet agent pools only)")
+	f.IntVar(&uc.maxUnavailable, "max-unavailable", -1, "how many nodes below its count each agent pool may shrink to while upgrading, overrides the agent pool maxUnavailable (default 0, AvailabilitySet agent pools only)")
+	f.BoolVar(&uc.dryRun, "dry-run", false, "print the upgrade plan as JSON without making any changes")
+	f.BoolVar(&uc.resume, "resume", false, "continue a failed or interrupted upgrade from the checkpoint in the deployment directory")
+	f.BoolVar(&uc.discardCheckpoint, "discard-checkpoint", false, "delete the checkpoint of an unfinished upgrade in the deployment directory and start the upgrade over")
+	f.BoolVar(&uc.rollback, "rollback", false, "revert a partially upgraded cluster to the Kubernetes version recorded in the checkpoint in the deployment directory, without the pre-flight health checks")
+	f.BoolVar(&uc.skipHealthChecks, "skip-health-checks", false, "do not check the health of the cluster before the upgrade and between nodes")
+	f.BoolVar(&uc.skipEtcdBackup, "skip-etcd-backup", false, "do not save a snapshot of etcd to the deployment directory before the upgrade")
+	f.StringVar(&uc.sshKeyPath, "ssh-key-path", "", "path to the private key used to SSH into the masters to back up etcd (defaults to <adminUsername>_rsa in the deployment directory)")
+	addOutputFormatFlag(&uc.outputFormat, f)
 	addAuthFlags(&uc.authArgs, f)
 
 	return upgradeCmd
@@ -98,7 +125,27 @@ func (uc *upgradeCmd) validate(cmd *cobra.Command) error {
 		uc.timeout = &timeout
 	}
 
-	if uc.upgradeVersion == "" {
+	if uc.maxSurge < -1 || uc.maxUnavailable < -1 {
+		cmd.Usage()
+		return errors.New("--max-surge and --max-unavailable cannot be negative")
+	}
+	if uc.maxSurge != -1 {
+		uc.maxSurgeOverride = &uc.maxSurge
+	}
+	if uc.maxUnavailable != -1 {
+		uc.maxUnavailOverride = &uc.maxUnavailable
+	}
+
+	if uc.rollback {
+		if uc.upgradeVersion != "" {
+			cmd.Usage()
+			return errors.New("--rollback and --upgrade-version cannot be used together")
+		}
+		if uc.dryRun || uc.resume || uc.discardCheckpoint {
+			cmd.Usage()
+			return errors.New("--rollback cannot be used with --dry-run, --resume or --discard-checkpoint")
+		}
+	} else if uc.upgradeVersion == "" {
 		cmd.Usage()
 		return errors.New("--upgrade-version must be specified")
 	}
@@ -107,6 +154,25 @@ func (uc *upgradeCmd) validate(cmd *cobra.Command) error {
 		cmd.Usage()
 		return errors.New("--deployment-dir must be specified")
 	}
+
+	if uc.dryRun && uc.resume {
+		cmd.Usage()
+		return errors.New("--dry-run and --resume cannot be used together")
+	}
+
+	if uc.resume && uc.discardCheckpoint {
+		cmd.Usage()
+		return errors.New("--resume and --discard-checkpoint cannot be used together")
+	}
+
+	if err = validateOutputFormat(uc.outputFormat); err != nil {
+		cmd.Usage()
+		return err
+	}
+	if uc.dryRun && uc.outputFormat == "json" {
+		cmd.Usage()
+		return errors.New("--dry-run already prints JSON and cannot be used with --output-format json")
+	}
 	return nil
 }
 
@@ -121,28 +187,31 @@ func (uc *upgradeCmd) loadCluster(cmd *cobra.Command) error {
 		return errors.Wrap(err, "failed to get client")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
-	defer cancel()
-	_, err = uc.client.EnsureResourceGroup(ctx, uc.resourceGroupName, uc.location, nil)
-	if err != nil {
-		return errors.Wrap(err, "error ensuring resource group")
+	if !uc.dryRun {
+		ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+		defer cancel()
+		_, err = uc.client.EnsureResourceGroup(ctx, uc.resourceGroupName, uc.location, nil)
+		if err != nil {
+			return errors.Wrap(err, "error ensuring resource group")
+		}
 	}
 
 	// Load apimodel from the deployment directory.
-	apiModelPath := path.Join(uc.deploymentDirectory, "apimodel.json")
+	uc.apiModelPath = api.FindAPIModelFile(uc.deploymentDirectory)
 
-	if _, err = os.Stat(apiModelPath); os.IsNotExist(err) {
-		return errors.Errorf("specified api model does not exist (%s)", apiModelPath)
+	if _, err = os.Stat(uc.apiModelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", uc.apiModelPath)
 	}
 
 	apiloader := &api.Apiloader{
 		Translator: &i18n.Translator{
 			Locale: uc.locale,
 		},
+		KeyVaultClient: uc.client,
 	}
 
 	// Load the container service.
-	uc.containerService, uc.apiVersion, err = apiloader.LoadContainerServiceFromFile(apiModelPath, true, true, nil)
+	uc.containerService, uc.apiVersion, err = apiloader.LoadContainerServiceFromFile(uc.apiModelPath, true, true, nil)
 	if err != nil {
 		return errors.Wrap(err, "error parsing the api model")
 	}
@@ -153,6 +222,22 @@ func (uc *upgradeCmd) loadCluster(cmd *cobra.Command) error {
 		return errors.New("--location does not match api model location")
 	}
 
+	if uc.rollback {
+		// a rollback returns the cluster to the version recorded by the failed upgrade
+		if uc.rollbackSnapshot, err = kubernetesupgrade.LoadRollbackSnapshot(path.Join(uc.deploymentDirectory, kubernetesupgrade.CheckpointFilename)); err != nil {
+			return err
+		}
+		uc.upgradeVersion = uc.rollbackSnapshot.OrchestratorVersion
+	} else if !uc.dryRun {
+		// keep the template the cluster was deployed with, to recreate masters that fail to upgrade
+		deployedTemplate, deployedParameters, err := loadDeployedTemplate(uc.deploymentDirectory)
+		if err != nil {
+			log.Warnf("Masters that fail to upgrade cannot be rolled back: %v", err)
+		} else {
+			uc.rollbackSnapshot = kubernetesupgrade.NewRollbackSnapshot(uc.containerService.Properties.OrchestratorProfile.OrchestratorVersion, deployedTemplate, deployedParameters)
+		}
+	}
+
 	// Get available upgrades for container service.
 	orchestratorInfo, err := api.GetOrchestratorVersionProfile(uc.containerService.Properties.OrchestratorProfile, uc.containerService.Properties.HasWindows())
 	if err != nil {
@@ -231,18 +316,22 @@ func (uc *upgradeCmd) run(cmd *cobra.Command, args []string) error {
 		log.Fatalf("Error validating upgrade command: %v", err)
 	}
 
-	err = uc.loadCluster(cmd)
+	uc.events = newEventStream(uc.outputFormat, cmd.OutOrStdout())
+	err = uc.events.Phase("load-cluster", func() error { return uc.loadCluster(cmd) })
 	if err != nil {
-		log.Fatalf("Error loading existing cluster: %v", err)
+		uc.fatalf(err, "Error loading existing cluster: %v", err)
 	}
 
 	upgradeCluster := kubernetesupgrade.UpgradeCluster{
 		Translator: &i18n.Translator{
 			Locale: uc.locale,
 		},
-		Logger:      log.NewEntry(log.New()),
-		Client:      uc.client,
-		StepTimeout: uc.timeout,
+		Logger:         log.NewEntry(log.New()),
+		Client:         uc.client,
+		StepTimeout:    uc.timeout,
+		MaxSurge:       uc.maxSurgeOverride,
+		MaxUnavailable: uc.maxUnavailOverride,
+		Events:         uc.events,
 	}
 
 	upgradeCluster.ClusterTopology = kubernetesupgrade.ClusterTopology{}
@@ -251,14 +340,40 @@ func (uc *upgradeCmd) run(cmd *cobra.Command, args []string) error {
 	upgradeCluster.DataModel = uc.containerService
 	upgradeCluster.NameSuffix = uc.nameSuffix
 	upgradeCluster.AgentPoolsToUpgrade = uc.agentPoolsToUpgrade
+	upgradeCluster.CheckpointPath = path.Join(uc.deploymentDirectory, kubernetesupgrade.CheckpointFilename)
+	upgradeCluster.Resume = uc.resume
+	upgradeCluster.DiscardCheckpoint = uc.discardCheckpoint
+	upgradeCluster.Rollback = uc.rollback
+	upgradeCluster.RollbackSnapshot = uc.rollbackSnapshot
+	if uc.skipHealthChecks {
+		upgradeCluster.HealthChecks = []operations.HealthCheck{}
+	}
 
 	kubeConfig, err := engine.GenerateKubeConfig(uc.containerService.Properties, uc.location)
 	if err != nil {
-		log.Fatalf("Failed to generate kubeconfig: %v", err)
+		uc.fatalf(err, "Failed to generate kubeconfig: %v", err)
+	}
+
+	if uc.dryRun {
+		deployedTemplate, deployedParameters, err := loadDeployedTemplate(uc.deploymentDirectory)
+		if err != nil {
+			return err
+		}
+		plan, err := upgradeCluster.PlanUpgrade(uc.client, kubeConfig, BuildTag, deployedTemplate, deployedParameters)
+		if err != nil {
+			return errors.Wrap(err, "error planning upgrade")
+		}
+		return printPlan(cmd.OutOrStdout(), plan)
+	}
+
+	if !uc.skipEtcdBackup {
+		if err = uc.events.Phase("backup-etcd", uc.backupEtcd); err != nil {
+			uc.fatalf(err, "Error backing up etcd, use --skip-etcd-backup to upgrade without a backup: %v", err)
+		}
 	}
 
 	if err = upgradeCluster.UpgradeCluster(uc.client, kubeConfig, BuildTag); err != nil {
-		log.Fatalf("Error upgrading cluster: %v\n", err)
+		uc.fatalf(err, "Error upgrading cluster: %v\n", err)
 	}
 
 	// Save the new apimodel to reflect the cluster's state.
@@ -266,17 +381,53 @@ func (uc *upgradeCmd) run(cmd *cobra.Command, args []string) error {
 		Translator: &i18n.Translator{
 			Locale: uc.locale,
 		},
+		KeyVaultClient: uc.client,
+	}
+	err = uc.events.Phase("save-api-model", func() error {
+		return apiloader.SaveContainerService(uc.containerService, uc.apiVersion, uc.deploymentDirectory, path.Base(uc.apiModelPath), nil)
+	})
+	uc.events.Finish(err)
+	return err
+}
+
+// fatalf ends the event stream with err before exiting
+func (uc *upgradeCmd) fatalf(err error, format string, args ...interface{}) {
+	uc.events.Finish(err)
+	log.Fatalf(format, args...)
+}
+
+// backupEtcd saves a snapshot of etcd to the deployment directory, so the cluster state can be restored with
+// `etcd restore` if the upgrade goes wrong. The backup is skipped if the cluster does not support etcd snapshots
+// or has no SSH key to reach the masters with; failing to save a snapshot from any master is an error.
+func (uc *upgradeCmd) backupEtcd() error {
+	properties := uc.containerService.Properties
+	if err := validateEtcdSnapshotSupported(properties); err != nil {
+		log.Warnf("Skipping etcd backup: %v", err)
+		return nil
+	}
+	if uc.sshRunner == nil {
+		runner, err := newSSHRemoteRunner(properties.LinuxProfile, uc.deploymentDirectory, uc.sshKeyPath)
+		if err != nil {
+			log.Warnf("Skipping etcd backup: %v", err)
+			return nil
+		}
+		uc.sshRunner = runner
+	}
+
+	s := &operations.EtcdSnapshotter{
+		Runner:             uc.sshRunner,
+		Logger:             log.WithField("source", "upgrade command line"),
+		CertificateProfile: properties.CertificateProfile,
 	}
-	b, err := apiloader.SerializeContainerService(uc.containerService, uc.apiVersion)
+	masterFQDN := api.FormatAzureProdFQDNByLocation(properties.MasterProfile.DNSPrefix, uc.location)
+	snapshot, err := takeEtcdSnapshot(s, masterHosts(masterFQDN, properties.MasterProfile.Count))
 	if err != nil {
 		return err
 	}
-
-	f := helpers.FileSaver{
-		Translator: &i18n.Translator{
-			Locale: uc.locale,
-		},
+	snapshotPath := path.Join(uc.deploymentDirectory, etcdSnapshotFilename(properties.MasterProfile.DNSPrefix, time.Now()))
+	if err = ioutil.WriteFile(snapshotPath, snapshot, 0600); err != nil {
+		return errors.Wrap(err, "failed to write the etcd snapshot")
 	}
-
-	return f.SaveFile(uc.deploymentDirectory, "apimodel.json", b)
+	log.Infof("Saved a snapshot of etcd to %s", snapshotPath)
+	return nil
 }
@@ -4,6 +4,12 @@
 package cmd
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/Azure/aks-engine/pkg/api"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
@@ -22,6 +28,42 @@ var _ = Describe("the upgrade command", func() {
 		Expect(output.Flags().Lookup("resource-group")).NotTo(BeNil())
 		Expect(output.Flags().Lookup("deployment-dir")).NotTo(BeNil())
 		Expect(output.Flags().Lookup("upgrade-version")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("dry-run")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("resume")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("discard-checkpoint")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("max-surge")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("max-unavailable")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("skip-health-checks")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("rollback")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("skip-etcd-backup")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("ssh-key-path")).NotTo(BeNil())
+		Expect(output.Flags().Lookup("output-format")).NotTo(BeNil())
+	})
+
+	It("should back up etcd to the deployment directory", func() {
+		outdir, err := ioutil.TempDir("", "upgrade")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(outdir)
+
+		cs := api.CreateMockContainerService("testcluster", "1.10.13", 3, 2, false)
+		runner := &fakeRemoteRunner{outputs: map[string]string{"snapshot save": "snapshot"}}
+		uc := &upgradeCmd{
+			deploymentDirectory: outdir,
+			location:            "westus",
+			containerService:    cs,
+			sshRunner:           runner,
+		}
+		Expect(uc.backupEtcd()).To(Succeed())
+		files, err := filepath.Glob(path.Join(outdir, "*-etcd-*.db.gz"))
+		Expect(err).To(BeNil())
+		Expect(files).To(HaveLen(1))
+
+		// the backup is skipped without an SSH key
+		uc.sshRunner = nil
+		Expect(uc.backupEtcd()).To(Succeed())
+
+		uc.sshRunner = &fakeRemoteRunner{failOn: "snapshot save"}
+		Expect(uc.backupEtcd()).NotTo(Succeed())
 	})
 
 	It("should validate an upgrade command", func() {
@@ -81,6 +123,89 @@ var _ = Describe("the upgrade command", func() {
 				},
 				expectedErr: errors.New("--deployment-dir must be specified"),
 			},
+			{
+				uc: &upgradeCmd{
+					resourceGroupName:   "test",
+					deploymentDirectory: "_output/mydir",
+					upgradeVersion:      "1.9.0",
+					location:            "southcentralus",
+					maxSurge:            -2,
+					maxUnavailable:      -1,
+				},
+				expectedErr: errors.New("--max-surge and --max-unavailable cannot be negative"),
+			},
+			{
+				uc: &upgradeCmd{
+					resourceGroupName:   "test",
+					deploymentDirectory: "_output/mydir",
+					upgradeVersion:      "1.9.0",
+					location:            "southcentralus",
+					dryRun:              true,
+					resume:              true,
+				},
+				expectedErr: errors.New("--dry-run and --resume cannot be used together"),
+			},
+			{
+				uc: &upgradeCmd{
+					resourceGroupName:   "test",
+					deploymentDirectory: "_output/mydir",
+					upgradeVersion:      "1.9.0",
+					location:            "southcentralus",
+					resume:              true,
+					discardCheckpoint:   true,
+				},
+				expectedErr: errors.New("--resume and --discard-checkpoint cannot be used together"),
+			},
+			{
+				uc: &upgradeCmd{
+					resourceGroupName:   "test",
+					deploymentDirectory: "_output/mydir",
+					upgradeVersion:      "1.9.0",
+					location:            "southcentralus",
+					outputFormat:        "yaml",
+				},
+				expectedErr: errors.New("unsupported output format: yaml"),
+			},
+			{
+				uc: &upgradeCmd{
+					resourceGroupName:   "test",
+					deploymentDirectory: "_output/mydir",
+					upgradeVersion:      "1.9.0",
+					location:            "southcentralus",
+					dryRun:              true,
+					outputFormat:        "json",
+				},
+				expectedErr: errors.New("--dry-run already prints JSON and cannot be used with --output-format json"),
+			},
+			{
+				uc: &upgradeCmd{
+					resourceGroupName:   "test",
+					deploymentDirectory: "_output/mydir",
+					upgradeVersion:      "1.9.0",
+					location:            "southcentralus",
+					rollback:            true,
+				},
+				expectedErr: errors.New("--rollback and --upgrade-version cannot be used together"),
+			},
+			{
+				uc: &upgradeCmd{
+					resourceGroupName:   "test",
+					deploymentDirectory: "_output/mydir",
+					location:            "southcentralus",
+					rollback:            true,
+					resume:              true,
+				},
+				expectedErr: errors.New("--rollback cannot be used with --dry-run, --resume or --discard-checkpoint"),
+			},
+			{
+				uc: &upgradeCmd{
+					resourceGroupName:   "test",
+					deploymentDirectory: "_output/mydir",
+					location:            "southcentralus",
+					rollback:            true,
+				},
+				expectedErr: nil,
+			},
 			{
 				uc: &upgradeCmd{
 					resourceGroupName:   "test",
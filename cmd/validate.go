@@ -0,0 +1,219 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/api/vlabs"
+	"github.com/Azure/aks-engine/pkg/engine"
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/leonelquinteros/gotext"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	validateName             = "validate"
+	validateShortDescription = "Validate an api model without deploying it"
+	validateLongDescription  = "Load, default and generate the ARM template for an api model without Azure credentials, reporting every problem found"
+)
+
+const (
+	validateStageLoad     = "load"
+	validateStageValidate = "validate"
+	validateStageDefaults = "defaults"
+	validateStageGenerate = "generate"
+)
+
+type validateCmd struct {
+	apimodelPath string
+	outputFormat string
+
+	// derived
+	locale *gotext.Locale
+	out    io.Writer
+}
+
+// validationProblem is a single problem found in an api model
+type validationProblem struct {
+	Stage   string `json:"stage"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// validationResult is the outcome of validating an api model
+type validationResult struct {
+	APIModel string              `json:"apiModel"`
+	Valid    bool                `json:"valid"`
+	Errors   []validationProblem `json:"errors"`
+}
+
+func newValidateCmd() *cobra.Command {
+	vc := validateCmd{
+		out: os.Stdout,
+	}
+
+	validateCmd := &cobra.Command{
+		Use:   validateName,
+		Short: validateShortDescription,
+		Long:  validateLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := vc.validate(cmd, args); err != nil {
+				return errors.Wrap(err, "failed to validate validate command")
+			}
+			return vc.run()
+		},
+	}
+
+	f := validateCmd.Flags()
+	f.StringVarP(&vc.apimodelPath, "api-model", "m", "", "path to the apimodel file")
+	f.StringVarP(&vc.outputFormat, "output", "o", "human", fmt.Sprintf("Output format to use: %s", outputFormatOptions))
+
+	return validateCmd
+}
+
+func (vc *validateCmd) validate(cmd *cobra.Command, args []string) error {
+	var err error
+
+	vc.locale, err = i18n.LoadTranslations()
+	if err != nil {
+		return errors.Wrap(err, "error loading translation files")
+	}
+
+	if vc.apimodelPath == "" {
+		if len(args) == 1 {
+			vc.apimodelPath = args[0]
+		} else if len(args) > 1 {
+			cmd.Usage()
+			return errors.New("too many arguments were provided to 'validate'")
+		} else {
+			cmd.Usage()
+			return errors.New("--api-model was not supplied, nor was one specified as a positional argument")
+		}
+	}
+
+	if _, err := os.Stat(vc.apimodelPath); os.IsNotExist(err) {
+		return errors.Errorf("specified api model does not exist (%s)", vc.apimodelPath)
+	}
+
+	if vc.outputFormat != "human" && vc.outputFormat != "json" {
+		cmd.Usage()
+		return errors.Errorf("unsupported output format: %s", vc.outputFormat)
+	}
+
+	return nil
+}
+
+func (vc *validateCmd) run() error {
+	result := vc.validateAPIModel()
+
+	if err := vc.printResult(result); err != nil {
+		return err
+	}
+	if !result.Valid {
+		return errors.Errorf("api model %s has %d problem(s)", vc.apimodelPath, len(result.Errors))
+	}
+	return nil
+}
+
+// validateAPIModel runs the api model through the same load, defaults and template generation steps as `generate`
+// without writing anything. Each step depends on the previous one, so validation stops after the first failing step.
+func (vc *validateCmd) validateAPIModel() *validationResult {
+	result := &validationResult{
+		APIModel: vc.apimodelPath,
+		Errors:   []validationProblem{},
+	}
+
+	translator := &i18n.Translator{
+		Locale: vc.locale,
+	}
+	apiloader := &api.Apiloader{
+		Translator: translator,
+	}
+	containerService, _, err := apiloader.LoadContainerServiceFromFile(vc.apimodelPath, true, false, nil)
+	if err != nil {
+		result.Errors = vc.loadProblems(apiloader, err)
+		return result
+	}
+
+	if _, err = containerService.SetPropertiesDefaults(false, false); err != nil {
+		result.Errors = append(result.Errors, validationProblem{Stage: validateStageDefaults, Field: "properties", Message: err.Error()})
+		return result
+	}
+
+	templateGenerator, err := engine.InitializeTemplateGenerator(engine.Context{Translator: translator})
+	if err != nil {
+		result.Errors = append(result.Errors, validationProblem{Stage: validateStageGenerate, Message: err.Error()})
+		return result
+	}
+	if _, _, err = templateGenerator.GenerateTemplate(containerService, engine.DefaultGeneratorCode, BuildTag); err != nil {
+		result.Errors = append(result.Errors, validationProblem{Stage: validateStageGenerate, Message: err.Error()})
+		return result
+	}
+
+	result.Valid = true
+	return result
+}
+
+// loadProblems expands the error returned by the api loader into every validation error in the api model.
+// The loader stops at the first error, so vlabs api models are read the way the loader reads them, YAML and
+// saved secrets included, and validated again with all errors collected.
+func (vc *validateCmd) loadProblems(apiloader *api.Apiloader, loadErr error) []validationProblem {
+	loadProblem := []validationProblem{{Stage: validateStageLoad, Message: loadErr.Error()}}
+
+	contents, err := apiloader.ReadAPIModelFile(vc.apimodelPath)
+	if err != nil {
+		return loadProblem
+	}
+	m := &api.TypeMeta{}
+	if err = json.Unmarshal(contents, m); err != nil || m.APIVersion != vlabs.APIVersion {
+		return loadProblem
+	}
+	cs := &vlabs.ContainerService{}
+	if err = json.Unmarshal(contents, cs); err != nil || cs.Properties == nil {
+		return loadProblem
+	}
+
+	fieldErrs := cs.Properties.ValidateAll(false)
+	if len(fieldErrs) == 0 {
+		// the api model is valid, the loader failed for another reason
+		return loadProblem
+	}
+	problems := []validationProblem{}
+	for _, fe := range fieldErrs {
+		problems = append(problems, validationProblem{Stage: validateStageValidate, Field: fe.Field, Message: fe.Err.Error()})
+	}
+	return problems
+}
+
+func (vc *validateCmd) printResult(result *validationResult) error {
+	if vc.outputFormat == "json" {
+		b, err := helpers.JSONMarshalIndent(result, "", "  ", false)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal validation result")
+		}
+		fmt.Fprintln(vc.out, string(b))
+		return nil
+	}
+
+	if result.Valid {
+		fmt.Fprintf(vc.out, "%s is valid\n", result.APIModel)
+		return nil
+	}
+	fmt.Fprintf(vc.out, "%s has %d problem(s):\n", result.APIModel, len(result.Errors))
+	for _, p := range result.Errors {
+		if p.Field != "" {
+			fmt.Fprintf(vc.out, "  [%s] %s: %s\n", p.Stage, p.Field, p.Message)
+		} else {
+			fmt.Fprintf(vc.out, "  [%s] %s\n", p.Stage, p.Message)
+		}
+	}
+	return nil
+}
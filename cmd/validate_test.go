@@ -0,0 +1,178 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/spf13/cobra"
+)
+
+func TestNewValidateCmd(t *testing.T) {
+	output := newValidateCmd()
+	if output.Use != validateName || output.Short != validateShortDescription || output.Long != validateLongDescription {
+		t.Fatalf("validate command should have use %s equal %s, short %s equal %s and long %s equal to %s", output.Use, validateName, output.Short, validateShortDescription, output.Long, validateLongDescription)
+	}
+
+	expectedFlags := []string{"api-model", "output"}
+	for _, f := range expectedFlags {
+		if output.Flags().Lookup(f) == nil {
+			t.Fatalf("validate command should have flag %s", f)
+		}
+	}
+}
+
+func TestValidateCmdValidate(t *testing.T) {
+	r := &cobra.Command{}
+
+	cases := []struct {
+		vc          *validateCmd
+		args        []string
+		expectedErr string
+	}{
+		{
+			vc:          &validateCmd{outputFormat: "human"},
+			args:        []string{},
+			expectedErr: "--api-model was not supplied, nor was one specified as a positional argument",
+		},
+		{
+			vc:          &validateCmd{outputFormat: "human"},
+			args:        []string{"a.json", "b.json"},
+			expectedErr: "too many arguments were provided to 'validate'",
+		},
+		{
+			vc:          &validateCmd{outputFormat: "human"},
+			args:        []string{"does-not-exist.json"},
+			expectedErr: "specified api model does not exist (does-not-exist.json)",
+		},
+		{
+			vc:          &validateCmd{outputFormat: "yaml"},
+			args:        []string{"../pkg/engine/testdata/simple/kubernetes.json"},
+			expectedErr: "unsupported output format: yaml",
+		},
+		{
+			vc:   &validateCmd{outputFormat: "json"},
+			args: []string{"../pkg/engine/testdata/simple/kubernetes.json"},
+		},
+	}
+
+	for _, c := range cases {
+		err := c.vc.validate(r, c.args)
+		if c.expectedErr == "" && err != nil {
+			t.Fatalf("expected validate command to validate with no error, got %s", err)
+		}
+		if c.expectedErr != "" && (err == nil || err.Error() != c.expectedErr) {
+			t.Fatalf("expected validate command to return error %s, got %v", c.expectedErr, err)
+		}
+	}
+}
+
+func TestValidateCmdRun(t *testing.T) {
+	var out bytes.Buffer
+	vc := &validateCmd{
+		apimodelPath: "../pkg/engine/testdata/simple/kubernetes.json",
+		outputFormat: "human",
+		out:          &out,
+	}
+	if err := vc.validate(&cobra.Command{}, []string{}); err != nil {
+		t.Fatalf("unexpected error validating validate command: %s", err)
+	}
+	if err := vc.run(); err != nil {
+		t.Fatalf("expected a valid api model, got %s: %s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "is valid") {
+		t.Fatalf("expected api model to be reported as valid, got %s", out.String())
+	}
+}
+
+func TestValidateCmdRunReportsAllErrors(t *testing.T) {
+	contents, err := ioutil.ReadFile("../pkg/engine/testdata/simple/kubernetes.json")
+	if err != nil {
+		t.Fatalf("unable to read test api model: %s", err)
+	}
+	invalid := strings.Replace(string(contents), `"dnsPrefix": "masterdns1"`, `"dnsPrefix": "-masterdns1"`, 1)
+	invalid = strings.Replace(invalid, `"name": "agentpool2"`, `"name": "agentpool1"`, 1)
+
+	f, err := ioutil.TempFile("", "apimodel")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString(invalid); err != nil {
+		t.Fatalf("unable to write test api model: %s", err)
+	}
+	f.Close()
+
+	var out bytes.Buffer
+	vc := &validateCmd{
+		apimodelPath: f.Name(),
+		outputFormat: "json",
+		out:          &out,
+	}
+	if err = vc.run(); err == nil {
+		t.Fatalf("expected an invalid api model to return an error")
+	}
+
+	result := &validationResult{}
+	if err = json.Unmarshal(out.Bytes(), result); err != nil {
+		t.Fatalf("expected json output, got %s", out.String())
+	}
+	if result.Valid || len(result.Errors) != 2 {
+		t.Fatalf("expected 2 validation errors, got %+v", result)
+	}
+	if result.Errors[0].Field != "properties.masterProfile" || result.Errors[1].Field != "properties.agentPoolProfiles[1].name" {
+		t.Fatalf("unexpected validation error fields %+v", result.Errors)
+	}
+}
+
+func TestValidateCmdRunReportsAllErrorsYAML(t *testing.T) {
+	contents, err := ioutil.ReadFile("../pkg/engine/testdata/simple/kubernetes.json")
+	if err != nil {
+		t.Fatalf("unable to read test api model: %s", err)
+	}
+	invalid := strings.Replace(string(contents), `"dnsPrefix": "masterdns1"`, `"dnsPrefix": "-masterdns1"`, 1)
+	invalid = strings.Replace(invalid, `"name": "agentpool2"`, `"name": "agentpool1"`, 1)
+
+	dir, err := ioutil.TempDir("", "apimodel")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	apimodelPath := filepath.Join(dir, "apimodel.yaml")
+	b, err := api.FormatAPIModel(apimodelPath, []byte(invalid))
+	if err != nil {
+		t.Fatalf("unable to convert test api model to YAML: %s", err)
+	}
+	if err = ioutil.WriteFile(apimodelPath, b, 0600); err != nil {
+		t.Fatalf("unable to write test api model: %s", err)
+	}
+
+	var out bytes.Buffer
+	vc := &validateCmd{
+		apimodelPath: apimodelPath,
+		outputFormat: "json",
+		out:          &out,
+	}
+	if err = vc.run(); err == nil {
+		t.Fatalf("expected an invalid api model to return an error")
+	}
+
+	result := &validationResult{}
+	if err = json.Unmarshal(out.Bytes(), result); err != nil {
+		t.Fatalf("expected json output, got %s", out.String())
+	}
+	if result.Valid || len(result.Errors) != 2 {
+		t.Fatalf("expected 2 validation errors, got %+v", result)
+	}
+	if result.Errors[0].Field != "properties.masterProfile" || result.Errors[1].Field != "properties.agentPoolProfiles[1].name" {
+		t.Fatalf("unexpected validation error fields %+v", result.Errors)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"io/ioutil"
+	"path/filepath"
 	"reflect"
 
 	v20170831 "github.com/Azure/aks-engine/pkg/api/agentPoolOnlyApi/v20170831"
@@ -27,17 +28,111 @@ import (
 // Apiloader represents the object that loads api model
 type Apiloader struct {
 	Translator *i18n.Translator
+	// SecretStore loads the secrets saved next to the api model file, instead of the store recorded in their manifest
+	SecretStore SecretStore
+	// KeyVaultClient loads the secrets of api models whose secrets are saved in Key Vault
+	KeyVaultClient KeyVaultClient
 }
 
-// LoadContainerServiceFromFile loads an AKS Cluster API Model from a JSON file
+// LoadContainerServiceFromFile loads an AKS Cluster API Model from a JSON or YAML file
 func (a *Apiloader) LoadContainerServiceFromFile(jsonFile string, validate, isUpdate bool, existingContainerService *ContainerService) (*ContainerService, string, error) {
-	contents, e := ioutil.ReadFile(jsonFile)
+	contents, e := a.ReadAPIModelFile(jsonFile)
 	if e != nil {
-		return nil, "", a.Translator.Errorf("error reading file %s: %s", jsonFile, e.Error())
+		return nil, "", e
 	}
 	return a.DeserializeContainerService(contents, validate, isUpdate, existingContainerService)
 }
 
+// ReadAPIModelFile reads the api model file as JSON, with the secrets saved next to it set in its contents
+func (a *Apiloader) ReadAPIModelFile(jsonFile string) ([]byte, error) {
+	contents, e := ioutil.ReadFile(jsonFile)
+	if e != nil {
+		return nil, a.Translator.Errorf("error reading file %s: %s", jsonFile, e.Error())
+	}
+	if contents, e = APIModelToJSON(contents); e != nil {
+		return nil, errors.Wrapf(e, "error reading file %s", jsonFile)
+	}
+	return a.resolveSecrets(jsonFile, contents)
+}
+
+// resolveSecrets sets the secrets saved next to the api model file in its contents
+func (a *Apiloader) resolveSecrets(jsonFile string, contents []byte) ([]byte, error) {
+	manifest, err := LoadSecretsManifest(filepath.Dir(jsonFile))
+	if err != nil || manifest == nil {
+		return contents, err
+	}
+
+	store := a.SecretStore
+	if store == nil {
+		if store, err = manifest.SecretStore(a.KeyVaultClient); err != nil {
+			return nil, err
+		}
+	}
+	secrets, err := store.Load(manifest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading the secrets of %s", jsonFile)
+	}
+	return injectSecrets(contents, secrets)
+}
+
+// SaveContainerService writes the container service to the api model file in dir, as YAML when the file is
+// named so. Its secrets are saved to store, or to the store of the secrets manifest already in dir when store
+// is nil. They are left in the api model when there is neither.
+func (a *Apiloader) SaveContainerService(containerService *ContainerService, version, dir, filename string, store SecretStore) error {
+	f := &helpers.FileSaver{
+		Translator: a.Translator,
+	}
+	store, err := a.SecretStoreFor(dir, store)
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		b, err := a.SerializeContainerService(containerService, version)
+		if err != nil {
+			return err
+		}
+		if b, err = FormatAPIModel(filename, b); err != nil {
+			return err
+		}
+		return f.SaveFile(dir, filename, b)
+	}
+
+	secrets := ExtractSecrets(containerService)
+	b, err := a.SerializeContainerService(containerService, version)
+	RestoreSecrets(containerService, secrets)
+	if err != nil {
+		return err
+	}
+	if b, err = FormatAPIModel(filename, b); err != nil {
+		return err
+	}
+	manifest, err := store.Save(secrets)
+	if err != nil {
+		return errors.Wrap(err, "error saving the secrets of the api model")
+	}
+	m, err := helpers.JSONMarshalIndent(manifest, "", "  ", false)
+	if err != nil {
+		return err
+	}
+	if err = f.SaveFile(dir, SecretsFilename, m); err != nil {
+		return err
+	}
+	return f.SaveFile(dir, filename, b)
+}
+
+// SecretStoreFor returns store, or the store of the secrets manifest already in dir when store is nil.
+// It returns nil when the secrets of the api model in dir are kept in the api model.
+func (a *Apiloader) SecretStoreFor(dir string, store SecretStore) (SecretStore, error) {
+	if store != nil {
+		return store, nil
+	}
+	manifest, err := LoadSecretsManifest(dir)
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+	return manifest.SecretStore(a.KeyVaultClient)
+}
+
 // LoadDefaultContainerServiceProperties loads the default API model
 func LoadDefaultContainerServiceProperties() (TypeMeta, *vlabs.Properties) {
 	return TypeMeta{APIVersion: vlabs.APIVersion}, &vlabs.Properties{
@@ -61,10 +156,14 @@ func LoadDefaultContainerServiceProperties() (TypeMeta, *vlabs.Properties) {
 	}
 }
 
-// DeserializeContainerService loads an AKS Cluster API Model, validates it, and returns the unversioned representation
+// DeserializeContainerService loads an AKS Cluster API Model written in JSON or YAML, validates it, and returns the unversioned representation
 func (a *Apiloader) DeserializeContainerService(contents []byte, validate, isUpdate bool, existingContainerService *ContainerService) (*ContainerService, string, error) {
+	contents, err := APIModelToJSON(contents)
+	if err != nil {
+		return nil, "", err
+	}
 	m := &TypeMeta{}
-	if err := json.Unmarshal(contents, &m); err != nil {
+	if err = json.Unmarshal(contents, &m); err != nil {
 		return nil, "", err
 	}
 
@@ -409,6 +508,14 @@ func (a *Apiloader) SerializeContainerService(containerService *ContainerService
 	}
 }
 
+// SerializeRedactedContainerService takes an unversioned container service and returns the bytes of the api model
+// without its secrets, so it can be shared
+func (a *Apiloader) SerializeRedactedContainerService(containerService *ContainerService, version string) ([]byte, error) {
+	restore := RedactSecrets(containerService)
+	defer restore()
+	return a.SerializeContainerService(containerService, version)
+}
+
 func (a *Apiloader) serializeHostedContainerService(containerService *ContainerService, version string) ([]byte, error) {
 	switch version {
 	case v20170831.APIVersion:
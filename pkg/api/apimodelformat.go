@@ -0,0 +1,85 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+const (
+	// APIModelFormatJSON writes the api model as JSON, to apimodel.json
+	APIModelFormatJSON = "json"
+	// APIModelFormatYAML writes the api model as YAML, to apimodel.yaml
+	APIModelFormatYAML = "yaml"
+)
+
+// APIModelFormats are the formats the api model can be written in
+var APIModelFormats = []string{APIModelFormatJSON, APIModelFormatYAML}
+
+// APIModelFilename returns the name of the api model file written to the artifacts directory in format
+func APIModelFilename(format string) string {
+	if format == "" {
+		format = APIModelFormatJSON
+	}
+	return "apimodel." + format
+}
+
+// RedactedAPIModelFilename returns the name of the api model file written without its secrets in format
+func RedactedAPIModelFilename(format string) string {
+	if format == "" {
+		format = APIModelFormatJSON
+	}
+	return "apimodel.redacted." + format
+}
+
+// IsYAMLFile returns true if the file is named as a YAML file
+func IsYAMLFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// FindAPIModelFile returns the path of the api model in a deployment directory: apimodel.json, or the YAML
+// api model when only it was written
+func FindAPIModelFile(dir string) string {
+	for _, filename := range []string{APIModelFilename(APIModelFormatJSON), APIModelFilename(APIModelFormatYAML), "apimodel.yml"} {
+		if _, err := os.Stat(filepath.Join(dir, filename)); err == nil {
+			return filepath.Join(dir, filename)
+		}
+	}
+	return filepath.Join(dir, APIModelFilename(APIModelFormatJSON))
+}
+
+// APIModelToJSON returns the JSON of an api model written in either JSON or YAML. JSON api models are returned
+// unchanged, so that the unknown keys of both are detected by the same checks.
+func APIModelToJSON(contents []byte) ([]byte, error) {
+	if trimmed := bytes.TrimSpace(contents); len(trimmed) > 0 && trimmed[0] == '{' {
+		return contents, nil
+	}
+	b, err := yaml.YAMLToJSON(contents)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing the YAML api model")
+	}
+	return b, nil
+}
+
+// FormatAPIModel returns the JSON of a serialized api model in the format of the file it is written to
+func FormatAPIModel(filename string, contents []byte) ([]byte, error) {
+	if !IsYAMLFile(filename) {
+		return contents, nil
+	}
+	b, err := yaml.JSONToYAML(contents)
+	if err != nil {
+		return nil, errors.Wrap(err, "error converting the api model to YAML")
+	}
+	return b, nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/i18n"
+)
+
+func TestAPIModelToJSON(t *testing.T) {
+	contents := []byte("  {\"apiVersion\": \"vlabs\"}")
+	b, err := APIModelToJSON(contents)
+	if err != nil {
+		t.Fatalf("unexpected error converting a JSON api model: %s", err)
+	}
+	if string(b) != string(contents) {
+		t.Fatalf("expected a JSON api model to be returned unchanged, got %s", string(b))
+	}
+
+	b, err = APIModelToJSON([]byte("# comment\napiVersion: vlabs\nproperties:\n  masterProfile:\n    count: 3\n"))
+	if err != nil {
+		t.Fatalf("unexpected error converting a YAML api model: %s", err)
+	}
+	if string(b) != `{"apiVersion":"vlabs","properties":{"masterProfile":{"count":3}}}` {
+		t.Fatalf("unexpected JSON of the YAML api model: %s", string(b))
+	}
+
+	if _, err = APIModelToJSON([]byte("apiVersion: vlabs\n  properties: {\n")); err == nil {
+		t.Fatalf("expected an error converting an invalid YAML api model")
+	}
+}
+
+func TestLoadContainerServiceFromYAMLFile(t *testing.T) {
+	apiloader := &Apiloader{
+		Translator: &i18n.Translator{},
+	}
+
+	fromJSON, _, err := apiloader.LoadContainerServiceFromFile("../engine/testdata/simple/kubernetes.json", true, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error loading the JSON api model: %s", err)
+	}
+	fromYAML, version, err := apiloader.LoadContainerServiceFromFile("../engine/testdata/simple/kubernetes.yaml", true, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error loading the YAML api model: %s", err)
+	}
+	if version != "vlabs" {
+		t.Fatalf("expected the YAML api model version to be vlabs, got %s", version)
+	}
+	if !reflect.DeepEqual(fromJSON, fromYAML) {
+		t.Fatalf("expected the YAML api model to load as its JSON equivalent")
+	}
+
+	// unknown keys are rejected as in JSON api models
+	_, _, err = apiloader.DeserializeContainerService([]byte("apiVersion: vlabs\nproperties:\n  masterProfile:\n    count: 1\n    vmSzie: Standard_D2_v2\n"), false, false, nil)
+	if err == nil || !strings.Contains(err.Error(), "Unknown JSON tag vmSzie") {
+		t.Fatalf("expected the unknown key of the YAML api model to be rejected, got %v", err)
+	}
+}
+
+func TestSaveContainerServiceAsYAML(t *testing.T) {
+	apiloader := &Apiloader{
+		Translator: &i18n.Translator{},
+	}
+	cs, _, err := apiloader.LoadContainerServiceFromFile("../engine/testdata/simple/kubernetes.json", true, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error loading the api model: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "apimodelformat")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if found := FindAPIModelFile(dir); found != path.Join(dir, "apimodel.json") {
+		t.Fatalf("expected apimodel.json to be found in an empty directory, got %s", found)
+	}
+	if err = apiloader.SaveContainerService(cs, "vlabs", dir, APIModelFilename(APIModelFormatYAML), nil); err != nil {
+		t.Fatalf("unexpected error saving the api model as YAML: %s", err)
+	}
+	b, err := ioutil.ReadFile(path.Join(dir, "apimodel.yaml"))
+	if err != nil {
+		t.Fatalf("expected apimodel.yaml to be written: %s", err)
+	}
+	if !strings.Contains(string(b), "apiVersion: vlabs\n") {
+		t.Fatalf("expected apimodel.yaml to be written in YAML, got %s", string(b))
+	}
+
+	found := FindAPIModelFile(dir)
+	if found != path.Join(dir, "apimodel.yaml") {
+		t.Fatalf("expected apimodel.yaml to be found, got %s", found)
+	}
+	saved, _, err := apiloader.LoadContainerServiceFromFile(found, true, true, nil)
+	if err != nil {
+		t.Fatalf("unexpected error loading the saved api model: %s", err)
+	}
+	if saved.Properties.MasterProfile.DNSPrefix != cs.Properties.MasterProfile.DNSPrefix || len(saved.Properties.AgentPoolProfiles) != 2 {
+		t.Fatalf("expected the saved YAML api model to load as the original")
+	}
+}
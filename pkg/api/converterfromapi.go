@@ -1011,6 +1011,8 @@ func convertAgentPoolProfileToVLabs(api *AgentPoolProfile, p *vlabs.AgentPoolPro
 	p.AcceleratedNetworkingEnabledWindows = api.AcceleratedNetworkingEnabledWindows
 	p.AvailabilityZones = api.AvailabilityZones
 	p.SinglePlacementGroup = api.SinglePlacementGroup
+	p.MaxSurge = api.MaxSurge
+	p.MaxUnavailable = api.MaxUnavailable
 
 	for k, v := range api.CustomNodeLabels {
 		p.CustomNodeLabels[k] = v
@@ -511,6 +511,13 @@ func (p *Properties) setHostedMasterProfileDefaults() {
 	p.HostedMasterProfile.Subnet = DefaultKubernetesMasterSubnet
 }
 
+// SetDefaultCerts generates any certificate/key pairs missing from the CertificateProfile,
+// returns true if certs are generated
+func (cs *ContainerService) SetDefaultCerts() (bool, error) {
+	certsGenerated, _, err := cs.Properties.setDefaultCerts()
+	return certsGenerated, err
+}
+
 func (p *Properties) setDefaultCerts() (bool, []net.IP, error) {
 	if p.MasterProfile == nil || p.OrchestratorProfile.OrchestratorType != Kubernetes {
 		return false, nil, nil
@@ -0,0 +1,476 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SecretsFilename is the name of the file written next to apimodel.json to find its secrets again
+	SecretsFilename = "apimodel.secrets.json"
+	// FileSecretStoreKind keeps the secrets in plain text in the secrets file
+	FileSecretStoreKind = "file"
+	// EncryptedFileSecretStoreKind keeps the secrets in the secrets file, encrypted with a local key
+	EncryptedFileSecretStoreKind = "encrypted"
+	// KeyVaultSecretStoreKind keeps the secrets in Azure Key Vault and references to them in the secrets file
+	KeyVaultSecretStoreKind = "keyvault"
+)
+
+// SecretStore keeps the secrets of an api model outside of the serialized api model
+type SecretStore interface {
+	// Save stores the secrets, keyed by their path in the api model, and returns the manifest
+	// written to SecretsFilename to find them again
+	Save(secrets map[string]string) (*SecretsManifest, error)
+	// Load returns the secrets saved with the manifest, keyed by their path in the api model
+	Load(manifest *SecretsManifest) (map[string]string, error)
+}
+
+// SecretsManifest records the store the secrets of an api model were saved in, and what is needed to load them
+type SecretsManifest struct {
+	Store      string                        `json:"store"`
+	Secrets    map[string]string             `json:"secrets,omitempty"`
+	KeyFile    string                        `json:"keyFile,omitempty"`
+	Ciphertext string                        `json:"ciphertext,omitempty"`
+	VaultID    string                        `json:"vaultID,omitempty"`
+	NamePrefix string                        `json:"namePrefix,omitempty"`
+	References map[string]*KeyvaultSecretRef `json:"references,omitempty"`
+}
+
+// SecretStore returns a store loading the secrets of the manifest, which saves new secrets the same way.
+// The client is only needed by secrets kept in Key Vault.
+func (m *SecretsManifest) SecretStore(client KeyVaultClient) (SecretStore, error) {
+	switch m.Store {
+	case FileSecretStoreKind:
+		return &FileSecretStore{}, nil
+	case EncryptedFileSecretStoreKind:
+		return &EncryptedFileSecretStore{KeyFile: m.KeyFile}, nil
+	case KeyVaultSecretStoreKind:
+		return &KeyVaultSecretStore{VaultID: m.VaultID, NamePrefix: m.NamePrefix, Client: client}, nil
+	default:
+		return nil, errors.Errorf("unrecognized secret store '%s' in %s", m.Store, SecretsFilename)
+	}
+}
+
+// KeyVaultClient reads and writes Azure Key Vault secrets
+type KeyVaultClient interface {
+	// GetKeyVaultSecret returns the value of the referenced secret
+	GetKeyVaultSecret(ctx context.Context, ref *KeyvaultSecretRef) (string, error)
+	// SetKeyVaultSecret creates a new version of the named secret and returns a reference to it
+	SetKeyVaultSecret(ctx context.Context, vaultID, name, value string) (*KeyvaultSecretRef, error)
+}
+
+// FileSecretStore keeps the secrets in plain text in the secrets file, which is only readable by its owner
+type FileSecretStore struct{}
+
+// Save returns a manifest holding the secrets
+func (s *FileSecretStore) Save(secrets map[string]string) (*SecretsManifest, error) {
+	return &SecretsManifest{Store: FileSecretStoreKind, Secrets: secrets}, nil
+}
+
+// Load returns the secrets held by the manifest
+func (s *FileSecretStore) Load(manifest *SecretsManifest) (map[string]string, error) {
+	return manifest.Secrets, nil
+}
+
+// EncryptedFileSecretStore keeps the secrets in the secrets file, encrypted with AES-256-GCM and a key kept in a
+// local file. The key file is created when it does not exist.
+type EncryptedFileSecretStore struct {
+	KeyFile string
+}
+
+// Save encrypts the secrets and returns a manifest holding the ciphertext and the path of the key file
+func (s *EncryptedFileSecretStore) Save(secrets map[string]string) (*SecretsManifest, error) {
+	keyFile, err := filepath.Abs(s.KeyFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error resolving key file %s", s.KeyFile)
+	}
+	key, err := readSecretsKey(keyFile)
+	if os.IsNotExist(errors.Cause(err)) {
+		key, err = createSecretsKey(keyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newSecretsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "error generating nonce")
+	}
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	return &SecretsManifest{
+		Store:      EncryptedFileSecretStoreKind,
+		KeyFile:    keyFile,
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// Load decrypts the secrets of the manifest with its key file, or with KeyFile when it is set
+func (s *EncryptedFileSecretStore) Load(manifest *SecretsManifest) (map[string]string, error) {
+	keyFile := manifest.KeyFile
+	if s.KeyFile != "" {
+		keyFile = s.KeyFile
+	}
+	key, err := readSecretsKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(manifest.Ciphertext)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding the encrypted secrets")
+	}
+	gcm, err := newSecretsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("the encrypted secrets are truncated")
+	}
+	nonce := ciphertext[:gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decrypting the secrets with key file %s", keyFile)
+	}
+	secrets := map[string]string{}
+	if err = json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, errors.Wrap(err, "error parsing the decrypted secrets")
+	}
+	return secrets, nil
+}
+
+func readSecretsKey(keyFile string) ([]byte, error) {
+	b, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading key file %s", keyFile)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != 32 {
+		return nil, errors.Errorf("key file %s does not hold a base64 encoded 256 bit key", keyFile)
+	}
+	return key, nil
+}
+
+func createSecretsKey(keyFile string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.Wrap(err, "error generating key")
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return nil, errors.Wrapf(err, "error creating the directory of key file %s", keyFile)
+	}
+	if err := ioutil.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, errors.Wrapf(err, "error writing key file %s", keyFile)
+	}
+	return key, nil
+}
+
+func newSecretsCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// KeyVaultSecretStore keeps every secret in its own secret of the Azure Key Vault VaultID, named after
+// NamePrefix and its path in the api model. The manifest references the secret versions that were written.
+type KeyVaultSecretStore struct {
+	VaultID    string
+	NamePrefix string
+	Client     KeyVaultClient
+}
+
+var invalidKeyVaultSecretNameChars = regexp.MustCompile("[^0-9a-zA-Z-]+")
+
+// Save writes the secrets to Key Vault and returns a manifest referencing them
+func (s *KeyVaultSecretStore) Save(secrets map[string]string) (*SecretsManifest, error) {
+	if s.Client == nil {
+		return nil, errors.New("a Key Vault client is required to save the secrets to Key Vault")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	manifest := &SecretsManifest{
+		Store:      KeyVaultSecretStoreKind,
+		VaultID:    s.VaultID,
+		NamePrefix: s.NamePrefix,
+		References: map[string]*KeyvaultSecretRef{},
+	}
+	for _, p := range sortedSecretPaths(secrets) {
+		name := invalidKeyVaultSecretNameChars.ReplaceAllString(s.NamePrefix+"-"+p, "-")
+		name = strings.Trim(name, "-")
+		ref, err := s.Client.SetKeyVaultSecret(ctx, s.VaultID, name, secrets[p])
+		if err != nil {
+			return nil, errors.Wrapf(err, "error saving secret %s to Key Vault", name)
+		}
+		manifest.References[p] = ref
+	}
+	return manifest, nil
+}
+
+// Load reads the secrets referenced by the manifest from Key Vault
+func (s *KeyVaultSecretStore) Load(manifest *SecretsManifest) (map[string]string, error) {
+	if s.Client == nil {
+		return nil, errors.New("a Key Vault client is required to load the secrets from Key Vault")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	secrets := map[string]string{}
+	for p, ref := range manifest.References {
+		value, err := s.Client.GetKeyVaultSecret(ctx, ref)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error loading secret %s from Key Vault", ref.SecretName)
+		}
+		secrets[p] = value
+	}
+	return secrets, nil
+}
+
+// ExtractSecrets clears the fields of the container service tagged conform:"redact" and returns their values,
+// keyed by their JSON path in the api model. Elements of a list are keyed by their index.
+func ExtractSecrets(cs *ContainerService) map[string]string {
+	secrets := map[string]string{}
+	walkSecrets(reflect.ValueOf(cs), "", func(p string, v reflect.Value) {
+		switch v.Kind() {
+		case reflect.String:
+			if v.String() != "" {
+				secrets[p] = v.String()
+				v.SetString("")
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				secrets[p+"."+strconv.Itoa(i)] = v.Index(i).String()
+			}
+			v.Set(reflect.Zero(v.Type()))
+		}
+	})
+	return secrets
+}
+
+// RestoreSecrets sets the fields of the container service cleared by ExtractSecrets to their values again
+func RestoreSecrets(cs *ContainerService, secrets map[string]string) {
+	walkSecrets(reflect.ValueOf(cs), "", func(p string, v reflect.Value) {
+		switch v.Kind() {
+		case reflect.String:
+			if value, ok := secrets[p]; ok {
+				v.SetString(value)
+			}
+		case reflect.Slice:
+			var values []string
+			for i := 0; ; i++ {
+				value, ok := secrets[p+"."+strconv.Itoa(i)]
+				if !ok {
+					break
+				}
+				values = append(values, value)
+			}
+			if values != nil {
+				v.Set(reflect.ValueOf(values))
+			}
+		}
+	})
+}
+
+// RedactedSecretPlaceholder replaces the redacted secrets an api model needs to be valid, it meets the Windows
+// password complexity requirements
+const RedactedSecretPlaceholder = "Redacted-Secret-0"
+
+// redactedAddonConfig lists the addon config keys holding secrets
+var redactedAddonConfig = []string{"workspaceKey"}
+
+// RedactSecrets blanks the secrets of the container service, which are the fields tagged conform:"redact", the
+// parameters of its extensions and the addon config secrets, and returns a function setting them back.
+// The service principal secret and the Windows admin password are replaced by RedactedSecretPlaceholder instead,
+// so the redacted api model still validates.
+func RedactSecrets(cs *ContainerService) func() {
+	secrets := ExtractSecrets(cs)
+	extensionParameters := map[*ExtensionProfile]string{}
+	addonConfig := map[*KubernetesAddon]map[string]string{}
+	if cs.Properties != nil {
+		if cs.Properties.ServicePrincipalProfile != nil && secrets["properties.servicePrincipalProfile.secret"] != "" {
+			cs.Properties.ServicePrincipalProfile.Secret = RedactedSecretPlaceholder
+		}
+		if cs.Properties.WindowsProfile != nil && secrets["properties.windowsProfile.adminPassword"] != "" {
+			cs.Properties.WindowsProfile.AdminPassword = RedactedSecretPlaceholder
+		}
+		for _, extension := range cs.Properties.ExtensionProfiles {
+			if extension != nil && extension.ExtensionParameters != "" {
+				extensionParameters[extension] = extension.ExtensionParameters
+				extension.ExtensionParameters = ""
+			}
+		}
+		if cs.Properties.OrchestratorProfile != nil && cs.Properties.OrchestratorProfile.KubernetesConfig != nil {
+			addons := cs.Properties.OrchestratorProfile.KubernetesConfig.Addons
+			for i := range addons {
+				for _, key := range redactedAddonConfig {
+					if value, ok := addons[i].Config[key]; ok && value != "" {
+						if addonConfig[&addons[i]] == nil {
+							addonConfig[&addons[i]] = map[string]string{}
+						}
+						addonConfig[&addons[i]][key] = value
+						addons[i].Config[key] = ""
+					}
+				}
+			}
+		}
+	}
+	return func() {
+		RestoreSecrets(cs, secrets)
+		for extension, parameters := range extensionParameters {
+			extension.ExtensionParameters = parameters
+		}
+		for addon, config := range addonConfig {
+			for key, value := range config {
+				addon.Config[key] = value
+			}
+		}
+	}
+}
+
+// walkSecrets calls fn with the JSON path and value of every string or string list field tagged conform:"redact"
+// reachable from v through structs, pointers and lists. Elements of a list are keyed by their index.
+func walkSecrets(v reflect.Value, prefix string, fn func(string, reflect.Value)) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			walkSecrets(v.Index(i), prefix+"."+strconv.Itoa(i), fn)
+		}
+		return
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath != "" || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		p := name
+		if prefix != "" {
+			p = prefix + "." + name
+		}
+		fv := v.Field(i)
+		if field.Tag.Get("conform") == "redact" {
+			if fv.Kind() == reflect.String || (fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String) {
+				fn(p, fv)
+			}
+			continue
+		}
+		walkSecrets(fv, p, fn)
+	}
+}
+
+// LoadSecretsManifest returns the secrets manifest written to dir, or nil when there is none
+func LoadSecretsManifest(dir string) (*SecretsManifest, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, SecretsFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	manifest := &SecretsManifest{}
+	if err = json.Unmarshal(b, manifest); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", SecretsFilename)
+	}
+	return manifest, nil
+}
+
+// injectSecrets sets the secrets in the JSON api model, creating the objects and lists on their path as needed
+func injectSecrets(contents []byte, secrets map[string]string) ([]byte, error) {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(contents, &m); err != nil {
+		return nil, err
+	}
+	for _, p := range sortedSecretPaths(secrets) {
+		if err := setJSONPath(m, strings.Split(p, "."), secrets[p]); err != nil {
+			return nil, errors.Wrapf(err, "error restoring secret %s", p)
+		}
+	}
+	return json.Marshal(m)
+}
+
+func setJSONPath(parent map[string]interface{}, path []string, value string) error {
+	key := path[0]
+	if len(path) == 1 {
+		parent[key] = value
+		return nil
+	}
+	if index, err := strconv.Atoi(path[1]); err == nil {
+		list, _ := parent[key].([]interface{})
+		if list == nil && parent[key] != nil {
+			return errors.Errorf("%s is not a list", key)
+		}
+		for len(list) <= index {
+			list = append(list, nil)
+		}
+		parent[key] = list
+		if len(path) == 2 {
+			list[index] = value
+			return nil
+		}
+		element, ok := list[index].(map[string]interface{})
+		if !ok {
+			if list[index] != nil {
+				return errors.Errorf("%s.%d is not an object", key, index)
+			}
+			element = map[string]interface{}{}
+			list[index] = element
+		}
+		return setJSONPath(element, path[2:], value)
+	}
+	child, ok := parent[key].(map[string]interface{})
+	if !ok {
+		if parent[key] != nil {
+			return errors.Errorf("%s is not an object", key)
+		}
+		child = map[string]interface{}{}
+		parent[key] = child
+	}
+	return setJSONPath(child, path[1:], value)
+}
+
+// sortedSecretPaths returns the paths of the secrets in a stable order
+func sortedSecretPaths(secrets map[string]string) []string {
+	paths := make([]string, 0, len(secrets))
+	for p := range secrets {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,246 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/i18n"
+)
+
+type fakeKeyVaultClient struct {
+	secrets map[string]string
+}
+
+func (c *fakeKeyVaultClient) GetKeyVaultSecret(ctx context.Context, ref *KeyvaultSecretRef) (string, error) {
+	value, ok := c.secrets[ref.VaultID+"/"+ref.SecretName+"/"+ref.SecretVersion]
+	if !ok {
+		return "", fmt.Errorf("secret %s not found", ref.SecretName)
+	}
+	return value, nil
+}
+
+func (c *fakeKeyVaultClient) SetKeyVaultSecret(ctx context.Context, vaultID, name, value string) (*KeyvaultSecretRef, error) {
+	version := fmt.Sprintf("v%d", len(c.secrets))
+	c.secrets[vaultID+"/"+name+"/"+version] = value
+	return &KeyvaultSecretRef{VaultID: vaultID, SecretName: name, SecretVersion: version}, nil
+}
+
+func createSecretsContainerService() *ContainerService {
+	cs := CreateMockContainerService("testcluster", "1.10.13", 3, 2, true)
+	cs.Properties.CertificateProfile.EtcdPeerPrivateKeys = []string{"etcdpeer0key", "etcdpeer1key", "etcdpeer2key"}
+	cs.Properties.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey = "etcdencryptionkey"
+	cs.Properties.WindowsProfile = &WindowsProfile{AdminUsername: "azureuser", AdminPassword: "adminpassword"}
+	return cs
+}
+
+func TestExtractAndRestoreSecrets(t *testing.T) {
+	cs := createSecretsContainerService()
+	secrets := ExtractSecrets(cs)
+
+	expected := map[string]string{
+		"properties.servicePrincipalProfile.secret":                         "DEC923E3-1EF1-4745-9516-37906D56DEC4",
+		"properties.certificateProfile.caPrivateKey":                        "cakey",
+		"properties.certificateProfile.etcdPeerPrivateKeys.2":               "etcdpeer2key",
+		"properties.orchestratorProfile.kubernetesConfig.etcdEncryptionKey": "etcdencryptionkey",
+		"properties.windowsProfile.adminPassword":                           "adminpassword",
+	}
+	for p, value := range expected {
+		if secrets[p] != value {
+			t.Errorf("expected secret %s to be %q, got %q", p, value, secrets[p])
+		}
+	}
+	if cs.Properties.ServicePrincipalProfile.Secret != "" || cs.Properties.CertificateProfile.CaPrivateKey != "" ||
+		cs.Properties.CertificateProfile.EtcdPeerPrivateKeys != nil || cs.Properties.WindowsProfile.AdminPassword != "" ||
+		cs.Properties.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey != "" {
+		t.Fatalf("expected the secrets to be cleared from the container service")
+	}
+	if cs.Properties.ServicePrincipalProfile.ClientID == "" {
+		t.Fatalf("expected the fields that are not secret to be kept")
+	}
+
+	RestoreSecrets(cs, secrets)
+	restored := createSecretsContainerService()
+	if cs.Properties.ServicePrincipalProfile.Secret != restored.Properties.ServicePrincipalProfile.Secret ||
+		cs.Properties.CertificateProfile.CaPrivateKey != restored.Properties.CertificateProfile.CaPrivateKey ||
+		strings.Join(cs.Properties.CertificateProfile.EtcdPeerPrivateKeys, ",") != strings.Join(restored.Properties.CertificateProfile.EtcdPeerPrivateKeys, ",") ||
+		cs.Properties.WindowsProfile.AdminPassword != restored.Properties.WindowsProfile.AdminPassword ||
+		cs.Properties.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey != restored.Properties.OrchestratorProfile.KubernetesConfig.EtcdEncryptionKey {
+		t.Fatalf("expected the secrets to be restored")
+	}
+}
+
+type listSecret struct {
+	Name     string `json:"name"`
+	Password string `json:"password" conform:"redact"`
+}
+
+func TestSecretsInLists(t *testing.T) {
+	v := &struct {
+		Items    []listSecret  `json:"items"`
+		Pointers []*listSecret `json:"pointers"`
+	}{
+		Items:    []listSecret{{Name: "a"}, {Name: "b", Password: "itempassword"}},
+		Pointers: []*listSecret{{Name: "c", Password: "pointerpassword"}, nil},
+	}
+	secrets := map[string]string{}
+	walkSecrets(reflect.ValueOf(v), "", func(p string, value reflect.Value) {
+		secrets[p] = value.String()
+	})
+	expected := map[string]string{"items.0.password": "", "items.1.password": "itempassword", "pointers.0.password": "pointerpassword"}
+	if !reflect.DeepEqual(secrets, expected) {
+		t.Fatalf("expected the secrets of list elements to be found, got %v", secrets)
+	}
+
+	b, err := injectSecrets([]byte(`{"items":[{"name":"a"},{"name":"b"}]}`), map[string]string{"items.1.password": "itempassword", "pointers.0.password": "pointerpassword"})
+	if err != nil {
+		t.Fatalf("unexpected error restoring the secrets of list elements: %s", err)
+	}
+	if string(b) != `{"items":[{"name":"a"},{"name":"b","password":"itempassword"}],"pointers":[{"password":"pointerpassword"}]}` {
+		t.Fatalf("expected the secrets to be set in the list elements, got %s", b)
+	}
+}
+
+func TestSaveContainerServiceWithSecretStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secretstore")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &fakeKeyVaultClient{secrets: map[string]string{}}
+	vaultID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/vault"
+	cases := []struct {
+		name  string
+		store SecretStore
+	}{
+		{name: FileSecretStoreKind, store: &FileSecretStore{}},
+		{name: EncryptedFileSecretStoreKind, store: &EncryptedFileSecretStore{KeyFile: filepath.Join(dir, "keys", "secrets.key")}},
+		{name: KeyVaultSecretStoreKind, store: &KeyVaultSecretStore{VaultID: vaultID, NamePrefix: "testcluster", Client: client}},
+	}
+
+	for _, c := range cases {
+		outdir := filepath.Join(dir, c.name)
+		apiloader := &Apiloader{
+			Translator:     &i18n.Translator{},
+			KeyVaultClient: client,
+		}
+		cs := createSecretsContainerService()
+		if err = apiloader.SaveContainerService(cs, "vlabs", outdir, "apimodel.json", c.store); err != nil {
+			t.Fatalf("%s: unexpected error saving the api model: %s", c.name, err)
+		}
+		if cs.Properties.CertificateProfile.CaPrivateKey != "cakey" {
+			t.Fatalf("%s: expected the secrets of the container service to be kept", c.name)
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(outdir, "apimodel.json"))
+		if err != nil {
+			t.Fatalf("%s: unable to read the api model: %s", c.name, err)
+		}
+		for _, secret := range []string{"cakey", "etcdpeer1key", "etcdencryptionkey", "adminpassword"} {
+			if strings.Contains(string(b), secret) {
+				t.Fatalf("%s: expected secret %s not to be in apimodel.json", c.name, secret)
+			}
+		}
+		if c.name != FileSecretStoreKind {
+			m, _ := ioutil.ReadFile(filepath.Join(outdir, SecretsFilename))
+			if strings.Contains(string(m), "cakey") {
+				t.Fatalf("%s: expected the secrets not to be in plain text in %s", c.name, SecretsFilename)
+			}
+		}
+
+		// saving again without a store keeps using the store of the manifest
+		cs.Properties.CertificateProfile.CaPrivateKey = "newcakey"
+		if err = apiloader.SaveContainerService(cs, "vlabs", outdir, "apimodel.json", nil); err != nil {
+			t.Fatalf("%s: unexpected error saving the api model again: %s", c.name, err)
+		}
+
+		loaded, _, err := apiloader.LoadContainerServiceFromFile(filepath.Join(outdir, "apimodel.json"), false, false, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error loading the api model: %s", c.name, err)
+		}
+		if loaded.Properties.CertificateProfile.CaPrivateKey != "newcakey" {
+			t.Fatalf("%s: expected caPrivateKey to be resolved to newcakey, got %q", c.name, loaded.Properties.CertificateProfile.CaPrivateKey)
+		}
+		if strings.Join(loaded.Properties.CertificateProfile.EtcdPeerPrivateKeys, ",") != "etcdpeer0key,etcdpeer1key,etcdpeer2key" {
+			t.Fatalf("%s: expected the etcd peer keys to be resolved, got %v", c.name, loaded.Properties.CertificateProfile.EtcdPeerPrivateKeys)
+		}
+		if loaded.Properties.ServicePrincipalProfile.Secret != "DEC923E3-1EF1-4745-9516-37906D56DEC4" {
+			t.Fatalf("%s: expected the service principal secret to be resolved", c.name)
+		}
+		if loaded.Properties.WindowsProfile.AdminPassword != "adminpassword" {
+			t.Fatalf("%s: expected the Windows admin password to be resolved", c.name)
+		}
+	}
+}
+
+func TestEncryptedFileSecretStoreWrongKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secretstore")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := &EncryptedFileSecretStore{KeyFile: filepath.Join(dir, "secrets.key")}
+	manifest, err := store.Save(map[string]string{"properties.servicePrincipalProfile.secret": "secret"})
+	if err != nil {
+		t.Fatalf("unexpected error saving the secrets: %s", err)
+	}
+
+	other := &EncryptedFileSecretStore{KeyFile: filepath.Join(dir, "other.key")}
+	if _, err = other.Save(map[string]string{}); err != nil {
+		t.Fatalf("unexpected error creating another key: %s", err)
+	}
+	if _, err = other.Load(manifest); err == nil {
+		t.Fatalf("expected loading the secrets with another key to fail")
+	}
+
+	secrets, err := store.Load(manifest)
+	if err != nil {
+		t.Fatalf("unexpected error loading the secrets: %s", err)
+	}
+	if secrets["properties.servicePrincipalProfile.secret"] != "secret" {
+		t.Fatalf("expected the secret to be decrypted, got %v", secrets)
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	cs := createSecretsContainerService()
+	cs.Properties.AADProfile = &AADProfile{ServerAppID: "serverapp", ServerAppSecret: "serverappsecret"}
+	cs.Properties.ExtensionProfiles = []*ExtensionProfile{{Name: "hello", Version: "v1", ExtensionParameters: "extensionsecret"}}
+	cs.Properties.OrchestratorProfile.KubernetesConfig.Addons = []KubernetesAddon{
+		{Name: "container-monitoring", Config: map[string]string{"workspaceGuid": "workspaceguid", "workspaceKey": "workspacekey"}},
+	}
+
+	restore := RedactSecrets(cs)
+	addon := cs.Properties.OrchestratorProfile.KubernetesConfig.Addons[0]
+	if cs.Properties.AADProfile.ServerAppSecret != "" || cs.Properties.ExtensionProfiles[0].ExtensionParameters != "" ||
+		cs.Properties.CertificateProfile.APIServerPrivateKey != "" || cs.Properties.CertificateProfile.CaCertificate != "" ||
+		addon.Config["workspaceKey"] != "" {
+		t.Fatalf("expected the secrets to be redacted")
+	}
+	if cs.Properties.ServicePrincipalProfile.Secret != RedactedSecretPlaceholder || cs.Properties.WindowsProfile.AdminPassword != RedactedSecretPlaceholder {
+		t.Fatalf("expected the secrets needed to validate the api model to be replaced by a placeholder")
+	}
+	if addon.Config["workspaceGuid"] != "workspaceguid" {
+		t.Fatalf("expected the addon config that is not secret to be kept")
+	}
+	if cs.Properties.AADProfile.ServerAppID != "serverapp" || cs.Properties.ExtensionProfiles[0].Name != "hello" {
+		t.Fatalf("expected the fields that are not secret to be kept")
+	}
+
+	restore()
+	if cs.Properties.AADProfile.ServerAppSecret != "serverappsecret" || cs.Properties.ExtensionProfiles[0].ExtensionParameters != "extensionsecret" ||
+		cs.Properties.CertificateProfile.CaCertificate != "cacert" || cs.Properties.WindowsProfile.AdminPassword != "adminpassword" ||
+		cs.Properties.OrchestratorProfile.KubernetesConfig.Addons[0].Config["workspaceKey"] != "workspacekey" {
+		t.Fatalf("expected the secrets to be restored")
+	}
+}
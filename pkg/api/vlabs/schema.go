@@ -0,0 +1,289 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package vlabs
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Azure/aks-engine/pkg/api/common"
+	"github.com/Azure/aks-engine/pkg/helpers"
+)
+
+// JSONSchemaDraft is the version of JSON Schema the api model schema is written in
+const JSONSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a JSON Schema, limited to the keywords needed to describe the api model
+type Schema struct {
+	Schema     string             `json:"$schema,omitempty"`
+	Title      string             `json:"title,omitempty"`
+	Ref        string             `json:"$ref,omitempty"`
+	Type       interface{}        `json:"type,omitempty"`
+	AnyOf      []*Schema          `json:"anyOf,omitempty"`
+	Enum       []interface{}      `json:"enum,omitempty"`
+	Minimum    *int               `json:"minimum,omitempty"`
+	Maximum    *int               `json:"maximum,omitempty"`
+	MinItems   *int               `json:"minItems,omitempty"`
+	MaxItems   *int               `json:"maxItems,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	// PatternProperties match the keys of the objects of the api model in any case, as the api loader does
+	PatternProperties map[string]*Schema `json:"patternProperties,omitempty"`
+	Required          []string           `json:"required,omitempty"`
+	// AdditionalProperties is false for the objects of the api model, which reject unknown keys,
+	// and the schema of the values of maps
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Definitions          map[string]*Schema `json:"definitions,omitempty"`
+}
+
+// schemaTypeEnums are the values allowed for the string types of the api model
+var schemaTypeEnums = map[reflect.Type][]string{
+	reflect.TypeOf(KubeProxyMode("")):        {string(KubeProxyModeIPTables), string(KubeProxyModeIPVS)},
+	reflect.TypeOf(Distro("")):               {string(Ubuntu), string(RHEL), string(CoreOS), string(AKS), string(AKSDockerEngine)},
+	reflect.TypeOf(OSType("")):               {string(Linux), string(Windows)},
+	reflect.TypeOf(AgentPoolProfileRole("")): {string(AgentPoolProfileRoleEmpty), string(AgentPoolProfileRoleInfra)},
+	reflect.TypeOf(ProvisioningState("")):    {string(Creating), string(Updating), string(Failed), string(Succeeded), string(Deleting), string(Migrating)},
+}
+
+// schemaFieldEnums are the values allowed for the plain string fields of the api model, keyed by <type>.<field>
+var schemaFieldEnums = map[string][]string{
+	"MasterProfile.AvailabilityProfile":    {common.AvailabilitySet, common.VirtualMachineScaleSets},
+	"AgentPoolProfile.AvailabilityProfile": {common.AvailabilitySet, common.VirtualMachineScaleSets},
+	"PrivateJumpboxProfile.StorageProfile": {common.StorageAccount, common.ManagedDisks},
+	"KubernetesConfig.NetworkPlugin":       NetworkPluginValues[:],
+	"KubernetesConfig.NetworkPolicy":       NetworkPolicyValues[:],
+	"KubernetesConfig.ContainerRuntime":    ContainerRuntimeValues[:],
+}
+
+// schemaOptionalFields are the fields tagged required that may be left out of an api model, since deploy fills them in
+var schemaOptionalFields = map[string]bool{
+	"MasterProfile.DNSPrefix": true,
+}
+
+// GenerateSchema returns the JSON Schema of the vlabs api model, reflecting over ContainerService.
+// Enums come from the validate struct tags and from the values the validation of each type allows.
+func GenerateSchema() *Schema {
+	g := &schemaGenerator{definitions: map[string]*Schema{}}
+	root := g.structSchema(reflect.TypeOf(ContainerService{}))
+	root.Schema = JSONSchemaDraft
+	root.Title = "aks-engine " + APIVersion + " api model"
+	root.Properties["apiVersion"] = &Schema{Type: "string", Enum: []interface{}{APIVersion}}
+	root.Required = append(root.Required, "apiVersion", "properties")
+	sort.Strings(root.Required)
+	root.Definitions = g.definitions
+	return root
+}
+
+// MarshalSchema returns the indented JSON of the vlabs api model schema
+func MarshalSchema() ([]byte, error) {
+	return helpers.JSONMarshalIndent(GenerateSchema(), "", "  ", false)
+}
+
+type schemaGenerator struct {
+	definitions map[string]*Schema
+}
+
+// typeSchema returns the schema of a value of type t. Named structs are added to the definitions and referenced.
+func (g *schemaGenerator) typeSchema(t reflect.Type) *Schema {
+	if values, ok := schemaTypeEnums[t]; ok {
+		return &Schema{Type: "string", Enum: stringEnum(values)}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return nullable(g.typeSchema(t.Elem()))
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return nullable(&Schema{Type: "array", Items: g.typeSchema(t.Elem())})
+	case reflect.Map:
+		return nullable(&Schema{Type: "object", AdditionalProperties: g.typeSchema(t.Elem())})
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.definitions[t.Name()]; !ok {
+			// reserve the name first, so recursive types terminate
+			g.definitions[t.Name()] = nil
+			g.definitions[t.Name()] = g.structSchema(t)
+		}
+		return &Schema{Ref: "#/definitions/" + t.Name()}
+	}
+	// interfaces accept any value
+	return &Schema{}
+}
+
+// structSchema returns the schema of the object a struct is serialized to
+func (g *schemaGenerator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:                 "object",
+		Properties:           map[string]*Schema{},
+		PatternProperties:    map[string]*Schema{},
+		AdditionalProperties: false,
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath != "" || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fieldSchema := g.typeSchema(field.Type)
+		if values, ok := schemaFieldEnums[t.Name()+"."+field.Name]; ok {
+			fieldSchema.Enum = stringEnum(values)
+		}
+		if applyValidateTag(fieldSchema, field.Type, field.Tag.Get("validate")) && !schemaOptionalFields[t.Name()+"."+field.Name] {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fieldSchema
+		s.PatternProperties[caseInsensitivePattern(name)] = fieldSchema
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// caseInsensitivePattern returns a regular expression matching a key in any case, without the flags ECMA 262 lacks
+func caseInsensitivePattern(key string) string {
+	pattern := "^"
+	for _, r := range key {
+		lower, upper := unicode.ToLower(r), unicode.ToUpper(r)
+		if lower == upper {
+			pattern += regexp.QuoteMeta(string(r))
+		} else {
+			pattern += "[" + string(lower) + string(upper) + "]"
+		}
+	}
+	return pattern + "$"
+}
+
+// applyValidateTag restricts a schema with the rules of a validate struct tag, returning true if the field is required.
+// Rules after "dive" apply to the elements of a list.
+func applyValidateTag(s *Schema, t reflect.Type, tag string) bool {
+	if tag == "" {
+		return false
+	}
+	required := false
+	target, targetType := s, t
+	var list *Schema
+	for _, rule := range strings.Split(tag, ",") {
+		switch {
+		case rule == "required" && list != nil:
+			// the elements of the list must not be null
+			list.Items = nonNull(list.Items)
+			target = list.Items
+		case rule == "required":
+			required = true
+		case rule == "dive":
+			for targetType.Kind() == reflect.Ptr {
+				targetType = targetType.Elem()
+			}
+			list = nonNull(target)
+			target, targetType = list.Items, targetType.Elem()
+		case rule == "omitempty":
+		case strings.Contains(rule, "|") || strings.HasPrefix(rule, "eq="):
+			target = nonNull(target)
+			target.Enum = nil
+			for _, alternative := range strings.Split(rule, "|") {
+				switch {
+				case strings.HasPrefix(alternative, "eq="):
+					target.Enum = append(target.Enum, schemaValue(strings.TrimPrefix(alternative, "eq="), targetType))
+				case alternative == "len=0" && targetType.Kind() == reflect.String:
+					target.Enum = append(target.Enum, "")
+				}
+			}
+		case strings.HasPrefix(rule, "min="), strings.HasPrefix(rule, "max="), strings.HasPrefix(rule, "len="):
+			n, err := strconv.Atoi(rule[4:])
+			if err != nil {
+				continue
+			}
+			setBound(nonNull(target), targetType, rule[:3], n)
+		}
+	}
+	return required
+}
+
+// setBound sets the minimum, maximum or exact length of a list or the range of a number
+func setBound(s *Schema, t reflect.Type, bound string, n int) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	isList := t.Kind() == reflect.Slice || t.Kind() == reflect.Array
+	switch {
+	case isList && (bound == "min" || bound == "len"):
+		s.MinItems = intPtr(n)
+		if bound == "len" {
+			s.MaxItems = intPtr(n)
+		}
+	case isList && bound == "max":
+		s.MaxItems = intPtr(n)
+	case bound == "min":
+		s.Minimum = intPtr(n)
+	case bound == "max":
+		s.Maximum = intPtr(n)
+	}
+}
+
+// nonNull returns the schema of the non-null values of a nullable schema
+func nonNull(s *Schema) *Schema {
+	if len(s.AnyOf) == 2 {
+		return nonNull(s.AnyOf[0])
+	}
+	return s
+}
+
+// nullable allows null besides the values of a schema, since nil pointers, lists and maps serialize to null
+func nullable(s *Schema) *Schema {
+	switch typ := s.Type.(type) {
+	case string:
+		s.Type = []string{typ, "null"}
+		return s
+	case []string:
+		// already nullable
+		return s
+	}
+	return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+}
+
+// stringEnum returns the values of a string enum, and the empty string unset fields are serialized to
+func stringEnum(values []string) []interface{} {
+	enum := []interface{}{}
+	seen := map[string]bool{}
+	values = append([]string{""}, values...)
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			enum = append(enum, v)
+		}
+	}
+	return enum
+}
+
+func schemaValue(value string, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+func intPtr(n int) *int {
+	return &n
+}
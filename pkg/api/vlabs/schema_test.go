@@ -0,0 +1,251 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package vlabs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// schemaFile is the published schema, kept in sync with the types by `make generate-schema`
+const schemaFile = "apimodel.schema.json"
+
+func TestSchemaIsUpToDate(t *testing.T) {
+	generated, err := MarshalSchema()
+	if err != nil {
+		t.Fatalf("unexpected error generating the schema: %s", err)
+	}
+	published, err := ioutil.ReadFile(schemaFile)
+	if err != nil {
+		t.Fatalf("unable to read the published schema: %s", err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(generated), bytes.TrimSpace(published)) {
+		t.Fatalf("pkg/api/vlabs/%s is out of date with the vlabs types, regenerate it with `make generate-schema`", schemaFile)
+	}
+}
+
+func TestGenerateSchema(t *testing.T) {
+	schema := GenerateSchema()
+	if schema.Schema != JSONSchemaDraft {
+		t.Fatalf("expected the schema to declare %s, got %s", JSONSchemaDraft, schema.Schema)
+	}
+	if !reflect.DeepEqual(schema.Required, []string{"apiVersion", "properties"}) {
+		t.Fatalf("expected apiVersion and properties to be required, got %v", schema.Required)
+	}
+
+	cases := []struct {
+		definition string
+		property   string
+		expected   string
+	}{
+		{"KubernetesConfig", "kubeProxyMode", `{"type":"string","enum":["","iptables","ipvs"]}`},
+		{"KubernetesConfig", "networkPlugin", `{"type":"string","enum":["","kubenet","azure","cilium","flannel"]}`},
+		{"AgentPoolProfile", "distro", `{"type":"string","enum":["","ubuntu","rhel","coreos","aks","aks-docker-engine"]}`},
+		{"AgentPoolProfile", "availabilityProfile", `{"type":"string","enum":["","AvailabilitySet","VirtualMachineScaleSets"]}`},
+		{"AgentPoolProfile", "storageProfile", `{"type":"string","enum":["StorageAccount","ManagedDisks",""]}`},
+		{"AgentPoolProfile", "count", `{"type":"integer","minimum":1,"maximum":100}`},
+		{"AgentPoolProfile", "diskSizesGB", `{"type":["array","null"],"maxItems":4,"items":{"type":"integer","minimum":1,"maximum":1023}}`},
+		{"AgentPoolProfile", "maxSurge", `{"type":["integer","null"],"minimum":0}`},
+		{"MasterProfile", "count", `{"type":"integer","enum":[1,3,5]}`},
+		{"MasterProfile", "dnsPrefix", `{"type":"string"}`},
+		{"Properties", "masterProfile", `{"anyOf":[{"$ref":"#/definitions/MasterProfile"},{"type":"null"}]}`},
+		{"Properties", "agentPoolProfiles", `{"type":["array","null"],"items":{"$ref":"#/definitions/AgentPoolProfile"}}`},
+	}
+	for _, c := range cases {
+		definition, ok := schema.Definitions[c.definition]
+		if !ok {
+			t.Fatalf("expected the schema to define %s", c.definition)
+		}
+		b, err := json.Marshal(definition.Properties[c.property])
+		if err != nil {
+			t.Fatalf("unexpected error marshalling the schema of %s.%s: %s", c.definition, c.property, err)
+		}
+		if string(b) != c.expected {
+			t.Fatalf("expected the schema of %s.%s to be %s, got %s", c.definition, c.property, c.expected, string(b))
+		}
+	}
+	if required := schema.Definitions["Properties"].Required; !reflect.DeepEqual(required, []string{"linuxProfile", "masterProfile", "orchestratorProfile"}) {
+		t.Fatalf("unexpected required properties %v", required)
+	}
+}
+
+func TestSchemaValidatesExamples(t *testing.T) {
+	var schema map[string]interface{}
+	b, err := MarshalSchema()
+	if err != nil {
+		t.Fatalf("unexpected error generating the schema: %s", err)
+	}
+	if err = json.Unmarshal(b, &schema); err != nil {
+		t.Fatalf("unexpected error parsing the schema: %s", err)
+	}
+
+	validated := 0
+	err = filepath.Walk("../../../examples", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var apimodel map[string]interface{}
+		if json.Unmarshal(contents, &apimodel) != nil || apimodel["apiVersion"] != APIVersion {
+			return nil
+		}
+		validated++
+		if e := validateSchema(schema, schema, apimodel, ""); e != nil {
+			t.Errorf("%s does not match the schema: %s", path, e)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error reading the examples: %s", err)
+	}
+	if validated == 0 {
+		t.Fatalf("expected vlabs examples to be validated")
+	}
+
+	invalid := map[string]interface{}{
+		"apiVersion": "vlabs",
+		"properties": map[string]interface{}{
+			"orchestratorProfile": map[string]interface{}{"orchestratorType": "Kubernetes", "kubernetesConfig": map[string]interface{}{"kubeProxyMode": "userspace"}},
+		},
+	}
+	if e := validateSchema(schema, schema, invalid, ""); e == nil {
+		t.Fatalf("expected an unknown kubeProxyMode not to match the schema")
+	}
+}
+
+// validateSchema checks a decoded JSON value against the keywords of the schema used by GenerateSchema
+func validateSchema(root, schema map[string]interface{}, value interface{}, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		definition := root["definitions"].(map[string]interface{})[strings.TrimPrefix(ref, "#/definitions/")]
+		return validateSchema(root, definition.(map[string]interface{}), value, path)
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		var errs []string
+		for _, s := range anyOf {
+			err := validateSchema(root, s.(map[string]interface{}), value, path)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return fmt.Errorf("%s matches none of: %s", path, strings.Join(errs, "; "))
+	}
+	if typ, ok := schema["type"]; ok && !schemaTypeMatches(typ, value) {
+		return fmt.Errorf("%s is not of type %v", path, typ)
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s is not one of %v", path, enum)
+		}
+	}
+	switch v := value.(type) {
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && v < min {
+			return fmt.Errorf("%s is less than %v", path, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && v > max {
+			return fmt.Errorf("%s is more than %v", path, max)
+		}
+	case []interface{}:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(v)) < min {
+			return fmt.Errorf("%s has fewer than %v items", path, min)
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(v)) > max {
+			return fmt.Errorf("%s has more than %v items", path, max)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateSchema(root, items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if _, ok := v[r.(string)]; !ok {
+					return fmt.Errorf("%s.%s is required", path, r)
+				}
+			}
+		}
+		patternProperties, _ := schema["patternProperties"].(map[string]interface{})
+		for k, child := range v {
+			childSchema, ok := properties[k].(map[string]interface{})
+			for pattern, s := range patternProperties {
+				if !ok && regexp.MustCompile(pattern).MatchString(k) {
+					childSchema, ok = s.(map[string]interface{})
+				}
+			}
+			if !ok {
+				switch additional := schema["additionalProperties"].(type) {
+				case bool:
+					if !additional {
+						return fmt.Errorf("%s.%s is not a known property", path, k)
+					}
+					continue
+				case map[string]interface{}:
+					childSchema = additional
+				default:
+					continue
+				}
+			}
+			if err := validateSchema(root, childSchema, child, path+"."+k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func schemaTypeMatches(typ interface{}, value interface{}) bool {
+	if types, ok := typ.([]interface{}); ok {
+		for _, t := range types {
+			if schemaTypeMatches(t, value) {
+				return true
+			}
+		}
+		return false
+	}
+	switch typ {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == float64(int64(n))
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
@@ -459,6 +459,10 @@ type AgentPoolProfile struct {
 	Extensions            []Extension       `json:"extensions"`
 	SinglePlacementGroup  *bool             `json:"singlePlacementGroup,omitempty"`
 	AvailabilityZones     []string          `json:"availabilityZones,omitempty"`
+	// MaxSurge is the number of nodes an upgrade may add above count, MaxUnavailable the number of nodes it may remove below count
+	// They only apply to AvailabilitySet agent pools, VirtualMachineScaleSets agent pools are upgraded one node at a time
+	MaxSurge       *int `json:"maxSurge,omitempty" validate:"omitempty,min=0"`
+	MaxUnavailable *int `json:"maxUnavailable,omitempty" validate:"omitempty,min=0"`
 }
 
 // AgentPoolProfileRole represents an agent role
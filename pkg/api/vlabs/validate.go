@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"reflect"
 	"regexp"
 	"strings"
 	"time"
@@ -113,47 +114,101 @@ func (a *Properties) Validate(isUpdate bool) error {
 	if e := validate.Struct(a); e != nil {
 		return handleValidationErrors(e.(validator.ValidationErrors))
 	}
-	if e := a.validateOrchestratorProfile(isUpdate); e != nil {
-		return e
-	}
-	if e := a.validateMasterProfile(); e != nil {
-		return e
-	}
-	if e := a.validateAgentPoolProfiles(isUpdate); e != nil {
-		return e
-	}
-	if e := a.validateZones(); e != nil {
-		return e
-	}
-	if e := a.validateLinuxProfile(); e != nil {
-		return e
-	}
-	if e := a.validateAddons(); e != nil {
-		return e
-	}
-	if e := a.validateExtensions(); e != nil {
-		return e
-	}
-	if e := a.validateVNET(); e != nil {
-		return e
-	}
-	if e := a.validateServicePrincipalProfile(); e != nil {
-		return e
+	for _, c := range a.propertiesChecks(isUpdate) {
+		if e := c.check(); e != nil {
+			return e
+		}
 	}
+	return nil
+}
 
-	if e := a.validateManagedIdentity(); e != nil {
-		return e
+// FieldError is a validation error along with the apimodel path of the field that caused it
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Err)
+}
+
+// ValidateAll runs the same checks as Validate, but returns every error found instead of only the first one
+func (a *Properties) ValidateAll(isUpdate bool) []*FieldError {
+	if e := validate.Struct(a); e != nil {
+		// the remaining checks rely on the required fields being present
+		var errs []*FieldError
+		for _, fe := range e.(validator.ValidationErrors) {
+			errs = append(errs, &FieldError{
+				Field: namespaceToFieldPath(fe.StructNamespace()),
+				Err:   handleValidationErrors(validator.ValidationErrors{fe}),
+			})
+		}
+		return errs
 	}
 
-	if e := a.validateAADProfile(); e != nil {
-		return e
+	var errs []*FieldError
+	for _, c := range a.propertiesChecks(isUpdate) {
+		if c.field == "properties.agentPoolProfiles" {
+			errs = append(errs, a.validateAllAgentPoolProfiles(isUpdate)...)
+			continue
+		}
+		if e := c.check(); e != nil {
+			errs = append(errs, &FieldError{Field: c.field, Err: e})
+		}
 	}
+	return errs
+}
 
-	if e := a.validateCustomCloudProfile(); e != nil {
-		return e
+type propertiesCheck struct {
+	field string
+	check func() error
+}
+
+// propertiesChecks lists the checks run by Validate, in order, along with the apimodel field each one covers
+func (a *Properties) propertiesChecks(isUpdate bool) []propertiesCheck {
+	return []propertiesCheck{
+		{"properties.orchestratorProfile", func() error { return a.validateOrchestratorProfile(isUpdate) }},
+		{"properties.masterProfile", a.validateMasterProfile},
+		{"properties.agentPoolProfiles", func() error { return a.validateAgentPoolProfiles(isUpdate) }},
+		{"properties", a.validateZones},
+		{"properties.linuxProfile", a.validateLinuxProfile},
+		{"properties.orchestratorProfile.kubernetesConfig.addons", a.validateAddons},
+		{"properties.extensionProfiles", a.validateExtensions},
+		{"properties", a.validateVNET},
+		{"properties.servicePrincipalProfile", a.validateServicePrincipalProfile},
+		{"properties.orchestratorProfile.kubernetesConfig", a.validateManagedIdentity},
+		{"properties.aadProfile", a.validateAADProfile},
+		{"properties.customCloudProfile", a.validateCustomCloudProfile},
 	}
+}
 
-	return nil
+// namespaceToFieldPath converts a validator struct namespace such as Properties.AgentPoolProfiles[0].VMSize
+// into the matching apimodel path, properties.agentPoolProfiles[0].vmSize
+func namespaceToFieldPath(ns string) string {
+	parts := strings.Split(ns, ".")
+	path := []string{"properties"}
+	t := reflect.TypeOf(Properties{})
+	for _, part := range parts[1:] {
+		name, index := part, ""
+		if i := strings.Index(part, "["); i >= 0 {
+			name, index = part[:i], part[i:]
+		}
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		f, ok := t.FieldByName(name)
+		if t.Kind() != reflect.Struct || !ok {
+			// fall back to the raw namespace for anything we cannot resolve
+			return ns
+		}
+		jsonName := strings.Split(f.Tag.Get("json"), ",")[0]
+		if jsonName == "" {
+			jsonName = name
+		}
+		path = append(path, jsonName+index)
+		t = f.Type
+	}
+	return strings.Join(path, ".")
 }
 
 func handleValidationErrors(e validator.ValidationErrors) error {
@@ -389,60 +444,104 @@ func (a *Properties) validateAgentPoolProfiles(isUpdate bool) error {
 		}
 		profileNames[agentPoolProfile.Name] = true
 
-		if e := validatePoolOSType(agentPoolProfile.OSType); e != nil {
+		if e := a.validateAgentPoolProfile(i, isUpdate); e != nil {
 			return e
 		}
 
-		if to.Bool(agentPoolProfile.AcceleratedNetworkingEnabled) || to.Bool(agentPoolProfile.AcceleratedNetworkingEnabledWindows) {
-			if e := validatePoolAcceleratedNetworking(agentPoolProfile.VMSize); e != nil {
-				return e
-			}
+		// the pools after one with an imageReference are not validated
+		if agentPoolProfile.ImageRef != nil {
+			return nil
 		}
+	}
 
-		if e := agentPoolProfile.validateOrchestratorSpecificProperties(a.OrchestratorProfile.OrchestratorType); e != nil {
-			return e
+	return nil
+}
+
+// validateAllAgentPoolProfiles runs the agent pool checks against every pool and returns all of the errors found
+func (a *Properties) validateAllAgentPoolProfiles(isUpdate bool) []*FieldError {
+	var errs []*FieldError
+	profileNames := make(map[string]bool)
+	for i, agentPoolProfile := range a.AgentPoolProfiles {
+		nameField := fmt.Sprintf("properties.agentPoolProfiles[%d].name", i)
+		if e := validatePoolName(agentPoolProfile.Name); e != nil {
+			errs = append(errs, &FieldError{Field: nameField, Err: e})
 		}
+		if _, ok := profileNames[agentPoolProfile.Name]; ok {
+			errs = append(errs, &FieldError{Field: nameField, Err: errors.Errorf("profile name '%s' already exists, profile names must be unique across pools", agentPoolProfile.Name)})
+		}
+		profileNames[agentPoolProfile.Name] = true
 
+		if e := a.validateAgentPoolProfile(i, isUpdate); e != nil {
+			errs = append(errs, &FieldError{Field: fmt.Sprintf("properties.agentPoolProfiles[%d]", i), Err: e})
+		}
+		// as in validateAgentPoolProfiles, the pools after one with an imageReference are not validated
 		if agentPoolProfile.ImageRef != nil {
-			return agentPoolProfile.ImageRef.validateImageNameAndGroup()
+			break
 		}
+	}
+	return errs
+}
 
-		if e := agentPoolProfile.validateAvailabilityProfile(a.OrchestratorProfile.OrchestratorType); e != nil {
-			return e
-		}
+func (a *Properties) validateAgentPoolProfile(i int, isUpdate bool) error {
+	agentPoolProfile := a.AgentPoolProfiles[i]
 
-		if e := agentPoolProfile.validateRoles(a.OrchestratorProfile.OrchestratorType); e != nil {
-			return e
-		}
+	if e := validatePoolOSType(agentPoolProfile.OSType); e != nil {
+		return e
+	}
 
-		if e := agentPoolProfile.validateStorageProfile(a.OrchestratorProfile.OrchestratorType); e != nil {
+	if to.Bool(agentPoolProfile.AcceleratedNetworkingEnabled) || to.Bool(agentPoolProfile.AcceleratedNetworkingEnabledWindows) {
+		if e := validatePoolAcceleratedNetworking(agentPoolProfile.VMSize); e != nil {
 			return e
 		}
+	}
 
-		if e := agentPoolProfile.validateCustomNodeLabels(a.OrchestratorProfile.OrchestratorType); e != nil {
+	if e := agentPoolProfile.validateOrchestratorSpecificProperties(a.OrchestratorProfile.OrchestratorType); e != nil {
+		return e
+	}
+
+	if agentPoolProfile.ImageRef != nil {
+		return agentPoolProfile.ImageRef.validateImageNameAndGroup()
+	}
+
+	if e := agentPoolProfile.validateAvailabilityProfile(a.OrchestratorProfile.OrchestratorType); e != nil {
+		return e
+	}
+
+	if e := agentPoolProfile.validateRoles(a.OrchestratorProfile.OrchestratorType); e != nil {
+		return e
+	}
+
+	if e := agentPoolProfile.validateStorageProfile(a.OrchestratorProfile.OrchestratorType); e != nil {
+		return e
+	}
+
+	if e := agentPoolProfile.validateCustomNodeLabels(a.OrchestratorProfile.OrchestratorType); e != nil {
+		return e
+	}
+
+	if e := agentPoolProfile.validateUpgradeSettings(); e != nil {
+		return e
+	}
+
+	if agentPoolProfile.AvailabilityProfile == VirtualMachineScaleSets {
+		e := validateVMSS(a.OrchestratorProfile, isUpdate, agentPoolProfile.StorageProfile)
+		if e != nil {
 			return e
 		}
+	}
 
-		if agentPoolProfile.AvailabilityProfile == VirtualMachineScaleSets {
-			e := validateVMSS(a.OrchestratorProfile, isUpdate, agentPoolProfile.StorageProfile)
-			if e != nil {
-				return e
-			}
+	if a.OrchestratorProfile.OrchestratorType == Kubernetes {
+		if a.AgentPoolProfiles[i].AvailabilityProfile != a.AgentPoolProfiles[0].AvailabilityProfile {
+			return errors.New("mixed mode availability profiles are not allowed. Please set either VirtualMachineScaleSets or AvailabilitySet in availabilityProfile for all agent pools")
 		}
 
-		if a.OrchestratorProfile.OrchestratorType == Kubernetes {
-			if a.AgentPoolProfiles[i].AvailabilityProfile != a.AgentPoolProfiles[0].AvailabilityProfile {
-				return errors.New("mixed mode availability profiles are not allowed. Please set either VirtualMachineScaleSets or AvailabilitySet in availabilityProfile for all agent pools")
-			}
-
-			if a.AgentPoolProfiles[i].SinglePlacementGroup != nil && a.AgentPoolProfiles[i].AvailabilityProfile == AvailabilitySet {
-				return errors.New("singlePlacementGroup is only supported with VirtualMachineScaleSets")
-			}
+		if a.AgentPoolProfiles[i].SinglePlacementGroup != nil && a.AgentPoolProfiles[i].AvailabilityProfile == AvailabilitySet {
+			return errors.New("singlePlacementGroup is only supported with VirtualMachineScaleSets")
 		}
+	}
 
-		if e := agentPoolProfile.validateWindows(a.OrchestratorProfile, a.WindowsProfile, isUpdate); agentPoolProfile.OSType == Windows && e != nil {
-			return e
-		}
+	if e := agentPoolProfile.validateWindows(a.OrchestratorProfile, a.WindowsProfile, isUpdate); agentPoolProfile.OSType == Windows && e != nil {
+		return e
 	}
 
 	return nil
@@ -767,6 +866,14 @@ func (a *AgentPoolProfile) validateCustomNodeLabels(orchestratorType string) err
 	return nil
 }
 
+func (a *AgentPoolProfile) validateUpgradeSettings() error {
+	// maxSurge defaults to 1 and maxUnavailable to 0, an upgrade needs at least one of them to make progress
+	if a.MaxSurge != nil && *a.MaxSurge == 0 && (a.MaxUnavailable == nil || *a.MaxUnavailable == 0) {
+		return errors.Errorf("agent pool %s must allow at least one surge or unavailable node during upgrades, maxSurge and maxUnavailable cannot both be 0", a.Name)
+	}
+	return nil
+}
+
 func (a *AgentPoolProfile) validateKubernetesDistro() error {
 	switch a.Distro {
 	case AKS:
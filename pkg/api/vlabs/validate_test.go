@@ -2233,6 +2233,37 @@ func TestAgentPoolProfile_ValidateAvailabilityProfile(t *testing.T) {
 	})
 }
 
+func TestAgentPoolProfile_ValidateUpgradeSettings(t *testing.T) {
+	t.Run("Should fail when maxSurge and maxUnavailable are both 0", func(t *testing.T) {
+		t.Parallel()
+		p := getK8sDefaultProperties(false)
+		p.AgentPoolProfiles[0].MaxSurge = to.IntPtr(0)
+		expectedMsg := "agent pool agentpool must allow at least one surge or unavailable node during upgrades, maxSurge and maxUnavailable cannot both be 0"
+		if err := p.validateAgentPoolProfiles(true); err == nil || err.Error() != expectedMsg {
+			t.Errorf("expected error with message : %s, but got %v", expectedMsg, err)
+		}
+	})
+
+	t.Run("Should allow replacing nodes without surge", func(t *testing.T) {
+		t.Parallel()
+		p := getK8sDefaultProperties(false)
+		p.AgentPoolProfiles[0].MaxSurge = to.IntPtr(0)
+		p.AgentPoolProfiles[0].MaxUnavailable = to.IntPtr(2)
+		if err := p.validateAgentPoolProfiles(true); err != nil {
+			t.Errorf("expected no error, but got %s", err.Error())
+		}
+	})
+
+	t.Run("Should fail for negative settings", func(t *testing.T) {
+		t.Parallel()
+		p := getK8sDefaultProperties(false)
+		p.AgentPoolProfiles[0].MaxUnavailable = to.IntPtr(-1)
+		if err := validate.Struct(p.AgentPoolProfiles[0]); err == nil {
+			t.Errorf("expected an error for a negative maxUnavailable")
+		}
+	})
+}
+
 func TestValidateCustomCloudProfile(t *testing.T) {
 
 	const (
@@ -2459,3 +2490,77 @@ func TestValidateCustomCloudProfile(t *testing.T) {
 		})
 	}
 }
+
+func TestProperties_ValidateAll(t *testing.T) {
+	p := getK8sDefaultProperties(false)
+	if errs := p.ValidateAll(false); len(errs) != 0 {
+		t.Fatalf("expected no validation errors, got %v", errs)
+	}
+
+	p.MasterProfile.DNSPrefix = "-invalid-"
+	p.LinuxProfile.SSH.PublicKeys[0].KeyData = ""
+	p.AgentPoolProfiles = append(p.AgentPoolProfiles, &AgentPoolProfile{
+		Name:                "agentpool",
+		VMSize:              "Standard_D2_v2",
+		Count:               1,
+		AvailabilityProfile: AvailabilitySet,
+	})
+	errs := p.ValidateAll(false)
+	expectedFields := []string{"properties.masterProfile", "properties.agentPoolProfiles[1].name", "properties.linuxProfile"}
+	if len(errs) != len(expectedFields) {
+		t.Fatalf("expected %d validation errors, got %v", len(expectedFields), errs)
+	}
+	for i, field := range expectedFields {
+		if errs[i].Field != field {
+			t.Errorf("expected validation error %d to be for field %s, got %s", i, field, errs[i].Field)
+		}
+	}
+	if err := p.Validate(false); err == nil || err.Error() != errs[0].Err.Error() {
+		t.Errorf("expected Validate to return the first error found by ValidateAll, got %v", err)
+	}
+}
+
+func TestProperties_ValidateAllAgentPoolImageRef(t *testing.T) {
+	p := getK8sDefaultProperties(false)
+	p.AgentPoolProfiles[0].ImageRef = &ImageReference{
+		Name:          "myimage",
+		ResourceGroup: "myresourcegroup",
+	}
+	p.AgentPoolProfiles = append(p.AgentPoolProfiles, &AgentPoolProfile{
+		Name:                "agentpool2",
+		VMSize:              "Standard_D2_v2",
+		Count:               1,
+		AvailabilityProfile: VirtualMachineScaleSets,
+	})
+	if err := p.Validate(false); err != nil {
+		t.Fatalf("expected the pools after one with an imageReference not to be validated, got %v", err)
+	}
+	if errs := p.ValidateAll(false); len(errs) != 0 {
+		t.Fatalf("expected no validation errors, got %v", errs)
+	}
+
+	p.AgentPoolProfiles[0].ImageRef.Name = ""
+	errs := p.ValidateAll(false)
+	if len(errs) != 1 || errs[0].Field != "properties.agentPoolProfiles[0]" {
+		t.Fatalf("expected a single validation error for properties.agentPoolProfiles[0], got %v", errs)
+	}
+	if err := p.Validate(false); err == nil || err.Error() != errs[0].Err.Error() {
+		t.Errorf("expected Validate to return the first error found by ValidateAll, got %v", err)
+	}
+}
+
+func TestProperties_ValidateAllInvalidStruct(t *testing.T) {
+	p := getK8sDefaultProperties(false)
+	p.MasterProfile.Count = 2
+	p.AgentPoolProfiles[0].VMSize = ""
+	errs := p.ValidateAll(false)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 validation errors, got %v", errs)
+	}
+	if errs[0].Field != "properties.masterProfile.count" || errs[0].Err.Error() != "MasterProfile count needs to be 1, 3, or 5" {
+		t.Errorf("unexpected validation error %s", errs[0])
+	}
+	if errs[1].Field != "properties.agentPoolProfiles[0].vmSize" || errs[1].Err.Error() != "missing Properties.AgentPoolProfiles[0].VMSize" {
+		t.Errorf("unexpected validation error %s", errs[1])
+	}
+}
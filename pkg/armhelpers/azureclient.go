@@ -62,6 +62,8 @@ type AzureClient struct {
 	interfacesClient                network.InterfacesClient
 	groupsClient                    resources.GroupsClient
 	providersClient                 resources.ProvidersClient
+	genericResourcesClient          resources.Client
+	availabilitySetsClient          compute.AvailabilitySetsClient
 	virtualMachinesClient           compute.VirtualMachinesClient
 	virtualMachineScaleSetsClient   compute.VirtualMachineScaleSetsClient
 	virtualMachineScaleSetVMsClient compute.VirtualMachineScaleSetVMsClient
@@ -69,6 +71,9 @@ type AzureClient struct {
 
 	applicationsClient      graphrbac.ApplicationsClient
 	servicePrincipalsClient graphrbac.ServicePrincipalsClient
+
+	keyVaultClient     autorest.Client
+	keyVaultAuthorizer autorest.Authorizer
 }
 
 // NewAzureClientWithCLI creates an AzureClient configured from Azure CLI 2.0 for local development scenarios.
@@ -88,7 +93,9 @@ func NewAzureClientWithCLI(env azure.Environment, subscriptionID string) (*Azure
 		return nil, err
 	}
 
-	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(&adalToken), autorest.NewBearerAuthorizer(&adalToken)), nil
+	keyVaultAuthorizer := &cliAuthorizer{resource: keyVaultResource(env)}
+
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(&adalToken), autorest.NewBearerAuthorizer(&adalToken), keyVaultAuthorizer), nil
 }
 
 // NewAzureClientWithDeviceAuth returns an AzureClient by having a user complete a device authentication flow
@@ -127,8 +134,12 @@ func NewAzureClientWithDeviceAuth(env azure.Environment, subscriptionID string)
 				return nil, err
 			}
 			graphSpt.Refresh()
+			keyVaultSpt, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, aksEngineClientID, keyVaultResource(env), armSpt.Token())
+			if err != nil {
+				return nil, err
+			}
 
-			return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt)), nil
+			return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), autorest.NewBearerAuthorizer(keyVaultSpt)), nil
 		}
 	}
 
@@ -159,8 +170,14 @@ func NewAzureClientWithDeviceAuth(env azure.Environment, subscriptionID string)
 		return nil, err
 	}
 	graphSpt.Refresh()
+	kvRawToken := armSpt.Token()
+	kvRawToken.Resource = keyVaultResource(env)
+	keyVaultSpt, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, aksEngineClientID, keyVaultResource(env), kvRawToken)
+	if err != nil {
+		return nil, err
+	}
 
-	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt)), nil
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), autorest.NewBearerAuthorizer(keyVaultSpt)), nil
 }
 
 // NewAzureClientWithClientSecret returns an AzureClient via client_id and client_secret
@@ -179,8 +196,12 @@ func NewAzureClientWithClientSecret(env azure.Environment, subscriptionID, clien
 		return nil, err
 	}
 	graphSpt.Refresh()
+	keyVaultSpt, err := adal.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, keyVaultResource(env))
+	if err != nil {
+		return nil, err
+	}
 
-	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt)), nil
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), autorest.NewBearerAuthorizer(keyVaultSpt)), nil
 }
 
 // NewAzureClientWithClientSecretExternalTenant returns an AzureClient via client_id and client_secret from a tenant
@@ -199,8 +220,12 @@ func NewAzureClientWithClientSecretExternalTenant(env azure.Environment, subscri
 		return nil, err
 	}
 	graphSpt.Refresh()
+	keyVaultSpt, err := adal.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, keyVaultResource(env))
+	if err != nil {
+		return nil, err
+	}
 
-	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt)), nil
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), autorest.NewBearerAuthorizer(keyVaultSpt)), nil
 }
 
 // NewAzureClientWithClientCertificateFile returns an AzureClient via client_id and jwt certificate assertion
@@ -266,8 +291,12 @@ func newAzureClientWithCertificate(env azure.Environment, oauthConfig *adal.OAut
 		return nil, err
 	}
 	graphSpt.Refresh()
+	keyVaultSpt, err := adal.NewServicePrincipalTokenFromCertificate(*oauthConfig, clientID, certificate, privateKey, keyVaultResource(env))
+	if err != nil {
+		return nil, err
+	}
 
-	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt)), nil
+	return getClient(env, subscriptionID, tenantID, autorest.NewBearerAuthorizer(armSpt), autorest.NewBearerAuthorizer(graphSpt), autorest.NewBearerAuthorizer(keyVaultSpt)), nil
 }
 
 func tokenCallback(path string) func(t adal.Token) error {
@@ -324,7 +353,7 @@ func getAksEngineClientID(envName string) string {
 	}
 }
 
-func getClient(env azure.Environment, subscriptionID, tenantID string, armAuthorizer autorest.Authorizer, graphAuthorizer autorest.Authorizer) *AzureClient {
+func getClient(env azure.Environment, subscriptionID, tenantID string, armAuthorizer autorest.Authorizer, graphAuthorizer autorest.Authorizer, keyVaultAuthorizer autorest.Authorizer) *AzureClient {
 	c := &AzureClient{
 		environment:    env,
 		subscriptionID: subscriptionID,
@@ -338,6 +367,8 @@ func getClient(env azure.Environment, subscriptionID, tenantID string, armAuthor
 		interfacesClient:                network.NewInterfacesClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 		groupsClient:                    resources.NewGroupsClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 		providersClient:                 resources.NewProvidersClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
+		genericResourcesClient:          resources.NewClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
+		availabilitySetsClient:          compute.NewAvailabilitySetsClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 		virtualMachinesClient:           compute.NewVirtualMachinesClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 		virtualMachineScaleSetsClient:   compute.NewVirtualMachineScaleSetsClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
 		virtualMachineScaleSetVMsClient: compute.NewVirtualMachineScaleSetVMsClientWithBaseURI(env.ResourceManagerEndpoint, subscriptionID),
@@ -345,6 +376,9 @@ func getClient(env azure.Environment, subscriptionID, tenantID string, armAuthor
 
 		applicationsClient:      graphrbac.NewApplicationsClientWithBaseURI(env.GraphEndpoint, tenantID),
 		servicePrincipalsClient: graphrbac.NewServicePrincipalsClientWithBaseURI(env.GraphEndpoint, tenantID),
+
+		keyVaultClient:     autorest.NewClientWithUserAgent(""),
+		keyVaultAuthorizer: keyVaultAuthorizer,
 	}
 
 	c.authorizationClient.Authorizer = armAuthorizer
@@ -356,6 +390,8 @@ func getClient(env azure.Environment, subscriptionID, tenantID string, armAuthor
 	c.interfacesClient.Authorizer = armAuthorizer
 	c.groupsClient.Authorizer = armAuthorizer
 	c.providersClient.Authorizer = armAuthorizer
+	c.genericResourcesClient.Authorizer = armAuthorizer
+	c.availabilitySetsClient.Authorizer = armAuthorizer
 	c.virtualMachinesClient.Authorizer = armAuthorizer
 	c.virtualMachineScaleSetsClient.Authorizer = armAuthorizer
 	c.virtualMachineScaleSetVMsClient.Authorizer = armAuthorizer
@@ -373,6 +409,7 @@ func getClient(env azure.Environment, subscriptionID, tenantID string, armAuthor
 	c.groupsClient.PollingDuration = DefaultARMOperationTimeout
 	c.interfacesClient.PollingDuration = DefaultARMOperationTimeout
 	c.providersClient.PollingDuration = DefaultARMOperationTimeout
+	c.genericResourcesClient.PollingDuration = DefaultARMOperationTimeout
 	c.resourcesClient.PollingDuration = DefaultARMOperationTimeout
 	c.storageAccountsClient.PollingDuration = DefaultARMOperationTimeout
 	c.virtualMachineScaleSetsClient.PollingDuration = DefaultARMOperationTimeout
@@ -459,6 +496,8 @@ func (az *AzureClient) AddAcceptLanguages(languages []string) {
 	az.interfacesClient.Client.RequestInspector = az.addAcceptLanguages()
 	az.groupsClient.Client.RequestInspector = az.addAcceptLanguages()
 	az.providersClient.Client.RequestInspector = az.addAcceptLanguages()
+	az.genericResourcesClient.Client.RequestInspector = az.addAcceptLanguages()
+	az.availabilitySetsClient.Client.RequestInspector = az.addAcceptLanguages()
 	az.virtualMachinesClient.Client.RequestInspector = az.addAcceptLanguages()
 	az.virtualMachineScaleSetsClient.Client.RequestInspector = az.addAcceptLanguages()
 	az.disksClient.Client.RequestInspector = az.addAcceptLanguages()
@@ -522,6 +561,8 @@ func (az *AzureClient) AddAuxiliaryTokens(tokens []string) {
 	az.interfacesClient.Client.RequestInspector = requestWithTokens
 	az.groupsClient.Client.RequestInspector = requestWithTokens
 	az.providersClient.Client.RequestInspector = requestWithTokens
+	az.genericResourcesClient.Client.RequestInspector = requestWithTokens
+	az.availabilitySetsClient.Client.RequestInspector = requestWithTokens
 	az.virtualMachinesClient.Client.RequestInspector = requestWithTokens
 	az.virtualMachineScaleSetsClient.Client.RequestInspector = requestWithTokens
 	az.disksClient.Client.RequestInspector = requestWithTokens
@@ -35,6 +35,12 @@ func (az *AzureClient) DeleteVirtualMachine(ctx context.Context, resourceGroup,
 	return err
 }
 
+// DeleteAvailabilitySet deletes the specified availability set. The availability set must not contain any VMs.
+func (az *AzureClient) DeleteAvailabilitySet(ctx context.Context, resourceGroup, name string) error {
+	_, err := az.availabilitySetsClient.Delete(ctx, resourceGroup, name)
+	return err
+}
+
 // ListVirtualMachineScaleSets returns (the first page of) the vmss resources in the specified resource group.
 func (az *AzureClient) ListVirtualMachineScaleSets(ctx context.Context, resourceGroup string) (compute.VirtualMachineScaleSetListResultPage, error) {
 	return az.virtualMachineScaleSetsClient.List(ctx, resourceGroup)
@@ -0,0 +1,293 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package armhelpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultDeploymentProgressInterval is how often the operations of a running deployment are listed
+const DefaultDeploymentProgressInterval = 15 * time.Second
+
+// vmExtensionResourceType is the type of the custom script extensions provisioning the nodes
+const vmExtensionResourceType = "Microsoft.Compute/virtualMachines/extensions"
+
+// exitStatusRegex matches the exit status the VM agent reports for a failed custom script
+var exitStatusRegex = regexp.MustCompile(`exit status=(\d+)`)
+
+// cseExitCodes are the meaning of the exit codes of the custom script provisioning the nodes,
+// defined in parts/k8s/kubernetesprovisionsource.sh
+var cseExitCodes = map[int]string{
+	4:   "Service could not be started or enabled by systemctl (ERR_SYSTEMCTL_START_FAIL)",
+	5:   "Timeout waiting for cloud-init runcmd to complete (ERR_CLOUD_INIT_TIMEOUT)",
+	6:   "Timeout waiting for a file (ERR_FILE_WATCH_TIMEOUT)",
+	7:   "Unable to place walinuxagent apt package on hold during install (ERR_HOLD_WALINUXAGENT)",
+	8:   "Unable to release hold on walinuxagent apt package after install (ERR_RELEASE_HOLD_WALINUXAGENT)",
+	9:   "Timeout installing required apt packages (ERR_APT_INSTALL_TIMEOUT)",
+	10:  "Etcd data dir not found (ERR_ETCD_DATA_DIR_NOT_FOUND)",
+	11:  "Timeout waiting for etcd to be accessible (ERR_ETCD_RUNNING_TIMEOUT)",
+	12:  "Timeout waiting for etcd to download (ERR_ETCD_DOWNLOAD_TIMEOUT)",
+	13:  "Unable to mount etcd disk volume (ERR_ETCD_VOL_MOUNT_FAIL)",
+	14:  "Unable to start etcd runtime (ERR_ETCD_START_TIMEOUT)",
+	15:  "Unable to configure etcd cluster (ERR_ETCD_CONFIG_FAIL)",
+	20:  "Timeout waiting for docker install (ERR_DOCKER_INSTALL_TIMEOUT)",
+	21:  "Timout waiting for docker download(s) (ERR_DOCKER_DOWNLOAD_TIMEOUT)",
+	22:  "Timeout waiting to download docker repo key (ERR_DOCKER_KEY_DOWNLOAD_TIMEOUT)",
+	23:  "Timeout waiting for docker apt-key (ERR_DOCKER_APT_KEY_TIMEOUT)",
+	24:  "Docker could not be started by systemctl (ERR_DOCKER_START_FAIL)",
+	25:  "Timeout waiting for moby apt sources (ERR_MOBY_APT_LIST_TIMEOUT)",
+	26:  "Timeout waiting for MS GPG key download (ERR_MS_GPG_KEY_DOWNLOAD_TIMEOUT)",
+	27:  "Timeout waiting for moby install (ERR_MOBY_INSTALL_TIMEOUT)",
+	30:  "Timeout waiting for k8s cluster to be healthy (ERR_K8S_RUNNING_TIMEOUT)",
+	31:  "Timeout waiting for Kubernetes download(s) (ERR_K8S_DOWNLOAD_TIMEOUT)",
+	32:  "kubectl client binary not found on local disk (ERR_KUBECTL_NOT_FOUND)",
+	33:  "Timeout waiting for img download (ERR_IMG_DOWNLOAD_TIMEOUT)",
+	34:  "kubelet could not be started by systemctl (ERR_KUBELET_START_FAIL)",
+	35:  "Timeout trying to pull a container image (ERR_CONTAINER_IMG_PULL_TIMEOUT)",
+	41:  "Timeout waiting for CNI download(s) (ERR_CNI_DOWNLOAD_TIMEOUT)",
+	42:  "Timeout waiting for https://packages.microsoft.com/config/ubuntu/16.04/packages-microsoft-prod.deb (ERR_MS_PROD_DEB_DOWNLOAD_TIMEOUT)",
+	43:  "Failed to add repo pkg file (ERR_MS_PROD_DEB_PKG_ADD_FAIL)",
+	49:  "Unable to load a kernel module using modprobe (ERR_MODPROBE_FAIL)",
+	50:  "Unable to establish outbound connection (ERR_OUTBOUND_CONN_FAIL)",
+	60:  "Timeout waiting to download kata repo key (ERR_KATA_KEY_DOWNLOAD_TIMEOUT)",
+	61:  "Timeout waiting for kata apt-key (ERR_KATA_APT_KEY_TIMEOUT)",
+	62:  "Timeout waiting for kata install (ERR_KATA_INSTALL_TIMEOUT)",
+	70:  "Timeout waiting for containerd download(s) (ERR_CONTAINERD_DOWNLOAD_TIMEOUT)",
+	80:  "Unable to configure custom search domains (ERR_CUSTOM_SEARCH_DOMAINS_FAIL)",
+	84:  "nvidia-modprobe could not be started by systemctl (ERR_GPU_DRIVERS_START_FAIL)",
+	85:  "Timeout waiting for GPU drivers install (ERR_GPU_DRIVERS_INSTALL_TIMEOUT)",
+	90:  "Timeout waiting for SGX prereqs to download (ERR_SGX_DRIVERS_INSTALL_TIMEOUT)",
+	91:  "Failed to execute SGX driver binary (ERR_SGX_DRIVERS_START_FAIL)",
+	98:  "Timeout waiting for apt daily updates (ERR_APT_DAILY_TIMEOUT)",
+	99:  "Timeout waiting for apt-get update to complete (ERR_APT_UPDATE_TIMEOUT)",
+	100: "Timeout waiting for cloud-init to place this (!) script on the vm (ERR_CSE_PROVISION_SCRIPT_NOT_READY_TIMEOUT)",
+}
+
+// DeploymentOperationProgress is the state of the operation deploying one resource of a template
+type DeploymentOperationProgress struct {
+	OperationID       string
+	ResourceName      string
+	ResourceType      string
+	ProvisioningState string
+	StatusCode        string
+	// Reason explains why the operation failed. The exit code of a failed custom script is decoded into its meaning.
+	Reason string
+}
+
+// ExtensionProvisioningError is a VM extension that failed while the deployment is still running
+type ExtensionProvisioningError struct {
+	// Extension is the name of the extension resource, <vm name>/<extension name>
+	Extension string
+	// ExitCode is the exit code of the custom script, or -1 if the extension did not report one
+	ExitCode int
+	Reason   string
+}
+
+// Error implements error interface
+func (e *ExtensionProvisioningError) Error() string {
+	if e.ExitCode < 0 {
+		return fmt.Sprintf("VM extension %s failed: %s", e.Extension, e.Reason)
+	}
+	return fmt.Sprintf("VM extension %s failed with exit code %d: %s", e.Extension, e.ExitCode, e.Reason)
+}
+
+// DeploymentProgressTracker follows the operations of an ARM deployment while it runs
+type DeploymentProgressTracker struct {
+	Client         AKSEngineClient
+	ResourceGroup  string
+	DeploymentName string
+	// Report is called for every operation that started or changed state since the previous poll
+	Report func(DeploymentOperationProgress)
+
+	states map[string]string
+}
+
+// Poll lists the operations of the deployment once, reporting those that changed. It returns an
+// *ExtensionProvisioningError if a VM extension failed, since the deployment cannot succeed anymore.
+func (t *DeploymentProgressTracker) Poll(ctx context.Context) error {
+	if t.states == nil {
+		t.states = map[string]string{}
+	}
+	var failed *ExtensionProvisioningError
+	page, err := t.Client.ListDeploymentOperations(ctx, t.ResourceGroup, t.DeploymentName, nil)
+	for ; err == nil && page.NotDone(); err = page.Next() {
+		for _, operation := range page.Values() {
+			progress := deploymentOperationProgress(operation)
+			if t.states[progress.OperationID] == progress.ProvisioningState {
+				continue
+			}
+			t.states[progress.OperationID] = progress.ProvisioningState
+			if t.Report != nil {
+				t.Report(progress)
+			}
+			if failed == nil && progress.ProvisioningState == string(api.Failed) && strings.EqualFold(progress.ResourceType, vmExtensionResourceType) {
+				failed = &ExtensionProvisioningError{
+					Extension: progress.ResourceName,
+					ExitCode:  extensionExitCode(operation.Properties.StatusMessage),
+					Reason:    progress.Reason,
+				}
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if failed != nil {
+		return failed
+	}
+	return nil
+}
+
+// Track polls the operations of the deployment every interval until ctx is done or a VM extension fails
+func (t *DeploymentProgressTracker) Track(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := t.Poll(ctx); err != nil {
+				if _, ok := err.(*ExtensionProvisioningError); ok {
+					return err
+				}
+				// the operations are not listed until ARM accepted the deployment
+				continue
+			}
+		}
+	}
+}
+
+// DeployTemplateWithProgress deploys the template while reporting the progress of every resource to report.
+// When a VM extension fails the deployment is cancelled, and the *ExtensionProvisioningError is returned
+// with the meaning of the exit code of the custom script. The resources already created are kept.
+func DeployTemplateWithProgress(ctx context.Context, az AKSEngineClient, resourceGroupName, deploymentName string, template, parameters map[string]interface{}, interval time.Duration, report func(DeploymentOperationProgress)) (resources.DeploymentExtended, error) {
+	deployCtx, cancelDeploy := context.WithCancel(ctx)
+	defer cancelDeploy()
+	tracker := &DeploymentProgressTracker{
+		Client:         az,
+		ResourceGroup:  resourceGroupName,
+		DeploymentName: deploymentName,
+		Report:         report,
+	}
+
+	trackCtx, stopTracking := context.WithCancel(ctx)
+	tracked := make(chan error, 1)
+	go func() {
+		err := tracker.Track(trackCtx, interval)
+		if err != nil {
+			cancelDeploy()
+		}
+		tracked <- err
+	}()
+
+	de, err := az.DeployTemplate(deployCtx, resourceGroupName, deploymentName, template, parameters)
+	stopTracking()
+	if extensionErr := <-tracked; extensionErr != nil {
+		// cancelling deployCtx only stops waiting for the deployment, ARM keeps running it until it is cancelled
+		if err != nil && ctx.Err() == nil {
+			if cancelErr := az.CancelDeployment(ctx, resourceGroupName, deploymentName); cancelErr != nil {
+				log.Warnf("Failed to cancel deployment %s: %v", deploymentName, cancelErr)
+			}
+		}
+		return de, extensionErr
+	}
+
+	// report the final state of every operation, and why the deployment failed when a VM extension did
+	pollErr := tracker.Poll(ctx)
+	if extensionErr, ok := pollErr.(*ExtensionProvisioningError); ok && err != nil {
+		return de, extensionErr
+	}
+	return de, err
+}
+
+// deploymentOperationProgress returns the state of a deployment operation
+func deploymentOperationProgress(operation resources.DeploymentOperation) DeploymentOperationProgress {
+	progress := DeploymentOperationProgress{
+		OperationID: to.String(operation.OperationID),
+	}
+	if progress.OperationID == "" {
+		progress.OperationID = to.String(operation.ID)
+	}
+	properties := operation.Properties
+	if properties == nil {
+		return progress
+	}
+	progress.ProvisioningState = to.String(properties.ProvisioningState)
+	progress.StatusCode = to.String(properties.StatusCode)
+	if properties.TargetResource != nil {
+		progress.ResourceName = to.String(properties.TargetResource.ResourceName)
+		progress.ResourceType = to.String(properties.TargetResource.ResourceType)
+	}
+	if progress.ProvisioningState == string(api.Failed) {
+		progress.Reason = failureReason(properties.StatusMessage)
+	}
+	return progress
+}
+
+// failureReason returns the meaning of the exit code of a failed custom script, or else the innermost error message
+func failureReason(statusMessage interface{}) string {
+	if code := extensionExitCode(statusMessage); code >= 0 {
+		if reason, ok := cseExitCodes[code]; ok {
+			return reason
+		}
+		return fmt.Sprintf("the custom script exited with code %d", code)
+	}
+	messages := statusMessages(statusMessage)
+	if len(messages) == 0 {
+		return ""
+	}
+	return messages[len(messages)-1]
+}
+
+// extensionExitCode returns the exit status of a failed custom script found in a status message, or -1
+func extensionExitCode(statusMessage interface{}) int {
+	for _, message := range statusMessages(statusMessage) {
+		if match := exitStatusRegex.FindStringSubmatch(message); match != nil {
+			if code, err := strconv.Atoi(match[1]); err == nil {
+				return code
+			}
+		}
+	}
+	return -1
+}
+
+// statusMessages returns the "message" fields of the nested errors of a status message, outermost first
+func statusMessages(statusMessage interface{}) []string {
+	var messages []string
+	switch v := statusMessage.(type) {
+	case string:
+		// status messages are sometimes JSON documents serialized as a string
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(v), &decoded); err == nil {
+			return statusMessages(decoded)
+		}
+		messages = append(messages, v)
+	case map[string]interface{}:
+		if message, ok := v["message"].(string); ok {
+			messages = append(messages, message)
+		}
+		for _, key := range []string{"error", "details"} {
+			if nested, ok := v[key]; ok {
+				messages = append(messages, statusMessages(nested)...)
+			}
+		}
+	case []interface{}:
+		for _, nested := range v {
+			messages = append(messages, statusMessages(nested)...)
+		}
+	}
+	return messages
+}
@@ -0,0 +1,134 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package armhelpers
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const cseFailureStatusMessage = `{"status":"Failed","error":{"code":"ResourceDeploymentFailure","message":"The resource operation completed with terminal provisioning state 'Failed'.","details":[{"code":"VMExtensionProvisioningError","message":"VM has reported a failure when processing extension 'cse-master-0'. Error message: \"Enable failed: failed to execute command: command terminated with exit status=30\n[stdout]\n\n[stderr]\n\"."}]}}`
+
+func deploymentOperation(id, name, resourceType, state string, statusMessage interface{}) resources.DeploymentOperation {
+	return resources.DeploymentOperation{
+		OperationID: to.StringPtr(id),
+		Properties: &resources.DeploymentOperationProperties{
+			ProvisioningState: to.StringPtr(state),
+			StatusMessage:     statusMessage,
+			TargetResource: &resources.TargetResource{
+				ResourceName: to.StringPtr(name),
+				ResourceType: to.StringPtr(resourceType),
+			},
+		},
+	}
+}
+
+var _ = Describe("Deployment progress tests", func() {
+
+	It("Should decode the exit code of a failed custom script", func() {
+		Expect(extensionExitCode(cseFailureStatusMessage)).To(Equal(30))
+		Expect(failureReason(cseFailureStatusMessage)).To(Equal(cseExitCodes[30]))
+		Expect(failureReason(`{"error":{"code":"Conflict","message":"Operation is not allowed"}}`)).To(Equal("Operation is not allowed"))
+		Expect(extensionExitCode(`{"error":{"code":"Conflict","message":"Operation is not allowed"}}`)).To(Equal(-1))
+	})
+
+	It("Should know the meaning of every exit code of the custom script", func() {
+		f, err := os.Open("../../parts/k8s/kubernetesprovisionsource.sh")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		errorCode := regexp.MustCompile(`^(ERR_[A-Z0-9_]+)=(\d+)`)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			match := errorCode.FindStringSubmatch(scanner.Text())
+			if match == nil {
+				continue
+			}
+			code, err := strconv.Atoi(match[2])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cseExitCodes).To(HaveKey(code), "missing the meaning of %s", match[1])
+			Expect(cseExitCodes[code]).To(ContainSubstring(match[1]))
+		}
+		Expect(scanner.Err()).NotTo(HaveOccurred())
+	})
+
+	It("Should report only the operations that changed since the previous poll", func() {
+		mockClient := &MockAKSEngineClient{
+			DeploymentOperations: []resources.DeploymentOperation{
+				deploymentOperation("1", "k8s-master-12345678-0", "Microsoft.Compute/virtualMachines", "Running", nil),
+				deploymentOperation("2", "k8s-master-12345678-0/cse-master-0", vmExtensionResourceType, "Running", nil),
+			},
+		}
+		var reported []DeploymentOperationProgress
+		tracker := &DeploymentProgressTracker{
+			Client:         mockClient,
+			ResourceGroup:  "rg1",
+			DeploymentName: "deployment1",
+			Report: func(progress DeploymentOperationProgress) {
+				reported = append(reported, progress)
+			},
+		}
+		Expect(tracker.Poll(context.Background())).To(Succeed())
+		Expect(reported).To(HaveLen(2))
+
+		mockClient.DeploymentOperations[0] = deploymentOperation("1", "k8s-master-12345678-0", "Microsoft.Compute/virtualMachines", "Succeeded", nil)
+		Expect(tracker.Poll(context.Background())).To(Succeed())
+		Expect(reported).To(HaveLen(3))
+		Expect(reported[2].ResourceName).To(Equal("k8s-master-12345678-0"))
+		Expect(reported[2].ProvisioningState).To(Equal("Succeeded"))
+
+		mockClient.DeploymentOperations[1] = deploymentOperation("2", "k8s-master-12345678-0/cse-master-0", vmExtensionResourceType, "Failed", cseFailureStatusMessage)
+		err := tracker.Poll(context.Background())
+		Expect(reported).To(HaveLen(4))
+		Expect(reported[3].Reason).To(Equal(cseExitCodes[30]))
+		extensionErr, ok := err.(*ExtensionProvisioningError)
+		Expect(ok).To(BeTrue())
+		Expect(extensionErr.Extension).To(Equal("k8s-master-12345678-0/cse-master-0"))
+		Expect(extensionErr.ExitCode).To(Equal(30))
+	})
+
+	It("Should stop waiting for the deployment as soon as a VM extension fails", func() {
+		mockClient := &MockAKSEngineClient{
+			BlockDeployTemplate: true,
+			DeploymentOperations: []resources.DeploymentOperation{
+				deploymentOperation("1", "k8s-master-12345678-0/cse-master-0", vmExtensionResourceType, "Failed", cseFailureStatusMessage),
+			},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		var reported []DeploymentOperationProgress
+		_, err := DeployTemplateWithProgress(ctx, mockClient, "rg1", "deployment1", map[string]interface{}{}, map[string]interface{}{}, time.Millisecond, func(progress DeploymentOperationProgress) {
+			reported = append(reported, progress)
+		})
+		Expect(ctx.Err()).NotTo(HaveOccurred())
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("VM extension k8s-master-12345678-0/cse-master-0 failed with exit code 30: " + cseExitCodes[30]))
+		Expect(reported).To(HaveLen(1))
+		Expect(mockClient.CancelledDeployments).To(Equal([]string{"deployment1"}))
+	})
+
+	It("Should report the final state of the operations of a deployment", func() {
+		mockClient := &MockAKSEngineClient{
+			DeploymentOperations: []resources.DeploymentOperation{
+				deploymentOperation("1", "k8s-master-12345678-0", "Microsoft.Compute/virtualMachines", "Succeeded", nil),
+			},
+		}
+		var reported []DeploymentOperationProgress
+		_, err := DeployTemplateWithProgress(context.Background(), mockClient, "rg1", "deployment1", map[string]interface{}{}, map[string]interface{}{}, time.Hour, func(progress DeploymentOperationProgress) {
+			reported = append(reported, progress)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reported).To(HaveLen(1))
+		Expect(reported[0].ProvisioningState).To(Equal("Succeeded"))
+		Expect(mockClient.CancelledDeployments).To(BeEmpty())
+	})
+})
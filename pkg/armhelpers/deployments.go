@@ -62,6 +62,12 @@ func (az *AzureClient) ValidateTemplate(
 	return az.deploymentsClient.Validate(ctx, resourceGroupName, deploymentName, deployment)
 }
 
+// CancelDeployment cancels a template deployment that is still running, the resources it already created are kept
+func (az *AzureClient) CancelDeployment(ctx context.Context, resourceGroupName, deploymentName string) error {
+	_, err := az.deploymentsClient.Cancel(ctx, resourceGroupName, deploymentName)
+	return err
+}
+
 // GetDeployment returns the template deployment
 func (az *AzureClient) GetDeployment(ctx context.Context, resourceGroupName, deploymentName string) (result resources.DeploymentExtended, err error) {
 	return az.deploymentsClient.Get(ctx, resourceGroupName, deploymentName)
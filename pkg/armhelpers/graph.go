@@ -14,6 +14,7 @@ import (
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/date"
 	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
 	log "github.com/sirupsen/logrus"
 )
@@ -113,6 +114,30 @@ func (az *AzureClient) DeleteApp(ctx context.Context, applicationName, applicati
 	return az.DeleteGraphApplication(ctx, applicationObjectID)
 }
 
+// GetApplicationByAppID returns the application with the application (client) ID
+func (az *AzureClient) GetApplicationByAppID(ctx context.Context, appID string) (graphrbac.Application, error) {
+	page, err := az.applicationsClient.List(ctx, fmt.Sprintf("appId eq '%s'", appID))
+	if err != nil {
+		return graphrbac.Application{}, err
+	}
+	for _, app := range page.Values() {
+		return app, nil
+	}
+	return graphrbac.Application{}, errors.Errorf("application %s was not found", appID)
+}
+
+// GetServicePrincipalByAppID returns the service principal of the application with the application (client) ID
+func (az *AzureClient) GetServicePrincipalByAppID(ctx context.Context, appID string) (graphrbac.ServicePrincipal, error) {
+	page, err := az.servicePrincipalsClient.List(ctx, fmt.Sprintf("appId eq '%s'", appID))
+	if err != nil {
+		return graphrbac.ServicePrincipal{}, err
+	}
+	for _, sp := range page.Values() {
+		return sp, nil
+	}
+	return graphrbac.ServicePrincipal{}, errors.Errorf("service principal of application %s was not found", appID)
+}
+
 // CreateRoleAssignmentSimple is a wrapper around RoleAssignmentsClient.Create
 func (az *AzureClient) CreateRoleAssignmentSimple(ctx context.Context, resourceGroup, servicePrincipalObjectID string) error {
 	roleAssignmentName := uuid.NewV4().String()
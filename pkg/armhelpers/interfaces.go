@@ -7,6 +7,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/Azure/aks-engine/pkg/api"
 	"github.com/Azure/azure-sdk-for-go/services/authorization/mgmt/2015-07-01/authorization"
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/graphrbac/1.6/graphrbac"
@@ -16,6 +17,7 @@ import (
 	"github.com/Azure/go-autorest/autorest"
 	log "github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
 )
 
 // VirtualMachineListResultPage is an interface for compute.VirtualMachineListResultPage to aid in mocking
@@ -34,6 +36,14 @@ type DeploymentOperationsListResultPage interface {
 	Values() []resources.DeploymentOperation
 }
 
+// ResourceListResultPage is an interface for resources.ListResultPage to aid in mocking
+type ResourceListResultPage interface {
+	Next() error
+	NotDone() bool
+	Response() resources.ListResult
+	Values() []resources.GenericResource
+}
+
 // RoleAssignmentListResultPage is an interface for authorization.RoleAssignmentListResultPage to aid in mocking
 type RoleAssignmentListResultPage interface {
 	Next() error
@@ -58,9 +68,18 @@ type AKSEngineClient interface {
 	// DeployTemplate can deploy a template into Azure ARM
 	DeployTemplate(ctx context.Context, resourceGroup, name string, template, parameters map[string]interface{}) (resources.DeploymentExtended, error)
 
+	// CancelDeployment cancels a template deployment that is still running
+	CancelDeployment(ctx context.Context, resourceGroup, name string) error
+
 	// EnsureResourceGroup ensures the specified resource group exists in the specified location
 	EnsureResourceGroup(ctx context.Context, resourceGroup, location string, managedBy *string) (*resources.Group, error)
 
+	// ListResources lists the resources in the resource group
+	ListResources(ctx context.Context, resourceGroup string) (ResourceListResultPage, error)
+
+	// DeleteResourceByID deletes the resource with the fully qualified ID using the API version of its resource provider
+	DeleteResourceByID(ctx context.Context, resourceID, apiVersion string) error
+
 	//
 	// COMPUTE
 
@@ -85,6 +104,12 @@ type AKSEngineClient interface {
 	// SetVirtualMachineScaleSetCapacity sets the VMSS capacity
 	SetVirtualMachineScaleSetCapacity(ctx context.Context, resourceGroup, virtualMachineScaleSet string, sku compute.Sku, location string) error
 
+	// DeleteVirtualMachineScaleSet deletes an entire VMSS
+	DeleteVirtualMachineScaleSet(ctx context.Context, resourceGroup, vmssName string) error
+
+	// DeleteAvailabilitySet deletes the specified availability set
+	DeleteAvailabilitySet(ctx context.Context, resourceGroup, name string) error
+
 	//
 	// STORAGE
 
@@ -98,6 +123,15 @@ type AKSEngineClient interface {
 	// DeleteNetworkInterface deletes the specified network interface.
 	DeleteNetworkInterface(ctx context.Context, resourceGroup, nicName string) error
 
+	//
+	// KEY VAULT
+
+	// GetKeyVaultSecret returns the value of the referenced Key Vault secret
+	GetKeyVaultSecret(ctx context.Context, ref *api.KeyvaultSecretRef) (string, error)
+
+	// SetKeyVaultSecret creates a new version of the named secret in the Key Vault with the resource ID vaultID
+	SetKeyVaultSecret(ctx context.Context, vaultID, name, value string) (*api.KeyvaultSecretRef, error)
+
 	//
 	// GRAPH
 
@@ -109,6 +143,12 @@ type AKSEngineClient interface {
 	CreateApp(ctx context.Context, applicationName, applicationURL string, replyURLs *[]string, requiredResourceAccess *[]graphrbac.RequiredResourceAccess) (result graphrbac.Application, servicePrincipalObjectID, secret string, err error)
 	DeleteApp(ctx context.Context, applicationName, applicationObjectID string) (autorest.Response, error)
 
+	// GetApplicationByAppID retrieves the application with the application (client) ID
+	GetApplicationByAppID(ctx context.Context, appID string) (graphrbac.Application, error)
+
+	// GetServicePrincipalByAppID retrieves the service principal of the application with the application (client) ID
+	GetServicePrincipalByAppID(ctx context.Context, appID string) (graphrbac.ServicePrincipal, error)
+
 	// User Assigned MSI
 	//CreateUserAssignedID - Creates a user assigned msi.
 	CreateUserAssignedID(location string, resourceGroup string, userAssignedID string) (*msi.Identity, error)
@@ -141,14 +181,26 @@ type AKSStorageClient interface {
 	CreateContainer(containerName string, options *azStorage.CreateContainerOptions) (bool, error)
 	// SaveBlockBlob initializes a block blob by taking the byte
 	SaveBlockBlob(containerName, blobName string, b []byte, options *azStorage.PutBlobOptions) error
+	// GetBlockBlob returns the contents of the specified blob
+	GetBlockBlob(containerName, blobName string) ([]byte, error)
 }
 
 // KubernetesClient interface models client for interacting with kubernetes api server
 type KubernetesClient interface {
 	//ListPods returns all Pods running on the passed in node
 	ListPods(node *v1.Node) (*v1.PodList, error)
+	//ListNamespacedPods returns all Pods in the passed in namespace
+	ListNamespacedPods(namespace string) (*v1.PodList, error)
+	//ListPodDisruptionBudgets returns the pod disruption budgets of all namespaces
+	ListPodDisruptionBudgets() (*policy.PodDisruptionBudgetList, error)
+	//ListComponentStatuses returns the health of the control plane components, including etcd members
+	ListComponentStatuses() (*v1.ComponentStatusList, error)
+	//GetServerVersion returns the version of the api server
+	GetServerVersion() (string, error)
 	//GetNode returns details about node with passed in name
 	GetNode(name string) (*v1.Node, error)
+	//ListNodes returns all nodes registered with the api server
+	ListNodes() (*v1.NodeList, error)
 	//UpdateNode updates the node in the api server with the passed in info
 	UpdateNode(node *v1.Node) (*v1.Node, error)
 	//DeleteNode deregisters node in the api server
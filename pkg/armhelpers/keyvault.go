@@ -0,0 +1,147 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package armhelpers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/azure/cli"
+	"github.com/pkg/errors"
+)
+
+const keyVaultAPIVersion = "7.0"
+
+type keyVaultSecretBundle struct {
+	Value string `json:"value"`
+	ID    string `json:"id,omitempty"`
+}
+
+// GetKeyVaultSecret returns the value of the referenced Key Vault secret, its latest version when the reference has none
+func (az *AzureClient) GetKeyVaultSecret(ctx context.Context, ref *api.KeyvaultSecretRef) (string, error) {
+	vaultURL, err := az.keyVaultURL(ref.VaultID)
+	if err != nil {
+		return "", err
+	}
+	pathParameters := map[string]interface{}{
+		"secret-name": autorest.Encode("path", ref.SecretName),
+	}
+	secretPath := "/secrets/{secret-name}"
+	if ref.SecretVersion != "" {
+		pathParameters["secret-version"] = autorest.Encode("path", ref.SecretVersion)
+		secretPath += "/{secret-version}"
+	}
+
+	bundle := keyVaultSecretBundle{}
+	err = az.sendKeyVaultRequest(ctx, &bundle,
+		autorest.AsGet(),
+		autorest.WithBaseURL(vaultURL),
+		autorest.WithPathParameters(secretPath, pathParameters))
+	if err != nil {
+		return "", errors.Wrapf(err, "error getting secret %s", ref.SecretName)
+	}
+	return bundle.Value, nil
+}
+
+// SetKeyVaultSecret creates a new version of the named secret in the Key Vault with the resource ID vaultID
+func (az *AzureClient) SetKeyVaultSecret(ctx context.Context, vaultID, name, value string) (*api.KeyvaultSecretRef, error) {
+	vaultURL, err := az.keyVaultURL(vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := keyVaultSecretBundle{}
+	err = az.sendKeyVaultRequest(ctx, &bundle,
+		autorest.AsContentType("application/json; charset=utf-8"),
+		autorest.AsPut(),
+		autorest.WithBaseURL(vaultURL),
+		autorest.WithPathParameters("/secrets/{secret-name}", map[string]interface{}{
+			"secret-name": autorest.Encode("path", name),
+		}),
+		autorest.WithJSON(keyVaultSecretBundle{Value: value}))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error setting secret %s", name)
+	}
+	// the ID of the secret is https://<vault>/secrets/<name>/<version>
+	idParts := strings.Split(bundle.ID, "/")
+	return &api.KeyvaultSecretRef{
+		VaultID:       vaultID,
+		SecretName:    name,
+		SecretVersion: idParts[len(idParts)-1],
+	}, nil
+}
+
+func (az *AzureClient) sendKeyVaultRequest(ctx context.Context, result *keyVaultSecretBundle, decorators ...autorest.PrepareDecorator) error {
+	if az.keyVaultAuthorizer == nil {
+		return errors.New("the client has no Key Vault credentials")
+	}
+	decorators = append(decorators,
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": keyVaultAPIVersion}),
+		az.keyVaultAuthorizer.WithAuthorization())
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx), decorators...)
+	if err != nil {
+		return err
+	}
+	resp, err := autorest.SendWithSender(az.keyVaultClient, req,
+		autorest.DoRetryForStatusCodes(az.keyVaultClient.RetryAttempts, az.keyVaultClient.RetryDuration, autorest.StatusCodesForRetry...))
+	if err != nil {
+		return err
+	}
+	return autorest.Respond(resp,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(result),
+		autorest.ByClosing())
+}
+
+// keyVaultURL returns the data plane URL of the Key Vault with the resource ID vaultID
+func (az *AzureClient) keyVaultURL(vaultID string) (string, error) {
+	parts := strings.Split(strings.Trim(vaultID, "/"), "/")
+	if len(parts) < 2 || !strings.EqualFold(parts[len(parts)-2], "vaults") {
+		return "", errors.Errorf("%s is not the resource ID of a Key Vault", vaultID)
+	}
+	return "https://" + parts[len(parts)-1] + "." + az.environment.KeyVaultDNSSuffix, nil
+}
+
+// keyVaultResource returns the resource Key Vault tokens are requested for in the environment
+func keyVaultResource(env azure.Environment) string {
+	return strings.TrimSuffix(env.KeyVaultEndpoint, "/")
+}
+
+// cliAuthorizer gets a token from the Azure CLI the first time a request needs it, so that commands which never
+// talk to the resource do not ask the CLI for one
+type cliAuthorizer struct {
+	resource   string
+	once       sync.Once
+	authorizer autorest.Authorizer
+	err        error
+}
+
+func (a *cliAuthorizer) WithAuthorization() autorest.PrepareDecorator {
+	a.once.Do(func() {
+		token, err := cli.GetTokenFromCLI(a.resource)
+		if err != nil {
+			a.err = err
+			return
+		}
+		adalToken, err := token.ToADALToken()
+		if err != nil {
+			a.err = err
+			return
+		}
+		a.authorizer = autorest.NewBearerAuthorizer(&adalToken)
+	})
+	if a.err != nil {
+		return func(p autorest.Preparer) autorest.Preparer {
+			return autorest.PreparerFunc(func(r *http.Request) (*http.Request, error) {
+				return r, errors.Wrapf(a.err, "error getting a token for %s from the Azure CLI", a.resource)
+			})
+		}
+	}
+	return a.authorizer.WithAuthorization()
+}
@@ -49,11 +49,40 @@ func (c *KubernetesClientSetClient) ListPods(node *v1.Node) (*v1.PodList, error)
 		FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": node.Name}).String()})
 }
 
+//ListNamespacedPods returns all Pods in the passed in namespace
+func (c *KubernetesClientSetClient) ListNamespacedPods(namespace string) (*v1.PodList, error) {
+	return c.clientset.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+}
+
+//ListPodDisruptionBudgets returns the pod disruption budgets of all namespaces
+func (c *KubernetesClientSetClient) ListPodDisruptionBudgets() (*policy.PodDisruptionBudgetList, error) {
+	return c.clientset.PolicyV1beta1().PodDisruptionBudgets(metav1.NamespaceAll).List(metav1.ListOptions{})
+}
+
+//ListComponentStatuses returns the health of the control plane components, including etcd members
+func (c *KubernetesClientSetClient) ListComponentStatuses() (*v1.ComponentStatusList, error) {
+	return c.clientset.CoreV1().ComponentStatuses().List(metav1.ListOptions{})
+}
+
+//GetServerVersion returns the version of the api server
+func (c *KubernetesClientSetClient) GetServerVersion() (string, error) {
+	info, err := c.clientset.Discovery().ServerVersion()
+	if err != nil {
+		return "", err
+	}
+	return info.GitVersion, nil
+}
+
 //GetNode returns details about node with passed in name
 func (c *KubernetesClientSetClient) GetNode(name string) (*v1.Node, error) {
 	return c.clientset.CoreV1().Nodes().Get(name, metav1.GetOptions{})
 }
 
+//ListNodes returns all nodes registered with the api server
+func (c *KubernetesClientSetClient) ListNodes() (*v1.NodeList, error) {
+	return c.clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+}
+
 //UpdateNode updates the node in the api server with the passed in info
 func (c *KubernetesClientSetClient) UpdateNode(node *v1.Node) (*v1.Node, error) {
 	return c.clientset.CoreV1().Nodes().Update(node)
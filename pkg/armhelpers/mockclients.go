@@ -10,10 +10,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/Azure/go-autorest/autorest/to"
 
+	"github.com/Azure/aks-engine/pkg/api"
 	"github.com/Azure/azure-sdk-for-go/services/authorization/mgmt/2015-07-01/authorization"
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/graphrbac/1.6/graphrbac"
@@ -23,6 +25,7 @@ import (
 	"github.com/Azure/go-autorest/autorest"
 	log "github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
 )
 
 //MockAKSEngineClient is an implementation of AKSEngineClient where all requests error out
@@ -39,6 +42,8 @@ type MockAKSEngineClient struct {
 	FailDeleteVirtualMachine              bool
 	FailDeleteVirtualMachineScaleSetVM    bool
 	FailSetVirtualMachineScaleSetCapacity bool
+	FailDeleteVirtualMachineScaleSet      bool
+	FailDeleteAvailabilitySet             bool
 	FailListVirtualMachineScaleSetVMs     bool
 	FailGetStorageClient                  bool
 	FailDeleteNetworkInterface            bool
@@ -46,28 +51,56 @@ type MockAKSEngineClient struct {
 	FailListProviders                     bool
 	ShouldSupportVMIdentity               bool
 	FailDeleteRoleAssignment              bool
+	FailListResources                     bool
+	FailDeleteResourceByID                bool
+	FailGetApplicationByAppID             bool
 	MockKubernetesClient                  *MockKubernetesClient
+	MockStorageClient                     *MockStorageClient
+	// DeletedResourceIDs holds the IDs of the resources deleted by DeleteResourceByID, in order
+	DeletedResourceIDs []string
+	// KeyVaultSecrets holds the values of the secrets set by SetKeyVaultSecret, keyed by "<secret>/<version>"
+	KeyVaultSecrets map[string]string
+	// DeploymentOperations, when set, are the operations returned by ListDeploymentOperations
+	DeploymentOperations []resources.DeploymentOperation
+	// BlockDeployTemplate makes DeployTemplate wait until its context is done
+	BlockDeployTemplate bool
+	// CancelledDeployments holds the names of the deployments cancelled by CancelDeployment, in order
+	CancelledDeployments []string
+	mu                   sync.Mutex
 }
 
 //MockStorageClient mock implementation of StorageClient
 type MockStorageClient struct {
 	FailCreateContainer bool
 	FailSaveBlockBlob   bool
+	FailGetBlockBlob    bool
+	// Blobs holds the contents of the saved blobs, keyed by "<container>/<blob>"
+	Blobs map[string][]byte
 }
 
 //MockKubernetesClient mock implementation of KubernetesClient
 type MockKubernetesClient struct {
-	FailListPods          bool
-	FailGetNode           bool
-	UpdateNodeFunc        func(*v1.Node) (*v1.Node, error)
-	FailUpdateNode        bool
-	FailDeleteNode        bool
-	FailSupportEviction   bool
-	FailDeletePod         bool
-	FailEvictPod          bool
-	FailWaitForDelete     bool
-	ShouldSupportEviction bool
-	PodsList              *v1.PodList
+	FailListPods                 bool
+	FailListNamespacedPods       bool
+	FailListPodDisruptionBudgets bool
+	FailListComponentStatuses    bool
+	FailGetServerVersion         bool
+	FailGetNode                  bool
+	GetNodeFunc                  func(string) (*v1.Node, error)
+	FailListNodes                bool
+	UpdateNodeFunc               func(*v1.Node) (*v1.Node, error)
+	FailUpdateNode               bool
+	FailDeleteNode               bool
+	FailSupportEviction          bool
+	FailDeletePod                bool
+	FailEvictPod                 bool
+	FailWaitForDelete            bool
+	ShouldSupportEviction        bool
+	PodsList                     *v1.PodList
+	NamespacedPodsList           *v1.PodList
+	NodesList                    *v1.NodeList
+	PodDisruptionBudgetsList     *policy.PodDisruptionBudgetList
+	ComponentStatusesList        *v1.ComponentStatusList
 }
 
 // MockVirtualMachineListResultPage contains a page of VirtualMachine values.
@@ -175,6 +208,41 @@ func (page MockRoleAssignmentListResultPage) Values() []authorization.RoleAssign
 	return *page.Ralr.Value
 }
 
+// MockResourceListResultPage contains a page of GenericResource values.
+type MockResourceListResultPage struct {
+	Fn func(resources.ListResult) (resources.ListResult, error)
+	Lr resources.ListResult
+}
+
+// Next advances to the next page of values.  If there was an error making
+// the request the page does not advance and the error is returned.
+func (page *MockResourceListResultPage) Next() error {
+	next, err := page.Fn(page.Lr)
+	if err != nil {
+		return err
+	}
+	page.Lr = next
+	return nil
+}
+
+// NotDone returns true if the page enumeration should be started or is not yet complete.
+func (page MockResourceListResultPage) NotDone() bool {
+	return !page.Lr.IsEmpty()
+}
+
+// Response returns the raw server response from the last page request.
+func (page MockResourceListResultPage) Response() resources.ListResult {
+	return page.Lr
+}
+
+// Values returns the slice of values for the current page or nil if there are no values.
+func (page MockResourceListResultPage) Values() []resources.GenericResource {
+	if page.Lr.IsEmpty() {
+		return nil
+	}
+	return *page.Lr.Value
+}
+
 //ListPods returns all Pods running on the passed in node
 func (mkc *MockKubernetesClient) ListPods(node *v1.Node) (*v1.PodList, error) {
 	if mkc.FailListPods {
@@ -186,8 +254,52 @@ func (mkc *MockKubernetesClient) ListPods(node *v1.Node) (*v1.PodList, error) {
 	return &v1.PodList{}, nil
 }
 
+//ListNamespacedPods returns all Pods in the passed in namespace
+func (mkc *MockKubernetesClient) ListNamespacedPods(namespace string) (*v1.PodList, error) {
+	if mkc.FailListNamespacedPods {
+		return nil, errors.New("ListNamespacedPods failed")
+	}
+	if mkc.NamespacedPodsList != nil {
+		return mkc.NamespacedPodsList, nil
+	}
+	return &v1.PodList{}, nil
+}
+
+//ListPodDisruptionBudgets returns the pod disruption budgets of all namespaces
+func (mkc *MockKubernetesClient) ListPodDisruptionBudgets() (*policy.PodDisruptionBudgetList, error) {
+	if mkc.FailListPodDisruptionBudgets {
+		return nil, errors.New("ListPodDisruptionBudgets failed")
+	}
+	if mkc.PodDisruptionBudgetsList != nil {
+		return mkc.PodDisruptionBudgetsList, nil
+	}
+	return &policy.PodDisruptionBudgetList{}, nil
+}
+
+//ListComponentStatuses returns the health of the control plane components, including etcd members
+func (mkc *MockKubernetesClient) ListComponentStatuses() (*v1.ComponentStatusList, error) {
+	if mkc.FailListComponentStatuses {
+		return nil, errors.New("ListComponentStatuses failed")
+	}
+	if mkc.ComponentStatusesList != nil {
+		return mkc.ComponentStatusesList, nil
+	}
+	return &v1.ComponentStatusList{}, nil
+}
+
+//GetServerVersion returns the version of the api server
+func (mkc *MockKubernetesClient) GetServerVersion() (string, error) {
+	if mkc.FailGetServerVersion {
+		return "", errors.New("GetServerVersion failed")
+	}
+	return "v1.7.9", nil
+}
+
 //GetNode returns details about node with passed in name
 func (mkc *MockKubernetesClient) GetNode(name string) (*v1.Node, error) {
+	if mkc.GetNodeFunc != nil {
+		return mkc.GetNodeFunc(name)
+	}
 	if mkc.FailGetNode {
 		return nil, errors.New("GetNode failed")
 	}
@@ -197,6 +309,17 @@ func (mkc *MockKubernetesClient) GetNode(name string) (*v1.Node, error) {
 	return node, nil
 }
 
+//ListNodes returns all nodes registered with the api server
+func (mkc *MockKubernetesClient) ListNodes() (*v1.NodeList, error) {
+	if mkc.FailListNodes {
+		return nil, errors.New("ListNodes failed")
+	}
+	if mkc.NodesList != nil {
+		return mkc.NodesList, nil
+	}
+	return &v1.NodeList{}, nil
+}
+
 //UpdateNode updates the node in the api server with the passed in info
 func (mkc *MockKubernetesClient) UpdateNode(node *v1.Node) (*v1.Node, error) {
 	if mkc.UpdateNodeFunc != nil {
@@ -267,11 +390,27 @@ func (msc *MockStorageClient) CreateContainer(container string, options *azStora
 //SaveBlockBlob mock
 func (msc *MockStorageClient) SaveBlockBlob(container, blob string, b []byte, options *azStorage.PutBlobOptions) error {
 	if !msc.FailSaveBlockBlob {
+		if msc.Blobs == nil {
+			msc.Blobs = make(map[string][]byte)
+		}
+		msc.Blobs[container+"/"+blob] = b
 		return nil
 	}
 	return errors.New("SaveBlockBlob failed")
 }
 
+//GetBlockBlob mock
+func (msc *MockStorageClient) GetBlockBlob(container, blob string) ([]byte, error) {
+	if msc.FailGetBlockBlob {
+		return nil, errors.New("GetBlockBlob failed")
+	}
+	b, ok := msc.Blobs[container+"/"+blob]
+	if !ok {
+		return nil, fmt.Errorf("blob %s/%s not found", container, blob)
+	}
+	return b, nil
+}
+
 //AddAcceptLanguages mock
 func (mc *MockAKSEngineClient) AddAcceptLanguages(languages []string) {}
 
@@ -281,6 +420,10 @@ func (mc *MockAKSEngineClient) AddAuxiliaryTokens(tokens []string) {}
 //DeployTemplate mock
 func (mc *MockAKSEngineClient) DeployTemplate(ctx context.Context, resourceGroup, name string, template, parameters map[string]interface{}) (de resources.DeploymentExtended, err error) {
 	switch {
+	case mc.BlockDeployTemplate:
+		<-ctx.Done()
+		return de, ctx.Err()
+
 	case mc.FailDeployTemplate:
 		return de, errors.New("DeployTemplate failed")
 
@@ -352,6 +495,14 @@ func (mc *MockAKSEngineClient) DeployTemplate(ctx context.Context, resourceGroup
 	}
 }
 
+// CancelDeployment mock
+func (mc *MockAKSEngineClient) CancelDeployment(ctx context.Context, resourceGroup, name string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.CancelledDeployments = append(mc.CancelledDeployments, name)
+	return nil
+}
+
 //EnsureResourceGroup mock
 func (mc *MockAKSEngineClient) EnsureResourceGroup(ctx context.Context, resourceGroup, location string, managedBy *string) (*resources.Group, error) {
 	if mc.FailEnsureResourceGroup {
@@ -361,6 +512,57 @@ func (mc *MockAKSEngineClient) EnsureResourceGroup(ctx context.Context, resource
 	return nil, nil
 }
 
+//ListResources mock returns the resources of the cluster with the name suffix 12345678, and of another cluster
+func (mc *MockAKSEngineClient) ListResources(ctx context.Context, resourceGroup string) (ResourceListResultPage, error) {
+	if mc.FailListResources {
+		return &MockResourceListResultPage{}, errors.New("ListResources failed")
+	}
+
+	resourceNameSuffix := "12345678"
+	poolName := "master"
+	tags := map[string]*string{
+		"resourceNameSuffix": &resourceNameSuffix,
+		"poolName":           &poolName,
+	}
+	newResource := func(resourceType, name string, tags map[string]*string) resources.GenericResource {
+		id := fmt.Sprintf("/subscriptions/DEC923E3-1EF1-4745-9516-37906D56DEC4/resourceGroups/%s/providers/%s/%s", resourceGroup, resourceType, name)
+		return resources.GenericResource{ID: to.StringPtr(id), Name: to.StringPtr(name), Type: to.StringPtr(resourceType), Tags: tags}
+	}
+	values := []resources.GenericResource{
+		newResource("Microsoft.Compute/virtualMachines", "k8s-master-12345678-0", tags),
+		newResource("Microsoft.Compute/virtualMachines/extensions", "k8s-master-12345678-0/cse0", nil),
+		newResource("Microsoft.Network/networkInterfaces", "k8s-master-12345678-nic-0", nil),
+		newResource("Microsoft.Compute/disks", "k8s-master-12345678-0_OsDisk_1_0a1b2c3d", nil),
+		newResource("Microsoft.Compute/availabilitySets", "master-availabilityset-12345678", nil),
+		newResource("Microsoft.Network/loadBalancers", "k8s-master-lb-12345678", nil),
+		newResource("Microsoft.Network/publicIPAddresses", "k8s-master-ip-masterdns1-12345678", nil),
+		newResource("Microsoft.Network/virtualNetworks", "k8s-vnet-12345678", nil),
+		newResource("Microsoft.Network/networkSecurityGroups", "k8s-master-12345678-nsg", nil),
+		newResource("Microsoft.Network/routeTables", "k8s-master-12345678-routetable", nil),
+		newResource("Microsoft.Compute/virtualMachines", "k8s-master-87654321-0", nil),
+		newResource("Microsoft.Network/virtualNetworks", "shared-vnet", nil),
+	}
+
+	return &MockResourceListResultPage{
+		Fn: func(lastResults resources.ListResult) (resources.ListResult, error) {
+			return resources.ListResult{}, nil
+		},
+		Lr: resources.ListResult{Value: &values},
+	}, nil
+}
+
+//DeleteResourceByID mock
+func (mc *MockAKSEngineClient) DeleteResourceByID(ctx context.Context, resourceID, apiVersion string) error {
+	if mc.FailDeleteResourceByID {
+		return errors.New("DeleteResourceByID failed")
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.DeletedResourceIDs = append(mc.DeletedResourceIDs, resourceID)
+	return nil
+}
+
 //ListVirtualMachines mock
 func (mc *MockAKSEngineClient) ListVirtualMachines(ctx context.Context, resourceGroup string) (VirtualMachineListResultPage, error) {
 	if mc.FailListVirtualMachines {
@@ -514,6 +716,24 @@ func (mc *MockAKSEngineClient) SetVirtualMachineScaleSetCapacity(ctx context.Con
 	return nil
 }
 
+//DeleteVirtualMachineScaleSet mock
+func (mc *MockAKSEngineClient) DeleteVirtualMachineScaleSet(ctx context.Context, resourceGroup, vmssName string) error {
+	if mc.FailDeleteVirtualMachineScaleSet {
+		return errors.New("DeleteVirtualMachineScaleSet failed")
+	}
+
+	return nil
+}
+
+//DeleteAvailabilitySet mock
+func (mc *MockAKSEngineClient) DeleteAvailabilitySet(ctx context.Context, resourceGroup, name string) error {
+	if mc.FailDeleteAvailabilitySet {
+		return errors.New("DeleteAvailabilitySet failed")
+	}
+
+	return nil
+}
+
 //ListVirtualMachineScaleSetVMs mock
 func (mc *MockAKSEngineClient) ListVirtualMachineScaleSetVMs(ctx context.Context, resourceGroup, virtualMachineScaleSet string) (compute.VirtualMachineScaleSetVMListResultPage, error) {
 	if mc.FailDeleteVirtualMachineScaleSetVM {
@@ -529,7 +749,10 @@ func (mc *MockAKSEngineClient) GetStorageClient(ctx context.Context, resourceGro
 		return nil, errors.New("GetStorageClient failed")
 	}
 
-	return &MockStorageClient{}, nil
+	if mc.MockStorageClient == nil {
+		mc.MockStorageClient = &MockStorageClient{}
+	}
+	return mc.MockStorageClient, nil
 }
 
 //DeleteNetworkInterface mock
@@ -571,6 +794,28 @@ func (mc *MockAKSEngineClient) DeleteApp(ctx context.Context, appName, applicati
 	return response, nil
 }
 
+// GetApplicationByAppID mock returns the application aks-engine creates for the cluster with the DNS prefix masterdns1
+func (mc *MockAKSEngineClient) GetApplicationByAppID(ctx context.Context, appID string) (graphrbac.Application, error) {
+	if mc.FailGetApplicationByAppID {
+		return graphrbac.Application{}, errors.New("GetApplicationByAppID failed")
+	}
+
+	return graphrbac.Application{
+		AppID:          to.StringPtr(appID),
+		ObjectID:       to.StringPtr("app-object-id"),
+		DisplayName:    to.StringPtr("masterdns1"),
+		IdentifierUris: to.StringSlicePtr([]string{"https://masterdns1/"}),
+	}, nil
+}
+
+// GetServicePrincipalByAppID mock
+func (mc *MockAKSEngineClient) GetServicePrincipalByAppID(ctx context.Context, appID string) (graphrbac.ServicePrincipal, error) {
+	return graphrbac.ServicePrincipal{
+		AppID:    to.StringPtr(appID),
+		ObjectID: to.StringPtr("sp-object-id"),
+	}, nil
+}
+
 // User Assigned MSI
 
 //CreateUserAssignedID - Creates a user assigned msi.
@@ -623,6 +868,16 @@ func (mc *MockAKSEngineClient) ListProviders(ctx context.Context) (resources.Pro
 
 // ListDeploymentOperations gets all deployments operations for a deployment.
 func (mc *MockAKSEngineClient) ListDeploymentOperations(ctx context.Context, resourceGroupName string, deploymentName string, top *int32) (result DeploymentOperationsListResultPage, err error) {
+	if mc.DeploymentOperations != nil {
+		operations := append([]resources.DeploymentOperation{}, mc.DeploymentOperations...)
+		return &MockDeploymentOperationsListResultPage{
+			Fn: func(lastResults resources.DeploymentOperationsListResult) (result resources.DeploymentOperationsListResult, err error) {
+				return resources.DeploymentOperationsListResult{}, nil
+			},
+			Dolr: resources.DeploymentOperationsListResult{Value: &operations},
+		}, nil
+	}
+
 	resp := `{
 	"properties": {
 	"provisioningState":"Failed",
@@ -710,8 +965,34 @@ func (mc *MockAKSEngineClient) ListRoleAssignmentsForPrincipal(ctx context.Conte
 	}
 
 	return &MockRoleAssignmentListResultPage{
+		Fn: func(lastResults authorization.RoleAssignmentListResult) (authorization.RoleAssignmentListResult, error) {
+			return authorization.RoleAssignmentListResult{}, nil
+		},
 		Ralr: authorization.RoleAssignmentListResult{
 			Value: &roleAssignments,
 		},
 	}, nil
 }
+
+// GetKeyVaultSecret returns the value of a secret set by SetKeyVaultSecret
+func (mc *MockAKSEngineClient) GetKeyVaultSecret(ctx context.Context, ref *api.KeyvaultSecretRef) (string, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	value, ok := mc.KeyVaultSecrets[ref.SecretName+"/"+ref.SecretVersion]
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s not found", ref.SecretName, ref.SecretVersion)
+	}
+	return value, nil
+}
+
+// SetKeyVaultSecret keeps the value of the secret in KeyVaultSecrets, at a new version
+func (mc *MockAKSEngineClient) SetKeyVaultSecret(ctx context.Context, vaultID, name, value string) (*api.KeyvaultSecretRef, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.KeyVaultSecrets == nil {
+		mc.KeyVaultSecrets = map[string]string{}
+	}
+	version := fmt.Sprintf("%d", len(mc.KeyVaultSecrets))
+	mc.KeyVaultSecrets[name+"/"+version] = value
+	return &api.KeyvaultSecretRef{VaultID: vaultID, SecretName: name, SecretVersion: version}, nil
+}
@@ -0,0 +1,43 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package armhelpers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// ListResources returns (the first page of) the resources in the specified resource group.
+func (az *AzureClient) ListResources(ctx context.Context, resourceGroup string) (ResourceListResultPage, error) {
+	page, err := az.genericResourcesClient.ListByResourceGroup(ctx, resourceGroup, "", "", nil)
+	return &page, err
+}
+
+// DeleteResourceByID deletes the resource with the fully qualified ID. Resource providers only accept their own API
+// versions, so the request is sent with the given API version instead of the one of the resources API.
+func (az *AzureClient) DeleteResourceByID(ctx context.Context, resourceID, apiVersion string) error {
+	preparer := autorest.CreatePreparer(
+		autorest.AsDelete(),
+		autorest.WithBaseURL(az.genericResourcesClient.BaseURI),
+		autorest.WithPathParameters("/{resourceId}", map[string]interface{}{"resourceId": resourceID}),
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": apiVersion}))
+	req, err := preparer.Prepare((&http.Request{}).WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	future, err := az.genericResourcesClient.DeleteByIDSender(req)
+	if err != nil {
+		return err
+	}
+
+	if err = future.WaitForCompletionRef(ctx, az.genericResourcesClient.Client); err != nil {
+		return err
+	}
+
+	_, err = future.Result(az.genericResourcesClient)
+	return err
+}
@@ -6,6 +6,7 @@ package armhelpers
 import (
 	"bytes"
 	"context"
+	"io/ioutil"
 
 	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2018-02-01/storage"
 	azStorage "github.com/Azure/azure-sdk-for-go/storage"
@@ -69,6 +70,19 @@ func (as *AzureStorageClient) SaveBlockBlob(containerName, blobName string, b []
 	return blobRef.CreateBlockBlobFromReader(bytes.NewReader(b), options)
 }
 
+// GetBlockBlob returns the contents of the specified blob
+func (as *AzureStorageClient) GetBlockBlob(containerName, blobName string) ([]byte, error) {
+	containerRef := getContainerRef(as.client, containerName)
+	blobRef := containerRef.GetBlobReference(blobName)
+
+	reader, err := blobRef.Get(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
 func getContainerRef(client *azStorage.Client, containerName string) *azStorage.Container {
 	bs := client.GetBlobService()
 	return bs.GetContainerReference(containerName)
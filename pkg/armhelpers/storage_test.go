@@ -52,3 +52,20 @@ var _ = Describe("SaveBlockBlob Test", func() {
 		Expect(err).NotTo(BeNil())
 	})
 })
+
+var _ = Describe("GetBlockBlob Test", func() {
+	It("Should return the contents of a saved blob", func() {
+		client := MockStorageClient{}
+		err := client.SaveBlockBlob("fakeContainerName", "fakeBlobName", []byte("entity"), nil)
+		Expect(err).To(BeNil())
+		b, err := client.GetBlockBlob("fakeContainerName", "fakeBlobName")
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal("entity"))
+	})
+
+	It("Should return error when the blob does not exist", func() {
+		client := MockStorageClient{}
+		_, err := client.GetBlockBlob("fakeContainerName", "fakeBlobName")
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -42,8 +42,24 @@ func init() {
 	keyvaultSecretPathRe = regexp.MustCompile(`^(/subscriptions/\S+/resourceGroups/\S+/providers/Microsoft.KeyVault/vaults/\S+)/secrets/([^/\s]+)(/(\S+))?$`)
 }
 
+// KubeConfigOptions customize the kubeconfig returned by GenerateKubeConfigWithOptions
+type KubeConfigOptions struct {
+	// PrivateEndpoint connects to the internal address of the masters, as is always done for private clusters
+	PrivateEndpoint bool
+	// UserName names the user of the kubeconfig, admin if empty
+	UserName string
+	// ClientCertificate and ClientPrivateKey authenticate the user instead of the admin certificate or AAD
+	ClientCertificate string
+	ClientPrivateKey  string
+}
+
 // GenerateKubeConfig returns a JSON string representing the KubeConfig
 func GenerateKubeConfig(properties *api.Properties, location string) (string, error) {
+	return GenerateKubeConfigWithOptions(properties, location, KubeConfigOptions{})
+}
+
+// GenerateKubeConfigWithOptions returns a JSON string representing the KubeConfig of the user described by the options
+func GenerateKubeConfigWithOptions(properties *api.Properties, location string, options KubeConfigOptions) (string, error) {
 	if properties == nil {
 		return "", errors.New("Properties nil in GenerateKubeConfig")
 	}
@@ -57,29 +73,30 @@ func GenerateKubeConfig(properties *api.Properties, location string) (string, er
 	kubeconfig := string(b)
 	// variable replacement
 	kubeconfig = strings.Replace(kubeconfig, "{{WrapAsVerbatim \"parameters('caCertificate')\"}}", base64.StdEncoding.EncodeToString([]byte(properties.CertificateProfile.CaCertificate)), -1)
-	if properties.OrchestratorProfile != nil &&
-		properties.OrchestratorProfile.KubernetesConfig != nil &&
-		properties.OrchestratorProfile.KubernetesConfig.PrivateCluster != nil &&
-		to.Bool(properties.OrchestratorProfile.KubernetesConfig.PrivateCluster.Enabled) {
-		if properties.MasterProfile.Count > 1 {
-			// more than 1 master, use the internal lb IP
-			firstMasterIP := net.ParseIP(properties.MasterProfile.FirstConsecutiveStaticIP).To4()
-			if firstMasterIP == nil {
-				return "", errors.Errorf("MasterProfile.FirstConsecutiveStaticIP '%s' is an invalid IP address", properties.MasterProfile.FirstConsecutiveStaticIP)
-			}
-			lbIP := net.IP{firstMasterIP[0], firstMasterIP[1], firstMasterIP[2], firstMasterIP[3] + byte(DefaultInternalLbStaticIPOffset)}
-			kubeconfig = strings.Replace(kubeconfig, "{{WrapAsVerbatim \"reference(concat('Microsoft.Network/publicIPAddresses/', variables('masterPublicIPAddressName'))).dnsSettings.fqdn\"}}", lbIP.String(), -1)
-		} else {
-			// Master count is 1, use the master IP
-			kubeconfig = strings.Replace(kubeconfig, "{{WrapAsVerbatim \"reference(concat('Microsoft.Network/publicIPAddresses/', variables('masterPublicIPAddressName'))).dnsSettings.fqdn\"}}", properties.MasterProfile.FirstConsecutiveStaticIP, -1)
-		}
-	} else {
-		kubeconfig = strings.Replace(kubeconfig, "{{WrapAsVerbatim \"reference(concat('Microsoft.Network/publicIPAddresses/', variables('masterPublicIPAddressName'))).dnsSettings.fqdn\"}}", api.FormatAzureProdFQDNByLocation(properties.MasterProfile.DNSPrefix, location), -1)
+	server, err := kubeConfigServer(properties, location, options.PrivateEndpoint)
+	if err != nil {
+		return "", err
 	}
+	kubeconfig = strings.Replace(kubeconfig, "{{WrapAsVerbatim \"reference(concat('Microsoft.Network/publicIPAddresses/', variables('masterPublicIPAddressName'))).dnsSettings.fqdn\"}}", server, -1)
 	kubeconfig = strings.Replace(kubeconfig, "{{WrapAsVariable \"resourceGroup\"}}", properties.MasterProfile.DNSPrefix, -1)
 
+	// the admin context keeps the name of the cluster, so that it is replaced when merged into an existing kubeconfig
+	userName := options.UserName
+	contextName := properties.MasterProfile.DNSPrefix
+	if userName == "" {
+		userName = "admin"
+	} else if userName != "admin" {
+		contextName = fmt.Sprintf("%s-%s", properties.MasterProfile.DNSPrefix, userName)
+	}
+	kubeconfig = strings.Replace(kubeconfig, "{{userName}}", fmt.Sprintf("%s-%s", properties.MasterProfile.DNSPrefix, userName), -1)
+	kubeconfig = strings.Replace(kubeconfig, "{{contextName}}", contextName, -1)
+
 	var authInfo string
-	if properties.AADProfile == nil {
+	if options.ClientCertificate != "" {
+		authInfo = fmt.Sprintf("{\"client-certificate-data\":\"%v\",\"client-key-data\":\"%v\"}",
+			base64.StdEncoding.EncodeToString([]byte(options.ClientCertificate)),
+			base64.StdEncoding.EncodeToString([]byte(options.ClientPrivateKey)))
+	} else if properties.AADProfile == nil {
 		authInfo = fmt.Sprintf("{\"client-certificate-data\":\"%v\",\"client-key-data\":\"%v\"}",
 			base64.StdEncoding.EncodeToString([]byte(properties.CertificateProfile.KubeConfigCertificate)),
 			base64.StdEncoding.EncodeToString([]byte(properties.CertificateProfile.KubeConfigPrivateKey)))
@@ -89,8 +106,12 @@ func GenerateKubeConfig(properties *api.Properties, location string) (string, er
 			tenantID = "common"
 		}
 
+		environment := helpers.GetCloudTargetEnv(location)
+		if properties.CustomCloudProfile != nil && properties.CustomCloudProfile.Environment != nil && properties.CustomCloudProfile.Environment.Name != "" {
+			environment = properties.CustomCloudProfile.Environment.Name
+		}
 		authInfo = fmt.Sprintf("{\"auth-provider\":{\"name\":\"azure\",\"config\":{\"environment\":\"%v\",\"tenant-id\":\"%v\",\"apiserver-id\":\"%v\",\"client-id\":\"%v\"}}}",
-			helpers.GetCloudTargetEnv(location),
+			environment,
 			tenantID,
 			properties.AADProfile.ServerAppID,
 			properties.AADProfile.ClientAppID)
@@ -100,6 +121,36 @@ func GenerateKubeConfig(properties *api.Properties, location string) (string, er
 	return kubeconfig, nil
 }
 
+// kubeConfigServer returns the address of the API server, the internal one for private clusters
+func kubeConfigServer(properties *api.Properties, location string, private bool) (string, error) {
+	if properties.OrchestratorProfile != nil &&
+		properties.OrchestratorProfile.KubernetesConfig != nil &&
+		properties.OrchestratorProfile.KubernetesConfig.PrivateCluster != nil &&
+		to.Bool(properties.OrchestratorProfile.KubernetesConfig.PrivateCluster.Enabled) {
+		private = true
+	}
+	if private {
+		if properties.MasterProfile.Count > 1 {
+			// more than 1 master, use the internal lb IP
+			firstMasterIP := net.ParseIP(properties.MasterProfile.FirstConsecutiveStaticIP).To4()
+			if firstMasterIP == nil {
+				return "", errors.Errorf("MasterProfile.FirstConsecutiveStaticIP '%s' is an invalid IP address", properties.MasterProfile.FirstConsecutiveStaticIP)
+			}
+			lbIP := net.IP{firstMasterIP[0], firstMasterIP[1], firstMasterIP[2], firstMasterIP[3] + byte(DefaultInternalLbStaticIPOffset)}
+			return lbIP.String(), nil
+		}
+		// Master count is 1, use the master IP
+		if properties.MasterProfile.FirstConsecutiveStaticIP == "" {
+			return "", errors.New("MasterProfile.FirstConsecutiveStaticIP must be set to connect to the internal address of the master")
+		}
+		return properties.MasterProfile.FirstConsecutiveStaticIP, nil
+	}
+	if properties.CustomCloudProfile != nil && properties.CustomCloudProfile.Environment != nil && properties.CustomCloudProfile.Environment.ResourceManagerVMDNSSuffix != "" {
+		return fmt.Sprintf("%s.%s.%s", properties.MasterProfile.DNSPrefix, location, properties.CustomCloudProfile.Environment.ResourceManagerVMDNSSuffix), nil
+	}
+	return api.FormatAzureProdFQDNByLocation(properties.MasterProfile.DNSPrefix, location), nil
+}
+
 // validateDistro checks if the requested orchestrator type is supported on the requested Linux distro.
 func validateDistro(cs *api.ContainerService) bool {
 	// Check Master distro
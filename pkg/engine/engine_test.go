@@ -5,6 +5,7 @@ package engine
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -19,6 +20,7 @@ import (
 	"github.com/Azure/aks-engine/pkg/api/vlabs"
 	"github.com/Azure/aks-engine/pkg/engine/transform"
 	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/leonelquinteros/gotext"
 	"github.com/pkg/errors"
 )
@@ -564,3 +566,79 @@ func TestGenerateKubeConfig(t *testing.T) {
 		t.Fatalf("Expected an error result from nil Properties child properties")
 	}
 }
+
+func TestGenerateKubeConfigWithOptions(t *testing.T) {
+	cs := api.CreateMockContainerService("testcluster", "1.11.6", 3, 2, false)
+	cs.Properties.MasterProfile.DNSPrefix = "testcluster"
+	cs.Properties.MasterProfile.FirstConsecutiveStaticIP = "10.239.255.239"
+	cs.Properties.CertificateProfile = &api.CertificateProfile{
+		CaCertificate:         "ca",
+		KubeConfigCertificate: "admincert",
+		KubeConfigPrivateKey:  "adminkey",
+	}
+
+	kubeConfig, err := GenerateKubeConfigWithOptions(cs.Properties, "westus2", KubeConfigOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error generating kubeconfig: %s", err)
+	}
+	config := struct {
+		Clusters []struct {
+			Cluster struct {
+				Server string `json:"server"`
+			} `json:"cluster"`
+		} `json:"clusters"`
+		CurrentContext string `json:"current-context"`
+		Users          []struct {
+			Name string `json:"name"`
+			User struct {
+				ClientCertificateData string `json:"client-certificate-data"`
+			} `json:"user"`
+		} `json:"users"`
+	}{}
+	if err = json.Unmarshal([]byte(kubeConfig), &config); err != nil {
+		t.Fatalf("unable to parse kubeconfig: %s", err)
+	}
+	if config.Clusters[0].Cluster.Server != "https://testcluster.westus2.cloudapp.azure.com" || config.CurrentContext != "testcluster" || config.Users[0].Name != "testcluster-admin" {
+		t.Fatalf("unexpected admin kubeconfig %s", kubeConfig)
+	}
+
+	kubeConfig, err = GenerateKubeConfigWithOptions(cs.Properties, "westus2", KubeConfigOptions{
+		PrivateEndpoint:   true,
+		UserName:          "alice",
+		ClientCertificate: "alicecert",
+		ClientPrivateKey:  "alicekey",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error generating kubeconfig: %s", err)
+	}
+	if err = json.Unmarshal([]byte(kubeConfig), &config); err != nil {
+		t.Fatalf("unable to parse kubeconfig: %s", err)
+	}
+	if config.Clusters[0].Cluster.Server != "https://10.239.255.249" || config.CurrentContext != "testcluster-alice" || config.Users[0].Name != "testcluster-alice" {
+		t.Fatalf("unexpected private endpoint kubeconfig %s", kubeConfig)
+	}
+	if config.Users[0].User.ClientCertificateData != base64.StdEncoding.EncodeToString([]byte("alicecert")) {
+		t.Fatalf("expected the kubeconfig to authenticate with the given client certificate, got %s", kubeConfig)
+	}
+
+	cs.Properties.CustomCloudProfile = &api.CustomCloudProfile{
+		Environment: &azure.Environment{
+			Name:                       "AzureStackCloud",
+			ResourceManagerVMDNSSuffix: "cloudapp.azurestack.external",
+		},
+	}
+	cs.Properties.AADProfile = &api.AADProfile{ServerAppID: "server", ClientAppID: "client"}
+	kubeConfig, err = GenerateKubeConfigWithOptions(cs.Properties, "local", KubeConfigOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error generating kubeconfig: %s", err)
+	}
+	if err = json.Unmarshal([]byte(kubeConfig), &config); err != nil {
+		t.Fatalf("unable to parse kubeconfig: %s", err)
+	}
+	if config.Clusters[0].Cluster.Server != "https://testcluster.local.cloudapp.azurestack.external" {
+		t.Fatalf("expected the custom cloud DNS suffix to be used, got %s", config.Clusters[0].Cluster.Server)
+	}
+	if !strings.Contains(kubeConfig, `"environment":"AzureStackCloud"`) {
+		t.Fatalf("expected the AAD auth provider to use the custom cloud environment, got %s", kubeConfig)
+	}
+}
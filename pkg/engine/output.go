@@ -4,6 +4,7 @@
 package engine
 
 import (
+	"encoding/json"
 	"fmt"
 	"path"
 	"strconv"
@@ -17,6 +18,16 @@ import (
 // ArtifactWriter represents the object that writes artifacts
 type ArtifactWriter struct {
 	Translator *i18n.Translator
+	// SecretStore keeps the secrets of the api model out of apimodel.json. When it is nil, the store of the
+	// secrets manifest already in the artifacts directory is used, if any.
+	SecretStore api.SecretStore
+	// KeyVaultClient saves the secrets of api models whose secrets are kept in Key Vault
+	KeyVaultClient api.KeyVaultClient
+	// Redact also writes the api model without its secrets to apimodel.redacted.json, for sharing
+	Redact bool
+	// APIModelFormat is the format the api model is written in, api.APIModelFormatJSON when empty or
+	// api.APIModelFormatYAML to write apimodel.yaml instead of apimodel.json
+	APIModelFormat string
 }
 
 // WriteTLSArtifacts saves TLS certificates and keys to the server filesystem
@@ -30,21 +41,33 @@ func (w *ArtifactWriter) WriteTLSArtifacts(containerService *api.ContainerServic
 		Translator: w.Translator,
 	}
 
+	apiloader := &api.Apiloader{
+		Translator:     w.Translator,
+		KeyVaultClient: w.KeyVaultClient,
+	}
+	store, err := apiloader.SecretStoreFor(artifactsDir, w.SecretStore)
+	if err != nil {
+		return err
+	}
+
 	// convert back the API object, and write it
-	var b []byte
-	var err error
 	if !parametersOnly {
-		apiloader := &api.Apiloader{
-			Translator: w.Translator,
-		}
-		b, err = apiloader.SerializeContainerService(containerService, apiVersion)
-
-		if err != nil {
-			return err
+		if e := apiloader.SaveContainerService(containerService, apiVersion, artifactsDir, api.APIModelFilename(w.APIModelFormat), store); e != nil {
+			return e
 		}
 
-		if e := f.SaveFile(artifactsDir, "apimodel.json", b); e != nil {
-			return e
+		if w.Redact {
+			b, e := apiloader.SerializeRedactedContainerService(containerService, apiVersion)
+			if e != nil {
+				return e
+			}
+			filename := api.RedactedAPIModelFilename(w.APIModelFormat)
+			if b, e = api.FormatAPIModel(filename, b); e != nil {
+				return e
+			}
+			if e = f.SaveFile(artifactsDir, filename, b); e != nil {
+				return e
+			}
 		}
 
 		if e := f.SaveFileString(artifactsDir, "azuredeploy.json", template); e != nil {
@@ -52,9 +75,22 @@ func (w *ArtifactWriter) WriteTLSArtifacts(containerService *api.ContainerServic
 		}
 	}
 
+	// with a secret store, the secure parameters and the private keys are only kept in the store, with the other
+	// secrets of the api model, and generated again from it
+	if store != nil {
+		if parameters, err = withoutSecureParameters(template, parameters); err != nil {
+			return err
+		}
+	}
 	if e := f.SaveFileString(artifactsDir, "azuredeploy.parameters.json", parameters); e != nil {
 		return e
 	}
+	saveKey := func(name, key string) error {
+		if store != nil {
+			return nil
+		}
+		return f.SaveFileString(artifactsDir, name, key)
+	}
 
 	if !certsGenerated {
 		return nil
@@ -80,37 +116,37 @@ func (w *ArtifactWriter) WriteTLSArtifacts(containerService *api.ContainerServic
 			}
 		}
 
-		if e := f.SaveFileString(artifactsDir, "ca.key", properties.CertificateProfile.CaPrivateKey); e != nil {
+		if e := saveKey("ca.key", properties.CertificateProfile.CaPrivateKey); e != nil {
 			return e
 		}
 		if e := f.SaveFileString(artifactsDir, "ca.crt", properties.CertificateProfile.CaCertificate); e != nil {
 			return e
 		}
-		if e := f.SaveFileString(artifactsDir, "apiserver.key", properties.CertificateProfile.APIServerPrivateKey); e != nil {
+		if e := saveKey("apiserver.key", properties.CertificateProfile.APIServerPrivateKey); e != nil {
 			return e
 		}
 		if e := f.SaveFileString(artifactsDir, "apiserver.crt", properties.CertificateProfile.APIServerCertificate); e != nil {
 			return e
 		}
-		if e := f.SaveFileString(artifactsDir, "client.key", properties.CertificateProfile.ClientPrivateKey); e != nil {
+		if e := saveKey("client.key", properties.CertificateProfile.ClientPrivateKey); e != nil {
 			return e
 		}
 		if e := f.SaveFileString(artifactsDir, "client.crt", properties.CertificateProfile.ClientCertificate); e != nil {
 			return e
 		}
-		if e := f.SaveFileString(artifactsDir, "kubectlClient.key", properties.CertificateProfile.KubeConfigPrivateKey); e != nil {
+		if e := saveKey("kubectlClient.key", properties.CertificateProfile.KubeConfigPrivateKey); e != nil {
 			return e
 		}
 		if e := f.SaveFileString(artifactsDir, "kubectlClient.crt", properties.CertificateProfile.KubeConfigCertificate); e != nil {
 			return e
 		}
-		if e := f.SaveFileString(artifactsDir, "etcdserver.key", properties.CertificateProfile.EtcdServerPrivateKey); e != nil {
+		if e := saveKey("etcdserver.key", properties.CertificateProfile.EtcdServerPrivateKey); e != nil {
 			return e
 		}
 		if e := f.SaveFileString(artifactsDir, "etcdserver.crt", properties.CertificateProfile.EtcdServerCertificate); e != nil {
 			return e
 		}
-		if e := f.SaveFileString(artifactsDir, "etcdclient.key", properties.CertificateProfile.EtcdClientPrivateKey); e != nil {
+		if e := saveKey("etcdclient.key", properties.CertificateProfile.EtcdClientPrivateKey); e != nil {
 			return e
 		}
 		if e := f.SaveFileString(artifactsDir, "etcdclient.crt", properties.CertificateProfile.EtcdClientCertificate); e != nil {
@@ -121,7 +157,7 @@ func (w *ArtifactWriter) WriteTLSArtifacts(containerService *api.ContainerServic
 				return errors.New("missing etcd peer certificate/key pair")
 			}
 			k := "etcdpeer" + strconv.Itoa(i) + ".key"
-			if e := f.SaveFileString(artifactsDir, k, properties.CertificateProfile.EtcdPeerPrivateKeys[i]); e != nil {
+			if e := saveKey(k, properties.CertificateProfile.EtcdPeerPrivateKeys[i]); e != nil {
 				return e
 			}
 			c := "etcdpeer" + strconv.Itoa(i) + ".crt"
@@ -133,3 +169,30 @@ func (w *ArtifactWriter) WriteTLSArtifacts(containerService *api.ContainerServic
 
 	return nil
 }
+
+// withoutSecureParameters returns the parameters file without the parameters the template declares as
+// securestring or secureobject
+func withoutSecureParameters(template, parameters string) (string, error) {
+	templateMap, err := parseTemplate(template)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing the template")
+	}
+	m := map[string]interface{}{}
+	if err = json.Unmarshal([]byte(parameters), &m); err != nil {
+		return "", errors.Wrap(err, "error parsing the parameters")
+	}
+	values := m
+	if wrapped, ok := m["parameters"].(map[string]interface{}); ok && m["$schema"] != nil {
+		values = wrapped
+	}
+	for name := range values {
+		if IsSecureParameter(templateMap, name) {
+			delete(values, name)
+		}
+	}
+	b, err := helpers.JSONMarshalIndent(m, "", "  ", false)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
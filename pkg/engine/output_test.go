@@ -5,8 +5,10 @@ package engine
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
 
 	"github.com/Azure/aks-engine/pkg/api"
@@ -86,3 +88,88 @@ func TestWriteTLSArtifacts(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteTLSArtifactsWithSecretStore(t *testing.T) {
+	cs := api.CreateMockContainerService("testcluster", "1.7.12", 1, 2, true)
+	cs.Properties.ServicePrincipalProfile.Secret = "serviceprincipalsecret"
+	writer := &ArtifactWriter{
+		Translator: &i18n.Translator{
+			Locale: nil,
+		},
+		SecretStore: &api.FileSecretStore{},
+	}
+	dir := "_testsecretstoredir"
+	defer os.RemoveAll(dir)
+
+	template := `{"parameters": {"servicePrincipalClientSecret": {"type": "securestring"}, "masterCount": {"type": "int"}}}`
+	parameters := `{"$schema": "https://schema.management.azure.com/schemas/2015-01-01/deploymentParameters.json#", "contentVersion": "1.0.0.0", "parameters": {"servicePrincipalClientSecret": {"value": "serviceprincipalsecret"}, "masterCount": {"value": 1}}}`
+	if err := writer.WriteTLSArtifacts(cs, "vlabs", template, parameters, dir, true, false); err != nil {
+		t.Fatalf("unexpected error trying to write TLS artifacts: %s", err.Error())
+	}
+
+	// the secure parameters and the private keys are kept in the secret store only
+	b, err := ioutil.ReadFile(path.Join(dir, "azuredeploy.parameters.json"))
+	if err != nil {
+		t.Fatalf("expected file %s/azuredeploy.parameters.json to be generated by WriteTLSArtifacts", dir)
+	}
+	if strings.Contains(string(b), "servicePrincipalClientSecret") || !strings.Contains(string(b), "masterCount") {
+		t.Fatalf("expected only the secure parameters to be left out of %s/azuredeploy.parameters.json, got %s", dir, b)
+	}
+	if _, err = os.Stat(path.Join(dir, "ca.key")); !os.IsNotExist(err) {
+		t.Fatalf("expected file %s/ca.key not to be written with a secret store", dir)
+	}
+	if _, err = os.Stat(path.Join(dir, "ca.crt")); err != nil {
+		t.Fatalf("expected file %s/ca.crt to be generated by WriteTLSArtifacts", dir)
+	}
+
+	b, err = ioutil.ReadFile(path.Join(dir, "apimodel.json"))
+	if err != nil {
+		t.Fatalf("expected file %s/apimodel.json to be generated by WriteTLSArtifacts", dir)
+	}
+	if strings.Contains(string(b), cs.Properties.ServicePrincipalProfile.Secret) {
+		t.Fatalf("expected the service principal secret not to be written to %s/apimodel.json", dir)
+	}
+	manifest, err := api.LoadSecretsManifest(dir)
+	if err != nil || manifest == nil {
+		t.Fatalf("expected file %s/%s to be generated by WriteTLSArtifacts", dir, api.SecretsFilename)
+	}
+	if manifest.Secrets["properties.servicePrincipalProfile.secret"] != cs.Properties.ServicePrincipalProfile.Secret {
+		t.Fatalf("expected the service principal secret to be written to %s/%s", dir, api.SecretsFilename)
+	}
+}
+
+func TestWriteTLSArtifactsAsYAML(t *testing.T) {
+	cs := api.CreateMockContainerService("testcluster", "1.7.12", 1, 2, true)
+	cs.Properties.ServicePrincipalProfile.Secret = "serviceprincipalsecret"
+	writer := &ArtifactWriter{
+		Translator: &i18n.Translator{
+			Locale: nil,
+		},
+		Redact:         true,
+		APIModelFormat: api.APIModelFormatYAML,
+	}
+	dir := "_testyamldir"
+	defer os.RemoveAll(dir)
+
+	if err := writer.WriteTLSArtifacts(cs, "vlabs", "fake template", "fake parameters", dir, false, false); err != nil {
+		t.Fatalf("unexpected error trying to write TLS artifacts: %s", err.Error())
+	}
+
+	if _, err := os.Stat(path.Join(dir, "apimodel.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected file %s/apimodel.json not to be generated by WriteTLSArtifacts with the yaml api model format", dir)
+	}
+	b, err := ioutil.ReadFile(path.Join(dir, "apimodel.yaml"))
+	if err != nil {
+		t.Fatalf("expected file %s/apimodel.yaml to be generated by WriteTLSArtifacts", dir)
+	}
+	if !strings.Contains(string(b), "apiVersion: vlabs") || !strings.Contains(string(b), cs.Properties.ServicePrincipalProfile.Secret) {
+		t.Fatalf("expected the api model to be written to %s/apimodel.yaml in YAML", dir)
+	}
+	b, err = ioutil.ReadFile(path.Join(dir, "apimodel.redacted.yaml"))
+	if err != nil {
+		t.Fatalf("expected file %s/apimodel.redacted.yaml to be generated by WriteTLSArtifacts", dir)
+	}
+	if !strings.Contains(string(b), "apiVersion: vlabs") || strings.Contains(string(b), cs.Properties.ServicePrincipalProfile.Secret) {
+		t.Fatalf("expected the api model to be written without its secrets to %s/apimodel.redacted.yaml in YAML", dir)
+	}
+}
@@ -0,0 +1,488 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Azure/aks-engine/pkg/engine/transform"
+	"github.com/pkg/errors"
+)
+
+// Template diff changes
+const (
+	DiffAdded    = "added"
+	DiffRemoved  = "removed"
+	DiffModified = "modified"
+)
+
+const (
+	// diffContextLines is the number of unchanged lines shown around each hunk of a script diff
+	diffContextLines = 3
+	// maxDiffCells bounds the size of the table used to compute a script diff
+	maxDiffCells = 16 * 1024 * 1024
+	// secureValue replaces the values of secure parameters in a diff
+	secureValue = "(secure value)"
+)
+
+// base64GzipRegex matches the payloads produced by getBase64CustomScriptFromStr, which all start with the gzip magic number
+var base64GzipRegex = regexp.MustCompile(`H4sI[A-Za-z0-9+/]+=*`)
+
+// TemplateDiff is the semantic difference between two ARM templates
+type TemplateDiff struct {
+	Parameters []PropertyDiff `json:"parameters"`
+	Variables  []PropertyDiff `json:"variables"`
+	Resources  []ResourceDiff `json:"resources"`
+	Outputs    []PropertyDiff `json:"outputs"`
+}
+
+// ResourceDiff is an ARM resource added, removed or modified between two templates
+type ResourceDiff struct {
+	Type       string         `json:"type"`
+	Name       string         `json:"name"`
+	Change     string         `json:"change"`
+	Properties []PropertyDiff `json:"properties,omitempty"`
+}
+
+// PropertyDiff is a single value that changed between two templates. Scripts and other multi-line values
+// are reported as a unified diff of their decoded contents instead of their old and new values.
+type PropertyDiff struct {
+	Path       string      `json:"path"`
+	Change     string      `json:"change"`
+	Old        interface{} `json:"old,omitempty"`
+	New        interface{} `json:"new,omitempty"`
+	ScriptDiff string      `json:"scriptDiff,omitempty"`
+}
+
+// IsEmpty returns true if the templates are semantically identical
+func (d *TemplateDiff) IsEmpty() bool {
+	return len(d.Parameters) == 0 && len(d.Variables) == 0 && len(d.Resources) == 0 && len(d.Outputs) == 0
+}
+
+// DecodeBase64CustomScript reverses getBase64CustomScriptFromStr, returning the script a payload was produced from
+func DecodeBase64CustomScript(str string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return "", errors.Wrap(err, "error decoding base64 payload")
+	}
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return "", errors.Wrap(err, "error reading gzip payload")
+	}
+	defer r.Close()
+	script, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", errors.Wrap(err, "error decompressing gzip payload")
+	}
+	return string(script), nil
+}
+
+// DiffTemplates compares two ARM templates and their parameters files at the resource level.
+// Either parameters file may be empty, in which case the template defaults are compared.
+func DiffTemplates(oldTemplate, oldParameters, newTemplate, newParameters string) (*TemplateDiff, error) {
+	oldMap, err := parseTemplate(oldTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing old template")
+	}
+	newMap, err := parseTemplate(newTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing new template")
+	}
+	oldValues, err := parseParameterValues(oldMap, oldParameters)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing old parameters")
+	}
+	newValues, err := parseParameterValues(newMap, newParameters)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing new parameters")
+	}
+	// the deployed parameters leave out the secure ones when the secrets are kept in a secret store
+	for name, value := range newValues {
+		if _, ok := oldValues[name]; !ok && IsSecureParameter(oldMap, name) {
+			oldValues[name] = value
+		}
+	}
+
+	diff := &TemplateDiff{
+		Parameters: []PropertyDiff{},
+		Variables:  []PropertyDiff{},
+		Resources:  []ResourceDiff{},
+		Outputs:    []PropertyDiff{},
+	}
+	diffValues("", oldValues, newValues, &diff.Parameters)
+	redactSecureParameters(diff.Parameters, oldMap, newMap)
+	diffValues("", oldMap["variables"], newMap["variables"], &diff.Variables)
+	diffValues("", oldMap["outputs"], newMap["outputs"], &diff.Outputs)
+	diff.Resources = diffResources(TemplateResources(oldMap), TemplateResources(newMap))
+	return diff, nil
+}
+
+// IsSecureParameter returns true if the template declares the parameter as a securestring or secureobject
+func IsSecureParameter(template map[string]interface{}, name string) bool {
+	defs, _ := template["parameters"].(map[string]interface{})
+	def, _ := defs[name].(map[string]interface{})
+	t, _ := def["type"].(string)
+	return strings.EqualFold(t, "securestring") || strings.EqualFold(t, "secureobject")
+}
+
+// parseTemplate normalizes a template the same way generated templates are written before parsing it
+func parseTemplate(template string) (map[string]interface{}, error) {
+	pretty, err := transform.PrettyPrintArmTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	if err = json.Unmarshal([]byte(pretty), &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseParameterValues returns the ParameterValues of a template and the contents of its parameters file, which may be empty
+func parseParameterValues(template map[string]interface{}, parameters string) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	if parameters != "" {
+		if err := json.Unmarshal([]byte(parameters), &m); err != nil {
+			return nil, err
+		}
+	}
+	return ParameterValues(template, m), nil
+}
+
+// ParameterValues returns the effective value of every template parameter, preferring the parameters over the
+// template defaults. The parameters may or may not be wrapped in a deployment parameters document.
+func ParameterValues(template, parameters map[string]interface{}) map[string]interface{} {
+	values := map[string]interface{}{}
+	if defs, ok := template["parameters"].(map[string]interface{}); ok {
+		for name, def := range defs {
+			if d, ok := def.(map[string]interface{}); ok && d["defaultValue"] != nil {
+				values[name] = d["defaultValue"]
+			}
+		}
+	}
+	if wrapped, ok := parameters["parameters"].(map[string]interface{}); ok && parameters["$schema"] != nil {
+		parameters = wrapped
+	}
+	for name, param := range parameters {
+		if p, ok := param.(map[string]interface{}); ok {
+			values[name] = p["value"]
+		}
+	}
+	return values
+}
+
+func redactSecureParameters(diffs []PropertyDiff, templates ...map[string]interface{}) {
+	for i := range diffs {
+		for _, template := range templates {
+			if IsSecureParameter(template, diffs[i].Path) {
+				if diffs[i].Old != nil {
+					diffs[i].Old = secureValue
+				}
+				if diffs[i].New != nil {
+					diffs[i].New = secureValue
+				}
+				diffs[i].ScriptDiff = ""
+				break
+			}
+		}
+	}
+}
+
+// TemplateResources returns the resources of an ARM template
+func TemplateResources(template map[string]interface{}) []map[string]interface{} {
+	var resources []map[string]interface{}
+	list, _ := template["resources"].([]interface{})
+	for _, r := range list {
+		if resource, ok := r.(map[string]interface{}); ok {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
+
+func resourceTypeAndName(resource map[string]interface{}) (string, string) {
+	resourceType, _ := resource["type"].(string)
+	name, _ := resource["name"].(string)
+	return resourceType, name
+}
+
+// diffResources matches resources by type and name, in the order of the new template followed by removed resources
+func diffResources(oldResources, newResources []map[string]interface{}) []ResourceDiff {
+	oldByKey := map[string]map[string]interface{}{}
+	for _, r := range oldResources {
+		t, n := resourceTypeAndName(r)
+		oldByKey[t+"/"+n] = r
+	}
+
+	diffs := []ResourceDiff{}
+	seen := map[string]bool{}
+	for _, r := range newResources {
+		t, n := resourceTypeAndName(r)
+		key := t + "/" + n
+		seen[key] = true
+		old, ok := oldByKey[key]
+		if !ok {
+			diffs = append(diffs, ResourceDiff{Type: t, Name: n, Change: DiffAdded})
+			continue
+		}
+		properties := []PropertyDiff{}
+		diffValues("", old, r, &properties)
+		if len(properties) > 0 {
+			diffs = append(diffs, ResourceDiff{Type: t, Name: n, Change: DiffModified, Properties: properties})
+		}
+	}
+	for _, r := range oldResources {
+		t, n := resourceTypeAndName(r)
+		if !seen[t+"/"+n] {
+			diffs = append(diffs, ResourceDiff{Type: t, Name: n, Change: DiffRemoved})
+		}
+	}
+	return diffs
+}
+
+// DiffJSON returns the differences between two decoded JSON documents, value by value
+func DiffJSON(oldValue, newValue interface{}) []PropertyDiff {
+	diffs := []PropertyDiff{}
+	diffValues("", oldValue, newValue, &diffs)
+	return diffs
+}
+
+// diffValues appends the differences between two JSON values to diffs. Objects are compared key by key,
+// arrays of the same length element by element, and anything else as a whole.
+func diffValues(path string, oldValue, newValue interface{}, diffs *[]PropertyDiff) {
+	if reflect.DeepEqual(oldValue, newValue) {
+		return
+	}
+	switch {
+	case oldValue == nil:
+		*diffs = append(*diffs, PropertyDiff{Path: path, Change: DiffAdded, New: newValue})
+		return
+	case newValue == nil:
+		*diffs = append(*diffs, PropertyDiff{Path: path, Change: DiffRemoved, Old: oldValue})
+		return
+	}
+
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := []string{}
+		for k := range oldMap {
+			keys = append(keys, k)
+		}
+		for k := range newMap {
+			if _, ok := oldMap[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffValues(joinPath(path, k), oldMap[k], newMap[k], diffs)
+		}
+		return
+	}
+
+	oldList, oldIsList := oldValue.([]interface{})
+	newList, newIsList := newValue.([]interface{})
+	if oldIsList && newIsList && len(oldList) == len(newList) {
+		for i := range oldList {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), oldList[i], newList[i], diffs)
+		}
+		return
+	}
+
+	oldString, oldIsString := oldValue.(string)
+	newString, newIsString := newValue.(string)
+	if oldIsString && newIsString {
+		oldScript, oldIsScript := decodeScript(oldString)
+		newScript, newIsScript := decodeScript(newString)
+		if oldIsScript || newIsScript || strings.HasSuffix(path, "customData") {
+			*diffs = append(*diffs, PropertyDiff{
+				Path:       path,
+				Change:     DiffModified,
+				ScriptDiff: UnifiedDiff(oldScript, newScript, "old/"+path, "new/"+path),
+			})
+			return
+		}
+	}
+
+	*diffs = append(*diffs, PropertyDiff{Path: path, Change: DiffModified, Old: oldValue, New: newValue})
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// decodeScript expands every base64 gzip payload embedded in a value. It returns true if the value
+// contained a payload or spans several lines, meaning it is better compared as a script.
+func decodeScript(value string) (string, bool) {
+	decoded := false
+	script := base64GzipRegex.ReplaceAllStringFunc(value, func(payload string) string {
+		s, err := DecodeBase64CustomScript(payload)
+		if err != nil {
+			return payload
+		}
+		decoded = true
+		return s
+	})
+	return script, decoded || strings.Contains(value, "\n")
+}
+
+type diffLine struct {
+	op   byte
+	text string
+	// oldPos and newPos are the number of old and new lines before this one
+	oldPos int
+	newPos int
+}
+
+// UnifiedDiff returns a unified diff of two texts, or an empty string if they are identical
+func UnifiedDiff(oldText, newText, oldName, newName string) string {
+	if oldText == newText {
+		return ""
+	}
+	lines := diffLines(strings.Split(oldText, "\n"), strings.Split(newText, "\n"))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].op != ' ' {
+				end = j
+			} else if j-end > 2*diffContextLines {
+				break
+			}
+		}
+		stop := end + diffContextLines + 1
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+
+		oldCount, newCount := 0, 0
+		for _, l := range lines[start:stop] {
+			if l.op != '+' {
+				oldCount++
+			}
+			if l.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(lines[start].oldPos, oldCount), hunkRange(lines[start].newPos, newCount))
+		for _, l := range lines[start:stop] {
+			fmt.Fprintf(&b, "%c%s\n", l.op, l.text)
+		}
+		i = stop
+	}
+	return b.String()
+}
+
+func hunkRange(pos, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", pos)
+	}
+	return fmt.Sprintf("%d,%d", pos+1, count)
+}
+
+// diffLines computes a line edit script using the longest common subsequence of the two texts
+func diffLines(oldLines, newLines []string) []diffLine {
+	// unchanged leading and trailing lines don't need to go through the table
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+	a := oldLines[prefix : len(oldLines)-suffix]
+	b := newLines[prefix : len(newLines)-suffix]
+
+	var ops []byte
+	if len(a)*len(b) > maxDiffCells {
+		// too large to align, replace the whole changed region
+		ops = append(bytes.Repeat([]byte{'-'}, len(a)), bytes.Repeat([]byte{'+'}, len(b))...)
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(a) || j < len(b) {
+			switch {
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				ops = append(ops, ' ')
+				i++
+				j++
+			case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+				ops = append(ops, '-')
+				i++
+			default:
+				ops = append(ops, '+')
+				j++
+			}
+		}
+	}
+
+	lines := []diffLine{}
+	oldPos, newPos := 0, 0
+	add := func(op byte) {
+		l := diffLine{op: op, oldPos: oldPos, newPos: newPos}
+		switch op {
+		case '-':
+			l.text = oldLines[oldPos]
+			oldPos++
+		case '+':
+			l.text = newLines[newPos]
+			newPos++
+		default:
+			l.text = oldLines[oldPos]
+			oldPos++
+			newPos++
+		}
+		lines = append(lines, l)
+	}
+	for k := 0; k < prefix; k++ {
+		add(' ')
+	}
+	for _, op := range ops {
+		add(op)
+	}
+	for k := 0; k < suffix; k++ {
+		add(' ')
+	}
+	return lines
+}
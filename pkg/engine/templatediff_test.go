@@ -0,0 +1,106 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeBase64CustomScript(t *testing.T) {
+	script := "#!/bin/bash\necho hello\n"
+	decoded, err := DecodeBase64CustomScript(getBase64CustomScriptFromStr(script))
+	if err != nil {
+		t.Fatalf("unexpected error decoding script: %s", err)
+	}
+	if decoded != script {
+		t.Fatalf("expected decoded script %q, got %q", script, decoded)
+	}
+
+	if _, err = DecodeBase64CustomScript("not base64!"); err == nil {
+		t.Fatalf("expected an error decoding an invalid payload")
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	if d := UnifiedDiff("a\nb", "a\nb", "old", "new"); d != "" {
+		t.Fatalf("expected no diff for identical texts, got %q", d)
+	}
+
+	oldText := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12"
+	newText := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n12\n13"
+	expected := `--- old
++++ new
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`
+	if d := UnifiedDiff(oldText, newText, "old", "new"); d != expected {
+		t.Fatalf("expected diff:\n%s\ngot:\n%s", expected, d)
+	}
+}
+
+func TestDiffTemplates(t *testing.T) {
+	oldScript := getBase64CustomScriptFromStr("echo one\necho two\n")
+	newScript := getBase64CustomScriptFromStr("echo one\necho three\n")
+	oldTemplate := `{
+		"parameters": {
+			"vmSize": {"type": "string", "defaultValue": "Standard_D2_v2"},
+			"caKey": {"type": "securestring"}
+		},
+		"variables": {"provisionScript": "` + oldScript + `"},
+		"resources": [
+			{"type": "Microsoft.Compute/virtualMachines", "name": "vm", "properties": {"hardwareProfile": {"vmSize": "[parameters('vmSize')]"}, "osProfile": {"customData": "[base64(concat('#cloud-config\n', variables('provisionScript')))]"}}},
+			{"type": "Microsoft.Network/loadBalancers", "name": "lb"}
+		]
+	}`
+	newTemplate := strings.Replace(oldTemplate, oldScript, newScript, 1)
+	newTemplate = strings.Replace(newTemplate, `{"type": "Microsoft.Network/loadBalancers", "name": "lb"}`, `{"type": "Microsoft.Network/publicIPAddresses", "name": "ip"}`, 1)
+	newTemplate = strings.Replace(newTemplate, `#cloud-config\n`, `#cloud-config\npackages:\n`, 1)
+
+	diff, err := DiffTemplates(oldTemplate, `{"caKey": {"value": "old-key"}}`, newTemplate, `{"$schema": "schema", "parameters": {"caKey": {"value": "new-key"}, "vmSize": {"value": "Standard_D4_v2"}}}`)
+	if err != nil {
+		t.Fatalf("unexpected error comparing templates: %s", err)
+	}
+
+	if len(diff.Parameters) != 2 || diff.Parameters[0].Path != "caKey" || diff.Parameters[0].New != secureValue ||
+		diff.Parameters[1].Path != "vmSize" || diff.Parameters[1].Old != "Standard_D2_v2" || diff.Parameters[1].New != "Standard_D4_v2" {
+		t.Fatalf("unexpected parameter differences %+v", diff.Parameters)
+	}
+
+	if len(diff.Variables) != 1 || diff.Variables[0].Path != "provisionScript" ||
+		!strings.Contains(diff.Variables[0].ScriptDiff, "-echo two\n+echo three\n") {
+		t.Fatalf("expected the decoded provision script diff, got %+v", diff.Variables)
+	}
+
+	if len(diff.Resources) != 3 {
+		t.Fatalf("expected 3 resource differences, got %+v", diff.Resources)
+	}
+	vm := diff.Resources[0]
+	if vm.Name != "vm" || vm.Change != DiffModified || len(vm.Properties) != 1 ||
+		vm.Properties[0].Path != "properties.osProfile.customData" || !strings.Contains(vm.Properties[0].ScriptDiff, "+packages:") {
+		t.Fatalf("expected the customData of vm to be modified, got %+v", vm)
+	}
+	if diff.Resources[1].Name != "ip" || diff.Resources[1].Change != DiffAdded {
+		t.Fatalf("expected ip to be added, got %+v", diff.Resources[1])
+	}
+	if diff.Resources[2].Name != "lb" || diff.Resources[2].Change != DiffRemoved {
+		t.Fatalf("expected lb to be removed, got %+v", diff.Resources[2])
+	}
+
+	if diff, err = DiffTemplates(oldTemplate, "", oldTemplate, ""); err != nil || !diff.IsEmpty() {
+		t.Fatalf("expected no differences between identical templates, got %+v %v", diff, err)
+	}
+}
@@ -4,24 +4,118 @@
 package transform
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
-	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
-	"github.com/Jeffail/gabs"
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/api/vlabs"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
 // APIModelValue represents a value in the APIModel JSON file
 type APIModelValue struct {
-	stringValue   string
-	intValue      int64
-	arrayValue    bool
-	arrayIndex    int
-	arrayProperty string
-	arrayName     string
+	path  []pathElement
+	value interface{}
+	unset bool
+}
+
+type pathElementKind int
+
+const (
+	objectKey pathElementKind = iota
+	listIndex
+	listSelector
+)
+
+// pathElement is a step of the path to a value of the api model: the key of an object, the index of a list
+// element, or the list element whose field equals a value, like addons[name=tiller]
+type pathElement struct {
+	kind          pathElementKind
+	key           string
+	index         int
+	selectorField string
+	selectorValue string
+}
+
+// APIModelOverrides are the changes made to an api model on the command line. The overlays are merged first, in
+// order, then the variables substituted. The values files are merged last, in order, before the --set and
+// --set-json values are set and the --unset keys removed.
+type APIModelOverrides struct {
+	// Overlays are partial api models merged into the api model: agent pools and addons are merged with the
+	// elements of the same name, and null values remove the existing ones
+	Overlays []string
+	// VarsFiles are JSON or YAML files of the variables substituted for ${name} in the values of the api model,
+	// before the environment variables
+	VarsFiles []string
+	// EnvVars substitutes the environment variables, as strings, for ${name} in the values of the api model.
+	// Variables are substituted only if vars files are given or EnvVars is set.
+	EnvVars bool
+	// ValuesFiles are JSON or YAML files of values merged into the properties: objects are merged, other values
+	// replace the existing ones and null values remove them
+	ValuesFiles []string
+	// Set are key=value pairs, separated by commas. Integers and true or false are typed, other values are strings.
+	Set []string
+	// SetJSON are key=value pairs whose value is a JSON literal
+	SetJSON []string
+	// Unset are the keys to remove
+	Unset []string
+}
+
+// IsEmpty returns true if no overlay, variables or value is given
+func (o *APIModelOverrides) IsEmpty() bool {
+	return len(o.Overlays) == 0 && !o.hasVariables() && !o.hasValues()
+}
+
+// hasValues returns true if values of the properties are changed
+func (o *APIModelOverrides) hasValues() bool {
+	return len(o.ValuesFiles) > 0 || len(o.Set) > 0 || len(o.SetJSON) > 0 || len(o.Unset) > 0
+}
+
+// values returns the values set and unset by the overrides, in the order they are applied
+func (o *APIModelOverrides) values() ([]APIModelValue, error) {
+	var values []APIModelValue
+	for _, setFlagValue := range o.Set {
+		kvpMap := parseKeyValuePairs(setFlagValue)
+		keys := make([]string, 0, len(kvpMap))
+		for key := range kvpMap {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			path, err := parsePath(key)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, APIModelValue{path: path, value: typedValue(path, kvpMap[key])})
+		}
+	}
+	for _, setJSONFlagValue := range o.SetJSON {
+		key, literal := splitKeyValue(setJSONFlagValue)
+		path, err := parsePath(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeJSON([]byte(literal))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid JSON value for %s", key)
+		}
+		values = append(values, APIModelValue{path: path, value: value})
+	}
+	for _, key := range o.Unset {
+		path, err := parsePath(key)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, APIModelValue{path: path, unset: true})
+	}
+	return values, nil
 }
 
 // MapValues converts an arraw of rwa ApiModel values (like ["masterProfile.count=4","linuxProfile.adminUsername=admin"]) to a map
@@ -30,101 +124,567 @@ func MapValues(m map[string]APIModelValue, setFlagValues []string) {
 		return
 	}
 
-	// regex to find array[index].property pattern in the key, like linuxProfile.ssh.publicKeys[0].keyData
-	re := regexp.MustCompile(`(.*?)\[(.*?)\]\.(.*?)$`)
-
 	for _, setFlagValue := range setFlagValues {
 		kvpMap := parseKeyValuePairs(setFlagValue)
 		for key, keyValue := range kvpMap {
-			flagValue := APIModelValue{}
-			// try to parse the value as integer or fallback to string
-			if keyValueAsInteger, err := strconv.ParseInt(keyValue, 10, 64); err == nil {
-				flagValue.intValue = keyValueAsInteger
-			} else {
-				flagValue.stringValue = keyValue
-			}
-
-			// check if the key is an array property
-			keyArrayMatch := re.FindStringSubmatch(key)
-
-			// it's an array
-			if keyArrayMatch != nil {
-				i, err := strconv.ParseInt(keyArrayMatch[2], 10, 32)
-				if err != nil {
-					log.Warnln(fmt.Sprintf("array index is not specified for property %s", key))
-				} else {
-					arrayIndex := int(i)
-					flagValue.arrayValue = true
-					flagValue.arrayName = keyArrayMatch[1]
-					flagValue.arrayIndex = arrayIndex
-					flagValue.arrayProperty = keyArrayMatch[3]
-					m[key] = flagValue
-				}
-			} else {
-				m[key] = flagValue
+			path, err := parsePath(key)
+			if err != nil {
+				log.Warnln(err.Error())
+				continue
 			}
+			m[key] = APIModelValue{path: path, value: typedValue(path, keyValue)}
 		}
 	}
 }
 
-// MergeValuesWithAPIModel takes the path to an ApiModel JSON file, loads it and merges it with the values in the map to another temp file
+// MergeValuesWithAPIModel takes the path to an ApiModel JSON or YAML file, loads it and merges it with the values in the map to another temp JSON file
 func MergeValuesWithAPIModel(apiModelPath string, m map[string]APIModelValue) (string, error) {
-	// load the apiModel file from path
-	fileContent, err := ioutil.ReadFile(apiModelPath)
+	apiModel, properties, err := loadAPIModel(apiModelPath)
 	if err != nil {
 		return "", err
 	}
 
-	// parse the json from file content
-	jsonObj, err := gabs.ParseJSON(fileContent)
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		log.Debugln(fmt.Sprintf("--set flag value detected: %s", key))
+		if err = applyValue(properties, m[key]); err != nil {
+			return "", err
+		}
+	}
+
+	return writeAPIModel(apiModel)
+}
+
+// MergeOverridesWithAPIModel takes the path to an ApiModel JSON or YAML file, loads it and applies the overrides to another temp JSON file.
+// The path of the api model is returned as is when the overrides leave it unchanged.
+func MergeOverridesWithAPIModel(apiModelPath string, o *APIModelOverrides) (string, error) {
+	apiModel, changed, err := RenderAPIModel(apiModelPath, o)
 	if err != nil {
 		return "", err
 	}
+	if !changed {
+		return apiModelPath, nil
+	}
+	return writeAPIModel(apiModel)
+}
 
-	// update api model definition with each value in the map
-	for key, flagValue := range m {
-		// working on an array
-		if flagValue.arrayValue {
-			log.Debugln(fmt.Sprintf("--set flag array value detected. Name: %s, Index: %b, PropertyName: %s", flagValue.arrayName, flagValue.arrayIndex, flagValue.arrayProperty))
-			arrayValue := jsonObj.Path(fmt.Sprint("properties.", flagValue.arrayName))
-			if flagValue.stringValue != "" {
-				arrayValue.Index(flagValue.arrayIndex).SetP(flagValue.stringValue, flagValue.arrayProperty)
-			} else {
-				arrayValue.Index(flagValue.arrayIndex).SetP(flagValue.intValue, flagValue.arrayProperty)
-			}
-		} else {
-			if flagValue.stringValue != "" {
-				jsonObj.SetP(flagValue.stringValue, fmt.Sprint("properties.", key))
-			} else {
-				jsonObj.SetP(flagValue.intValue, fmt.Sprint("properties.", key))
-			}
+// RenderAPIModel returns the api model in a JSON or YAML file with the overrides applied, and whether they changed it
+func RenderAPIModel(apiModelPath string, o *APIModelOverrides) (map[string]interface{}, bool, error) {
+	apiModel, err := readJSONObject(apiModelPath)
+	if err != nil {
+		return nil, false, err
+	}
+	changed := false
+
+	for _, overlay := range o.Overlays {
+		overlayPath, e := resolveOverlay(apiModelPath, overlay)
+		if e != nil {
+			return nil, false, e
 		}
+		values, e := readJSONObject(overlayPath)
+		if e != nil {
+			return nil, false, errors.Wrapf(e, "error reading overlay %s", overlayPath)
+		}
+		if e = mergeOverlay(apiModel, values); e != nil {
+			return nil, false, errors.Wrapf(e, "error merging overlay %s", overlayPath)
+		}
+		changed = true
 	}
 
-	// generate a new file
-	tmpFile, err := ioutil.TempFile("", "mergedApiModel")
+	if o.hasVariables() {
+		variables, e := o.variables()
+		if e != nil {
+			return nil, false, e
+		}
+		substituted, e := substituteVariables(apiModel, variables, "")
+		if e != nil {
+			return nil, false, e
+		}
+		changed = changed || substituted
+	}
+
+	if !o.hasValues() {
+		return apiModel, changed, nil
+	}
+	properties, err := propertiesOf(apiModel, apiModelPath)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, valuesFile := range o.ValuesFiles {
+		values, e := readJSONObject(valuesFile)
+		if e != nil {
+			return nil, false, errors.Wrapf(e, "error reading values file %s", valuesFile)
+		}
+		mergeValues(properties, values)
+	}
+
+	values, err := o.values()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, value := range values {
+		if err = applyValue(properties, value); err != nil {
+			return nil, false, err
+		}
+	}
+	return apiModel, true, nil
+}
+
+// loadAPIModel returns the api model in a file and its properties
+func loadAPIModel(apiModelPath string) (map[string]interface{}, map[string]interface{}, error) {
+	apiModel, err := readJSONObject(apiModelPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	properties, err := propertiesOf(apiModel, apiModelPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return apiModel, properties, nil
+}
+
+// propertiesOf returns the properties of an api model, added when it has none
+func propertiesOf(apiModel map[string]interface{}, apiModelPath string) (map[string]interface{}, error) {
+	key := objectKeyOf(apiModel, "properties")
+	properties, ok := apiModel[key].(map[string]interface{})
+	if !ok {
+		if apiModel[key] != nil {
+			return nil, errors.Errorf("the properties of %s are not an object", apiModelPath)
+		}
+		properties = map[string]interface{}{}
+		apiModel[key] = properties
+	}
+	return properties, nil
+}
+
+// readJSONObject returns the object in a JSON or YAML file
+func readJSONObject(filename string) (map[string]interface{}, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if contents, err = api.APIModelToJSON(contents); err != nil {
+		return nil, err
+	}
+	value, err := decodeJSON(contents)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("%s does not contain an object", filename)
+	}
+	return object, nil
+}
+
+// decodeJSON decodes a JSON value, keeping numbers as they are written
+func decodeJSON(contents []byte) (interface{}, error) {
+	var value interface{}
+	d := json.NewDecoder(bytes.NewReader(contents))
+	d.UseNumber()
+	if err := d.Decode(&value); err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, errors.New("unexpected content after the JSON value")
+	}
+	return value, nil
+}
+
+// writeAPIModel writes the api model to a new temp file
+func writeAPIModel(apiModel map[string]interface{}) (string, error) {
+	b, err := json.Marshal(apiModel)
 	if err != nil {
 		return "", err
 	}
 
-	tmpFileName := tmpFile.Name()
-	err = ioutil.WriteFile(tmpFileName, []byte(jsonObj.String()), os.ModeAppend)
+	tmpFile, err := ioutil.TempFile("", "mergedApiModel")
 	if err != nil {
 		return "", err
 	}
+	defer tmpFile.Close()
+
+	if _, err = tmpFile.Write(b); err != nil {
+		return "", err
+	}
+
+	return tmpFile.Name(), nil
+}
+
+// mergeValues merges the objects of values into dst, replacing its other values and removing those set to null
+func mergeValues(dst, values map[string]interface{}) {
+	for k, v := range values {
+		key := objectKeyOf(dst, k)
+		if v == nil {
+			delete(dst, key)
+			continue
+		}
+		dstObject, dstIsObject := dst[key].(map[string]interface{})
+		valuesObject, valuesIsObject := v.(map[string]interface{})
+		if dstIsObject && valuesIsObject {
+			mergeValues(dstObject, valuesObject)
+			continue
+		}
+		dst[key] = v
+	}
+}
+
+func applyValue(properties map[string]interface{}, v APIModelValue) error {
+	var err error
+	if v.unset {
+		_, err = unsetPath(properties, v.path, 0)
+	} else {
+		_, err = setPath(properties, v.path, 0, v.value)
+	}
+	return err
+}
+
+// setPath sets the value at path[i:] in node, creating the missing objects and list elements, and returns the node
+func setPath(node interface{}, path []pathElement, i int, value interface{}) (interface{}, error) {
+	if i == len(path) {
+		return value, nil
+	}
+	e := path[i]
+	if e.kind == objectKey {
+		if node == nil {
+			node = map[string]interface{}{}
+		}
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("cannot set %s: %s is not an object", formatPath(path), formatPath(path[:i]))
+		}
+		key := objectKeyOf(object, e.key)
+		child, err := setPath(object[key], path, i+1, value)
+		if err != nil {
+			return nil, err
+		}
+		object[key] = child
+		return object, nil
+	}
+
+	if node == nil {
+		node = []interface{}{}
+	}
+	list, ok := node.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("cannot set %s: %s is not a list", formatPath(path), formatPath(path[:i]))
+	}
+	index := e.index
+	if e.kind == listSelector {
+		// a missing element is added, identified by the selected field
+		if index = selectElement(list, e); index < 0 {
+			list = append(list, map[string]interface{}{e.selectorField: e.selectorValue})
+			index = len(list) - 1
+		}
+	} else if index == len(list) {
+		list = append(list, nil)
+	} else if index > len(list) {
+		return nil, errors.Errorf("cannot set %s: %s has %d elements", formatPath(path), formatPath(path[:i]), len(list))
+	}
+	child, err := setPath(list[index], path, i+1, value)
+	if err != nil {
+		return nil, err
+	}
+	list[index] = child
+	return list, nil
+}
+
+// unsetPath removes the value at path[i:] from node, if it exists, and returns the node
+func unsetPath(node interface{}, path []pathElement, i int) (interface{}, error) {
+	e := path[i]
+	last := i == len(path)-1
+	if e.kind == objectKey {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return node, nil
+		}
+		key := objectKeyOf(object, e.key)
+		if _, exists := object[key]; !exists {
+			return node, nil
+		}
+		if last {
+			delete(object, key)
+			return object, nil
+		}
+		child, err := unsetPath(object[key], path, i+1)
+		if err != nil {
+			return nil, err
+		}
+		object[key] = child
+		return object, nil
+	}
+
+	list, ok := node.([]interface{})
+	if !ok {
+		return node, nil
+	}
+	index := e.index
+	if e.kind == listSelector {
+		index = selectElement(list, e)
+	}
+	if index < 0 || index >= len(list) {
+		return node, nil
+	}
+	if last {
+		return append(list[:index], list[index+1:]...), nil
+	}
+	child, err := unsetPath(list[index], path, i+1)
+	if err != nil {
+		return nil, err
+	}
+	list[index] = child
+	return list, nil
+}
 
-	return tmpFileName, nil
+// selectElement returns the index of the list element whose selected field has the selected value, or -1
+func selectElement(list []interface{}, e pathElement) int {
+	for i, element := range list {
+		if object, ok := element.(map[string]interface{}); ok {
+			if value, exists := object[objectKeyOf(object, e.selectorField)]; exists && fmt.Sprint(value) == e.selectorValue {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// objectKeyOf returns the key of an object matching key in any case, as the api model is loaded, or key when
+// there is none
+func objectKeyOf(object map[string]interface{}, key string) string {
+	if _, exists := object[key]; exists {
+		return key
+	}
+	for k := range object {
+		if strings.EqualFold(k, key) {
+			return k
+		}
+	}
+	return key
 }
 
-func parseKeyValuePairs(literal string) map[string]string {
+// parsePath parses a path like agentPoolProfiles[0].customNodeLabels.team or addons[name=tiller].enabled.
+// A backslash escapes the next character, like the dots of kubernetes\.io/role.
+func parsePath(key string) ([]pathElement, error) {
+	var path []pathElement
+	current := ""
+	escaped := false
+	afterList := false
+	flush := func() error {
+		if current == "" {
+			if afterList {
+				return nil
+			}
+			return errors.Errorf("invalid path %s: empty key", key)
+		}
+		path = append(path, pathElement{kind: objectKey, key: current})
+		current = ""
+		return nil
+	}
+
+	runes := []rune(key)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case escaped:
+			current += string(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '.':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			afterList = false
+		case r == '[':
+			if current != "" {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			} else if len(path) == 0 {
+				return nil, errors.Errorf("invalid path %s: a list index must follow a key", key)
+			}
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, errors.Errorf("invalid path %s: missing ]", key)
+			}
+			element, err := parseListElement(string(runes[i+1 : end]))
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid path %s", key)
+			}
+			path = append(path, element)
+			i = end
+			afterList = true
+			if i+1 < len(runes) && runes[i+1] != '.' && runes[i+1] != '[' {
+				return nil, errors.Errorf("invalid path %s: expected . or [ after ]", key)
+			}
+		default:
+			current += string(r)
+		}
+	}
+	if current != "" || !afterList {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	return path, nil
+}
+
+// parseListElement parses an index, or a field=value selector, between brackets
+func parseListElement(s string) (pathElement, error) {
+	if i := strings.Index(s, "="); i >= 0 {
+		if i == 0 {
+			return pathElement{}, errors.Errorf("missing the field of the selector [%s]", s)
+		}
+		return pathElement{kind: listSelector, selectorField: s[:i], selectorValue: s[i+1:]}, nil
+	}
+	index, err := strconv.Atoi(s)
+	if err != nil || index < 0 {
+		return pathElement{}, errors.Errorf("invalid list index [%s]", s)
+	}
+	return pathElement{kind: listIndex, index: index}, nil
+}
+
+// formatPath returns the path of a value under the properties of the api model
+func formatPath(path []pathElement) string {
+	s := "properties"
+	for _, e := range path {
+		switch e.kind {
+		case objectKey:
+			s += "." + e.key
+		case listIndex:
+			s += fmt.Sprintf("[%d]", e.index)
+		case listSelector:
+			s += fmt.Sprintf("[%s=%s]", e.selectorField, e.selectorValue)
+		}
+	}
+	return s
+}
+
+// setFlagValue is the value of a key of a --set flag, and whether it was quoted
+type setFlagValue struct {
+	literal string
+	quoted  bool
+}
+
+// typedValue types a --set value: quoted values and the values of the string fields of the api model, like the
+// flags of kubeletConfig, are strings, and other values are typed by parseValue
+func typedValue(path []pathElement, v setFlagValue) interface{} {
+	if v.quoted || isStringField(path) {
+		return v.literal
+	}
+	return parseValue(v.literal)
+}
+
+var (
+	apiModelSchema     *vlabs.Schema
+	apiModelSchemaOnce sync.Once
+)
+
+// isStringField returns true if the schema of the api model types the value at the path, relative to properties,
+// as a string
+func isStringField(path []pathElement) bool {
+	apiModelSchemaOnce.Do(func() {
+		apiModelSchema = vlabs.GenerateSchema()
+	})
+	s := apiModelSchema.Properties["properties"]
+	for _, e := range path {
+		s = resolveSchema(s)
+		if s == nil {
+			return false
+		}
+		switch e.kind {
+		case objectKey:
+			field := (*vlabs.Schema)(nil)
+			for name, fieldSchema := range s.Properties {
+				if strings.EqualFold(name, e.key) {
+					field = fieldSchema
+				}
+			}
+			if field == nil {
+				// the values of maps, like the flags of kubeletConfig
+				field, _ = s.AdditionalProperties.(*vlabs.Schema)
+			}
+			s = field
+		default:
+			s = s.Items
+		}
+	}
+	s = resolveSchema(s)
+	if s == nil {
+		return false
+	}
+	switch t := s.Type.(type) {
+	case string:
+		return t == "string"
+	case []string:
+		return len(t) > 0 && t[0] == "string"
+	}
+	return false
+}
+
+// resolveSchema returns the schema a reference or a nullable schema stands for
+func resolveSchema(s *vlabs.Schema) *vlabs.Schema {
+	for s != nil {
+		switch {
+		case s.Ref != "":
+			s = apiModelSchema.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+		case len(s.AnyOf) > 0:
+			s = s.AnyOf[0]
+		default:
+			return s
+		}
+	}
+	return nil
+}
+
+// parseValue types a --set value: integers and booleans are typed, other values are strings
+func parseValue(value string) interface{} {
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i
+	}
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return value
+}
+
+// splitKeyValue splits key=value at the first = outside of the brackets of the key
+func splitKeyValue(literal string) (string, string) {
+	inBrackets := false
+	for i, r := range literal {
+		switch {
+		case r == '[':
+			inBrackets = true
+		case r == ']':
+			inBrackets = false
+		case r == '=' && !inBrackets:
+			return literal[:i], literal[i+1:]
+		}
+	}
+	return literal, ""
+}
+
+func parseKeyValuePairs(literal string) map[string]setFlagValue {
 	log.Debugln(fmt.Sprintf("parsing --set flag key/value pairs from %s", literal))
 	inQuoteLiteral := false
 	inDblQuoteLiteral := false
 	inKey := true
-	kvpMap := map[string]string{}
+	inBrackets := false // in the [index] or [field=value] of a key
+	kvpMap := map[string]setFlagValue{}
 
 	currentKey := ""
 	currentValue := ""
+	currentQuoted := false
 
 	for _, literalChar := range literal {
 		switch literalChar {
@@ -132,6 +692,7 @@ func parseKeyValuePairs(literal string) map[string]string {
 			if !inQuoteLiteral && !inDblQuoteLiteral { // and we are not already in a literal
 				inQuoteLiteral = true // start a new ' delimited literal value
 				inKey = false
+				currentQuoted = true
 			} else if inQuoteLiteral { // we already are in a ' delimited literal value
 				inQuoteLiteral = false // stop it
 				inKey = true
@@ -140,6 +701,7 @@ func parseKeyValuePairs(literal string) map[string]string {
 			if !inDblQuoteLiteral && !inQuoteLiteral { // and we are not already in a literal
 				inDblQuoteLiteral = true // start a new " delimited literal value
 				inKey = false
+				currentQuoted = true
 			} else if inDblQuoteLiteral { // we already are in a " delimited literal value
 				inDblQuoteLiteral = false // stop it
 				inKey = true
@@ -149,19 +711,28 @@ func parseKeyValuePairs(literal string) map[string]string {
 				currentValue += string(literalChar)
 			} else {
 				log.Debugln(fmt.Sprintf("new key/value parsed: %s = %s", currentKey, currentValue))
-				kvpMap[currentKey] = currentValue
+				kvpMap[currentKey] = setFlagValue{literal: currentValue, quoted: currentQuoted}
 				currentKey = ""
 				currentValue = ""
+				currentQuoted = false
 				inKey = true
 			}
 		case '=': // if we hit a = char
 			if inQuoteLiteral || inDblQuoteLiteral || !inKey { // we are in a literal / value
 				currentValue += string(literalChar)
+			} else if inBrackets { // we are in a list selector of the key
+				currentKey += string(literalChar)
 			} else {
 				inKey = false
 			}
 		default: // we hit any other char
 			if inKey {
+				switch literalChar {
+				case '[':
+					inBrackets = true
+				case ']':
+					inBrackets = false
+				}
 				currentKey += string(literalChar)
 			} else {
 				currentValue += string(literalChar)
@@ -172,7 +743,7 @@ func parseKeyValuePairs(literal string) map[string]string {
 	// push latest literal
 	if currentKey != "" {
 		log.Debugln(fmt.Sprintf("new key/value parsed: %s = %s", currentKey, currentValue))
-		kvpMap[currentKey] = currentValue
+		kvpMap[currentKey] = setFlagValue{literal: currentValue, quoted: currentQuoted}
 	}
 
 	return kvpMap
@@ -5,8 +5,12 @@ package transform
 
 import (
 	"io/ioutil"
+	"os"
+	"path"
 	"testing"
 
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/i18n"
 	"github.com/Jeffail/gabs"
 	. "github.com/onsi/gomega"
 )
@@ -23,15 +27,93 @@ func TestAPIModelMergerMapValues(t *testing.T) {
 	}
 
 	MapValues(m, values)
-	Expect(m["masterProfile.count"].intValue).To(BeIdenticalTo(int64(5)))
-	Expect(m["agentPoolProfiles[0].name"].arrayValue).To(BeTrue())
-	Expect(m["agentPoolProfiles[0].name"].arrayIndex).To(BeIdenticalTo(0))
-	Expect(m["agentPoolProfiles[0].name"].arrayProperty).To(BeIdenticalTo("name"))
-	Expect(m["agentPoolProfiles[0].name"].arrayName).To(BeIdenticalTo("agentPoolProfiles"))
-	Expect(m["agentPoolProfiles[0].name"].stringValue).To(BeIdenticalTo("agentpool1"))
-	Expect(m["linuxProfile.adminUsername"].stringValue).To(BeIdenticalTo("admin"))
-	Expect(m["servicePrincipalProfile.secret"].stringValue).To(BeIdenticalTo("=!,Test$^="))
-	Expect(m["servicePrincipalProfile.clientId"].stringValue).To(BeIdenticalTo("123a1238-c6eb-4b61-9d6f-7db6f1e14123"))
+	Expect(m["masterProfile.count"].value).To(BeIdenticalTo(int64(5)))
+	Expect(m["agentPoolProfiles[0].name"].path).To(Equal([]pathElement{
+		{kind: objectKey, key: "agentPoolProfiles"},
+		{kind: listIndex, index: 0},
+		{kind: objectKey, key: "name"},
+	}))
+	Expect(m["agentPoolProfiles[0].name"].value).To(BeIdenticalTo("agentpool1"))
+	Expect(m["linuxProfile.adminUsername"].value).To(BeIdenticalTo("admin"))
+	Expect(m["servicePrincipalProfile.secret"].value).To(BeIdenticalTo("=!,Test$^="))
+	Expect(m["servicePrincipalProfile.clientId"].value).To(BeIdenticalTo("123a1238-c6eb-4b61-9d6f-7db6f1e14123"))
+}
+
+func TestAPIModelMergerMapValuesTypesAndPaths(t *testing.T) {
+	RegisterTestingT(t)
+
+	m := make(map[string]APIModelValue)
+	MapValues(m, []string{
+		"orchestratorProfile.kubernetesConfig.addons[name=tiller].enabled=false,agentPoolProfiles[1].customNodeLabels.kubernetes\\.io/role=infra",
+		"masterProfile.vmSize=true_size,bad[.key=1",
+	})
+	Expect(m["orchestratorProfile.kubernetesConfig.addons[name=tiller].enabled"].value).To(BeIdenticalTo(false))
+	Expect(m["orchestratorProfile.kubernetesConfig.addons[name=tiller].enabled"].path[3]).To(Equal(pathElement{kind: listSelector, selectorField: "name", selectorValue: "tiller"}))
+	Expect(m["agentPoolProfiles[1].customNodeLabels.kubernetes\\.io/role"].path[3]).To(Equal(pathElement{kind: objectKey, key: "kubernetes.io/role"}))
+	Expect(m["masterProfile.vmSize"].value).To(BeIdenticalTo("true_size"))
+	Expect(m).NotTo(HaveKey("bad[.key"))
+}
+
+func TestAPIModelMergerStringValues(t *testing.T) {
+	RegisterTestingT(t)
+
+	m := make(map[string]APIModelValue)
+	MapValues(m, []string{
+		`masterProfile.count='3',agentPoolProfiles[0].count="4",orchestratorProfile.kubernetesConfig.addons[name=tiller].enabled='false'`,
+		"orchestratorProfile.kubernetesConfig.kubeletConfig.--max-pods=30,orchestratorProfile.kubernetesConfig.apiServerConfig.--anonymous-auth=false",
+		"agentPoolProfiles[0].customNodeLabels.gpu=true,servicePrincipalProfile.secret=1234",
+	})
+	// quoted values are strings
+	Expect(m["masterProfile.count"].value).To(BeIdenticalTo("3"))
+	Expect(m["agentPoolProfiles[0].count"].value).To(BeIdenticalTo("4"))
+	Expect(m["orchestratorProfile.kubernetesConfig.addons[name=tiller].enabled"].value).To(BeIdenticalTo("false"))
+	// the values of string fields and maps of strings are never typed
+	Expect(m["orchestratorProfile.kubernetesConfig.kubeletConfig.--max-pods"].value).To(BeIdenticalTo("30"))
+	Expect(m["orchestratorProfile.kubernetesConfig.apiServerConfig.--anonymous-auth"].value).To(BeIdenticalTo("false"))
+	Expect(m["agentPoolProfiles[0].customNodeLabels.gpu"].value).To(BeIdenticalTo("true"))
+	Expect(m["servicePrincipalProfile.secret"].value).To(BeIdenticalTo("1234"))
+}
+
+func TestMergeKubeletConfigWithAPIModel(t *testing.T) {
+	RegisterTestingT(t)
+
+	mergedPath, err := MergeOverridesWithAPIModel("../testdata/simple/kubernetes.json", &APIModelOverrides{
+		Set: []string{
+			"orchestratorProfile.kubernetesConfig.kubeletConfig.--anonymous-auth=false,orchestratorProfile.kubernetesConfig.kubeletConfig.--max-pods=30",
+			"agentPoolProfiles[0].customNodeLabels.team='42',masterProfile.count=3",
+		},
+	})
+	Expect(err).To(BeNil())
+	defer os.Remove(mergedPath)
+
+	cs, _, err := (&api.Apiloader{Translator: &i18n.Translator{}}).LoadContainerServiceFromFile(mergedPath, false, false, nil)
+	Expect(err).To(BeNil())
+	kubeletConfig := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
+	Expect(kubeletConfig["--anonymous-auth"]).To(Equal("false"))
+	Expect(kubeletConfig["--max-pods"]).To(Equal("30"))
+	Expect(cs.Properties.AgentPoolProfiles[0].CustomNodeLabels["team"]).To(Equal("42"))
+	Expect(cs.Properties.MasterProfile.Count).To(Equal(3))
+}
+
+func TestParsePath(t *testing.T) {
+	RegisterTestingT(t)
+
+	path, err := parsePath("a[0][2].b[name=x=y].c")
+	Expect(err).To(BeNil())
+	Expect(path).To(Equal([]pathElement{
+		{kind: objectKey, key: "a"},
+		{kind: listIndex, index: 0},
+		{kind: listIndex, index: 2},
+		{kind: objectKey, key: "b"},
+		{kind: listSelector, selectorField: "name", selectorValue: "x=y"},
+		{kind: objectKey, key: "c"},
+	}))
+	Expect(formatPath(path)).To(Equal("properties.a[0][2].b[name=x=y].c"))
+
+	for _, invalid := range []string{"", "a.", "a..b", "[0].a", "a[x]", "a[-1]", "a[0", "a[0]b", "a[=x]"} {
+		_, err = parsePath(invalid)
+		Expect(err).NotTo(BeNil(), "expected path %q to be invalid", invalid)
+	}
 }
 
 func TestMergeValuesWithAPIModel(t *testing.T) {
@@ -58,3 +140,85 @@ func TestMergeValuesWithAPIModel(t *testing.T) {
 	agentPoolProfileName := jsonAPIModel.Path("properties.agentPoolProfiles").Index(0).Path("name").Data().(string)
 	Expect(agentPoolProfileName).To(BeIdenticalTo("agentpool1"))
 }
+
+func TestMergeValuesWithYAMLAPIModel(t *testing.T) {
+	RegisterTestingT(t)
+
+	m := make(map[string]APIModelValue)
+	MapValues(m, []string{"masterProfile.count=5", "agentPoolProfiles[1].name=agentpool3"})
+	tmpFile, err := MergeValuesWithAPIModel("../testdata/simple/kubernetes.yaml", m)
+	Expect(err).To(BeNil())
+
+	jsonFileContent, err := ioutil.ReadFile(tmpFile)
+	Expect(err).To(BeNil())
+
+	jsonAPIModel, err := gabs.ParseJSON(jsonFileContent)
+	Expect(err).To(BeNil())
+	Expect(jsonAPIModel.Path("properties.masterProfile.count").Data()).To(BeIdenticalTo(float64(5)))
+	Expect(jsonAPIModel.Path("properties.agentPoolProfiles").Index(1).Path("name").Data()).To(BeIdenticalTo("agentpool3"))
+	Expect(jsonAPIModel.Path("properties.agentPoolProfiles").Index(1).Path("vmSize").Data()).To(BeIdenticalTo("Standard_D2_v2"))
+}
+
+func TestMergeOverridesWithAPIModel(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "overrides")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(dir)
+
+	valuesFile := path.Join(dir, "values.yaml")
+	Expect(ioutil.WriteFile(valuesFile, []byte("masterProfile:\n  count: 3\n  vmSize: null\nlinuxProfile:\n  adminUsername: values\n"), 0644)).To(BeNil())
+	overrideFile := path.Join(dir, "override.json")
+	Expect(ioutil.WriteFile(overrideFile, []byte(`{"linuxProfile": {"adminUsername": "override"}}`), 0644)).To(BeNil())
+
+	o := &APIModelOverrides{
+		ValuesFiles: []string{valuesFile, overrideFile},
+		Set: []string{
+			"agentPoolProfiles[1].customNodeLabels.team=x,agentPoolProfiles[2].name=agentpool3",
+			"orchestratorProfile.kubernetesConfig.addons[name=tiller].enabled=false",
+			"MasterProfile.DNSPrefix=newdns",
+		},
+		SetJSON: []string{
+			`orchestratorProfile.kubernetesConfig.addons[name=tiller].config={"max-history": "5"}`,
+			`agentPoolProfiles[0].availabilityZones=["1","2"]`,
+		},
+		Unset: []string{"certificateProfile", "agentPoolProfiles[name=agentpool2].availabilityProfile", "does.not[0].exist"},
+	}
+	Expect(o.IsEmpty()).To(BeFalse())
+	tmpFile, err := MergeOverridesWithAPIModel("../testdata/simple/kubernetes.json", o)
+	Expect(err).To(BeNil())
+	defer os.Remove(tmpFile)
+
+	jsonFileContent, err := ioutil.ReadFile(tmpFile)
+	Expect(err).To(BeNil())
+	jsonAPIModel, err := gabs.ParseJSON(jsonFileContent)
+	Expect(err).To(BeNil())
+
+	Expect(jsonAPIModel.Path("properties.masterProfile.count").Data()).To(BeIdenticalTo(float64(3)))
+	Expect(jsonAPIModel.Exists("properties", "masterProfile", "vmSize")).To(BeFalse())
+	Expect(jsonAPIModel.Path("properties.masterProfile.dnsPrefix").Data()).To(BeIdenticalTo("newdns"))
+	Expect(jsonAPIModel.Exists("properties", "MasterProfile")).To(BeFalse())
+	Expect(jsonAPIModel.Path("properties.linuxProfile.adminUsername").Data()).To(BeIdenticalTo("override"))
+	Expect(jsonAPIModel.Path("properties.linuxProfile.ssh").Data()).NotTo(BeNil())
+	Expect(jsonAPIModel.Exists("properties", "certificateProfile")).To(BeFalse())
+
+	agentPools := jsonAPIModel.Path("properties.agentPoolProfiles")
+	Expect(agentPools.Index(0).Path("availabilityZones").Data()).To(Equal([]interface{}{"1", "2"}))
+	Expect(agentPools.Index(1).Path("customNodeLabels.team").Data()).To(BeIdenticalTo("x"))
+	Expect(agentPools.Index(1).Exists("availabilityProfile")).To(BeFalse())
+	Expect(agentPools.Index(2).Path("name").Data()).To(BeIdenticalTo("agentpool3"))
+
+	addons := jsonAPIModel.Path("properties.orchestratorProfile.kubernetesConfig.addons")
+	Expect(addons.Index(0).Data()).To(Equal(map[string]interface{}{"name": "tiller", "enabled": false, "config": map[string]interface{}{"max-history": "5"}}))
+
+	// a value cannot be set through a value that is not an object
+	_, err = MergeOverridesWithAPIModel("../testdata/simple/kubernetes.json", &APIModelOverrides{Set: []string{"masterProfile.count.value=1"}})
+	Expect(err).NotTo(BeNil())
+	Expect(err.Error()).To(Equal("cannot set properties.masterProfile.count.value: properties.masterProfile.count is not an object"))
+
+	_, err = MergeOverridesWithAPIModel("../testdata/simple/kubernetes.json", &APIModelOverrides{SetJSON: []string{"masterProfile.count={"}})
+	Expect(err).NotTo(BeNil())
+
+	_, err = MergeOverridesWithAPIModel("../testdata/simple/kubernetes.json", &APIModelOverrides{Set: []string{"agentPoolProfiles[5].name=x"}})
+	Expect(err).NotTo(BeNil())
+}
@@ -0,0 +1,244 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package transform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// overlayMergeKeys are the lists of the api model whose elements are merged by an overlay with the elements having
+// the same value of a field, instead of being replaced
+var overlayMergeKeys = map[string]string{
+	"agentPoolProfiles": "name",
+	"addons":            "name",
+}
+
+const (
+	// overlayPatchKey marks an element of a merged list, like {"name": "pool", "$patch": "delete"}
+	overlayPatchKey = "$patch"
+	// overlayPatchDelete removes the element with the same name from the merged list
+	overlayPatchDelete = "delete"
+)
+
+// variablePattern matches the ${name} of a variable, or the $${ escaping a literal ${
+var variablePattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// resolveOverlay returns the path of an overlay file, or of the overlay of that name in the overlays directory
+// next to the api model, like overlays/production.yaml
+func resolveOverlay(apiModelPath, overlay string) (string, error) {
+	if _, err := os.Stat(overlay); err == nil {
+		return overlay, nil
+	}
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		p := filepath.Join(filepath.Dir(apiModelPath), "overlays", overlay+ext)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", errors.Errorf("overlay %s does not exist, nor does %s", overlay, filepath.Join(filepath.Dir(apiModelPath), "overlays", overlay+".yaml"))
+}
+
+// mergeOverlay merges an overlay into dst: objects are merged, the elements of the lists of overlayMergeKeys are
+// merged by name, other values replace the existing ones and null values remove them
+func mergeOverlay(dst, overlay map[string]interface{}) error {
+	for k, v := range overlay {
+		key := objectKeyOf(dst, k)
+		switch value := v.(type) {
+		case nil:
+			delete(dst, key)
+			continue
+		case map[string]interface{}:
+			if dstObject, ok := dst[key].(map[string]interface{}); ok {
+				if err := mergeOverlay(dstObject, value); err != nil {
+					return err
+				}
+				continue
+			}
+		case []interface{}:
+			dstList, ok := dst[key].([]interface{})
+			if field := overlayMergeKey(k); field != "" && ok {
+				merged, err := mergeOverlayList(dstList, value, field)
+				if err != nil {
+					return errors.Wrapf(err, "error merging %s", k)
+				}
+				dst[key] = merged
+				continue
+			}
+		}
+		dst[key] = v
+	}
+	return nil
+}
+
+// mergeOverlayList merges the elements of an overlay list into the elements of dst with the same value of field,
+// appending the others
+func mergeOverlayList(dst, overlay []interface{}, field string) ([]interface{}, error) {
+	for _, element := range overlay {
+		object, ok := element.(map[string]interface{})
+		if !ok {
+			dst = append(dst, element)
+			continue
+		}
+		patch := object[overlayPatchKey]
+		delete(object, overlayPatchKey)
+		if patch != nil && patch != overlayPatchDelete {
+			return nil, errors.Errorf("unsupported %s %v", overlayPatchKey, patch)
+		}
+
+		index := -1
+		if value, exists := object[objectKeyOf(object, field)]; exists {
+			index = selectElement(dst, pathElement{kind: listSelector, selectorField: field, selectorValue: fmt.Sprint(value)})
+		}
+		switch {
+		case patch == overlayPatchDelete:
+			if index >= 0 {
+				dst = append(dst[:index], dst[index+1:]...)
+			}
+		case index < 0:
+			dst = append(dst, object)
+		default:
+			dstObject, ok := dst[index].(map[string]interface{})
+			if !ok {
+				dst[index] = object
+				continue
+			}
+			if err := mergeOverlay(dstObject, object); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return dst, nil
+}
+
+// overlayMergeKey returns the field the elements of a list are merged by, or "" when the list is replaced
+func overlayMergeKey(key string) string {
+	for k, field := range overlayMergeKeys {
+		if strings.EqualFold(k, key) {
+			return field
+		}
+	}
+	return ""
+}
+
+// hasVariables returns true if variables are substituted in the api model
+func (o *APIModelOverrides) hasVariables() bool {
+	return len(o.VarsFiles) > 0 || o.EnvVars
+}
+
+// variables returns the variables defined in the vars files, the later files overriding the former, and the
+// environment variables as strings when EnvVars is set
+func (o *APIModelOverrides) variables() (map[string]interface{}, error) {
+	variables := map[string]interface{}{}
+	if o.EnvVars {
+		for _, env := range os.Environ() {
+			if i := strings.Index(env, "="); i > 0 {
+				variables[env[:i]] = env[i+1:]
+			}
+		}
+	}
+	for _, varsFile := range o.VarsFiles {
+		values, err := readJSONObject(varsFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading vars file %s", varsFile)
+		}
+		for k, v := range values {
+			variables[k] = v
+		}
+	}
+	return variables, nil
+}
+
+// lookupVariable returns the value of a variable
+func lookupVariable(variables map[string]interface{}, name string) (interface{}, bool) {
+	value, ok := variables[name]
+	return value, ok
+}
+
+// substituteVariables substitutes the variables in the string values under node, returning true if any was found
+func substituteVariables(node interface{}, variables map[string]interface{}, path string) (bool, error) {
+	substituted := false
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			if s, ok := v.(string); ok {
+				value, changed, err := substituteString(s, variables, childPath)
+				if err != nil {
+					return false, err
+				}
+				n[k] = value
+				substituted = substituted || changed
+				continue
+			}
+			changed, err := substituteVariables(v, variables, childPath)
+			if err != nil {
+				return false, err
+			}
+			substituted = substituted || changed
+		}
+	case []interface{}:
+		for i, v := range n {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			if s, ok := v.(string); ok {
+				value, changed, err := substituteString(s, variables, childPath)
+				if err != nil {
+					return false, err
+				}
+				n[i] = value
+				substituted = substituted || changed
+				continue
+			}
+			changed, err := substituteVariables(v, variables, childPath)
+			if err != nil {
+				return false, err
+			}
+			substituted = substituted || changed
+		}
+	}
+	return substituted, nil
+}
+
+// substituteString substitutes the variables in a string. A string that is a single variable takes its value,
+// so that numbers, booleans and objects can be substituted too.
+func substituteString(s string, variables map[string]interface{}, path string) (interface{}, bool, error) {
+	if !strings.Contains(s, "${") {
+		return s, false, nil
+	}
+	if match := variablePattern.FindStringSubmatch(s); match != nil && match[0] == s && match[1] != "" {
+		value, ok := lookupVariable(variables, match[1])
+		if !ok {
+			return nil, false, errors.Errorf("undefined variable %s in %s (escape a literal ${ as $${)", match[1], path)
+		}
+		return value, true, nil
+	}
+
+	var err error
+	substituted := variablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		name := match[2 : len(match)-1]
+		value, ok := lookupVariable(variables, name)
+		if !ok {
+			if err == nil {
+				err = errors.Errorf("undefined variable %s in %s (escape a literal ${ as $${)", name, path)
+			}
+			return match
+		}
+		return fmt.Sprint(value)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return substituted, true, nil
+}
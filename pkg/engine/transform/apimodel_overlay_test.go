@@ -0,0 +1,196 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package transform
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const overlayBaseAPIModel = `apiVersion: vlabs
+properties:
+  orchestratorProfile:
+    orchestratorType: Kubernetes
+    kubernetesConfig:
+      addons:
+      - name: tiller
+        enabled: true
+      - name: kubernetes-dashboard
+        enabled: true
+  masterProfile:
+    count: ${masterCount}
+    dnsPrefix: ${dnsPrefix}
+    vmSize: Standard_D2_v2
+  agentPoolProfiles:
+  - name: agentpool1
+    count: 3
+    vmSize: Standard_D2_v2
+  - name: agentpool2
+    count: 3
+    vmSize: Standard_D2_v2
+  linuxProfile:
+    adminUsername: azureuser
+    ssh:
+      publicKeys:
+      - keyData: ssh-rsa ${sshKey} $${USER}@linuxvm
+`
+
+func TestMergeOverlay(t *testing.T) {
+	RegisterTestingT(t)
+
+	value, err := decodeJSON([]byte(`{
+		"properties": {
+			"masterProfile": {"count": 1, "vmSize": "Standard_D2_v2"},
+			"agentPoolProfiles": [{"name": "agentpool1", "count": 3}, {"name": "agentpool2", "count": 3}],
+			"orchestratorProfile": {"kubernetesConfig": {"addons": [{"name": "tiller", "enabled": true}], "apiServerConfig": {"--v": "2"}}}
+		}
+	}`))
+	Expect(err).To(BeNil())
+	apiModel := value.(map[string]interface{})
+	value, err = decodeJSON([]byte(`{
+		"properties": {
+			"MasterProfile": {"count": 3, "vmSize": null},
+			"agentPoolProfiles": [{"name": "agentpool2", "count": 10}, {"name": "agentpool1", "$patch": "delete"}, {"name": "agentpool3", "count": 1}],
+			"orchestratorProfile": {"kubernetesConfig": {"addons": [{"name": "tiller", "enabled": false}], "apiServerConfig": {"--v": "4"}}}
+		}
+	}`))
+	Expect(err).To(BeNil())
+	Expect(mergeOverlay(apiModel, value.(map[string]interface{}))).To(BeNil())
+
+	properties := apiModel["properties"].(map[string]interface{})
+	Expect(properties["masterProfile"]).To(Equal(map[string]interface{}{"count": json.Number("3")}))
+	Expect(properties).NotTo(HaveKey("MasterProfile"))
+	Expect(properties["agentPoolProfiles"]).To(Equal([]interface{}{
+		map[string]interface{}{"name": "agentpool2", "count": json.Number("10")},
+		map[string]interface{}{"name": "agentpool3", "count": json.Number("1")},
+	}))
+	kubernetesConfig := properties["orchestratorProfile"].(map[string]interface{})["kubernetesConfig"].(map[string]interface{})
+	Expect(kubernetesConfig["addons"]).To(Equal([]interface{}{map[string]interface{}{"name": "tiller", "enabled": false}}))
+	Expect(kubernetesConfig["apiServerConfig"]).To(Equal(map[string]interface{}{"--v": "4"}))
+
+	// lists not merged by name are replaced
+	Expect(mergeOverlay(properties, map[string]interface{}{"agentPoolProfiles": "none"})).To(BeNil())
+	Expect(properties["agentPoolProfiles"]).To(Equal("none"))
+
+	err = mergeOverlay(kubernetesConfig, map[string]interface{}{"addons": []interface{}{map[string]interface{}{"name": "tiller", "$patch": "replace"}}})
+	Expect(err).NotTo(BeNil())
+	Expect(err.Error()).To(Equal("error merging addons: unsupported $patch replace"))
+}
+
+func TestRenderAPIModelWithOverlaysAndVariables(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "overlays")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(dir)
+
+	apiModelPath := path.Join(dir, "kubernetes.yaml")
+	Expect(ioutil.WriteFile(apiModelPath, []byte(overlayBaseAPIModel), 0644)).To(BeNil())
+	Expect(os.Mkdir(path.Join(dir, "overlays"), 0755)).To(BeNil())
+	Expect(ioutil.WriteFile(path.Join(dir, "overlays", "production.yaml"), []byte(`properties:
+  orchestratorProfile:
+    kubernetesConfig:
+      addons:
+      - name: kubernetes-dashboard
+        $patch: delete
+  agentPoolProfiles:
+  - name: agentpool2
+    count: 10
+    vmSize: ${poolSize}
+`), 0644)).To(BeNil())
+	regionOverlay := path.Join(dir, "westus2.json")
+	Expect(ioutil.WriteFile(regionOverlay, []byte(`{"location": "westus2", "properties": {"agentPoolProfiles": [{"name": "agentpool3", "count": 1}]}}`), 0644)).To(BeNil())
+	varsFile := path.Join(dir, "vars.yaml")
+	Expect(ioutil.WriteFile(varsFile, []byte("masterCount: 3\ndnsPrefix: prod\npoolSize: Standard_D4_v2\n"), 0644)).To(BeNil())
+	overrideVarsFile := path.Join(dir, "override.json")
+	Expect(ioutil.WriteFile(overrideVarsFile, []byte(`{"dnsPrefix": "prod-westus2", "sshKey": "PUBLICKEY"}`), 0644)).To(BeNil())
+
+	o := &APIModelOverrides{
+		Overlays:  []string{"production", regionOverlay},
+		VarsFiles: []string{varsFile, overrideVarsFile},
+		Set:       []string{"agentPoolProfiles[name=agentpool3].vmSize=Standard_D2_v2"},
+	}
+	apiModel, changed, err := RenderAPIModel(apiModelPath, o)
+	Expect(err).To(BeNil())
+	Expect(changed).To(BeTrue())
+	Expect(apiModel["location"]).To(Equal("westus2"))
+
+	properties := apiModel["properties"].(map[string]interface{})
+	// an exact variable keeps the type of its value
+	Expect(properties["masterProfile"]).To(Equal(map[string]interface{}{"count": json.Number("3"), "dnsPrefix": "prod-westus2", "vmSize": "Standard_D2_v2"}))
+	Expect(properties["agentPoolProfiles"]).To(Equal([]interface{}{
+		map[string]interface{}{"name": "agentpool1", "count": json.Number("3"), "vmSize": "Standard_D2_v2"},
+		map[string]interface{}{"name": "agentpool2", "count": json.Number("10"), "vmSize": "Standard_D4_v2"},
+		map[string]interface{}{"name": "agentpool3", "count": json.Number("1"), "vmSize": "Standard_D2_v2"},
+	}))
+	kubernetesConfig := properties["orchestratorProfile"].(map[string]interface{})["kubernetesConfig"].(map[string]interface{})
+	Expect(kubernetesConfig["addons"]).To(Equal([]interface{}{map[string]interface{}{"name": "tiller", "enabled": true}}))
+
+	// with --env-vars, variables missing from the vars files are looked up in the environment, as strings
+	os.Setenv("sshKey", "ENVKEY")
+	os.Setenv("dnsPrefix", "1234")
+	os.Setenv("masterCount", "1")
+	defer func() {
+		os.Unsetenv("sshKey")
+		os.Unsetenv("dnsPrefix")
+		os.Unsetenv("masterCount")
+	}()
+	apiModel, _, err = RenderAPIModel(apiModelPath, &APIModelOverrides{VarsFiles: []string{varsFile}, EnvVars: true})
+	Expect(err).To(BeNil())
+	properties = apiModel["properties"].(map[string]interface{})
+	linuxProfile := properties["linuxProfile"].(map[string]interface{})
+	Expect(linuxProfile["ssh"]).To(Equal(map[string]interface{}{"publicKeys": []interface{}{map[string]interface{}{"keyData": "ssh-rsa ENVKEY ${USER}@linuxvm"}}}))
+	Expect(properties["masterProfile"].(map[string]interface{})["dnsPrefix"]).To(Equal("prod"))
+	apiModel, _, err = RenderAPIModel(apiModelPath, &APIModelOverrides{EnvVars: true})
+	Expect(err).To(BeNil())
+	masterProfile := apiModel["properties"].(map[string]interface{})["masterProfile"].(map[string]interface{})
+	Expect(masterProfile["dnsPrefix"]).To(Equal("1234"))
+	Expect(masterProfile["count"]).To(Equal("1"))
+
+	// nothing is substituted without vars files or --env-vars
+	apiModel, _, err = RenderAPIModel(apiModelPath, &APIModelOverrides{Set: []string{"masterProfile.count=1"}})
+	Expect(err).To(BeNil())
+	masterProfile = apiModel["properties"].(map[string]interface{})["masterProfile"].(map[string]interface{})
+	Expect(masterProfile["dnsPrefix"]).To(Equal("${dnsPrefix}"))
+
+	// the environment is not looked up without --env-vars
+	_, _, err = RenderAPIModel(apiModelPath, &APIModelOverrides{VarsFiles: []string{varsFile}})
+	Expect(err).NotTo(BeNil())
+	Expect(err.Error()).To(Equal("undefined variable sshKey in properties.linuxProfile.ssh.publicKeys[0].keyData (escape a literal ${ as $${)"))
+
+	_, _, err = RenderAPIModel(apiModelPath, &APIModelOverrides{Overlays: []string{"staging"}})
+	Expect(err).NotTo(BeNil())
+	Expect(err.Error()).To(Equal("overlay staging does not exist, nor does " + path.Join(dir, "overlays", "staging.yaml")))
+}
+
+func TestMergeOverridesWithAPIModelUnchanged(t *testing.T) {
+	RegisterTestingT(t)
+
+	o := &APIModelOverrides{}
+	Expect(o.IsEmpty()).To(BeTrue())
+	apiModelPath, err := MergeOverridesWithAPIModel("../testdata/simple/kubernetes.json", o)
+	Expect(err).To(BeNil())
+	Expect(apiModelPath).To(Equal("../testdata/simple/kubernetes.json"))
+
+	dir, err := ioutil.TempDir("", "overlays")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(dir)
+	apiModelPath = path.Join(dir, "kubernetes.yaml")
+	Expect(ioutil.WriteFile(apiModelPath, []byte(overlayBaseAPIModel), 0644)).To(BeNil())
+	varsFile := path.Join(dir, "vars.yaml")
+	Expect(ioutil.WriteFile(varsFile, []byte("masterCount: 3\ndnsPrefix: prod\nsshKey: PUBLICKEY\n"), 0644)).To(BeNil())
+
+	mergedPath, err := MergeOverridesWithAPIModel(apiModelPath, &APIModelOverrides{VarsFiles: []string{varsFile}})
+	Expect(err).To(BeNil())
+	defer os.Remove(mergedPath)
+	Expect(mergedPath).NotTo(Equal(apiModelPath))
+	merged, err := readJSONObject(mergedPath)
+	Expect(err).To(BeNil())
+	Expect(merged["properties"].(map[string]interface{})["masterProfile"].(map[string]interface{})["count"]).To(Equal(json.Number("3")))
+}
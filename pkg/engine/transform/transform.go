@@ -8,6 +8,7 @@ import (
 	"log"
 	"sort"
 	"strings"
+	"unicode"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
 	"github.com/sirupsen/logrus"
@@ -191,6 +192,56 @@ func (t *Transformer) NormalizeForK8sVMASScalingUp(logger *logrus.Entry, templat
 	return nil
 }
 
+// NormalizeForK8sAgentPoolAddition takes a template generated for every agent pool of a K8s cluster and removes the resources
+// of the existing agent pools, so deploying it only adds the resources of the new pool
+func (t *Transformer) NormalizeForK8sAgentPoolAddition(logger *logrus.Entry, templateMap map[string]interface{}, existingAgentPools []string) error {
+	resources := templateMap[resourcesFieldName].([]interface{})
+	filteredResources := resources[:0]
+	for _, resource := range resources {
+		resourceMap, ok := resource.(map[string]interface{})
+		if !ok {
+			logger.Warnf("Template improperly formatted for field name: %s", resourcesFieldName)
+			filteredResources = append(filteredResources, resource)
+			continue
+		}
+
+		resourceName, _ := resourceMap[nameFieldName].(string)
+		remove := false
+		for _, poolName := range existingAgentPools {
+			if referencesAgentPoolVariable(resourceName, poolName) {
+				remove = true
+				break
+			}
+		}
+		if remove {
+			logger.Infoln(fmt.Sprintf("Removing resource: %s of an existing agent pool from template", resourceName))
+			continue
+		}
+		filteredResources = append(filteredResources, resource)
+	}
+	templateMap[resourcesFieldName] = filteredResources
+
+	return t.NormalizeForK8sVMASScalingUp(logger, templateMap)
+}
+
+// referencesAgentPoolVariable returns true if the expression references a variable of the agent pool, such as
+// variables('agentpool1VMNamePrefix'). Pool names are lower case, so the variable name continues with an upper case letter.
+func referencesAgentPoolVariable(expression, poolName string) bool {
+	ref := "variables('" + poolName
+	for i := strings.Index(expression, ref); i != -1; {
+		next := i + len(ref)
+		if next < len(expression) && unicode.IsUpper(rune(expression[next])) {
+			return true
+		}
+		j := strings.Index(expression[next:], ref)
+		if j == -1 {
+			break
+		}
+		i = next + j
+	}
+	return false
+}
+
 func removeIndexesFromArray(array []interface{}, indexes []int) []interface{} {
 	sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
 	for _, index := range indexes {
@@ -66,6 +66,31 @@ func TestNormalizeForK8sVMASScalingUpWithVnet(t *testing.T) {
 	ValidateTemplate(templateMap, expectedFileContents, "TestNormalizeForK8sVMASScalingUpWithVnet")
 }
 
+func TestNormalizeForK8sAgentPoolAddition(t *testing.T) {
+	RegisterTestingT(t)
+	logger := logrus.New().WithField("testName", "TestNormalizeForK8sAgentPoolAddition")
+	fileContents, e := ioutil.ReadFile("./transformtestfiles/k8s_template.json")
+	Expect(e).To(BeNil())
+	expectedFileContents, e := ioutil.ReadFile("./transformtestfiles/k8s_agentpool_addition_template.json")
+	Expect(e).To(BeNil())
+	templateJSON := string(fileContents)
+	var template interface{}
+	json.Unmarshal([]byte(templateJSON), &template)
+	templateMap := template.(map[string]interface{})
+	transformer := Transformer{}
+	e = transformer.NormalizeForK8sAgentPoolAddition(logger, templateMap, []string{"agentppol1"})
+	Expect(e).To(BeNil())
+	ValidateTemplate(templateMap, expectedFileContents, "TestNormalizeForK8sAgentPoolAddition")
+}
+
+func TestReferencesAgentPoolVariable(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(referencesAgentPoolVariable("[variables('pool1AvailabilitySet')]", "pool1")).To(BeTrue())
+	Expect(referencesAgentPoolVariable("[concat(variables('pool10VMNamePrefix'), variables('pool1VMNamePrefix'))]", "pool1")).To(BeTrue())
+	Expect(referencesAgentPoolVariable("[variables('pool10AvailabilitySet')]", "pool1")).To(BeFalse())
+	Expect(referencesAgentPoolVariable("[variables('masterAvailabilitySet')]", "pool1")).To(BeFalse())
+}
+
 func TestNormalizeResourcesForK8sMasterUpgrade(t *testing.T) {
 	RegisterTestingT(t)
 	logger := logrus.New().WithField("testName", "TestNormalizeResourcesForK8sMasterUpgrade")
@@ -137,7 +137,28 @@ func CreatePki(extraFQDNs []string, extraIPs []net.IP, clusterDomain string, caP
 		nil
 }
 
+// CreateClientCertificate creates a client certificate for the user and groups, signed by the CA and valid for the duration
+func CreateClientCertificate(caPair *PkiKeyCertPair, user string, groups []string, validity time.Duration) (*PkiKeyCertPair, error) {
+	caCertificate, err := pemToCertificate(caPair.CertificatePem)
+	if err != nil {
+		return nil, err
+	}
+	caPrivateKey, err := pemToKey(caPair.PrivateKeyPem)
+	if err != nil {
+		return nil, err
+	}
+	certificate, privateKey, err := createCertificateValidFor(user, caCertificate, caPrivateKey, false, false, nil, nil, groups, validity)
+	if err != nil {
+		return nil, err
+	}
+	return &PkiKeyCertPair{CertificatePem: string(certificateToPem(certificate.Raw)), PrivateKeyPem: string(privateKeyToPem(privateKey))}, nil
+}
+
 func createCertificate(commonName string, caCertificate *x509.Certificate, caPrivateKey *rsa.PrivateKey, isEtcd bool, isServer bool, extraFQDNs []string, extraIPs []net.IP, organization []string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	return createCertificateValidFor(commonName, caCertificate, caPrivateKey, isEtcd, isServer, extraFQDNs, extraIPs, organization, ValidityDuration)
+}
+
+func createCertificateValidFor(commonName string, caCertificate *x509.Certificate, caPrivateKey *rsa.PrivateKey, isEtcd bool, isServer bool, extraFQDNs []string, extraIPs []net.IP, organization []string, validity time.Duration) (*x509.Certificate, *rsa.PrivateKey, error) {
 	var err error
 
 	isCA := (caCertificate == nil)
@@ -147,7 +168,7 @@ func createCertificate(commonName string, caCertificate *x509.Certificate, caPri
 	template := x509.Certificate{
 		Subject:   pkix.Name{CommonName: commonName},
 		NotBefore: now,
-		NotAfter:  now.Add(ValidityDuration),
+		NotAfter:  now.Add(validity),
 
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 		BasicConstraintsValid: true,
@@ -8,7 +8,9 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"net"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateCertificateWithOrganisation(t *testing.T) {
@@ -232,3 +234,34 @@ func TestCreatePkiKeyCertPair(t *testing.T) {
 		t.Errorf("unexpected error thrown while executing CreatePkiKeyCertPair : %s", err.Error())
 	}
 }
+
+func TestCreateClientCertificate(t *testing.T) {
+	caPair, err := CreatePkiKeyCertPair("ca")
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %s", err)
+	}
+
+	clientPair, err := CreateClientCertificate(caPair, "alice", []string{"developers", "testers"}, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error thrown while executing CreateClientCertificate : %s", err.Error())
+	}
+	certificate, err := pemToCertificate(clientPair.CertificatePem)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %s", err)
+	}
+	organization := strings.Join(certificate.Subject.Organization, ",")
+	if certificate.Subject.CommonName != "alice" || (organization != "developers,testers" && organization != "testers,developers") {
+		t.Fatalf("certificate subject did not match, got %v", certificate.Subject)
+	}
+	if certificate.NotAfter.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("certificate should expire within an hour, expires %s", certificate.NotAfter)
+	}
+	caCertificate, _ := pemToCertificate(caPair.CertificatePem)
+	if err = certificate.CheckSignatureFrom(caCertificate); err != nil {
+		t.Fatalf("certificate should be signed by the CA: %s", err)
+	}
+
+	if _, err = CreateClientCertificate(&PkiKeyCertPair{}, "alice", nil, time.Hour); err == nil {
+		t.Fatalf("expected an invalid CA to be rejected")
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// clusterResourceAPIVersions are the API versions cluster resources are deleted with, by resource provider.
+// They match the API versions the templates deploy the resources with.
+var clusterResourceAPIVersions = map[string]string{
+	"Microsoft.Compute":         "2018-06-01",
+	"Microsoft.Network":         "2018-08-01",
+	"Microsoft.Storage":         "2018-07-01",
+	"Microsoft.KeyVault":        "2018-02-14",
+	"Microsoft.ManagedIdentity": "2015-08-31-preview",
+}
+
+// clusterResourceDeletionOrder groups the resource types of a cluster so that every resource is deleted before the
+// resources it depends on. Resources of types missing from the list are deleted last.
+var clusterResourceDeletionOrder = [][]string{
+	{"Microsoft.Compute/virtualMachineScaleSets", "Microsoft.Compute/virtualMachines"},
+	{"Microsoft.Network/networkInterfaces", "Microsoft.Compute/disks", "Microsoft.Compute/availabilitySets", "Microsoft.ManagedIdentity/userAssignedIdentities"},
+	{"Microsoft.Network/loadBalancers"},
+	{"Microsoft.Network/publicIPAddresses", "Microsoft.Network/virtualNetworks"},
+	{"Microsoft.Network/networkSecurityGroups", "Microsoft.Network/routeTables"},
+}
+
+// windowsResourceNamePrefixLength is the length of the prefix of the name suffix Windows agent resources are tagged with
+const windowsResourceNamePrefixLength = 5
+
+// IsClusterResource returns true if the resource was created for the cluster with the name suffix, either tagged
+// with the suffix, or with its prefix for Windows agent resources, or named after it
+func IsClusterResource(resource resources.GenericResource, nameSuffix string) bool {
+	if suffix, ok := resource.Tags["resourceNameSuffix"]; ok && suffix != nil {
+		return *suffix == nameSuffix || (len(nameSuffix) >= windowsResourceNamePrefixLength && *suffix == nameSuffix[:windowsResourceNamePrefixLength])
+	}
+	// names are made of the suffix and other parts separated by dashes, like k8s-master-12345678-nic-0
+	for _, part := range strings.FieldsFunc(to.String(resource.Name), func(r rune) bool { return r == '-' || r == '_' }) {
+		if part == nameSuffix {
+			return true
+		}
+	}
+	return false
+}
+
+// windowsVMResourceNames returns the names of the untagged NICs and OS disks of the cluster Windows VMs. Windows VMs
+// are named after only the first 4 characters of the name suffix, so their resources are matched by VM name instead.
+func windowsVMResourceNames(all []resources.GenericResource, nameSuffix string) map[string]bool {
+	names := map[string]bool{}
+	for _, resource := range all {
+		name := to.String(resource.Name)
+		if len(nameSuffix) < 4 || !strings.EqualFold(to.String(resource.Type), "Microsoft.Compute/virtualMachines") ||
+			!IsClusterResource(resource, nameSuffix) || !strings.HasPrefix(name, nameSuffix[:4]+"k8s") {
+			continue
+		}
+		// VMs are named <prefix><index>, with a prefix of the pool index like 1234k8s01, and their NICs <prefix>nic-<index>
+		prefixLength := len(nameSuffix[:4]+"k8s") + 2
+		if len(name) > prefixLength {
+			names[name[:prefixLength]+"nic-"+name[prefixLength:]] = true
+		}
+		names[name+"-osdisk"] = true
+	}
+	return names
+}
+
+// ClusterResources returns the top level resources of the cluster with the name suffix, grouped in the order they
+// can be deleted in. Child resources, such as VM extensions, are deleted with their parent.
+func ClusterResources(all []resources.GenericResource, nameSuffix string) [][]resources.GenericResource {
+	groups := make([][]resources.GenericResource, len(clusterResourceDeletionOrder)+1)
+	windowsResources := windowsVMResourceNames(all, nameSuffix)
+	for _, resource := range all {
+		resourceType := to.String(resource.Type)
+		if strings.Count(resourceType, "/") != 1 {
+			continue
+		}
+		if !IsClusterResource(resource, nameSuffix) && (resource.Tags["resourceNameSuffix"] != nil || !windowsResources[to.String(resource.Name)]) {
+			continue
+		}
+		group := len(clusterResourceDeletionOrder)
+		for i, types := range clusterResourceDeletionOrder {
+			for _, t := range types {
+				if strings.EqualFold(t, resourceType) {
+					group = i
+				}
+			}
+		}
+		groups[group] = append(groups[group], resource)
+	}
+
+	ordered := [][]resources.GenericResource{}
+	for _, group := range groups {
+		if len(group) > 0 {
+			ordered = append(ordered, group)
+		}
+	}
+	return ordered
+}
+
+// DeleteClusterResources deletes the groups of resources returned by ClusterResources in order, deleting the
+// resources of a group concurrently. It stops at the first group a resource fails to delete from.
+func DeleteClusterResources(az armhelpers.AKSEngineClient, logger *log.Entry, groups [][]resources.GenericResource) error {
+	for _, group := range groups {
+		errChan := make(chan error, len(group))
+		for _, resource := range group {
+			go func(resource resources.GenericResource) {
+				errChan <- deleteClusterResource(az, logger, resource)
+			}(resource)
+		}
+
+		var failed []string
+		for range group {
+			if err := <-errChan; err != nil {
+				logger.Error(err)
+				failed = append(failed, err.Error())
+			}
+		}
+		close(errChan)
+		if len(failed) > 0 {
+			return errors.New(strings.Join(failed, "; "))
+		}
+	}
+	return nil
+}
+
+func deleteClusterResource(az armhelpers.AKSEngineClient, logger *log.Entry, resource resources.GenericResource) error {
+	resourceType := to.String(resource.Type)
+	name := to.String(resource.Name)
+	apiVersion, ok := clusterResourceAPIVersions[strings.Split(resourceType, "/")[0]]
+	if !ok {
+		return errors.Errorf("failed to delete %s %s: unsupported resource provider", resourceType, name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	logger.Infof("Deleting %s %s", resourceType, name)
+	if err := az.DeleteResourceByID(ctx, to.String(resource.ID), apiVersion); err != nil {
+		return errors.Wrapf(err, "failed to delete %s %s", resourceType, name)
+	}
+	return nil
+}
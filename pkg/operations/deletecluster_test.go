@@ -0,0 +1,118 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2018-05-01/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Delete cluster tests", func() {
+	var (
+		client *armhelpers.MockAKSEngineClient
+		all    []resources.GenericResource
+	)
+
+	BeforeEach(func() {
+		client = &armhelpers.MockAKSEngineClient{}
+		page, err := client.ListResources(context.Background(), "rg")
+		Expect(err).NotTo(HaveOccurred())
+		all = page.Values()
+	})
+
+	names := func(groups [][]resources.GenericResource) [][]string {
+		n := [][]string{}
+		for _, group := range groups {
+			g := []string{}
+			for _, r := range group {
+				g = append(g, to.String(r.Name))
+			}
+			n = append(n, g)
+		}
+		return n
+	}
+
+	It("Should only select the top level resources of the cluster", func() {
+		groups := ClusterResources(all, "12345678")
+		Expect(names(groups)).To(Equal([][]string{
+			{"k8s-master-12345678-0"},
+			{"k8s-master-12345678-nic-0", "k8s-master-12345678-0_OsDisk_1_0a1b2c3d", "master-availabilityset-12345678"},
+			{"k8s-master-lb-12345678"},
+			{"k8s-master-ip-masterdns1-12345678", "k8s-vnet-12345678"},
+			{"k8s-master-12345678-nsg", "k8s-master-12345678-routetable"},
+		}))
+	})
+
+	It("Should select resources tagged with the name suffix or the Windows prefix of it", func() {
+		tag := func(suffix string) map[string]*string {
+			return map[string]*string{"resourceNameSuffix": &suffix}
+		}
+		Expect(IsClusterResource(resources.GenericResource{Name: to.StringPtr("custom-name"), Tags: tag("12345678")}, "12345678")).To(BeTrue())
+		Expect(IsClusterResource(resources.GenericResource{Name: to.StringPtr("1234k8s010"), Tags: tag("12345")}, "12345678")).To(BeTrue())
+		Expect(IsClusterResource(resources.GenericResource{Name: to.StringPtr("1234k8s010"), Tags: tag("12349")}, "12345678")).To(BeFalse())
+		Expect(IsClusterResource(resources.GenericResource{Name: to.StringPtr("1234k8s010"), Tags: tag("1234")}, "12345678")).To(BeFalse())
+		Expect(IsClusterResource(resources.GenericResource{Name: to.StringPtr("k8s-master-12345678-0"), Tags: tag("87654321")}, "12345678")).To(BeFalse())
+		Expect(IsClusterResource(resources.GenericResource{Name: to.StringPtr("k8s-master-12345678-nic-0")}, "12345678")).To(BeTrue())
+		Expect(IsClusterResource(resources.GenericResource{Name: to.StringPtr("k8s-master-123456789-nic-0")}, "12345678")).To(BeFalse())
+		Expect(IsClusterResource(resources.GenericResource{Name: to.StringPtr("1234k8s010nic-0")}, "12345678")).To(BeFalse())
+		Expect(IsClusterResource(resources.GenericResource{Name: to.StringPtr("shared-vnet")}, "12345678")).To(BeFalse())
+	})
+
+	It("Should select the untagged NICs and disks of the cluster Windows VMs only", func() {
+		resource := func(name, resourceType, suffix string) resources.GenericResource {
+			r := resources.GenericResource{Name: to.StringPtr(name), Type: to.StringPtr(resourceType)}
+			if suffix != "" {
+				r.Tags = map[string]*string{"resourceNameSuffix": &suffix}
+			}
+			return r
+		}
+		windows := []resources.GenericResource{
+			resource("1234k8s010", "Microsoft.Compute/virtualMachines", "12345"),
+			resource("1234k8s01nic-0", "Microsoft.Network/networkInterfaces", ""),
+			resource("1234k8s010-osdisk", "Microsoft.Compute/disks", ""),
+			// a cluster whose name suffix starts with the same 4 characters
+			resource("1234k8s011", "Microsoft.Compute/virtualMachines", "12349"),
+			resource("1234k8s01nic-1", "Microsoft.Network/networkInterfaces", ""),
+			resource("1234k8s011-osdisk", "Microsoft.Compute/disks", ""),
+		}
+		Expect(names(ClusterResources(windows, "12345678"))).To(Equal([][]string{
+			{"1234k8s010"},
+			{"1234k8s01nic-0", "1234k8s010-osdisk"},
+		}))
+	})
+
+	It("Should delete every group of resources in order", func() {
+		groups := ClusterResources(all, "12345678")
+		Expect(DeleteClusterResources(client, log.NewEntry(log.New()), groups)).To(Succeed())
+		Expect(client.DeletedResourceIDs).To(HaveLen(9))
+		Expect(client.DeletedResourceIDs[0]).To(HaveSuffix("/Microsoft.Compute/virtualMachines/k8s-master-12345678-0"))
+		Expect(client.DeletedResourceIDs[4]).To(HaveSuffix("/Microsoft.Network/loadBalancers/k8s-master-lb-12345678"))
+		for _, id := range client.DeletedResourceIDs[5:] {
+			Expect(strings.Contains(id, "networkSecurityGroups") || strings.Contains(id, "routeTables") || strings.Contains(id, "virtualNetworks") || strings.Contains(id, "publicIPAddresses")).To(BeTrue())
+		}
+	})
+
+	It("Should stop at the first group that fails to delete", func() {
+		client.FailDeleteResourceByID = true
+		err := DeleteClusterResources(client, log.NewEntry(log.New()), ClusterResources(all, "12345678"))
+		Expect(err).To(MatchError("failed to delete Microsoft.Compute/virtualMachines k8s-master-12345678-0: DeleteResourceByID failed"))
+	})
+
+	It("Should refuse to delete resources of unknown providers", func() {
+		groups := [][]resources.GenericResource{{{
+			ID:   to.StringPtr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Web/sites/k8s-12345678"),
+			Name: to.StringPtr("k8s-12345678"),
+			Type: to.StringPtr("Microsoft.Web/sites"),
+		}}}
+		err := DeleteClusterResources(client, log.NewEntry(log.New()), groups)
+		Expect(err).To(MatchError("failed to delete Microsoft.Web/sites k8s-12345678: unsupported resource provider"))
+	})
+})
@@ -0,0 +1,200 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// etcdDefaultsFile holds the etcd member's command line, as written by the master's custom data
+	etcdDefaultsFile = "/etc/default/etcd"
+	// etcdRestoreDir is where a snapshot is staged and restored on each master before etcd is stopped.
+	// The data the member had before the restore is left in it, until the next restore.
+	etcdRestoreDir = "/var/lib/etcd-restore"
+	// etcdHealthRetries is how many times, 10 seconds apart, a restored member is checked for health
+	etcdHealthRetries = 30
+)
+
+// EtcdSnapshotter saves and restores snapshots of the etcd cluster running on the masters of a Kubernetes cluster.
+// Snapshots are gzip-compressed etcd v3 snapshot files.
+type EtcdSnapshotter struct {
+	Runner RemoteRunner
+	Logger *log.Entry
+	// CertificateProfile holds the CA and etcd client certificate used to authenticate with etcd
+	CertificateProfile *api.CertificateProfile
+}
+
+// Snapshot saves a snapshot of etcd from the member running on master
+func (s *EtcdSnapshotter) Snapshot(master *RemoteHost) ([]byte, error) {
+	s.Logger.Infof("Saving an etcd snapshot on %s", master)
+	out, err := s.runWithClientCerts(master,
+		fmt.Sprintf("%s snapshot save $d/snapshot.db > /dev/null", s.etcdctl()),
+		"gzip -c $d/snapshot.db")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to save etcd snapshot")
+	}
+	if len(out) == 0 {
+		return nil, errors.Errorf("etcd snapshot saved on %s is empty", master)
+	}
+	return []byte(out), nil
+}
+
+// Restore replaces the data of every etcd member with the snapshot. Each member is restored from the snapshot
+// while etcd is still running, then etcd is stopped on all masters, the restored data is swapped in and
+// etcd is started again on all masters together so they can form a quorum. If the data cannot be swapped in on
+// every master, the previous data is moved back and etcd is started again, so the control plane is not left down.
+func (s *EtcdSnapshotter) Restore(masters []*RemoteHost, snapshot []byte) error {
+	for i, host := range masters {
+		s.Logger.Infof("Restoring the etcd snapshot on master %d (%s)", i, host)
+		if _, err := s.Runner.RunCommandWithInput(host, stageSnapshotCommand(), bytes.NewReader(snapshot)); err != nil {
+			return errors.Wrapf(err, "failed to copy the etcd snapshot to master %d", i)
+		}
+		if _, err := s.Runner.RunCommand(host, restoreSnapshotCommand()); err != nil {
+			return errors.Wrapf(err, "failed to restore the etcd snapshot on master %d", i)
+		}
+	}
+
+	s.Logger.Info("Stopping etcd on all masters")
+	if err := s.runOnAll(masters, "sudo systemctl stop etcd", "stop etcd"); err != nil {
+		return s.rollBack(masters, err)
+	}
+	for i, host := range masters {
+		if _, err := s.Runner.RunCommand(host, swapDataCommand()); err != nil {
+			return s.rollBack(masters, errors.Wrapf(err, "failed to replace the etcd data on master %d", i))
+		}
+	}
+	s.Logger.Info("Starting etcd on all masters")
+	if err := s.runOnAll(masters, "sudo systemctl start etcd", "start etcd"); err != nil {
+		return err
+	}
+
+	for i, host := range masters {
+		s.Logger.Infof("Waiting for the etcd member on master %d to be healthy", i)
+		check := fmt.Sprintf("for i in $(seq 1 %d); do %s endpoint health && exit 0; sleep 10; done; exit 1", etcdHealthRetries, s.etcdctl())
+		if _, err := s.runWithClientCerts(host, check); err != nil {
+			return errors.Wrapf(err, "etcd member on master %d is not healthy after the restore", i)
+		}
+	}
+
+	// the api servers cache the etcd revision they watch from, which went back in time
+	s.Logger.Info("Restarting the api servers")
+	restartAPIServer := "sudo docker ps -q --filter name=k8s_kube-apiserver | xargs -r sudo docker restart"
+	return s.runOnAll(masters, restartAPIServer, "restart the api server")
+}
+
+// rollBack moves the previous data of every member back in place and starts etcd on every master again,
+// then returns the error the restore failed with
+func (s *EtcdSnapshotter) rollBack(masters []*RemoteHost, cause error) error {
+	s.Logger.Warnf("Rolling back the etcd restore: %v", cause)
+	var failed []string
+	for i, host := range masters {
+		if _, err := s.Runner.RunCommand(host, restorePreviousDataCommand()); err != nil {
+			failed = append(failed, fmt.Sprintf("failed to move the previous etcd data back on master %d, it is in %s/previous-member: %v", i, etcdRestoreDir, err))
+		}
+	}
+	if err := s.runOnAll(masters, "sudo systemctl start etcd", "start etcd"); err != nil {
+		failed = append(failed, err.Error())
+	}
+	if len(failed) > 0 {
+		return errors.Wrapf(cause, "rolling back the etcd restore failed (%s)", strings.Join(failed, "; "))
+	}
+	return errors.Wrap(cause, "the etcd restore was rolled back")
+}
+
+// runWithClientCerts runs a command on host that extracts the etcd client certificates, read on its standard input,
+// to a temporary directory $d, runs cmds in order and removes the directory
+func (s *EtcdSnapshotter) runWithClientCerts(host *RemoteHost, cmds ...string) (string, error) {
+	cp := s.CertificateProfile
+	certs, err := FilesArchive([]RemoteFile{
+		{Name: "ca.crt", Content: cp.CaCertificate, Mode: 0600},
+		{Name: "etcdclient.crt", Content: cp.EtcdClientCertificate, Mode: 0600},
+		{Name: "etcdclient.key", Content: cp.EtcdClientPrivateKey, Mode: 0600},
+	})
+	if err != nil {
+		return "", err
+	}
+	script := []string{"set -e", "umask 077", "d=$(mktemp -d)", `trap 'rm -rf "$d"' EXIT`, `tar -xf - -C "$d"`}
+	return s.Runner.RunCommandWithInput(host, strings.Join(append(script, cmds...), "; "), certs)
+}
+
+// etcdctl returns the etcdctl command line that talks to the local member with the certificates extracted by runWithClientCerts
+func (s *EtcdSnapshotter) etcdctl() string {
+	return fmt.Sprintf("ETCDCTL_API=3 etcdctl --endpoints=https://127.0.0.1:%d --cacert=$d/ca.crt --cert=$d/etcdclient.crt --key=$d/etcdclient.key", api.DefaultMasterEtcdClientPort)
+}
+
+// runOnAll runs cmd on every master concurrently
+func (s *EtcdSnapshotter) runOnAll(masters []*RemoteHost, cmd, action string) error {
+	errChan := make(chan error, len(masters))
+	for i, host := range masters {
+		go func(i int, host *RemoteHost) {
+			_, err := s.Runner.RunCommand(host, cmd)
+			errChan <- errors.Wrapf(err, "failed to %s on master %d", action, i)
+		}(i, host)
+	}
+	var failed []string
+	for range masters {
+		if err := <-errChan; err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// stageSnapshotCommand returns a command that writes the compressed snapshot read from stdin to the restore directory
+func stageSnapshotCommand() string {
+	return strings.Join([]string{
+		fmt.Sprintf("sudo rm -rf %s", etcdRestoreDir),
+		fmt.Sprintf("sudo mkdir -p %s", etcdRestoreDir),
+		fmt.Sprintf("gunzip -c | sudo tee %s/snapshot.db > /dev/null", etcdRestoreDir),
+	}, " && ")
+}
+
+// etcdFlag returns a shell expression that reads the value of an etcd flag from the member's command line
+func etcdFlag(name string) string {
+	return fmt.Sprintf(`$(grep '^DAEMON_ARGS=' %s | sed -n 's/.*--%s \([^ ]*\).*/\1/p')`, etcdDefaultsFile, name)
+}
+
+// restoreSnapshotCommand returns a command that restores the staged snapshot into a new data directory,
+// with the same member name and cluster membership as the member running on the master
+func restoreSnapshotCommand() string {
+	return strings.Join([]string{
+		fmt.Sprintf("sudo ETCDCTL_API=3 etcdctl snapshot restore %s/snapshot.db --name %s --initial-cluster %s --initial-cluster-token %s --initial-advertise-peer-urls %s --data-dir %s/data > /dev/null",
+			etcdRestoreDir, etcdFlag("name"), etcdFlag("initial-cluster"), etcdFlag("initial-cluster-token"), etcdFlag("initial-advertise-peer-urls"), etcdRestoreDir),
+		fmt.Sprintf("sudo rm -f %s/snapshot.db", etcdRestoreDir),
+	}, " && ")
+}
+
+// swapDataCommand returns a command that moves the member's data aside and moves the restored data in its place.
+// The data directory is a mount point, so only its member directory is replaced.
+func swapDataCommand() string {
+	dataDir := etcdFlag("data-dir")
+	return strings.Join([]string{
+		fmt.Sprintf("dir=%s", dataDir),
+		`test -n "$dir"`,
+		fmt.Sprintf(`(test ! -d "$dir/member" || sudo mv "$dir/member" %s/previous-member)`, etcdRestoreDir),
+		fmt.Sprintf(`sudo mv %s/data/member "$dir/member"`, etcdRestoreDir),
+		`sudo chown -R etcd:etcd "$dir/member"`,
+	}, " && ")
+}
+
+// restorePreviousDataCommand returns a command that undoes swapDataCommand: the restored data is moved back to the
+// restore directory and the member's previous data is moved in its place. Masters whose data was not swapped are left as they are.
+func restorePreviousDataCommand() string {
+	dataDir := etcdFlag("data-dir")
+	return strings.Join([]string{
+		fmt.Sprintf("dir=%s", dataDir),
+		`test -n "$dir"`,
+		fmt.Sprintf(`(test ! -d %s/previous-member || ((test ! -d "$dir/member" || sudo mv "$dir/member" %s/restored-member) && sudo mv %s/previous-member "$dir/member"))`, etcdRestoreDir, etcdRestoreDir, etcdRestoreDir),
+	}, " && ")
+}
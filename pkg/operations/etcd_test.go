@@ -0,0 +1,190 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// fakeRunner records the commands run on every host, and their standard input, and returns output for commands
+// containing a key of outputs
+type fakeRunner struct {
+	mu       sync.Mutex
+	commands map[string][]string
+	inputs   map[string][][]byte
+	outputs  map[string]string
+	failOn   string
+	// failHost limits failOn to the commands run on one host
+	failHost string
+}
+
+func (r *fakeRunner) RunCommand(host *RemoteHost, cmd string) (string, error) {
+	return r.RunCommandWithInput(host, cmd, nil)
+}
+
+func (r *fakeRunner) RunCommandWithInput(host *RemoteHost, cmd string, stdin io.Reader) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.commands == nil {
+		r.commands = make(map[string][]string)
+		r.inputs = make(map[string][][]byte)
+	}
+	r.commands[host.String()] = append(r.commands[host.String()], cmd)
+	if stdin != nil {
+		b, _ := ioutil.ReadAll(stdin)
+		r.inputs[host.String()] = append(r.inputs[host.String()], b)
+	}
+	if r.failOn != "" && strings.Contains(cmd, r.failOn) && (r.failHost == "" || r.failHost == host.String()) {
+		return "", errors.Errorf("command failed on %s", host)
+	}
+	for k, out := range r.outputs {
+		if strings.Contains(cmd, k) {
+			return out, nil
+		}
+	}
+	return "", nil
+}
+
+// archivedFiles returns the contents of the files in a tar archive, by name
+func archivedFiles(b []byte) map[string]string {
+	files := map[string]string{}
+	tr := tar.NewReader(bytes.NewReader(b))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		Expect(err).NotTo(HaveOccurred())
+		content, err := ioutil.ReadAll(tr)
+		Expect(err).NotTo(HaveOccurred())
+		files[header.Name] = string(content)
+	}
+	return files
+}
+
+var _ = Describe("Etcd snapshot tests", func() {
+	var (
+		runner  *fakeRunner
+		s       *EtcdSnapshotter
+		masters []*RemoteHost
+	)
+
+	BeforeEach(func() {
+		runner = &fakeRunner{}
+		s = &EtcdSnapshotter{
+			Runner: runner,
+			Logger: log.NewEntry(log.New()),
+			CertificateProfile: &api.CertificateProfile{
+				CaCertificate:         "ca",
+				EtcdClientCertificate: "etcdclient",
+				EtcdClientPrivateKey:  "etcdclientkey",
+			},
+		}
+		masters = []*RemoteHost{
+			{Addr: "testcluster.westus.cloudapp.azure.com", Port: 22},
+			{Addr: "testcluster.westus.cloudapp.azure.com", Port: 2201},
+			{Addr: "testcluster.westus.cloudapp.azure.com", Port: 2202},
+		}
+	})
+
+	It("Should save a snapshot with the etcd client certificates", func() {
+		runner.outputs = map[string]string{"snapshot save": "snapshot"}
+		snapshot, err := s.Snapshot(masters[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(snapshot)).To(Equal("snapshot"))
+
+		cmds := runner.commands[masters[0].String()]
+		Expect(cmds).To(HaveLen(1))
+		Expect(cmds[0]).To(ContainSubstring(`tar -xf - -C "$d"`))
+		Expect(cmds[0]).NotTo(ContainSubstring("etcdclientkey"))
+		certs := archivedFiles(runner.inputs[masters[0].String()][0])
+		Expect(certs).To(Equal(map[string]string{"ca.crt": "ca", "etcdclient.crt": "etcdclient", "etcdclient.key": "etcdclientkey"}))
+		Expect(cmds[0]).To(ContainSubstring("--endpoints=https://127.0.0.1:2379 --cacert=$d/ca.crt --cert=$d/etcdclient.crt --key=$d/etcdclient.key snapshot save $d/snapshot.db"))
+		Expect(cmds[0]).To(HaveSuffix("gzip -c $d/snapshot.db"))
+	})
+
+	It("Should fail when the snapshot is empty", func() {
+		_, err := s.Snapshot(masters[0])
+		Expect(err).To(MatchError("etcd snapshot saved on testcluster.westus.cloudapp.azure.com:22 is empty"))
+	})
+
+	It("Should restore the snapshot on every master before restarting etcd", func() {
+		Expect(s.Restore(masters, []byte("snapshot"))).To(Succeed())
+		for _, m := range masters {
+			Expect(runner.inputs[m.String()][0]).To(Equal([]byte("snapshot")))
+			cmds := runner.commands[m.String()]
+			Expect(cmds).To(HaveLen(7))
+			Expect(cmds[0]).To(HaveSuffix("gunzip -c | sudo tee /var/lib/etcd-restore/snapshot.db > /dev/null"))
+			Expect(cmds[1]).To(ContainSubstring("etcdctl snapshot restore /var/lib/etcd-restore/snapshot.db --name $(grep '^DAEMON_ARGS=' /etc/default/etcd"))
+			Expect(cmds[2]).To(Equal("sudo systemctl stop etcd"))
+			Expect(cmds[3]).To(ContainSubstring(`sudo mv /var/lib/etcd-restore/data/member "$dir/member"`))
+			Expect(cmds[4]).To(Equal("sudo systemctl start etcd"))
+			Expect(cmds[5]).To(ContainSubstring("endpoint health && exit 0"))
+			Expect(cmds[6]).To(ContainSubstring("k8s_kube-apiserver"))
+		}
+	})
+
+	It("Should not stop etcd when the snapshot cannot be restored", func() {
+		runner.failOn = "snapshot restore"
+		err := s.Restore(masters, []byte("snapshot"))
+		Expect(err).To(MatchError("failed to restore the etcd snapshot on master 0: command failed on testcluster.westus.cloudapp.azure.com:22"))
+		for _, m := range masters {
+			for _, cmd := range runner.commands[m.String()] {
+				Expect(cmd).NotTo(ContainSubstring("systemctl stop etcd"))
+			}
+		}
+	})
+
+	It("Should report every master etcd fails to start on", func() {
+		runner.failOn = "systemctl start etcd"
+		err := s.Restore(masters, []byte("snapshot"))
+		Expect(err).To(HaveOccurred())
+		for i := range masters {
+			Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("failed to start etcd on master %d", i)))
+		}
+	})
+
+	It("Should move the previous data back and start etcd when the restored data cannot be swapped in", func() {
+		runner.failOn = "data/member"
+		runner.failHost = masters[1].String()
+		err := s.Restore(masters, []byte("snapshot"))
+		Expect(err).To(MatchError("the etcd restore was rolled back: failed to replace the etcd data on master 1: command failed on testcluster.westus.cloudapp.azure.com:2201"))
+		for i, m := range masters {
+			cmds := runner.commands[m.String()]
+			if i < 2 {
+				Expect(cmds).To(HaveLen(6))
+				Expect(cmds[3]).To(ContainSubstring(`sudo mv /var/lib/etcd-restore/data/member "$dir/member"`))
+			} else {
+				// the data of the last master was never swapped
+				Expect(cmds).To(HaveLen(5))
+			}
+			Expect(cmds[len(cmds)-2]).To(ContainSubstring(`sudo mv /var/lib/etcd-restore/previous-member "$dir/member"`))
+			Expect(cmds[len(cmds)-1]).To(Equal("sudo systemctl start etcd"))
+		}
+	})
+
+	It("Should report the masters the previous data cannot be moved back on", func() {
+		runner.failOn = "previous-member"
+		runner.failHost = masters[0].String()
+		err := s.Restore(masters, []byte("snapshot"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(HavePrefix("rolling back the etcd restore failed (failed to move the previous etcd data back on master 0, it is in /var/lib/etcd-restore/previous-member"))
+		for _, m := range masters {
+			cmds := runner.commands[m.String()]
+			Expect(cmds[len(cmds)-1]).To(Equal("sudo systemctl start etcd"))
+		}
+	})
+})
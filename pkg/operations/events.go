@@ -0,0 +1,203 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/pkg/errors"
+)
+
+// EventSchemaVersion is the version of the schema of the events, it changes only when a field is removed or changes meaning
+const EventSchemaVersion = "v1"
+
+// EventType is the kind of an event of the machine-readable event stream
+type EventType string
+
+// The types of event emitted by long-running commands
+const (
+	EventPhaseStarted        EventType = "PhaseStarted"
+	EventPhaseFinished       EventType = "PhaseFinished"
+	EventNodeDrained         EventType = "NodeDrained"
+	EventVMDeleted           EventType = "VMDeleted"
+	EventVMCreated           EventType = "VMCreated"
+	EventNodeReady           EventType = "NodeReady"
+	EventDeploymentOperation EventType = "DeploymentOperation"
+	EventSummary             EventType = "Summary"
+)
+
+// The statuses of finished phases and of the summary
+const (
+	EventStatusSucceeded = "Succeeded"
+	EventStatusFailed    = "Failed"
+)
+
+// Event is a single line of the event stream
+type Event struct {
+	SchemaVersion string    `json:"schemaVersion"`
+	Time          time.Time `json:"time"`
+	Type          EventType `json:"type"`
+	// Phase is the step of the command the event belongs to
+	Phase string `json:"phase,omitempty"`
+	Pool  string `json:"pool,omitempty"`
+	Node  string `json:"node,omitempty"`
+	// Deployment, Resource and ResourceType identify the ARM deployment operation of DeploymentOperation events
+	Deployment      string         `json:"deployment,omitempty"`
+	Resource        string         `json:"resource,omitempty"`
+	ResourceType    string         `json:"resourceType,omitempty"`
+	Status          string         `json:"status,omitempty"`
+	StatusCode      string         `json:"statusCode,omitempty"`
+	Error           string         `json:"error,omitempty"`
+	DurationSeconds float64        `json:"durationSeconds,omitempty"`
+	Steps           []StepDuration `json:"steps,omitempty"`
+}
+
+// StepDuration is how long a phase took, reported by the Summary event
+type StepDuration struct {
+	Phase           string  `json:"phase"`
+	Status          string  `json:"status"`
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// EventStream writes the events of a command as one JSON object per line.
+// A nil *EventStream discards every event, so it can be passed to code that runs without --output-format json.
+type EventStream struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	now     func() time.Time
+	start   time.Time
+	started map[string]time.Time
+	steps   []StepDuration
+}
+
+// NewEventStream returns an event stream writing to w
+func NewEventStream(w io.Writer) *EventStream {
+	s := &EventStream{
+		encoder: json.NewEncoder(w),
+		now:     time.Now,
+		started: map[string]time.Time{},
+	}
+	s.start = s.now()
+	return s
+}
+
+// Emit writes an event, filling in its schema version and time
+func (s *EventStream) Emit(e Event) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emit(e)
+}
+
+func (s *EventStream) emit(e Event) {
+	e.SchemaVersion = EventSchemaVersion
+	e.Time = s.now().UTC()
+	// the stream is best effort, a closed stdout must not fail the operation
+	_ = s.encoder.Encode(e)
+}
+
+// StartPhase records the start of a phase
+func (s *EventStream) StartPhase(phase string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started[phase] = s.now()
+	s.emit(Event{Type: EventPhaseStarted, Phase: phase})
+}
+
+// FinishPhase records the end of a phase started with StartPhase, failed if err is not nil
+func (s *EventStream) FinishPhase(phase string, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	step := StepDuration{Phase: phase, Status: EventStatusSucceeded}
+	if started, ok := s.started[phase]; ok {
+		step.DurationSeconds = s.now().Sub(started).Seconds()
+		delete(s.started, phase)
+	}
+	e := Event{Type: EventPhaseFinished, Phase: phase, DurationSeconds: step.DurationSeconds}
+	if err != nil {
+		step.Status = EventStatusFailed
+		e.Error = err.Error()
+	}
+	e.Status = step.Status
+	s.steps = append(s.steps, step)
+	s.emit(e)
+}
+
+// Phase runs f as the named phase
+func (s *EventStream) Phase(phase string, f func() error) error {
+	s.StartPhase(phase)
+	err := f()
+	s.FinishPhase(phase, err)
+	return err
+}
+
+// Finish emits the Summary event with the outcome of the command and the duration of every phase.
+// Phases that were started but not finished are reported as failed.
+func (s *EventStream) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unfinished := make([]string, 0, len(s.started))
+	for phase := range s.started {
+		unfinished = append(unfinished, phase)
+	}
+	sort.Strings(unfinished)
+	for _, phase := range unfinished {
+		s.steps = append(s.steps, StepDuration{Phase: phase, Status: EventStatusFailed, DurationSeconds: s.now().Sub(s.started[phase]).Seconds()})
+	}
+	s.started = map[string]time.Time{}
+	e := Event{
+		Type:            EventSummary,
+		Status:          EventStatusSucceeded,
+		DurationSeconds: s.now().Sub(s.start).Seconds(),
+		Steps:           s.steps,
+	}
+	if err != nil {
+		e.Status = EventStatusFailed
+		e.Error = err.Error()
+	}
+	s.emit(e)
+}
+
+// EmitDeploymentOperations emits an event with the status of every operation of an ARM deployment
+func (s *EventStream) EmitDeploymentOperations(client armhelpers.AKSEngineClient, resourceGroup, deploymentName string) error {
+	if s == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	page, err := client.ListDeploymentOperations(ctx, resourceGroup, deploymentName, nil)
+	for ; err == nil && page.NotDone(); err = page.Next() {
+		for _, op := range page.Values() {
+			e := Event{Type: EventDeploymentOperation, Deployment: deploymentName}
+			if op.Properties != nil {
+				e.Status = to.String(op.Properties.ProvisioningState)
+				if op.Properties.TargetResource != nil {
+					e.Resource = to.String(op.Properties.TargetResource.ResourceName)
+					e.ResourceType = to.String(op.Properties.TargetResource.ResourceType)
+				}
+				e.StatusCode = to.String(op.Properties.StatusCode)
+			}
+			s.Emit(e)
+		}
+	}
+	return errors.Wrapf(err, "error listing the operations of deployment %s", deploymentName)
+}
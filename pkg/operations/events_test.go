@@ -0,0 +1,100 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+func parseEvents(out *bytes.Buffer) []Event {
+	events := []Event{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		e := Event{}
+		Expect(json.Unmarshal([]byte(line), &e)).To(Succeed())
+		events = append(events, e)
+	}
+	return events
+}
+
+var _ = Describe("Event stream tests", func() {
+	It("Should report phases and their durations in the summary", func() {
+		out := &bytes.Buffer{}
+		s := NewEventStream(out)
+		clock := s.start
+		s.now = func() time.Time {
+			return clock
+		}
+
+		Expect(s.Phase("drain-nodes", func() error {
+			s.Emit(Event{Type: EventNodeDrained, Node: "k8s-agentpool1-12345678-0"})
+			clock = clock.Add(2 * time.Second)
+			return nil
+		})).To(Succeed())
+		s.StartPhase("delete-vms")
+		clock = clock.Add(time.Second)
+		s.Finish(errors.New("failed to delete VM"))
+
+		events := parseEvents(out)
+		Expect(events).To(HaveLen(5))
+		for _, e := range events {
+			Expect(e.SchemaVersion).To(Equal(EventSchemaVersion))
+		}
+		Expect(events[0].Type).To(Equal(EventPhaseStarted))
+		Expect(events[1].Type).To(Equal(EventNodeDrained))
+		Expect(events[1].Node).To(Equal("k8s-agentpool1-12345678-0"))
+		Expect(events[2].Type).To(Equal(EventPhaseFinished))
+		Expect(events[2].Status).To(Equal(EventStatusSucceeded))
+		Expect(events[2].DurationSeconds).To(Equal(2.0))
+		Expect(events[3].Type).To(Equal(EventPhaseStarted))
+
+		summary := events[4]
+		Expect(summary.Type).To(Equal(EventSummary))
+		Expect(summary.DurationSeconds).To(Equal(3.0))
+		Expect(summary.Status).To(Equal(EventStatusFailed))
+		Expect(summary.Error).To(Equal("failed to delete VM"))
+		Expect(summary.Steps).To(Equal([]StepDuration{
+			{Phase: "drain-nodes", Status: EventStatusSucceeded, DurationSeconds: 2},
+			{Phase: "delete-vms", Status: EventStatusFailed, DurationSeconds: 1},
+		}))
+	})
+
+	It("Should report failed phases", func() {
+		out := &bytes.Buffer{}
+		s := NewEventStream(out)
+		err := s.Phase("deploy", func() error { return errors.New("deployment failed") })
+		Expect(err).To(HaveOccurred())
+		events := parseEvents(out)
+		Expect(events[1].Status).To(Equal(EventStatusFailed))
+		Expect(events[1].Error).To(Equal("deployment failed"))
+	})
+
+	It("Should report the operations of a deployment", func() {
+		out := &bytes.Buffer{}
+		s := NewEventStream(out)
+		Expect(s.EmitDeploymentOperations(&armhelpers.MockAKSEngineClient{}, "rg", "deployment")).To(Succeed())
+		events := parseEvents(out)
+		Expect(events).NotTo(BeEmpty())
+		Expect(events[0].Type).To(Equal(EventDeploymentOperation))
+		Expect(events[0].Deployment).To(Equal("deployment"))
+		Expect(events[0].Status).To(Equal("Failed"))
+	})
+
+	It("Should discard events without a stream", func() {
+		var s *EventStream
+		s.StartPhase("deploy")
+		s.Emit(Event{Type: EventVMCreated})
+		s.FinishPhase("deploy", nil)
+		s.Finish(nil)
+		Expect(s.Phase("deploy", func() error { return nil })).To(Succeed())
+		Expect(s.EmitDeploymentOperations(&armhelpers.MockAKSEngineClient{}, "rg", "deployment")).To(Succeed())
+	})
+})
@@ -0,0 +1,212 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// HealthCheck is a gate that verifies one aspect of cluster health before or during an operation that disrupts nodes
+type HealthCheck struct {
+	// Name describes what the check verifies, as shown in the health report
+	Name string
+	// Check returns an error describing why the cluster is unhealthy, or nil if it is healthy
+	Check func(client armhelpers.KubernetesClient) error
+}
+
+// HealthCheckResult is the outcome of a single health check
+type HealthCheckResult struct {
+	Name string
+	Err  error
+}
+
+// HealthReport holds the outcome of every health check run against a cluster
+type HealthReport struct {
+	Results []HealthCheckResult
+}
+
+// HealthCheckError is returned when one or more health checks fail
+type HealthCheckError struct {
+	Report *HealthReport
+}
+
+func (e *HealthCheckError) Error() string {
+	var b strings.Builder
+	b.WriteString("cluster health checks failed:")
+	for _, r := range e.Report.Failed() {
+		fmt.Fprintf(&b, "\n  - %s: %v", r.Name, r.Err)
+	}
+	return b.String()
+}
+
+// DefaultHealthChecks returns the health checks run by operations that replace nodes
+func DefaultHealthChecks() []HealthCheck {
+	return []HealthCheck{
+		{Name: "api server is reachable through the load balancer", Check: CheckAPIServerReachable},
+		{Name: "all nodes are Ready", Check: CheckNodesReady},
+		{Name: "kube-system pods are Running", Check: CheckSystemPodsRunning},
+		{Name: "etcd members are healthy", Check: CheckEtcdHealthy},
+		{Name: "pod disruption budgets allow disruptions", Check: CheckPodDisruptionBudgets},
+	}
+}
+
+// RunHealthChecks runs every check once and reports the outcome of each
+func RunHealthChecks(client armhelpers.KubernetesClient, checks []HealthCheck) *HealthReport {
+	report := &HealthReport{}
+	for _, c := range checks {
+		report.Results = append(report.Results, HealthCheckResult{Name: c.Name, Err: c.Check(client)})
+	}
+	return report
+}
+
+// Failed returns the results of the checks that did not pass
+func (r *HealthReport) Failed() []HealthCheckResult {
+	var failed []HealthCheckResult
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err returns a *HealthCheckError listing the failed checks, or nil if all checks passed
+func (r *HealthReport) Err() error {
+	if len(r.Failed()) == 0 {
+		return nil
+	}
+	return &HealthCheckError{Report: r}
+}
+
+// WaitForHealthChecks runs the checks every interval until they all pass, returning the last report's error on timeout
+func WaitForHealthChecks(client armhelpers.KubernetesClient, logger *log.Entry, checks []HealthCheck, interval, timeout time.Duration) error {
+	var report *HealthReport
+	err := wait.PollImmediate(interval, timeout, func() (bool, error) {
+		report = RunHealthChecks(client, checks)
+		failed := report.Failed()
+		for _, r := range failed {
+			logger.Infof("Waiting for health check %q: %v", r.Name, r.Err)
+		}
+		return len(failed) == 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return report.Err()
+	}
+	return err
+}
+
+// CheckAPIServerReachable verifies the api server answers requests
+func CheckAPIServerReachable(client armhelpers.KubernetesClient) error {
+	if _, err := client.GetServerVersion(); err != nil {
+		return errors.Wrap(err, "api server is not reachable")
+	}
+	return nil
+}
+
+// CheckNodesReady verifies every node registered with the api server is Ready
+func CheckNodesReady(client armhelpers.KubernetesClient) error {
+	nodes, err := client.ListNodes()
+	if err != nil {
+		return errors.Wrap(err, "error listing nodes")
+	}
+	var notReady []string
+	for _, node := range nodes.Items {
+		if !isNodeReady(&node) {
+			notReady = append(notReady, node.Name)
+		}
+	}
+	if len(notReady) > 0 {
+		return errors.Errorf("nodes not Ready: %s", strings.Join(notReady, ", "))
+	}
+	return nil
+}
+
+// CheckSystemPodsRunning verifies every kube-system pod is Running, or has run to completion.
+// Pods that are being deleted are ignored.
+func CheckSystemPodsRunning(client armhelpers.KubernetesClient) error {
+	pods, err := client.ListNamespacedPods(metav1.NamespaceSystem)
+	if err != nil {
+		return errors.Wrap(err, "error listing kube-system pods")
+	}
+	var notRunning []string
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if pod.Status.Phase != v1.PodRunning && pod.Status.Phase != v1.PodSucceeded {
+			notRunning = append(notRunning, fmt.Sprintf("%s (%s)", pod.Name, pod.Status.Phase))
+		}
+	}
+	if len(notRunning) > 0 {
+		return errors.Errorf("kube-system pods not Running: %s", strings.Join(notRunning, ", "))
+	}
+	return nil
+}
+
+// CheckEtcdHealthy verifies the api server reports every etcd member as healthy
+func CheckEtcdHealthy(client armhelpers.KubernetesClient) error {
+	statuses, err := client.ListComponentStatuses()
+	if err != nil {
+		return errors.Wrap(err, "error listing component statuses")
+	}
+	var unhealthy []string
+	for _, cs := range statuses.Items {
+		if !strings.HasPrefix(cs.Name, "etcd-") {
+			continue
+		}
+		healthy := false
+		message := "no health reported"
+		for _, c := range cs.Conditions {
+			if c.Type == v1.ComponentHealthy {
+				healthy = c.Status == v1.ConditionTrue
+				message = c.Error
+			}
+		}
+		if !healthy {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", cs.Name, message))
+		}
+	}
+	if len(unhealthy) > 0 {
+		return errors.Errorf("etcd members not healthy: %s", strings.Join(unhealthy, ", "))
+	}
+	return nil
+}
+
+// CheckPodDisruptionBudgets verifies every pod disruption budget that covers pods allows at least one disruption,
+// otherwise draining a node would block on evicting its pods
+func CheckPodDisruptionBudgets(client armhelpers.KubernetesClient) error {
+	pdbs, err := client.ListPodDisruptionBudgets()
+	if err != nil {
+		return errors.Wrap(err, "error listing pod disruption budgets")
+	}
+	var blocking []string
+	for _, pdb := range pdbs.Items {
+		if pdb.Status.ExpectedPods > 0 && pdb.Status.PodDisruptionsAllowed == 0 {
+			blocking = append(blocking, fmt.Sprintf("%s/%s (%d of %d pods healthy)",
+				pdb.Namespace, pdb.Name, pdb.Status.CurrentHealthy, pdb.Status.ExpectedPods))
+		}
+	}
+	if len(blocking) > 0 {
+		return errors.Errorf("pod disruption budgets allow no disruptions: %s", strings.Join(blocking, ", "))
+	}
+	return nil
+}
+
+func isNodeReady(node *v1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Cluster health check tests", func() {
+	It("Should pass every default check on a healthy cluster", func() {
+		client := &armhelpers.MockKubernetesClient{
+			NodesList: &v1.NodeList{Items: []v1.Node{readyNode("k8s-master-12345678-0", v1.ConditionTrue)}},
+			NamespacedPodsList: &v1.PodList{Items: []v1.Pod{
+				systemPod("kube-proxy-abcde", v1.PodRunning),
+				systemPod("kube-addon-job", v1.PodSucceeded),
+			}},
+			ComponentStatusesList: &v1.ComponentStatusList{Items: []v1.ComponentStatus{
+				etcdStatus("etcd-0", v1.ConditionTrue, ""),
+			}},
+			PodDisruptionBudgetsList: &policy.PodDisruptionBudgetList{Items: []policy.PodDisruptionBudget{
+				pdb("default", "web", 1, 3, 3),
+			}},
+		}
+		report := RunHealthChecks(client, DefaultHealthChecks())
+		Expect(report.Results).To(HaveLen(len(DefaultHealthChecks())))
+		Expect(report.Err()).To(BeNil())
+	})
+
+	It("Should report every failed check", func() {
+		client := &armhelpers.MockKubernetesClient{
+			NodesList: &v1.NodeList{Items: []v1.Node{
+				readyNode("k8s-agentpool1-12345678-0", v1.ConditionTrue),
+				readyNode("k8s-agentpool1-12345678-1", v1.ConditionFalse),
+			}},
+			NamespacedPodsList: &v1.PodList{Items: []v1.Pod{systemPod("kube-dns-abcde", v1.PodPending)}},
+			ComponentStatusesList: &v1.ComponentStatusList{Items: []v1.ComponentStatus{
+				etcdStatus("etcd-0", v1.ConditionTrue, ""),
+				etcdStatus("etcd-1", v1.ConditionFalse, "connection refused"),
+				{ObjectMeta: metav1.ObjectMeta{Name: "scheduler"}},
+			}},
+			PodDisruptionBudgetsList: &policy.PodDisruptionBudgetList{Items: []policy.PodDisruptionBudget{
+				pdb("default", "web", 0, 2, 2),
+				pdb("default", "idle", 0, 0, 0),
+			}},
+			FailGetServerVersion: true,
+		}
+		err := RunHealthChecks(client, DefaultHealthChecks()).Err()
+		Expect(err).To(HaveOccurred())
+		_, ok := err.(*HealthCheckError)
+		Expect(ok).To(BeTrue())
+		Expect(err.Error()).To(Equal(`cluster health checks failed:
+  - api server is reachable through the load balancer: api server is not reachable: GetServerVersion failed
+  - all nodes are Ready: nodes not Ready: k8s-agentpool1-12345678-1
+  - kube-system pods are Running: kube-system pods not Running: kube-dns-abcde (Pending)
+  - etcd members are healthy: etcd members not healthy: etcd-1 (connection refused)
+  - pod disruption budgets allow disruptions: pod disruption budgets allow no disruptions: default/web (2 of 2 pods healthy)`))
+	})
+
+	It("Should ignore kube-system pods that are being deleted", func() {
+		pod := systemPod("kube-proxy-abcde", v1.PodPending)
+		now := metav1.Now()
+		pod.DeletionTimestamp = &now
+		client := &armhelpers.MockKubernetesClient{NamespacedPodsList: &v1.PodList{Items: []v1.Pod{pod}}}
+		Expect(CheckSystemPodsRunning(client)).To(Succeed())
+	})
+
+	It("Should return the error of a check that cannot query the api server", func() {
+		client := &armhelpers.MockKubernetesClient{FailListNodes: true}
+		Expect(CheckNodesReady(client)).To(MatchError("error listing nodes: ListNodes failed"))
+	})
+
+	It("Should wait until the checks pass", func() {
+		calls := 0
+		checks := []HealthCheck{{Name: "eventually healthy", Check: func(armhelpers.KubernetesClient) error {
+			calls++
+			if calls < 3 {
+				return CheckNodesReady(&armhelpers.MockKubernetesClient{FailListNodes: true})
+			}
+			return nil
+		}}}
+		err := WaitForHealthChecks(&armhelpers.MockKubernetesClient{}, log.NewEntry(log.New()), checks, time.Millisecond, time.Minute)
+		Expect(err).To(BeNil())
+		Expect(calls).To(Equal(3))
+	})
+
+	It("Should return the health report when the checks do not pass in time", func() {
+		client := &armhelpers.MockKubernetesClient{FailListNodes: true}
+		checks := []HealthCheck{{Name: "all nodes are Ready", Check: CheckNodesReady}}
+		err := WaitForHealthChecks(client, log.NewEntry(log.New()), checks, time.Millisecond, 10*time.Millisecond)
+		Expect(err).To(MatchError("cluster health checks failed:\n  - all nodes are Ready: error listing nodes: ListNodes failed"))
+	})
+})
+
+func readyNode(name string, status v1.ConditionStatus) v1.Node {
+	node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: status}}
+	return node
+}
+
+func systemPod(name string, phase v1.PodPhase) v1.Pod {
+	pod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceSystem}}
+	pod.Status.Phase = phase
+	return pod
+}
+
+func etcdStatus(name string, status v1.ConditionStatus, message string) v1.ComponentStatus {
+	return v1.ComponentStatus{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Conditions: []v1.ComponentCondition{{Type: v1.ComponentHealthy, Status: status, Error: message}},
+	}
+}
+
+func pdb(namespace, name string, allowed, healthy, expected int32) policy.PodDisruptionBudget {
+	p := policy.PodDisruptionBudget{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	p.Status.PodDisruptionsAllowed = allowed
+	p.Status.CurrentHealthy = healthy
+	p.Status.ExpectedPods = expected
+	return p
+}
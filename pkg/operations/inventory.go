@@ -0,0 +1,180 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Node statuses of inventory machines
+const (
+	NodeStatusReady    = "Ready"
+	NodeStatusNotReady = "NotReady"
+	NodeStatusMissing  = "Missing"
+)
+
+// Drift kinds
+const (
+	DriftCount       = "count"
+	DriftVersion     = "version"
+	DriftMissingNode = "missingNode"
+	DriftMissingVM   = "missingVM"
+)
+
+// MasterPoolName is the pool name of the masters in an inventory
+const MasterPoolName = "master"
+
+// ClusterInventory is the live state of the machines and nodes of a cluster, reconciled with its api model
+type ClusterInventory struct {
+	OrchestratorVersion string             `json:"orchestratorVersion"`
+	Pools               []InventoryPool    `json:"pools"`
+	Machines            []InventoryMachine `json:"machines"`
+	Drift               []InventoryDrift   `json:"drift"`
+}
+
+// InventoryPool compares the number of machines found for a pool with its count in the api model
+type InventoryPool struct {
+	Name     string `json:"name"`
+	Expected int    `json:"expected"`
+	Found    int    `json:"found"`
+}
+
+// InventoryMachine is a VM or scale set instance of the cluster, joined with its Kubernetes node
+type InventoryMachine struct {
+	Name                string `json:"name"`
+	Pool                string `json:"pool"`
+	Index               int    `json:"index"`
+	ScaleSet            string `json:"scaleSet,omitempty"`
+	OrchestratorVersion string `json:"orchestratorVersion,omitempty"`
+	NodeName            string `json:"nodeName"`
+	NodeStatus          string `json:"nodeStatus"`
+	KubeletVersion      string `json:"kubeletVersion,omitempty"`
+}
+
+// InventoryDrift is a difference between the api model and the live state of the cluster
+type InventoryDrift struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	Detail string `json:"detail"`
+}
+
+// NewClusterInventory joins the machines of the cluster with their nodes and reports the drift from the api model:
+// pools whose machine count differs, machines and nodes that run another version, machines without node and nodes
+// without machine. The NodeName of the machines is used to find their node.
+func NewClusterInventory(properties *api.Properties, machines []InventoryMachine, nodes []v1.Node) *ClusterInventory {
+	inventory := &ClusterInventory{
+		Pools:    []InventoryPool{},
+		Machines: []InventoryMachine{},
+		Drift:    []InventoryDrift{},
+	}
+	if properties.OrchestratorProfile != nil {
+		inventory.OrchestratorVersion = properties.OrchestratorProfile.OrchestratorVersion
+	}
+
+	pools := map[string]int{}
+	if properties.MasterProfile != nil {
+		inventory.Pools = append(inventory.Pools, InventoryPool{Name: MasterPoolName, Expected: properties.MasterProfile.Count})
+		pools[MasterPoolName] = 0
+	}
+	for _, pool := range properties.AgentPoolProfiles {
+		pools[pool.Name] = len(inventory.Pools)
+		inventory.Pools = append(inventory.Pools, InventoryPool{Name: pool.Name, Expected: pool.Count})
+	}
+
+	nodesByName := map[string]v1.Node{}
+	for _, node := range nodes {
+		nodesByName[node.Name] = node
+	}
+	for _, machine := range machines {
+		if node, ok := nodesByName[machine.NodeName]; ok {
+			machine.NodeStatus = nodeStatus(node)
+			machine.KubeletVersion = node.Status.NodeInfo.KubeletVersion
+			delete(nodesByName, machine.NodeName)
+		} else {
+			machine.NodeStatus = NodeStatusMissing
+		}
+		if _, ok := pools[machine.Pool]; !ok {
+			pools[machine.Pool] = len(inventory.Pools)
+			inventory.Pools = append(inventory.Pools, InventoryPool{Name: machine.Pool})
+		}
+		inventory.Pools[pools[machine.Pool]].Found++
+		inventory.Machines = append(inventory.Machines, machine)
+	}
+	sort.SliceStable(inventory.Machines, func(i, j int) bool {
+		a, b := inventory.Machines[i], inventory.Machines[j]
+		if a.Pool != b.Pool {
+			return pools[a.Pool] < pools[b.Pool]
+		}
+		return a.Index < b.Index
+	})
+
+	for _, pool := range inventory.Pools {
+		if pool.Found != pool.Expected {
+			inventory.addDrift(DriftCount, pool.Name, "the api model has %d machines, found %d", pool.Expected, pool.Found)
+		}
+	}
+	for _, machine := range inventory.Machines {
+		if machine.OrchestratorVersion != "" && !sameVersion(machine.OrchestratorVersion, inventory.OrchestratorVersion) {
+			inventory.addDrift(DriftVersion, machine.Name, "tagged with version %s, the api model has %s", machine.OrchestratorVersion, inventory.OrchestratorVersion)
+		}
+		if machine.NodeStatus == NodeStatusMissing {
+			inventory.addDrift(DriftMissingNode, machine.Name, "no node %s is registered", machine.NodeName)
+		} else if !sameVersion(machine.KubeletVersion, inventory.OrchestratorVersion) {
+			inventory.addDrift(DriftVersion, machine.NodeName, "runs kubelet %s, the api model has %s", machine.KubeletVersion, inventory.OrchestratorVersion)
+		}
+	}
+	if versions := kubeletVersions(inventory.Machines); len(versions) > 1 {
+		inventory.addDrift(DriftVersion, "nodes", "nodes run different kubelet versions: %s", strings.Join(versions, ", "))
+	}
+	names := []string{}
+	for name := range nodesByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		inventory.addDrift(DriftMissingVM, name, "no virtual machine of the cluster runs node %s", name)
+	}
+	return inventory
+}
+
+func (inventory *ClusterInventory) addDrift(kind, target, format string, args ...interface{}) {
+	inventory.Drift = append(inventory.Drift, InventoryDrift{Kind: kind, Target: target, Detail: fmt.Sprintf(format, args...)})
+}
+
+// kubeletVersions returns the kubelet versions the nodes of the machines run, with how many nodes run each
+func kubeletVersions(machines []InventoryMachine) []string {
+	counts := map[string]int{}
+	for _, machine := range machines {
+		if machine.NodeStatus != NodeStatusMissing {
+			counts[machine.KubeletVersion]++
+		}
+	}
+	versions := []string{}
+	for version, count := range counts {
+		versions = append(versions, fmt.Sprintf("%s (%d)", version, count))
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// nodeStatus returns whether the node is ready
+func nodeStatus(node v1.Node) string {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+			return NodeStatusReady
+		}
+	}
+	return NodeStatusNotReady
+}
+
+// sameVersion returns true if both Kubernetes versions are the same, ignoring the v prefix of kubelet versions.
+// Versions are not compared when the api model has none.
+func sameVersion(version, expected string) bool {
+	return expected == "" || strings.TrimPrefix(version, "v") == strings.TrimPrefix(expected, "v")
+}
@@ -0,0 +1,92 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"github.com/Azure/aks-engine/pkg/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Cluster inventory tests", func() {
+	var properties *api.Properties
+
+	BeforeEach(func() {
+		properties = &api.Properties{
+			OrchestratorProfile: &api.OrchestratorProfile{OrchestratorVersion: "1.11.6"},
+			MasterProfile:       &api.MasterProfile{Count: 1},
+			AgentPoolProfiles: []*api.AgentPoolProfile{
+				{Name: "agentpool1", Count: 2},
+			},
+		}
+	})
+
+	versionedNode := func(name string, status v1.ConditionStatus, version string) v1.Node {
+		node := readyNode(name, status)
+		node.Status.NodeInfo.KubeletVersion = version
+		return node
+	}
+
+	It("Should report no drift when the cluster matches the api model", func() {
+		machines := []InventoryMachine{
+			{Name: "k8s-agentpool1-12345678-1", Pool: "agentpool1", Index: 1, NodeName: "k8s-agentpool1-12345678-1", OrchestratorVersion: "1.11.6"},
+			{Name: "k8s-agentpool1-12345678-0", Pool: "agentpool1", Index: 0, NodeName: "k8s-agentpool1-12345678-0", OrchestratorVersion: "1.11.6"},
+			{Name: "k8s-master-12345678-0", Pool: MasterPoolName, Index: 0, NodeName: "k8s-master-12345678-0", OrchestratorVersion: "1.11.6"},
+		}
+		nodes := []v1.Node{
+			versionedNode("k8s-master-12345678-0", v1.ConditionTrue, "v1.11.6"),
+			versionedNode("k8s-agentpool1-12345678-0", v1.ConditionTrue, "v1.11.6"),
+			versionedNode("k8s-agentpool1-12345678-1", v1.ConditionFalse, "v1.11.6"),
+		}
+		inventory := NewClusterInventory(properties, machines, nodes)
+		Expect(inventory.Drift).To(BeEmpty())
+		Expect(inventory.Pools).To(Equal([]InventoryPool{
+			{Name: MasterPoolName, Expected: 1, Found: 1},
+			{Name: "agentpool1", Expected: 2, Found: 2},
+		}))
+		Expect(inventory.Machines[0].Name).To(Equal("k8s-master-12345678-0"))
+		Expect(inventory.Machines[1].Name).To(Equal("k8s-agentpool1-12345678-0"))
+		Expect(inventory.Machines[1].NodeStatus).To(Equal(NodeStatusReady))
+		Expect(inventory.Machines[2].NodeStatus).To(Equal(NodeStatusNotReady))
+		Expect(inventory.Machines[2].KubeletVersion).To(Equal("v1.11.6"))
+	})
+
+	It("Should report count, version and missing node and VM drift", func() {
+		machines := []InventoryMachine{
+			{Name: "k8s-master-12345678-0", Pool: MasterPoolName, Index: 0, NodeName: "k8s-master-12345678-0", OrchestratorVersion: "1.11.6"},
+			{Name: "k8s-agentpool1-12345678-0", Pool: "agentpool1", Index: 0, NodeName: "k8s-agentpool1-12345678-0", OrchestratorVersion: "1.11.5"},
+			{Name: "k8s-gpupool-12345678-vmss_0", Pool: "gpupool", Index: 0, ScaleSet: "k8s-gpupool-12345678-vmss", NodeName: "k8s-gpupool-12345678-vmss000000"},
+		}
+		nodes := []v1.Node{
+			versionedNode("k8s-master-12345678-0", v1.ConditionTrue, "v1.11.6"),
+			versionedNode("k8s-agentpool1-12345678-0", v1.ConditionTrue, "v1.11.5"),
+			versionedNode("k8s-agentpool1-12345678-5", v1.ConditionTrue, "v1.11.6"),
+		}
+		inventory := NewClusterInventory(properties, machines, nodes)
+		Expect(inventory.Pools).To(HaveLen(3))
+		Expect(inventory.Pools[2]).To(Equal(InventoryPool{Name: "gpupool", Expected: 0, Found: 1}))
+		Expect(inventory.Drift).To(Equal([]InventoryDrift{
+			{Kind: DriftCount, Target: "agentpool1", Detail: "the api model has 2 machines, found 1"},
+			{Kind: DriftCount, Target: "gpupool", Detail: "the api model has 0 machines, found 1"},
+			{Kind: DriftVersion, Target: "k8s-agentpool1-12345678-0", Detail: "tagged with version 1.11.5, the api model has 1.11.6"},
+			{Kind: DriftVersion, Target: "k8s-agentpool1-12345678-0", Detail: "runs kubelet v1.11.5, the api model has 1.11.6"},
+			{Kind: DriftMissingNode, Target: "k8s-gpupool-12345678-vmss_0", Detail: "no node k8s-gpupool-12345678-vmss000000 is registered"},
+			{Kind: DriftVersion, Target: "nodes", Detail: "nodes run different kubelet versions: v1.11.5 (1), v1.11.6 (1)"},
+			{Kind: DriftMissingVM, Target: "k8s-agentpool1-12345678-5", Detail: "no virtual machine of the cluster runs node k8s-agentpool1-12345678-5"},
+		}))
+	})
+
+	It("Should not compare versions when the api model has none", func() {
+		properties.OrchestratorProfile = nil
+		machines := []InventoryMachine{
+			{Name: "k8s-master-12345678-0", Pool: MasterPoolName, NodeName: "k8s-master-12345678-0", OrchestratorVersion: "1.11.6"},
+		}
+		nodes := []v1.Node{versionedNode("k8s-master-12345678-0", v1.ConditionTrue, "v1.11.6")}
+		inventory := NewClusterInventory(properties, machines, nodes)
+		Expect(inventory.Drift).To(Equal([]InventoryDrift{
+			{Kind: DriftCount, Target: "agentpool1", Detail: "the api model has 2 machines, found 0"},
+		}))
+	})
+})
@@ -0,0 +1,194 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/Azure/aks-engine/pkg/helpers"
+	"github.com/pkg/errors"
+)
+
+// CheckpointFilename is the name of the file an upgrade records its progress in, inside the deployment directory
+const CheckpointFilename = "upgrade-checkpoint.json"
+
+// scaleSetTemplatePool is the checkpoint pool name of the ARM deployment applied before upgrading scale sets
+const scaleSetTemplatePool = "agent-scale-sets-template"
+
+// Checkpoint step actions
+const (
+	stepCreate  = "create"
+	stepDelete  = "delete"
+	stepDrain   = "drain"
+	stepDeploy  = "deploy"
+	stepReplace = "replace"
+)
+
+type stepStatus string
+
+const (
+	stepPending   stepStatus = "pending"
+	stepStarted   stepStatus = "started"
+	stepCompleted stepStatus = "completed"
+)
+
+// checkpoint records the planned node operations of an upgrade and how far it got, so that a failed or
+// interrupted upgrade continues with the same operations instead of planning again from the VM tags
+type checkpoint struct {
+	UpgradeVersion string            `json:"upgradeVersion"`
+	Pools          []*poolCheckpoint `json:"pools"`
+	Rollback       *RollbackSnapshot `json:"rollback,omitempty"`
+
+	path string
+	// mu serializes updates from nodes upgraded concurrently
+	mu sync.Mutex
+}
+
+// poolCheckpoint holds the operations of a master pool, agent pool or scale set, in the order they are run
+type poolCheckpoint struct {
+	Name  string            `json:"name"`
+	Steps []*checkpointStep `json:"steps"`
+}
+
+// checkpointStep is a single operation against a VM and its status
+type checkpointStep struct {
+	Action     string     `json:"action"`
+	VM         string     `json:"vm,omitempty"`
+	Index      int        `json:"index"`
+	InstanceID string     `json:"instanceID,omitempty"`
+	Capacity   int64      `json:"capacity,omitempty"`
+	Batch      int        `json:"batch"`
+	Status     stepStatus `json:"status"`
+}
+
+// loadCheckpoint reads the checkpoint of a previous upgrade to the same version
+func loadCheckpoint(path, upgradeVersion string) (*checkpoint, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading upgrade checkpoint")
+	}
+	c := &checkpoint{}
+	if err = json.Unmarshal(contents, c); err != nil {
+		return nil, errors.Wrapf(err, "error parsing upgrade checkpoint %s", path)
+	}
+	if c.UpgradeVersion != upgradeVersion {
+		return nil, errors.Errorf("upgrade checkpoint %s is for Kubernetes version %s, not %s", path, c.UpgradeVersion, upgradeVersion)
+	}
+	c.path = path
+	return c, nil
+}
+
+// newCheckpoint returns an empty checkpoint. It refuses to overwrite the checkpoint of an unfinished upgrade.
+func newCheckpoint(path, upgradeVersion string) (*checkpoint, error) {
+	if path != "" {
+		if _, err := os.Stat(path); err == nil {
+			return nil, errors.Errorf("found the checkpoint of an unfinished upgrade at %s, resume it with --resume or discard it with --discard-checkpoint to start over", path)
+		}
+	}
+	return &checkpoint{
+		UpgradeVersion: upgradeVersion,
+		Pools:          []*poolCheckpoint{},
+		path:           path,
+	}, nil
+}
+
+// pool returns the checkpointed operations of a pool, or nil if the upgrade has not reached it yet
+func (c *checkpoint) pool(name string) *poolCheckpoint {
+	for _, p := range c.Pools {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// addPool records the planned operations of a pool
+func (c *checkpoint) addPool(name string, steps []*checkpointStep) (*poolCheckpoint, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range steps {
+		s.Status = stepPending
+	}
+	p := &poolCheckpoint{Name: name, Steps: steps}
+	c.Pools = append(c.Pools, p)
+	return p, c.save()
+}
+
+// removePool discards the recorded operations of a pool, so they are planned again
+func (c *checkpoint) removePool(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, p := range c.Pools {
+		if p.Name == name {
+			c.Pools = append(c.Pools[:i], c.Pools[i+1:]...)
+			break
+		}
+	}
+	return c.save()
+}
+
+// setStatus updates the status of a step and persists the checkpoint
+func (c *checkpoint) setStatus(step *checkpointStep, status stepStatus) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	step.Status = status
+	return c.save()
+}
+
+// save writes the checkpoint atomically, so a crash never leaves a partial file behind.
+// Checkpoints without a path are only kept in memory.
+func (c *checkpoint) save() error {
+	if c.path == "" {
+		return nil
+	}
+	b, err := helpers.JSONMarshalIndent(c, "", "  ", false)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling upgrade checkpoint")
+	}
+	tmp := c.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return errors.Wrap(err, "error writing upgrade checkpoint")
+	}
+	return errors.Wrap(os.Rename(tmp, c.path), "error writing upgrade checkpoint")
+}
+
+// remove deletes the checkpoint once the upgrade has completed
+func (c *checkpoint) remove() error {
+	if c.path == "" {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "error removing upgrade checkpoint")
+	}
+	return nil
+}
+
+// completed returns true if every step of the pool has completed
+func (p *poolCheckpoint) completed() bool {
+	for _, s := range p.Steps {
+		if s.Status != stepCompleted {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeActionSteps converts planned node actions into checkpoint steps
+func nodeActionSteps(actions []nodeAction) []*checkpointStep {
+	steps := make([]*checkpointStep, 0, len(actions))
+	for _, a := range actions {
+		step := &checkpointStep{Action: stepDelete, VM: a.name, Index: a.index, Batch: a.batch}
+		switch {
+		case a.create:
+			step.Action = stepCreate
+		case a.drain:
+			step.Action = stepDrain
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
@@ -0,0 +1,152 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/aks-engine/pkg/engine/transform"
+	"github.com/Azure/aks-engine/pkg/operations"
+)
+
+// Plan returns the ordered steps RunUpgrade would take against the cluster topology, without changing anything.
+// deployedTemplate and deployedParameters are the ARM template and parameters the cluster was last deployed with,
+// and are used to report which resources the upgrade deployments add or modify.
+func (ku *Upgrader) Plan(deployedTemplate, deployedParameters map[string]interface{}) (*operations.Plan, error) {
+	upgradeVersion := ku.DataModel.Properties.OrchestratorProfile.OrchestratorVersion
+	plan := operations.NewPlan("upgrade", fmt.Sprintf("Upgrade to Kubernetes version %s", upgradeVersion), ku.ResourceGroup)
+	transformer := &transform.Transformer{
+		Translator: ku.Translator,
+	}
+	var isMasterManagedDisk bool
+	if ku.DataModel.Properties.MasterProfile != nil {
+		isMasterManagedDisk = ku.DataModel.Properties.MasterProfile.IsManagedDisks()
+	}
+
+	// diffDeployment reports the resources changed by a deployment of the upgrade template normalized by normalize
+	diffDeployment := func(normalize func(templateMap map[string]interface{}) error) error {
+		templateMap, parametersMap, err := ku.generateUpgradeTemplate(ku.DataModel, ku.AKSEngineVersion)
+		if err != nil {
+			return ku.Translator.Errorf("error generating upgrade template: %s", err.Error())
+		}
+		if err = normalize(templateMap); err != nil {
+			return err
+		}
+		deployed, err := copyTemplate(deployedTemplate)
+		if err != nil {
+			return err
+		}
+		if err = normalize(deployed); err != nil {
+			return err
+		}
+		plan.AddResources(operations.DiffTemplateResources(deployed, deployedParameters, templateMap, parametersMap))
+		return nil
+	}
+
+	if ku.DataModel.Properties.MasterProfile != nil {
+		actions, err := ku.masterActions()
+		if err != nil {
+			return nil, err
+		}
+		if len(actions) > 0 {
+			err = diffDeployment(func(templateMap map[string]interface{}) error {
+				return transformer.NormalizeResourcesForK8sMasterUpgrade(ku.logger, templateMap, isMasterManagedDisk, nil)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		addActionSteps(plan, MasterPoolName, actions)
+	}
+
+	if len(ku.AgentPoolScaleSetsToUpgrade) > 0 {
+		err := diffDeployment(func(templateMap map[string]interface{}) error {
+			return transformer.NormalizeForVMSSScaling(ku.logger, templateMap)
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan.AddStep(operations.PlanActionDeploy, "", "agent scale sets", "apply the upgrade template so new instances run the target version")
+	}
+	for _, vmss := range ku.AgentPoolScaleSetsToUpgrade {
+		pool := ku.scaleSetPoolName(vmss.Name)
+		for _, vm := range vmss.VMsToUpgrade {
+			plan.AddStep(operations.PlanActionSetCapacity, pool, vmss.Name, fmt.Sprintf("capacity %d", *vmss.Sku.Capacity+1))
+			plan.AddStep(operations.PlanActionDrain, pool, vm.Name, "")
+			plan.AddStep(operations.PlanActionDelete, pool, vm.Name, fmt.Sprintf("instance %s", vm.InstanceID))
+		}
+	}
+
+	for _, agentPool := range ku.sortedAgentPools() {
+		agentCount, agentPoolProfile := ku.agentPoolProfile(*agentPool.Name)
+		if agentCount == 0 {
+			continue
+		}
+		actions, err := ku.agentPoolActions(agentPool, agentCount, agentPoolProfile)
+		if err != nil {
+			return nil, err
+		}
+		if len(actions) == 0 {
+			continue
+		}
+		preservePools := map[string]bool{*agentPool.Name: true}
+		err = diffDeployment(func(templateMap map[string]interface{}) error {
+			return transformer.NormalizeResourcesForK8sAgentUpgrade(ku.logger, templateMap, isMasterManagedDisk, preservePools)
+		})
+		if err != nil {
+			return nil, err
+		}
+		addActionSteps(plan, *agentPool.Name, actions)
+	}
+
+	for _, app := range ku.DataModel.Properties.AgentPoolProfiles {
+		if !plan.HasPoolSteps(app.Name) {
+			plan.UntouchedAgentPools = append(plan.UntouchedAgentPools, app.Name)
+		}
+	}
+
+	return plan, nil
+}
+
+func addActionSteps(plan *operations.Plan, pool string, actions []nodeAction) {
+	for _, action := range actions {
+		target := action.name
+		if target == "" {
+			target = fmt.Sprintf("%s node with index %d", pool, action.index)
+		}
+		switch {
+		case action.create:
+			plan.AddStep(operations.PlanActionCreate, pool, target, fmt.Sprintf("index %d", action.index))
+		case action.drain:
+			plan.AddStep(operations.PlanActionDrain, pool, target, "")
+			plan.AddStep(operations.PlanActionDelete, pool, target, "")
+		default:
+			plan.AddStep(operations.PlanActionDelete, pool, target, "")
+		}
+	}
+}
+
+// scaleSetPoolName returns the name of the agent pool backed by a VMSS, or the VMSS name if the pool is not known
+func (ku *Upgrader) scaleSetPoolName(vmssName string) string {
+	for _, app := range ku.DataModel.Properties.AgentPoolProfiles {
+		if strings.Contains(vmssName, "-"+app.Name+"-") {
+			return app.Name
+		}
+	}
+	return vmssName
+}
+
+func copyTemplate(template map[string]interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	var c map[string]interface{}
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
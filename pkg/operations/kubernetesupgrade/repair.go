@@ -0,0 +1,384 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/aks-engine/pkg/api"
+	"github.com/Azure/aks-engine/pkg/armhelpers"
+	"github.com/Azure/aks-engine/pkg/armhelpers/utils"
+	"github.com/Azure/aks-engine/pkg/engine/transform"
+	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+)
+
+// poolRepair is the node operations that repair a single pool
+type poolRepair struct {
+	name    string
+	actions []nodeAction
+}
+
+// RepairCluster recreates the masters and availability set agents of the cluster that are missing or unhealthy.
+// Every node is recreated at its own index from the template of the api model version, so node names and etcd
+// membership do not change. Scale set instances are not repaired, their pools are reported as not repaired.
+func (uc *UpgradeCluster) RepairCluster(az armhelpers.AKSEngineClient, kubeConfig string, aksEngineVersion string) error {
+	u, err := uc.newRepairer(az, kubeConfig, aksEngineVersion)
+	if err != nil {
+		return err
+	}
+	if err = u.RunRepair(); err != nil {
+		return err
+	}
+	uc.Logger.Infof("Cluster repaired successfully")
+	return nil
+}
+
+// PlanRepair returns the steps RepairCluster would take to repair the cluster, without changing it
+func (uc *UpgradeCluster) PlanRepair(az armhelpers.AKSEngineClient, kubeConfig string, aksEngineVersion string) (*operations.Plan, error) {
+	u, err := uc.newRepairer(az, kubeConfig, aksEngineVersion)
+	if err != nil {
+		return nil, err
+	}
+	return u.PlanRepair()
+}
+
+func (uc *UpgradeCluster) newRepairer(az armhelpers.AKSEngineClient, kubeConfig string, aksEngineVersion string) (*Upgrader, error) {
+	// the VMs of every pool are needed to tell which are missing
+	uc.AgentPoolsToUpgrade = map[string]bool{MasterPoolName: true}
+	for _, app := range uc.DataModel.Properties.AgentPoolProfiles {
+		uc.AgentPoolsToUpgrade[app.Name] = true
+	}
+	uc.repairing = true
+	defer func() { uc.repairing = false }()
+	if err := uc.loadClusterTopology(az, kubeConfig); err != nil {
+		return nil, err
+	}
+
+	u := &Upgrader{}
+	u.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, kubeConfig, uc.StepTimeout, aksEngineVersion)
+	if uc.HealthChecks != nil {
+		u.SetHealthChecks(uc.HealthChecks)
+	}
+	return u, nil
+}
+
+// RunRepair deletes the unhealthy nodes of the cluster and creates them again, along with the missing ones.
+// The cluster is not expected to be healthy until every pool is repaired, so the health checks only run once
+// the repair completes.
+func (ku *Upgrader) RunRepair() error {
+	if ku.checkpoint == nil {
+		if err := ku.InitCheckpoint("", false); err != nil {
+			return err
+		}
+	}
+
+	pools, err := ku.repairActions()
+	if err != nil {
+		return err
+	}
+	if unrepaired := ku.unrepairedAgentPools(); len(unrepaired) > 0 {
+		ku.logger.Warnf("Agent pools %s are not repaired, repair does not support VirtualMachineScaleSets agent pools", strings.Join(unrepaired, ", "))
+	}
+	if len(pools) == 0 {
+		ku.logger.Infof("No missing or unhealthy nodes found")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Minute)
+	defer cancel()
+	checks := ku.healthChecks
+	ku.healthChecks = nil
+	err = ku.repairPools(ctx, pools)
+	ku.healthChecks = checks
+	if err != nil {
+		return err
+	}
+
+	ku.logger.Infof("Running post-repair health checks...")
+	if err = ku.checkHealth(true); err != nil {
+		return errors.Wrap(err, "post-repair health checks failed")
+	}
+	return nil
+}
+
+// PlanRepair returns the ordered steps RunRepair would take against the cluster topology, without changing anything
+func (ku *Upgrader) PlanRepair() (*operations.Plan, error) {
+	plan := operations.NewPlan("repair", "Recreate the missing and unhealthy nodes", ku.ResourceGroup)
+	pools, err := ku.repairActions()
+	if err != nil {
+		return nil, err
+	}
+	for _, pool := range pools {
+		addActionSteps(plan, pool.name, pool.actions)
+	}
+	plan.UnsupportedAgentPools = ku.unrepairedAgentPools()
+	for _, app := range ku.DataModel.Properties.AgentPoolProfiles {
+		if !plan.HasPoolSteps(app.Name) && !app.IsVirtualMachineScaleSets() {
+			plan.UntouchedAgentPools = append(plan.UntouchedAgentPools, app.Name)
+		}
+	}
+	return plan, nil
+}
+
+func (ku *Upgrader) repairPools(ctx context.Context, pools []poolRepair) error {
+	for _, p := range pools {
+		newNode, err := ku.repairNodes(p.name)
+		if err != nil {
+			return err
+		}
+		pool, err := ku.checkpoint.addPool(p.name, nodeActionSteps(p.actions))
+		if err != nil {
+			return err
+		}
+		ku.logger.Infof("Repairing pool %s...", p.name)
+		if err = ku.runNodeSteps(ctx, newNode, p.name, pool); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repairNodes returns a function returning the nodes a pool is repaired with. They are created from the template
+// of the api model version, normalized the same way as when upgrading the pool.
+func (ku *Upgrader) repairNodes(poolName string) (func() (UpgradeNode, error), error) {
+	templateMap, parametersMap, err := ku.upgradeTemplate()
+	if err != nil {
+		return nil, ku.Translator.Errorf("error generating repair template: %s", err.Error())
+	}
+	transformer := &transform.Transformer{
+		Translator: ku.Translator,
+	}
+	var isMasterManagedDisk bool
+	if ku.DataModel.Properties.MasterProfile != nil {
+		isMasterManagedDisk = ku.DataModel.Properties.MasterProfile.IsManagedDisks()
+	}
+
+	if poolName == MasterPoolName {
+		if err = transformer.NormalizeResourcesForK8sMasterUpgrade(ku.logger, templateMap, isMasterManagedDisk, nil); err != nil {
+			return nil, err
+		}
+		// master nodes are repaired one at a time, so every step can share the same template
+		masterNode := ku.newMasterNode(templateMap, parametersMap)
+		return func() (UpgradeNode, error) {
+			return masterNode, nil
+		}, nil
+	}
+
+	preservePools := map[string]bool{poolName: true}
+	if err = transformer.NormalizeResourcesForK8sAgentUpgrade(ku.logger, templateMap, isMasterManagedDisk, preservePools); err != nil {
+		return nil, err
+	}
+	return agentNodeCopies(ku.newAgentNode(templateMap, parametersMap, poolName)), nil
+}
+
+// repairActions returns the node operations that repair each pool that needs it, masters first
+func (ku *Upgrader) repairActions() ([]poolRepair, error) {
+	nodes, err := ku.clusterNodes()
+	if err != nil {
+		// the api server cannot be reached when every master is gone, which leaves the missing VMs to recreate
+		ku.logger.Warnf("Only missing VMs are recreated, the health of the nodes is unknown: %v", err)
+	}
+
+	pools := []poolRepair{}
+	if ku.DataModel.Properties.MasterProfile != nil {
+		if actions := ku.repairMasterActions(nodes); len(actions) > 0 {
+			pools = append(pools, poolRepair{name: MasterPoolName, actions: actions})
+		}
+	}
+
+	topologies := map[string]*AgentPoolTopology{}
+	for _, agentPool := range ku.sortedAgentPools() {
+		topologies[*agentPool.Name] = agentPool
+	}
+	for _, app := range ku.DataModel.Properties.AgentPoolProfiles {
+		if app.IsVirtualMachineScaleSets() {
+			continue
+		}
+		actions, err := ku.repairAgentPoolActions(topologies[app.Name], app, nodes)
+		if err != nil {
+			return nil, err
+		}
+		if len(actions) > 0 {
+			pools = append(pools, poolRepair{name: app.Name, actions: actions})
+		}
+	}
+	return pools, nil
+}
+
+// unrepairedAgentPools returns the names of the agent pools repair does not support, which are the scale set pools
+func (ku *Upgrader) unrepairedAgentPools() []string {
+	pools := []string{}
+	for _, app := range ku.DataModel.Properties.AgentPoolProfiles {
+		if app.IsVirtualMachineScaleSets() {
+			pools = append(pools, app.Name)
+		}
+	}
+	return pools
+}
+
+// clusterNodes returns the nodes registered with the api server by name
+func (ku *Upgrader) clusterNodes() (map[string]*v1.Node, error) {
+	timeout := defaultTimeout
+	if ku.stepTimeout != nil {
+		timeout = *ku.stepTimeout
+	}
+	client, err := ku.getKubernetesClient(timeout)
+	if err != nil {
+		return nil, err
+	}
+	nodeList, err := client.ListNodes()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing the nodes of the cluster")
+	}
+	nodes := make(map[string]*v1.Node, len(nodeList.Items))
+	for i := range nodeList.Items {
+		nodes[nodeList.Items[i].Name] = &nodeList.Items[i]
+	}
+	return nodes, nil
+}
+
+// repairMasterActions returns the node operations that recreate the missing and unhealthy masters.
+// Masters are recreated one at a time, so etcd keeps its quorum.
+func (ku *Upgrader) repairMasterActions(nodes map[string]*v1.Node) []nodeAction {
+	masterVMs := make(map[int]compute.VirtualMachine)
+	for _, vm := range append(append([]compute.VirtualMachine{}, *ku.ClusterTopology.MasterVMs...), *ku.ClusterTopology.UpgradedMasterVMs...) {
+		masterIndex, _ := utils.GetVMNameIndex(vm.StorageProfile.OsDisk.OsType, *vm.Name)
+		masterVMs[masterIndex] = vm
+	}
+
+	var actions []nodeAction
+	vmPrefix := ku.DataModel.Properties.GetMasterVMPrefix()
+	for masterIndex := 0; masterIndex < ku.DataModel.Properties.MasterProfile.Count; masterIndex++ {
+		vm, found := masterVMs[masterIndex]
+		if !found {
+			vmName := vmPrefix + strconv.Itoa(masterIndex)
+			ku.logger.Infof("Master VM %s is missing and will be recreated", vmName)
+			actions = append(actions, nodeAction{create: true, name: vmName, index: masterIndex, batch: len(actions)})
+			continue
+		}
+		if reason := unhealthyReason(vm, nodes); reason != "" {
+			ku.logger.Infof("Master VM %s will be recreated, %s", *vm.Name, reason)
+			actions = append(actions,
+				nodeAction{name: *vm.Name, index: masterIndex, batch: len(actions)},
+				nodeAction{create: true, name: *vm.Name, index: masterIndex, batch: len(actions) + 1})
+		}
+	}
+	return actions
+}
+
+// repairAgentPoolActions returns the node operations that recreate the missing and unhealthy agents of an availability
+// set pool. Unhealthy agents are drained and deleted together, then recreated along with the missing ones. Missing
+// agents get the index of the nodes their deleted VM left behind, then the lowest free indexes up to the pool count.
+func (ku *Upgrader) repairAgentPoolActions(agentPool *AgentPoolTopology, agentPoolProfile *api.AgentPoolProfile, nodes map[string]*v1.Node) ([]nodeAction, error) {
+	var deletes, creates []nodeAction
+	agentVMs := make(map[int]bool)
+	if agentPool != nil {
+		for _, vm := range append(append([]compute.VirtualMachine{}, *agentPool.AgentVMs...), *agentPool.UpgradedAgentVMs...) {
+			agentIndex, _ := utils.GetVMNameIndex(vm.StorageProfile.OsDisk.OsType, *vm.Name)
+			agentVMs[agentIndex] = true
+			if reason := unhealthyReason(vm, nodes); reason != "" {
+				ku.logger.Infof("Agent VM %s will be recreated, %s", *vm.Name, reason)
+				deletes = append(deletes, nodeAction{drain: true, name: *vm.Name, index: agentIndex})
+				creates = append(creates, nodeAction{create: true, name: *vm.Name, index: agentIndex})
+			}
+		}
+	}
+
+	missing := agentPoolProfile.Count - len(agentVMs)
+	if missing > 0 {
+		indexes, err := ku.orphanedNodeIndexes(agentPoolProfile, nodes, agentVMs)
+		if err != nil {
+			return nil, err
+		}
+		for agentIndex := 0; len(indexes) < missing; agentIndex++ {
+			if !agentVMs[agentIndex] && !containsIndex(indexes, agentIndex) {
+				indexes = append(indexes, agentIndex)
+			}
+		}
+		for _, agentIndex := range indexes[:missing] {
+			vmName, err := utils.GetK8sVMName(ku.DataModel.Properties, agentPoolProfile, agentIndex)
+			if err != nil {
+				ku.logger.Errorf("Error reconstructing agent VM name with index %d: %v", agentIndex, err)
+				return nil, err
+			}
+			ku.logger.Infof("Agent VM %s is missing and will be recreated", vmName)
+			creates = append(creates, nodeAction{create: true, name: vmName, index: agentIndex})
+		}
+	}
+
+	batch := 0
+	if len(deletes) > 0 {
+		batch = 1
+	}
+	for i := range creates {
+		creates[i].batch = batch
+	}
+	return append(deletes, creates...), nil
+}
+
+// orphanedNodeIndexes returns the sorted indexes of the nodes of an agent pool that no VM runs anymore
+func (ku *Upgrader) orphanedNodeIndexes(agentPoolProfile *api.AgentPoolProfile, nodes map[string]*v1.Node, agentVMs map[int]bool) ([]int, error) {
+	indexes := []int{}
+	for name := range nodes {
+		_, _, agentIndex, err := utils.K8sLinuxVMNameParts(name)
+		if err != nil {
+			if _, _, _, agentIndex, err = utils.WindowsVMNameParts(name); err != nil {
+				continue
+			}
+		}
+		if agentVMs[agentIndex] || containsIndex(indexes, agentIndex) {
+			continue
+		}
+		vmName, err := utils.GetK8sVMName(ku.DataModel.Properties, agentPoolProfile, agentIndex)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(vmName, name) {
+			indexes = append(indexes, agentIndex)
+		}
+	}
+	sort.Ints(indexes)
+	return indexes, nil
+}
+
+// unhealthyReason returns why a VM has to be recreated, or an empty string if it is healthy. VMs that ARM is still
+// creating, updating or deleting are left alone, as are VMs whose node cannot be known when nodes is nil.
+func unhealthyReason(vm compute.VirtualMachine, nodes map[string]*v1.Node) string {
+	if vm.VirtualMachineProperties != nil {
+		switch to.String(vm.VirtualMachineProperties.ProvisioningState) {
+		case "Failed":
+			return "its provisioning failed"
+		case "Creating", "Updating", "Deleting":
+			return ""
+		}
+	}
+	if nodes == nil {
+		return ""
+	}
+	node, found := nodes[strings.ToLower(*vm.Name)]
+	if !found {
+		return "its node is not registered"
+	}
+	if !isNodeReady(node) {
+		return "its node is not Ready"
+	}
+	return ""
+}
+
+func containsIndex(indexes []int, index int) bool {
+	for _, i := range indexes {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package kubernetesupgrade
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/Azure/aks-engine/pkg/engine"
+	"github.com/Azure/aks-engine/pkg/engine/transform"
+	"github.com/pkg/errors"
+)
+
+// RollbackSnapshot is the state of a cluster before an upgrade, recorded in the upgrade checkpoint so that
+// nodes can be recreated at the previous version. It holds no secure parameters: the secrets and private keys
+// are generated again from the api model when rolling back.
+type RollbackSnapshot struct {
+	OrchestratorVersion string                 `json:"orchestratorVersion"`
+	Template            map[string]interface{} `json:"template"`
+	Parameters          map[string]interface{} `json:"parameters"`
+}
+
+// NewRollbackSnapshot returns the snapshot of a cluster running orchestratorVersion that was deployed with the
+// passed in ARM template and parameters. The parameters may be given as azuredeploy.parameters.json contents.
+// The parameters the template declares as securestring or secureobject are left out of the snapshot.
+func NewRollbackSnapshot(orchestratorVersion string, template, parameters map[string]interface{}) *RollbackSnapshot {
+	if wrapped, ok := parameters["parameters"].(map[string]interface{}); ok && parameters["$schema"] != nil {
+		parameters = wrapped
+	}
+	kept := map[string]interface{}{}
+	for name, value := range parameters {
+		if !engine.IsSecureParameter(template, name) {
+			kept[name] = value
+		}
+	}
+	return &RollbackSnapshot{
+		OrchestratorVersion: orchestratorVersion,
+		Template:            template,
+		Parameters:          kept,
+	}
+}
+
+// LoadRollbackSnapshot returns the snapshot recorded in the checkpoint of an unfinished upgrade
+func LoadRollbackSnapshot(checkpointPath string) (*RollbackSnapshot, error) {
+	contents, err := ioutil.ReadFile(checkpointPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading upgrade checkpoint, there is no unfinished upgrade to roll back")
+	}
+	c := &checkpoint{}
+	if err = json.Unmarshal(contents, c); err != nil {
+		return nil, errors.Wrapf(err, "error parsing upgrade checkpoint %s", checkpointPath)
+	}
+	if c.Rollback == nil {
+		return nil, errors.Errorf("upgrade checkpoint %s does not record the state of the cluster before the upgrade", checkpointPath)
+	}
+	return c.Rollback, nil
+}
+
+// SetRollbackSnapshot records the state of the cluster before the upgrade in the checkpoint, so that a master
+// that fails to upgrade is recreated at the previous version. A snapshot recorded by a resumed upgrade is kept.
+func (ku *Upgrader) SetRollbackSnapshot(snapshot *RollbackSnapshot) {
+	if ku.checkpoint.Rollback == nil {
+		ku.checkpoint.Rollback = snapshot
+	}
+}
+
+// InitRollbackCheckpoint makes the upgrader revert the cluster to the snapshot recorded before an upgrade.
+// The checkpoint of the failed upgrade at path is replaced, unless it belongs to an interrupted rollback.
+func (ku *Upgrader) InitRollbackCheckpoint(path string, snapshot *RollbackSnapshot) error {
+	c, err := loadCheckpoint(path, snapshot.OrchestratorVersion)
+	if err == nil {
+		ku.logger.Infof("Resuming rollback from checkpoint %s", path)
+	} else {
+		c = &checkpoint{
+			UpgradeVersion: snapshot.OrchestratorVersion,
+			Pools:          []*poolCheckpoint{},
+			path:           path,
+		}
+	}
+	c.Rollback = snapshot
+	ku.checkpoint = c
+	ku.rollingBack = true
+	return nil
+}
+
+// snapshotTemplate returns copies of the ARM template and parameters recorded before the upgrade, with the secure
+// parameters the snapshot leaves out generated again from the api model
+func (ku *Upgrader) snapshotTemplate() (map[string]interface{}, map[string]interface{}, error) {
+	snapshot := ku.checkpoint.Rollback
+	templateMap, err := copyTemplate(snapshot.Template)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error copying the rollback template")
+	}
+	parametersMap, err := copyTemplate(snapshot.Parameters)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error copying the rollback parameters")
+	}
+	definitions, _ := templateMap["parameters"].(map[string]interface{})
+	for name := range definitions {
+		if _, ok := parametersMap[name]; ok || !engine.IsSecureParameter(templateMap, name) {
+			continue
+		}
+		if ku.secureParameters == nil {
+			if _, ku.secureParameters, err = ku.generateUpgradeTemplate(ku.ClusterTopology.DataModel, ku.AKSEngineVersion); err != nil {
+				return nil, nil, errors.Wrap(err, "error generating the secure parameters of the rollback template")
+			}
+		}
+		if value, ok := ku.secureParameters[name]; ok {
+			parametersMap[name] = value
+		}
+	}
+	return templateMap, parametersMap, nil
+}
+
+// rollbackMasterNode recreates a master that failed to upgrade from the snapshot of the cluster before the upgrade,
+// so the cluster keeps all of its masters. The master pool is planned again when the upgrade is resumed.
+func (ku *Upgrader) rollbackMasterNode(ctx context.Context, step *checkpointStep, cause error) error {
+	version := ku.checkpoint.Rollback.OrchestratorVersion
+	ku.logger.Warnf("Master VM %s failed to upgrade, recreating it at Kubernetes version %s", step.VM, version)
+
+	templateMap, parametersMap, err := ku.snapshotTemplate()
+	if err != nil {
+		return err
+	}
+	transformer := &transform.Transformer{
+		Translator: ku.Translator,
+	}
+	if err = transformer.NormalizeResourcesForK8sMasterUpgrade(ku.logger, templateMap, ku.DataModel.Properties.MasterProfile.IsManagedDisks(), nil); err != nil {
+		return errors.Wrapf(err, "error rolling back master VM %s after it failed to upgrade (%v)", step.VM, cause)
+	}
+	node := ku.newMasterNode(templateMap, parametersMap)
+
+	vmName := step.VM
+	deleted, err := ku.vmDeleted(vmName)
+	if err == nil && !deleted {
+		err = node.DeleteNode(&vmName, false)
+	}
+	if err == nil {
+		err = node.CreateNode(ctx, MasterPoolName, step.Index)
+	}
+	if err == nil {
+		err = node.Validate(&vmName)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error rolling back master VM %s after it failed to upgrade (%v)", step.VM, cause)
+	}
+
+	if err = ku.checkpoint.removePool(MasterPoolName); err != nil {
+		return err
+	}
+	return errors.Wrapf(cause, "master VM %s failed to upgrade and was recreated at Kubernetes version %s", step.VM, version)
+}
@@ -38,6 +38,8 @@ type UpgradeAgentNode struct {
 	Client                  armhelpers.AKSEngineClient
 	kubeConfig              string
 	timeout                 time.Duration
+	events                  *operations.EventStream
+	poolName                string
 }
 
 // DeleteNode takes state/resources of the master/agent node from ListNodeResources
@@ -63,6 +65,8 @@ func (kan *UpgradeAgentNode) DeleteNode(vmName *string, drain bool) error {
 		if err != nil {
 			kan.logger.Warningf("Error draining agent VM %s. Proceeding with deletion. Error: %v", *vmName, err)
 			// Proceed with deletion anyways
+		} else {
+			kan.events.Emit(operations.Event{Type: operations.EventNodeDrained, Pool: kan.poolName, Node: *vmName})
 		}
 	}
 	// Delete VM in ARM
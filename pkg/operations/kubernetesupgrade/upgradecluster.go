@@ -6,6 +6,7 @@ package kubernetesupgrade
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/Azure/aks-engine/pkg/armhelpers"
 	"github.com/Azure/aks-engine/pkg/armhelpers/utils"
 	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/aks-engine/pkg/operations"
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -66,6 +68,28 @@ type UpgradeCluster struct {
 	ClusterTopology
 	Client      armhelpers.AKSEngineClient
 	StepTimeout *time.Duration
+	// CheckpointPath is the file the upgrade records its progress in. Progress is not persisted if empty.
+	CheckpointPath string
+	// Resume continues the upgrade recorded in CheckpointPath
+	Resume bool
+	// DiscardCheckpoint deletes the checkpoint of an unfinished upgrade in CheckpointPath and starts over
+	DiscardCheckpoint bool
+	// MaxSurge and MaxUnavailable override the upgrade settings of every agent pool when set
+	MaxSurge       *int
+	MaxUnavailable *int
+	// HealthChecks replace the default health gates of the upgrade when not nil. An empty list disables them.
+	HealthChecks []operations.HealthCheck
+	// RollbackSnapshot is the state of the cluster before the upgrade. Masters that fail to upgrade are recreated from it.
+	RollbackSnapshot *RollbackSnapshot
+	// Rollback reverts the cluster to RollbackSnapshot instead of upgrading it. The pre-flight health checks are
+	// not run, a partially upgraded cluster is expected to fail them, but the checks gate every batch of nodes.
+	Rollback bool
+	// Events receives the phases of the upgrade and the nodes it replaces when not nil
+	Events *operations.EventStream
+
+	// repairing is set while the topology of a cluster being repaired is loaded, its nodes already run the
+	// version of the api model
+	repairing bool
 }
 
 // MasterVMNamePrefix is the prefix for all master VM names for Kubernetes clusters
@@ -76,29 +100,87 @@ const MasterPoolName = "master"
 
 // UpgradeCluster runs the workflow to upgrade a Kubernetes cluster.
 func (uc *UpgradeCluster) UpgradeCluster(az armhelpers.AKSEngineClient, kubeConfig string, aksEngineVersion string) error {
-	uc.MasterVMs = &[]compute.VirtualMachine{}
-	uc.UpgradedMasterVMs = &[]compute.VirtualMachine{}
-	uc.AgentPools = make(map[string]*AgentPoolTopology)
+	if uc.Rollback {
+		if uc.RollbackSnapshot == nil {
+			return errors.New("the state of the cluster before the upgrade is required to roll it back")
+		}
+		uc.DataModel.Properties.OrchestratorProfile.OrchestratorVersion = uc.RollbackSnapshot.OrchestratorVersion
+	}
 
-	if err := uc.getClusterNodeStatus(az, uc.ResourceGroup, kubeConfig); err != nil {
-		return uc.Translator.Errorf("Error while querying ARM for resources: %+v", err)
+	if err := uc.Events.Phase("load-cluster-topology", func() error { return uc.loadClusterTopology(az, kubeConfig) }); err != nil {
+		return err
 	}
 
 	var upgrader UpgradeWorkFlow
 	upgradeVersion := uc.DataModel.Properties.OrchestratorProfile.OrchestratorVersion
-	uc.Logger.Infof("Upgrading to Kubernetes version %s\n", upgradeVersion)
 	u := &Upgrader{}
 	u.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, kubeConfig, uc.StepTimeout, aksEngineVersion)
+	if uc.Rollback {
+		uc.Logger.Infof("Rolling back to Kubernetes version %s\n", upgradeVersion)
+		if err := u.InitRollbackCheckpoint(uc.CheckpointPath, uc.RollbackSnapshot); err != nil {
+			return err
+		}
+	} else {
+		uc.Logger.Infof("Upgrading to Kubernetes version %s\n", upgradeVersion)
+		if uc.DiscardCheckpoint && uc.CheckpointPath != "" {
+			if err := os.Remove(uc.CheckpointPath); err != nil && !os.IsNotExist(err) {
+				return errors.Wrap(err, "error discarding the upgrade checkpoint")
+			}
+		}
+		if err := u.InitCheckpoint(uc.CheckpointPath, uc.Resume); err != nil {
+			return err
+		}
+		if uc.RollbackSnapshot != nil {
+			u.SetRollbackSnapshot(uc.RollbackSnapshot)
+		}
+	}
+	u.SetAgentPoolUpgradeSettings(uc.MaxSurge, uc.MaxUnavailable)
+	u.SetEventStream(uc.Events)
+	if uc.HealthChecks != nil {
+		u.SetHealthChecks(uc.HealthChecks)
+	}
 	upgrader = u
 
 	if err := upgrader.RunUpgrade(); err != nil {
 		return err
 	}
 
+	if err := upgrader.Validate(); err != nil {
+		return err
+	}
+
+	if uc.Rollback {
+		uc.Logger.Infof("Cluster rolled back successfully to Kubernetes version %s\n", upgradeVersion)
+		return nil
+	}
 	uc.Logger.Infof("Cluster upgraded successfully to Kubernetes version %s\n", upgradeVersion)
 	return nil
 }
 
+// PlanUpgrade returns the steps UpgradeCluster would take to upgrade the cluster, without changing it.
+// deployedTemplate and deployedParameters are the ARM template and parameters the cluster was last deployed with.
+func (uc *UpgradeCluster) PlanUpgrade(az armhelpers.AKSEngineClient, kubeConfig string, aksEngineVersion string, deployedTemplate, deployedParameters map[string]interface{}) (*operations.Plan, error) {
+	if err := uc.loadClusterTopology(az, kubeConfig); err != nil {
+		return nil, err
+	}
+
+	u := &Upgrader{}
+	u.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, kubeConfig, uc.StepTimeout, aksEngineVersion)
+	u.SetAgentPoolUpgradeSettings(uc.MaxSurge, uc.MaxUnavailable)
+	return u.Plan(deployedTemplate, deployedParameters)
+}
+
+func (uc *UpgradeCluster) loadClusterTopology(az armhelpers.AKSEngineClient, kubeConfig string) error {
+	uc.MasterVMs = &[]compute.VirtualMachine{}
+	uc.UpgradedMasterVMs = &[]compute.VirtualMachine{}
+	uc.AgentPools = make(map[string]*AgentPoolTopology)
+
+	if err := uc.getClusterNodeStatus(az, uc.ResourceGroup, kubeConfig); err != nil {
+		return uc.Translator.Errorf("Error while querying ARM for resources: %+v", err)
+	}
+	return nil
+}
+
 func (uc *UpgradeCluster) getClusterNodeStatus(az armhelpers.AKSEngineClient, resourceGroup, kubeConfig string) error {
 	goalVersion := uc.DataModel.Properties.OrchestratorProfile.OrchestratorVersion
 
@@ -178,7 +260,9 @@ func (uc *UpgradeCluster) getClusterNodeStatus(az armhelpers.AKSEngineClient, re
 			}
 
 			// Skip the VM upgrade validation for managed clusters as it only applies to aks-engine version support.
-			if !uc.DataModel.Properties.IsHostedMasterProfile() {
+			// A rollback returns nodes to the version they were upgraded from, which is never an upgrade.
+			// A repair recreates nodes at the version they already run.
+			if !uc.DataModel.Properties.IsHostedMasterProfile() && !uc.Rollback && !uc.repairing {
 				if err := uc.upgradable(currentVersion); err != nil {
 					return err
 				}
@@ -4,18 +4,31 @@
 package kubernetesupgrade
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
 	"os"
+	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"fmt"
 
 	"github.com/Azure/aks-engine/pkg/api"
 	"github.com/Azure/aks-engine/pkg/armhelpers"
 	"github.com/Azure/aks-engine/pkg/i18n"
+	"github.com/Azure/aks-engine/pkg/operations"
 	. "github.com/Azure/aks-engine/pkg/test"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-04-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
 const TestAKSEngineVersion = "1.0.0"
@@ -56,6 +69,50 @@ var _ = Describe("Upgrade Kubernetes cluster tests", func() {
 		os.RemoveAll("./translations")
 	})
 
+	It("Should report the phases of the upgrade and the nodes it replaces to the event stream", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 1, 1, false)
+		out := &bytes.Buffer{}
+		uc := UpgradeCluster{
+			Translator: &i18n.Translator{},
+			Logger:     log.NewEntry(log.New()),
+			Events:     operations.NewEventStream(out),
+		}
+
+		mockClient := armhelpers.MockAKSEngineClient{}
+		uc.Client = &mockClient
+
+		uc.ClusterTopology = ClusterTopology{}
+		uc.SubscriptionID = "DEC923E3-1EF1-4745-9516-37906D56DEC4"
+		uc.ResourceGroup = "TestRg"
+		uc.DataModel = cs
+		uc.NameSuffix = "12345678"
+		uc.AgentPoolsToUpgrade = map[string]bool{"agentpool1": true}
+
+		err := uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).To(BeNil())
+
+		types := map[operations.EventType]int{}
+		phases := []string{}
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			e := operations.Event{}
+			Expect(json.Unmarshal([]byte(line), &e)).To(Succeed())
+			types[e.Type]++
+			if e.Type == operations.EventNodeDrained {
+				Expect(e.Pool).To(Equal("agentpool1"))
+			}
+			if e.Type == operations.EventPhaseFinished {
+				Expect(e.Status).To(Equal(operations.EventStatusSucceeded))
+				phases = append(phases, e.Phase)
+			}
+		}
+		Expect(phases).To(Equal([]string{"load-cluster-topology", "pre-flight-health-checks", "upgrade-master-nodes",
+			"upgrade-agent-scale-sets", "upgrade-agent-pools", "post-upgrade-health-checks"}))
+		Expect(types[operations.EventVMDeleted]).To(BeNumerically(">", 0))
+		Expect(types[operations.EventNodeDrained]).To(BeNumerically(">", 0))
+		Expect(types[operations.EventVMCreated]).To(BeNumerically(">", 0))
+		Expect(types[operations.EventNodeReady]).To(Equal(types[operations.EventVMCreated]))
+	})
+
 	It("Should return error message when failing to list VMs during upgrade operation", func() {
 		cs := api.CreateMockContainerService("testcluster", "1.7.14", 1, 1, false)
 		uc := UpgradeCluster{
@@ -268,4 +325,646 @@ var _ = Describe("Upgrade Kubernetes cluster tests", func() {
 		err := uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
 		Expect(err).To(BeNil())
 	})
+
+	It("Should checkpoint a failed upgrade and resume it where it stopped", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 1, 1, false)
+		uc := UpgradeCluster{
+			Translator: &i18n.Translator{},
+			Logger:     log.NewEntry(log.New()),
+		}
+
+		mockClient := armhelpers.MockAKSEngineClient{}
+		mockClient.FailDeleteVirtualMachine = true
+		uc.Client = &mockClient
+
+		uc.ClusterTopology = ClusterTopology{}
+		uc.SubscriptionID = "DEC923E3-1EF1-4745-9516-37906D56DEC4"
+		uc.ResourceGroup = "TestRg"
+		uc.DataModel = cs
+		uc.NameSuffix = "12345678"
+		uc.AgentPoolsToUpgrade = map[string]bool{"agentpool1": true}
+
+		Expect(os.MkdirAll("_output", 0755)).To(Succeed())
+		uc.CheckpointPath = path.Join("_output", CheckpointFilename)
+
+		err := uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(Equal("DeleteVirtualMachine failed"))
+
+		c, err := loadCheckpoint(uc.CheckpointPath, "1.7.16")
+		Expect(err).To(BeNil())
+		Expect(c.Pools).To(HaveLen(2))
+		Expect(c.Pools[0].Name).To(Equal(MasterPoolName))
+		Expect(c.Pools[0].completed()).To(BeTrue())
+		Expect(c.Pools[1].Name).To(Equal("agentpool1"))
+		Expect(c.Pools[1].Steps).To(HaveLen(2))
+		Expect(c.Pools[1].Steps[0].Action).To(Equal(stepCreate))
+		Expect(c.Pools[1].Steps[0].Status).To(Equal(stepCompleted))
+		Expect(*c.Pools[1].Steps[1]).To(Equal(checkpointStep{Action: stepDrain, VM: "k8s-agentpool1-12345678-0", Batch: 1, Status: stepStarted}))
+
+		// a new upgrade must not discard the progress of the failed one
+		err = uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("found the checkpoint of an unfinished upgrade"))
+
+		// nodes that were already created are not deployed again when resuming, and the cluster left unhealthy by
+		// the interrupted upgrade does not fail the pre-flight checks
+		mockClient.FailDeleteVirtualMachine = false
+		mockClient.FailDeployTemplate = true
+		uc.Resume = true
+		checks := 0
+		uc.HealthChecks = []operations.HealthCheck{{Name: "nodes", Check: func(client armhelpers.KubernetesClient) error {
+			checks++
+			if checks == 1 {
+				return errors.New("a node is missing")
+			}
+			return nil
+		}}}
+		err = uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).To(BeNil())
+		Expect(checks).To(BeNumerically(">", 1))
+		_, err = os.Stat(uc.CheckpointPath)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("Should discard the checkpoint of an unfinished upgrade when asked to", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 1, 1, false)
+		uc := UpgradeCluster{
+			Translator: &i18n.Translator{},
+			Logger:     log.NewEntry(log.New()),
+		}
+
+		mockClient := armhelpers.MockAKSEngineClient{}
+		uc.Client = &mockClient
+
+		uc.ClusterTopology = ClusterTopology{}
+		uc.SubscriptionID = "DEC923E3-1EF1-4745-9516-37906D56DEC4"
+		uc.ResourceGroup = "TestRg"
+		uc.DataModel = cs
+		uc.NameSuffix = "12345678"
+		uc.AgentPoolsToUpgrade = map[string]bool{"agentpool1": true}
+
+		Expect(os.MkdirAll("_output", 0755)).To(Succeed())
+		uc.CheckpointPath = path.Join("_output", CheckpointFilename)
+		c, err := newCheckpoint(uc.CheckpointPath, "1.7.14")
+		Expect(err).To(BeNil())
+		_, err = c.addPool(MasterPoolName, []*checkpointStep{{Action: stepDelete, VM: "k8s-master-12345678-0"}})
+		Expect(err).To(BeNil())
+
+		err = uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("discard it with --discard-checkpoint"))
+
+		uc.DiscardCheckpoint = true
+		err = uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).To(BeNil())
+		_, err = os.Stat(uc.CheckpointPath)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("Should resume replacing a VMSS instance whose node was already deleted", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 1, 1, false)
+		mockClient := &armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{
+			GetNodeFunc: func(name string) (*v1.Node, error) {
+				return nil, apierrors.NewNotFound(v1.Resource("nodes"), name)
+			},
+		}}
+		topology := ClusterTopology{
+			DataModel:     cs,
+			ResourceGroup: "TestRg",
+			AgentPoolScaleSetsToUpgrade: []AgentPoolScaleSet{{
+				Name:         "k8s-agentpool1-12345678-vmss",
+				Sku:          compute.Sku{Capacity: to.Int64Ptr(1)},
+				VMsToUpgrade: []AgentPoolScaleSetVM{{Name: "k8s-agentpool1-12345678-vmss000000", InstanceID: "0"}},
+			}},
+		}
+		out := &bytes.Buffer{}
+		u := &Upgrader{}
+		u.Init(&i18n.Translator{}, log.NewEntry(log.New()), topology, mockClient, "kubeConfig", nil, TestAKSEngineVersion)
+		u.SetEventStream(operations.NewEventStream(out))
+		u.healthChecks = []operations.HealthCheck{}
+		Expect(u.InitCheckpoint("", false)).To(Succeed())
+		template, err := u.checkpoint.addPool(scaleSetTemplatePool, []*checkpointStep{{Action: stepDeploy}})
+		Expect(err).To(BeNil())
+		Expect(u.checkpoint.setStatus(template.Steps[0], stepCompleted)).To(Succeed())
+		pool, err := u.checkpoint.addPool("k8s-agentpool1-12345678-vmss", []*checkpointStep{{Action: stepReplace, VM: "k8s-agentpool1-12345678-vmss000000", InstanceID: "0", Capacity: 2}})
+		Expect(err).To(BeNil())
+
+		// a missing node is an error when the instance has not been replaced yet
+		err = u.upgradeAgentScaleSets(context.Background())
+		Expect(err).NotTo(BeNil())
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		// the step was interrupted after the instance was deleted
+		Expect(pool.Steps[0].Status).To(Equal(stepStarted))
+		err = u.upgradeAgentScaleSets(context.Background())
+		Expect(err).To(BeNil())
+		Expect(pool.Steps[0].Status).To(Equal(stepCompleted))
+		Expect(out.String()).NotTo(ContainSubstring(string(operations.EventNodeDrained)))
+		Expect(out.String()).To(ContainSubstring(string(operations.EventVMDeleted)))
+	})
+
+	It("Should not resume an upgrade to a different version", func() {
+		Expect(os.MkdirAll("_output", 0755)).To(Succeed())
+		checkpointPath := path.Join("_output", CheckpointFilename)
+		c, err := newCheckpoint(checkpointPath, "1.7.14")
+		Expect(err).To(BeNil())
+		_, err = c.addPool(MasterPoolName, []*checkpointStep{{Action: stepDelete, VM: "k8s-master-12345678-0"}})
+		Expect(err).To(BeNil())
+
+		_, err = loadCheckpoint(checkpointPath, "1.7.16")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(Equal("upgrade checkpoint _output/upgrade-checkpoint.json is for Kubernetes version 1.7.14, not 1.7.16"))
+	})
+
+	It("Should replace agent nodes in batches of maxSurge plus maxUnavailable", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 1, 4, false)
+		agentPoolProfile := cs.Properties.AgentPoolProfiles[0]
+		agentPoolProfile.MaxSurge = to.IntPtr(2)
+		agentPoolProfile.MaxUnavailable = to.IntPtr(1)
+
+		agentVMs := []compute.VirtualMachine{}
+		for i := 0; i < 4; i++ {
+			agentVMs = append(agentVMs, compute.VirtualMachine{
+				Name: to.StringPtr(fmt.Sprintf("k8s-agentpool1-12345678-%d", i)),
+				VirtualMachineProperties: &compute.VirtualMachineProperties{
+					StorageProfile: &compute.StorageProfile{
+						OsDisk: &compute.OSDisk{OsType: compute.Linux},
+					},
+				},
+			})
+		}
+		agentPool := &AgentPoolTopology{
+			Identifier:       to.StringPtr("agentpool1"),
+			Name:             to.StringPtr("agentpool1"),
+			AgentVMs:         &agentVMs,
+			UpgradedAgentVMs: &[]compute.VirtualMachine{},
+		}
+
+		u := &Upgrader{}
+		u.Init(&i18n.Translator{}, log.NewEntry(log.New()), ClusterTopology{DataModel: cs}, nil, "kubeConfig", nil, TestAKSEngineVersion)
+		actions, err := u.agentPoolActions(agentPool, 4, agentPoolProfile)
+		Expect(err).To(BeNil())
+
+		type batchedAction struct {
+			create bool
+			drain  bool
+			index  int
+			batch  int
+		}
+		batched := []batchedAction{}
+		for _, a := range actions {
+			batched = append(batched, batchedAction{create: a.create, drain: a.drain, index: a.index, batch: a.batch})
+		}
+		Expect(batched).To(Equal([]batchedAction{
+			// surge nodes
+			{create: true, index: 4, batch: 0},
+			{create: true, index: 5, batch: 0},
+			// first batch of maxSurge+maxUnavailable nodes, the last two are not recreated in favor of the surge nodes
+			{drain: true, index: 0, batch: 1},
+			{drain: true, index: 1, batch: 1},
+			{drain: true, index: 2, batch: 1},
+			{create: true, index: 0, batch: 2},
+			{create: true, index: 1, batch: 2},
+			{drain: true, index: 3, batch: 3},
+		}))
+
+		// the upgrade command settings override the api model
+		u.SetAgentPoolUpgradeSettings(to.IntPtr(0), to.IntPtr(0))
+		_, err = u.agentPoolActions(agentPool, 4, agentPoolProfile)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(Equal("invalid upgrade settings for agent pool agentpool1: maxSurge 0, maxUnavailable 0"))
+
+		u.SetAgentPoolUpgradeSettings(nil, nil)
+		agentPoolProfile.MaxSurge = nil
+		agentPoolProfile.MaxUnavailable = nil
+		actions, err = u.agentPoolActions(agentPool, 4, agentPoolProfile)
+		Expect(err).To(BeNil())
+		// by default nodes are replaced one at a time
+		Expect(actions).To(HaveLen(8))
+		for i, a := range actions {
+			Expect(a.batch).To(Equal(i))
+		}
+	})
+
+	It("Should run the node steps of a batch concurrently", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 1, 1, false)
+		u := &Upgrader{}
+		u.Init(&i18n.Translator{}, log.NewEntry(log.New()), ClusterTopology{DataModel: cs}, &armhelpers.MockAKSEngineClient{}, "kubeConfig", nil, TestAKSEngineVersion)
+		Expect(u.InitCheckpoint("", false)).To(Succeed())
+		pool, err := u.checkpoint.addPool("agentpool1", []*checkpointStep{
+			{Action: stepCreate, VM: "vm-2", Index: 2, Batch: 0},
+			{Action: stepCreate, VM: "vm-3", Index: 3, Batch: 0},
+			{Action: stepDrain, VM: "vm-0", Index: 0, Batch: 1},
+		})
+		Expect(err).To(BeNil())
+
+		// both creations must be in flight at the same time to get past the barrier
+		barrier := make(chan struct{})
+		created := make(chan int, 2)
+		nodes := []*fakeUpgradeNode{}
+		newNode := func() (UpgradeNode, error) {
+			node := &fakeUpgradeNode{barrier: barrier, created: created}
+			nodes = append(nodes, node)
+			return node, nil
+		}
+		go func() {
+			<-created
+			<-created
+			close(barrier)
+		}()
+
+		Expect(u.runNodeSteps(context.Background(), newNode, "agentpool1", pool)).To(Succeed())
+		Expect(pool.completed()).To(BeTrue())
+		Expect(nodes).To(HaveLen(3))
+		Expect(nodes[2].deleted).To(Equal("vm-0"))
+	})
+
+	It("Should not start an upgrade when the pre-flight health checks fail", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 1, 1, false)
+		uc := UpgradeCluster{
+			Translator: &i18n.Translator{},
+			Logger:     log.NewEntry(log.New()),
+		}
+
+		mockClient := armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{}}
+		mockClient.MockKubernetesClient.FailListPodDisruptionBudgets = true
+		mockClient.FailDeleteVirtualMachine = true
+		mockClient.FailDeployTemplate = true
+		uc.Client = &mockClient
+
+		uc.ClusterTopology = ClusterTopology{}
+		uc.SubscriptionID = "DEC923E3-1EF1-4745-9516-37906D56DEC4"
+		uc.ResourceGroup = "TestRg"
+		uc.DataModel = cs
+		uc.NameSuffix = "12345678"
+		uc.AgentPoolsToUpgrade = map[string]bool{"agentpool1": true}
+
+		err := uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(Equal("pre-flight health checks failed, the upgrade was not started: cluster health checks failed:\n" +
+			"  - pod disruption budgets allow disruptions: error listing pod disruption budgets: ListPodDisruptionBudgets failed"))
+
+		// the health checks can be disabled
+		uc.HealthChecks = []operations.HealthCheck{}
+		err = uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(Equal("DeployTemplate failed"))
+	})
+
+	It("Should stop the upgrade when a health check fails between nodes", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 3, 1, false)
+		timeout := 10 * time.Millisecond
+		u := &Upgrader{}
+		u.Init(&i18n.Translator{}, log.NewEntry(log.New()), ClusterTopology{DataModel: cs}, &armhelpers.MockAKSEngineClient{}, "kubeConfig", &timeout, TestAKSEngineVersion)
+		Expect(u.InitCheckpoint("", false)).To(Succeed())
+		pool, err := u.checkpoint.addPool(MasterPoolName, []*checkpointStep{
+			{Action: stepDelete, VM: "k8s-master-12345678-0", Index: 0, Batch: 0},
+			{Action: stepCreate, VM: "k8s-master-12345678-0", Index: 0, Batch: 1},
+			{Action: stepDelete, VM: "k8s-master-12345678-1", Index: 1, Batch: 2},
+			{Action: stepCreate, VM: "k8s-master-12345678-1", Index: 1, Batch: 3},
+		})
+		Expect(err).To(BeNil())
+
+		// the api server of a cluster whose master was just deleted is not checked
+		checked := []string{}
+		u.SetHealthChecks([]operations.HealthCheck{{Name: "etcd members are healthy", Check: func(client armhelpers.KubernetesClient) error {
+			for _, step := range pool.Steps {
+				if step.Status != stepCompleted {
+					checked = append(checked, step.VM)
+					break
+				}
+			}
+			return fmt.Errorf("etcd-1 is unhealthy")
+		}}})
+
+		barrier := make(chan struct{})
+		close(barrier)
+		newNode := func() (UpgradeNode, error) {
+			return &fakeUpgradeNode{barrier: barrier, created: make(chan int, 1)}, nil
+		}
+		err = u.runNodeSteps(context.Background(), newNode, MasterPoolName, pool)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(Equal("health checks failed while upgrading pool master, stopping the upgrade: cluster health checks failed:\n" +
+			"  - etcd members are healthy: etcd-1 is unhealthy"))
+		Expect(checked).NotTo(BeEmpty())
+		for _, vm := range checked {
+			Expect(vm).To(Equal("k8s-master-12345678-1"))
+		}
+		Expect(pool.Steps[1].Status).To(Equal(stepCompleted))
+		Expect(pool.Steps[2].Status).To(Equal(stepPending))
+	})
+
+	It("Should recreate a master that fails to upgrade at the previous version", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 3, 1, false)
+		u := &Upgrader{}
+		u.Init(&i18n.Translator{}, log.NewEntry(log.New()), ClusterTopology{DataModel: cs}, &armhelpers.MockAKSEngineClient{}, "kubeConfig", nil, TestAKSEngineVersion)
+		Expect(u.InitCheckpoint("", false)).To(Succeed())
+		template, parameters, err := u.generateUpgradeTemplate(cs, TestAKSEngineVersion)
+		Expect(err).To(BeNil())
+		u.SetRollbackSnapshot(NewRollbackSnapshot("1.7.9", template, map[string]interface{}{
+			"$schema":        "https://schema.management.azure.com/schemas/2015-01-01/deploymentParameters.json#",
+			"contentVersion": "1.0.0.0",
+			"parameters":     parameters,
+		}))
+		// secrets and private keys are not recorded in the checkpoint, they are generated again from the api model
+		Expect(u.checkpoint.Rollback.Parameters).NotTo(HaveKey("servicePrincipalClientSecret"))
+		Expect(u.checkpoint.Rollback.Parameters).NotTo(HaveKey("caPrivateKey"))
+		Expect(u.checkpoint.Rollback.Parameters).To(HaveKeyWithValue("masterVMSize", parameters["masterVMSize"]))
+		_, snapshotParameters, err := u.snapshotTemplate()
+		Expect(err).To(BeNil())
+		Expect(snapshotParameters).To(Equal(parameters))
+		pool, err := u.checkpoint.addPool(MasterPoolName, []*checkpointStep{
+			{Action: stepDelete, VM: "k8s-master-12345678-0", Index: 0, Batch: 0},
+			{Action: stepCreate, VM: "k8s-master-12345678-0", Index: 0, Batch: 1},
+			{Action: stepDelete, VM: "k8s-master-12345678-1", Index: 1, Batch: 2},
+			{Action: stepCreate, VM: "k8s-master-12345678-1", Index: 1, Batch: 3},
+		})
+		Expect(err).To(BeNil())
+
+		barrier := make(chan struct{})
+		close(barrier)
+		newNode := func() (UpgradeNode, error) {
+			return &fakeUpgradeNode{barrier: barrier, created: make(chan int, 1), failValidate: true}, nil
+		}
+		err = u.runNodeSteps(context.Background(), newNode, MasterPoolName, pool)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(Equal("master VM k8s-master-12345678-0 failed to upgrade and was recreated at Kubernetes version 1.7.9: node was not Ready"))
+		// the master pool is planned again when the upgrade is resumed
+		Expect(u.checkpoint.pool(MasterPoolName)).To(BeNil())
+		Expect(pool.Steps[2].Status).To(Equal(stepPending))
+
+		// a master whose name is not known is not rolled back
+		Expect(u.rollbackFailedNode(context.Background(), MasterPoolName, &checkpointStep{Action: stepCreate}, fmt.Errorf("failed"))).To(MatchError("failed"))
+	})
+
+	It("Should roll back a partially upgraded cluster to the recorded version", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 1, 1, false)
+		uc := UpgradeCluster{
+			Translator: &i18n.Translator{},
+			Logger:     log.NewEntry(log.New()),
+		}
+
+		mockClient := armhelpers.MockAKSEngineClient{}
+		mockClient.FailDeleteVirtualMachine = true
+		uc.Client = &mockClient
+
+		uc.ClusterTopology = ClusterTopology{}
+		uc.SubscriptionID = "DEC923E3-1EF1-4745-9516-37906D56DEC4"
+		uc.ResourceGroup = "TestRg"
+		uc.DataModel = cs
+		uc.NameSuffix = "12345678"
+		uc.AgentPoolsToUpgrade = map[string]bool{"agentpool1": true}
+
+		Expect(os.MkdirAll("_output", 0755)).To(Succeed())
+		uc.CheckpointPath = path.Join("_output", CheckpointFilename)
+		_, err := LoadRollbackSnapshot(uc.CheckpointPath)
+		Expect(err).NotTo(BeNil())
+
+		u := &Upgrader{}
+		u.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, "kubeConfig", nil, TestAKSEngineVersion)
+		template, parameters, err := u.generateUpgradeTemplate(cs, TestAKSEngineVersion)
+		Expect(err).To(BeNil())
+		// the mocked VMs are on version 1.7.9, which is rolled back to an older version
+		uc.RollbackSnapshot = NewRollbackSnapshot("1.7.7", template, parameters)
+
+		err = uc.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(Equal("DeleteVirtualMachine failed"))
+
+		snapshot, err := LoadRollbackSnapshot(uc.CheckpointPath)
+		Expect(err).To(BeNil())
+		Expect(snapshot.OrchestratorVersion).To(Equal("1.7.7"))
+		contents, err := ioutil.ReadFile(uc.CheckpointPath)
+		Expect(err).To(BeNil())
+		Expect(string(contents)).NotTo(ContainSubstring(cs.Properties.ServicePrincipalProfile.Secret))
+		info, err := os.Stat(uc.CheckpointPath)
+		Expect(err).To(BeNil())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+		mockClient.FailDeleteVirtualMachine = false
+		rollback := uc
+		rollback.RollbackSnapshot = snapshot
+		rollback.Rollback = true
+		Expect(rollback.UpgradeCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)).To(Succeed())
+		Expect(cs.Properties.OrchestratorProfile.OrchestratorVersion).To(Equal("1.7.7"))
+		_, err = os.Stat(uc.CheckpointPath)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("Should plan an upgrade without changing the cluster", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.16", 1, 1, false)
+		cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &api.AgentPoolProfile{
+			Name:                "agentpool2",
+			Count:               1,
+			VMSize:              "Standard_D2_v2",
+			OSType:              "Linux",
+			AvailabilityProfile: "AvailabilitySet",
+			StorageProfile:      "StorageAccount",
+		})
+		uc := UpgradeCluster{
+			Translator: &i18n.Translator{},
+			Logger:     log.NewEntry(log.New()),
+		}
+
+		mockClient := armhelpers.MockAKSEngineClient{}
+		mockClient.FailDeleteVirtualMachine = true
+		mockClient.FailDeployTemplate = true
+		uc.Client = &mockClient
+
+		uc.ClusterTopology = ClusterTopology{}
+		uc.SubscriptionID = "DEC923E3-1EF1-4745-9516-37906D56DEC4"
+		uc.ResourceGroup = "TestRg"
+		uc.DataModel = cs
+		uc.NameSuffix = "12345678"
+		uc.AgentPoolsToUpgrade = map[string]bool{"agentpool1": true, "agentpool2": true}
+
+		u := &Upgrader{}
+		u.Init(uc.Translator, uc.Logger, uc.ClusterTopology, uc.Client, "kubeConfig", nil, TestAKSEngineVersion)
+		deployedTemplate, deployedParameters, err := u.generateUpgradeTemplate(cs, TestAKSEngineVersion)
+		Expect(err).To(BeNil())
+		// drop a resource from the deployed template so the plan reports it as added
+		resources := deployedTemplate["resources"].([]interface{})
+		deployedTemplate["resources"] = resources[1:]
+
+		plan, err := uc.PlanUpgrade(&mockClient, "kubeConfig", TestAKSEngineVersion, deployedTemplate, deployedParameters)
+		Expect(err).To(BeNil())
+		Expect(plan.Summary).To(Equal("Upgrade to Kubernetes version 1.7.16"))
+		Expect(plan.Steps).To(HaveLen(4))
+		// the surge node is named after the data model, not the mocked VMs
+		Expect(plan.Steps[1].Target).To(MatchRegexp("^k8s-agentpool1-[0-9]+-1$"))
+		plan.Steps[1].Target = ""
+		Expect(plan.Steps).To(Equal([]operations.PlanStep{
+			{Action: operations.PlanActionCreate, Pool: MasterPoolName, Target: "master node with index 0", Detail: "index 0"},
+			{Action: operations.PlanActionCreate, Pool: "agentpool1", Detail: "index 1"},
+			{Action: operations.PlanActionDrain, Pool: "agentpool1", Target: "k8s-agentpool1-12345678-0"},
+			{Action: operations.PlanActionDelete, Pool: "agentpool1", Target: "k8s-agentpool1-12345678-0"},
+		}))
+		Expect(plan.UntouchedAgentPools).To(Equal([]string{"agentpool2"}))
+		Expect(plan.Resources).NotTo(BeEmpty())
+		for _, r := range plan.Resources {
+			Expect(r.Change).To(Equal(operations.ResourceAdded))
+			Expect(r.Type).To(Equal(resources[0].(map[string]interface{})["type"]))
+		}
+	})
+
+	It("Should plan the repair of missing and unhealthy nodes at their own index", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.9", 3, 3, false)
+		cs.Properties.ClusterID = "12345678"
+		cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &api.AgentPoolProfile{
+			Name:                "vmsspool",
+			Count:               1,
+			AvailabilityProfile: api.VirtualMachineScaleSets,
+		})
+		uc := UpgradeCluster{
+			Translator: &i18n.Translator{},
+			Logger:     log.NewEntry(log.New()),
+		}
+
+		// the mocked VM k8s-agentpool1-12345678-0 is not Ready, and the VM of node k8s-agentpool1-12345678-2 is gone
+		mockClient := armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{
+			NodesList: &v1.NodeList{Items: []v1.Node{
+				repairTestNode("k8s-agentpool1-12345678-0", v1.ConditionFalse),
+				repairTestNode("k8s-agentpool1-12345678-2", v1.ConditionTrue),
+			}},
+		}}
+		mockClient.FailDeleteVirtualMachine = true
+		mockClient.FailDeployTemplate = true
+		uc.Client = &mockClient
+
+		uc.ClusterTopology = ClusterTopology{}
+		uc.SubscriptionID = "DEC923E3-1EF1-4745-9516-37906D56DEC4"
+		uc.ResourceGroup = "TestRg"
+		uc.DataModel = cs
+		uc.NameSuffix = "12345678"
+
+		plan, err := uc.PlanRepair(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).To(BeNil())
+		Expect(plan.Operation).To(Equal("repair"))
+		Expect(plan.Steps).To(Equal([]operations.PlanStep{
+			{Action: operations.PlanActionCreate, Pool: MasterPoolName, Target: "k8s-master-12345678-0", Detail: "index 0"},
+			{Action: operations.PlanActionCreate, Pool: MasterPoolName, Target: "k8s-master-12345678-1", Detail: "index 1"},
+			{Action: operations.PlanActionCreate, Pool: MasterPoolName, Target: "k8s-master-12345678-2", Detail: "index 2"},
+			{Action: operations.PlanActionDrain, Pool: "agentpool1", Target: "k8s-agentpool1-12345678-0"},
+			{Action: operations.PlanActionDelete, Pool: "agentpool1", Target: "k8s-agentpool1-12345678-0"},
+			{Action: operations.PlanActionCreate, Pool: "agentpool1", Target: "k8s-agentpool1-12345678-0", Detail: "index 0"},
+			{Action: operations.PlanActionCreate, Pool: "agentpool1", Target: "k8s-agentpool1-12345678-2", Detail: "index 2"},
+			{Action: operations.PlanActionCreate, Pool: "agentpool1", Target: "k8s-agentpool1-12345678-1", Detail: "index 1"},
+		}))
+		Expect(plan.UnsupportedAgentPools).To(Equal([]string{"vmsspool"}))
+		Expect(plan.UntouchedAgentPools).To(BeEmpty())
+
+		u, err := uc.newRepairer(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).To(BeNil())
+		pools, err := u.repairActions()
+		Expect(err).To(BeNil())
+		Expect(pools).To(HaveLen(2))
+		// masters are recreated one at a time, the agents all at once once the unhealthy ones are deleted
+		for i, a := range pools[0].actions {
+			Expect(a.batch).To(Equal(i))
+		}
+		batches := []int{}
+		for _, a := range pools[1].actions {
+			batches = append(batches, a.batch)
+		}
+		Expect(batches).To(Equal([]int{0, 1, 1, 1}))
+	})
+
+	It("Should repair a cluster and only check its health once it is repaired", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.9", 1, 1, false)
+		cs.Properties.ClusterID = "12345678"
+		uc := UpgradeCluster{
+			Translator: &i18n.Translator{},
+			Logger:     log.NewEntry(log.New()),
+		}
+
+		mockClient := armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{
+			NodesList: &v1.NodeList{Items: []v1.Node{repairTestNode("k8s-agentpool1-12345678-0", v1.ConditionFalse)}},
+		}}
+		uc.Client = &mockClient
+
+		uc.ClusterTopology = ClusterTopology{}
+		uc.SubscriptionID = "DEC923E3-1EF1-4745-9516-37906D56DEC4"
+		uc.ResourceGroup = "TestRg"
+		uc.DataModel = cs
+		uc.NameSuffix = "12345678"
+
+		checked := 0
+		uc.HealthChecks = []operations.HealthCheck{{Name: "all nodes are Ready", Check: func(client armhelpers.KubernetesClient) error {
+			checked++
+			return nil
+		}}}
+		Expect(uc.RepairCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)).To(Succeed())
+		Expect(checked).To(Equal(1))
+
+		mockClient.FailDeployTemplate = true
+		err := uc.RepairCluster(&mockClient, "kubeConfig", TestAKSEngineVersion)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(Equal("DeployTemplate failed"))
+	})
+
+	It("Should only recreate missing VMs when the nodes cannot be listed", func() {
+		cs := api.CreateMockContainerService("testcluster", "1.7.9", 1, 1, false)
+		cs.Properties.ClusterID = "12345678"
+		mockClient := &armhelpers.MockAKSEngineClient{MockKubernetesClient: &armhelpers.MockKubernetesClient{FailListNodes: true}}
+		u := &Upgrader{}
+		u.Init(&i18n.Translator{}, log.NewEntry(log.New()), ClusterTopology{
+			DataModel:         cs,
+			MasterVMs:         &[]compute.VirtualMachine{},
+			UpgradedMasterVMs: &[]compute.VirtualMachine{},
+			AgentPools:        map[string]*AgentPoolTopology{},
+		}, mockClient, "kubeConfig", nil, TestAKSEngineVersion)
+
+		pools, err := u.repairActions()
+		Expect(err).To(BeNil())
+		Expect(pools).To(HaveLen(2))
+		Expect(pools[0].actions).To(Equal([]nodeAction{{create: true, name: "k8s-master-12345678-0", index: 0}}))
+		Expect(pools[1].actions).To(Equal([]nodeAction{{create: true, name: "k8s-agentpool1-12345678-0", index: 0}}))
+
+		vm := compute.VirtualMachine{Name: to.StringPtr("k8s-agentpool1-12345678-0"), VirtualMachineProperties: &compute.VirtualMachineProperties{}}
+		Expect(unhealthyReason(vm, nil)).To(BeEmpty())
+		Expect(unhealthyReason(vm, map[string]*v1.Node{})).To(Equal("its node is not registered"))
+		vm.ProvisioningState = to.StringPtr("Creating")
+		Expect(unhealthyReason(vm, map[string]*v1.Node{})).To(BeEmpty())
+		vm.ProvisioningState = to.StringPtr("Failed")
+		Expect(unhealthyReason(vm, nil)).To(Equal("its provisioning failed"))
+	})
 })
+
+// repairTestNode returns a node with the passed in Ready condition
+func repairTestNode(name string, ready v1.ConditionStatus) v1.Node {
+	node := v1.Node{}
+	node.Name = name
+	node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: ready}}
+	return node
+}
+
+// fakeUpgradeNode blocks node creations until the barrier is closed, and optionally fails to validate them
+type fakeUpgradeNode struct {
+	barrier      chan struct{}
+	created      chan int
+	deleted      string
+	failValidate bool
+}
+
+func (n *fakeUpgradeNode) DeleteNode(vmName *string, drain bool) error {
+	n.deleted = *vmName
+	return nil
+}
+
+func (n *fakeUpgradeNode) CreateNode(ctx context.Context, poolName string, agentNo int) error {
+	n.created <- agentNo
+	select {
+	case <-n.barrier:
+		return nil
+	case <-time.After(10 * time.Second):
+		return fmt.Errorf("node %d was not created concurrently", agentNo)
+	}
+}
+
+func (n *fakeUpgradeNode) Validate(vmName *string) error {
+	if n.failValidate {
+		return fmt.Errorf("node was not Ready")
+	}
+	return nil
+}
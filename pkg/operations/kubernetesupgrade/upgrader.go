@@ -8,6 +8,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/Azure/aks-engine/pkg/api"
@@ -17,8 +20,11 @@ import (
 	"github.com/Azure/aks-engine/pkg/engine/transform"
 	"github.com/Azure/aks-engine/pkg/i18n"
 	"github.com/Azure/aks-engine/pkg/operations"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
 // Upgrader holds information on upgrading an AKS cluster
@@ -30,10 +36,25 @@ type Upgrader struct {
 	kubeConfig       string
 	stepTimeout      *time.Duration
 	AKSEngineVersion string
+	checkpoint       *checkpoint
+	maxSurge         *int
+	maxUnavailable   *int
+	healthChecks     []operations.HealthCheck
+	rollingBack      bool
+	resuming         bool
+	// secureParameters are generated from the api model, for the template of the rollback snapshot
+	secureParameters map[string]interface{}
+	events           *operations.EventStream
 }
 
 type vmStatus int
 
+// agent pool upgrade settings used when neither the api model nor the upgrade command set them
+const (
+	defaultMaxSurge       = 1
+	defaultMaxUnavailable = 0
+)
+
 const (
 	defaultTimeout            = time.Minute * 20
 	vmStatusUpgraded vmStatus = iota
@@ -55,35 +76,144 @@ func (ku *Upgrader) Init(translator *i18n.Translator, logger *logrus.Entry, clus
 	ku.kubeConfig = kubeConfig
 	ku.stepTimeout = stepTimeout
 	ku.AKSEngineVersion = aksEngineVersion
+	ku.healthChecks = operations.DefaultHealthChecks()
+}
+
+// InitCheckpoint makes the upgrader record its progress in the checkpoint file at path after every node.
+// When resume is true, the node operations recorded by a previous upgrade are continued instead of planned again.
+func (ku *Upgrader) InitCheckpoint(path string, resume bool) error {
+	upgradeVersion := ku.DataModel.Properties.OrchestratorProfile.OrchestratorVersion
+	var err error
+	if resume {
+		ku.checkpoint, err = loadCheckpoint(path, upgradeVersion)
+		if err == nil {
+			ku.logger.Infof("Resuming upgrade from checkpoint %s", path)
+			ku.resuming = true
+		}
+	} else {
+		ku.checkpoint, err = newCheckpoint(path, upgradeVersion)
+	}
+	return err
+}
+
+// SetAgentPoolUpgradeSettings overrides the maxSurge and maxUnavailable settings of every agent pool.
+// A nil value keeps the setting of each pool. The settings only apply to AvailabilitySet agent pools,
+// VirtualMachineScaleSets agent pools are upgraded one node at a time.
+func (ku *Upgrader) SetAgentPoolUpgradeSettings(maxSurge, maxUnavailable *int) {
+	ku.maxSurge = maxSurge
+	ku.maxUnavailable = maxUnavailable
+}
+
+// SetHealthChecks replaces the health checks run before the upgrade, after every batch of nodes and
+// once the upgrade completes. An empty list disables them.
+func (ku *Upgrader) SetHealthChecks(checks []operations.HealthCheck) {
+	ku.healthChecks = checks
+}
+
+// SetEventStream makes the upgrader report its phases and every node it drains, deletes and creates to events
+func (ku *Upgrader) SetEventStream(events *operations.EventStream) {
+	ku.events = events
 }
 
 // RunUpgrade runs the upgrade pipeline
 func (ku *Upgrader) RunUpgrade() error {
+	if ku.checkpoint == nil {
+		if err := ku.InitCheckpoint("", false); err != nil {
+			return err
+		}
+	}
+
+	// a cluster being rolled back is expected to be unhealthy, since repairing it is the point of the rollback, and
+	// so is one whose upgrade was interrupted while a node was being replaced: it may be a node short, or have a
+	// node that never became Ready. The checks still gate every batch of nodes once the first one is replaced.
+	if ku.rollingBack {
+		ku.logger.Infof("Skipping pre-flight health checks, the cluster is rolled back")
+	} else if ku.resuming {
+		ku.logger.Infof("Skipping pre-flight health checks, the upgrade is resumed from a checkpoint")
+	} else {
+		ku.logger.Infof("Running pre-flight health checks...")
+		if err := ku.events.Phase("pre-flight-health-checks", func() error { return ku.checkHealth(false) }); err != nil {
+			return errors.Wrap(err, "pre-flight health checks failed, the upgrade was not started")
+		}
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Minute)
 	defer cancel()
-	if err := ku.upgradeMasterNodes(ctx); err != nil {
+	if err := ku.events.Phase("upgrade-master-nodes", func() error { return ku.upgradeMasterNodes(ctx) }); err != nil {
+		return err
+	}
+
+	if err := ku.events.Phase("upgrade-agent-scale-sets", func() error { return ku.upgradeAgentScaleSets(ctx) }); err != nil {
 		return err
 	}
 
-	if err := ku.upgradeAgentScaleSets(ctx); err != nil {
+	if err := ku.events.Phase("upgrade-agent-pools", func() error { return ku.upgradeAgentPools(ctx) }); err != nil {
 		return err
 	}
 
-	return ku.upgradeAgentPools(ctx)
+	return ku.checkpoint.remove()
 }
 
 // Validate will run validation post upgrade
 func (ku *Upgrader) Validate() error {
+	ku.logger.Infof("Running post-upgrade health checks...")
+	if err := ku.events.Phase("post-upgrade-health-checks", func() error { return ku.checkHealth(true) }); err != nil {
+		return errors.Wrap(err, "post-upgrade health checks failed")
+	}
 	return nil
 }
 
+// checkHealth runs the health checks against the cluster. When wait is true the checks are retried until they
+// pass or the step timeout expires, giving the cluster time to settle after nodes were replaced.
+func (ku *Upgrader) checkHealth(wait bool) error {
+	if len(ku.healthChecks) == 0 {
+		return nil
+	}
+	timeout := defaultTimeout
+	if ku.stepTimeout != nil {
+		timeout = *ku.stepTimeout
+	}
+	client, err := ku.getKubernetesClient(timeout)
+	if err != nil {
+		return err
+	}
+	if wait {
+		return operations.WaitForHealthChecks(client, ku.logger, ku.healthChecks, retry, timeout)
+	}
+	return operations.RunHealthChecks(client, ku.healthChecks).Err()
+}
+
+// getKubernetesClient returns a client for the api server of the cluster being upgraded
+func (ku *Upgrader) getKubernetesClient(timeout time.Duration) (armhelpers.KubernetesClient, error) {
+	var kubeAPIServerURL string
+	switch {
+	case ku.DataModel.Properties.HostedMasterProfile != nil:
+		kubeAPIServerURL = ku.DataModel.Properties.HostedMasterProfile.FQDN
+	case ku.DataModel.Properties.MasterProfile != nil:
+		kubeAPIServerURL = ku.DataModel.Properties.MasterProfile.FQDN
+	default:
+		return nil, errors.New("the api model has neither a master profile nor a hosted master profile")
+	}
+	client, err := ku.Client.GetKubernetesClient(kubeAPIServerURL, ku.kubeConfig, interval, timeout)
+	if err != nil {
+		ku.logger.Errorf("Error getting Kubernetes client: %v", err)
+		return nil, err
+	}
+	return client, nil
+}
+
 func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 	if ku.ClusterTopology.DataModel.Properties.MasterProfile == nil {
 		return nil
 	}
+	pool := ku.checkpoint.pool(MasterPoolName)
+	if pool != nil && pool.completed() {
+		ku.logger.Infof("Master nodes were already upgraded")
+		return nil
+	}
 	ku.logger.Infof("Master nodes StorageProfile: %s", ku.ClusterTopology.DataModel.Properties.MasterProfile.StorageProfile)
 	// Upgrade Master VMs
-	templateMap, parametersMap, err := ku.generateUpgradeTemplate(ku.ClusterTopology.DataModel, ku.AKSEngineVersion)
+	templateMap, parametersMap, err := ku.upgradeTemplate()
 	if err != nil {
 		return ku.Translator.Errorf("error generating upgrade template: %s", err.Error())
 	}
@@ -98,7 +228,30 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 		return err
 	}
 
-	upgradeMasterNode := UpgradeMasterNode{
+	upgradeMasterNode := ku.newMasterNode(templateMap, parametersMap)
+
+	if pool == nil {
+		actions, err := ku.masterActions()
+		if err != nil {
+			return err
+		}
+		if pool, err = ku.checkpoint.addPool(MasterPoolName, nodeActionSteps(actions)); err != nil {
+			return err
+		}
+	}
+
+	ku.logger.Infof("Starting upgrade of master nodes...")
+
+	// master nodes are upgraded one at a time, so every step can share the same template
+	newNode := func() (UpgradeNode, error) {
+		return upgradeMasterNode, nil
+	}
+	return ku.runNodeSteps(ctx, newNode, MasterPoolName, pool)
+}
+
+// newMasterNode returns a master node that is created from the passed in template and parameters
+func (ku *Upgrader) newMasterNode(templateMap, parametersMap map[string]interface{}) *UpgradeMasterNode {
+	upgradeMasterNode := &UpgradeMasterNode{
 		Translator: ku.Translator,
 		logger:     ku.logger,
 	}
@@ -114,7 +267,166 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 	} else {
 		upgradeMasterNode.timeout = *ku.stepTimeout
 	}
+	return upgradeMasterNode
+}
+
+// runNodeSteps runs the steps of a pool that have not completed yet, recording the progress of each one.
+// Consecutive steps of the same batch run concurrently, each against its own node from newNode.
+// The health checks gate every batch that takes nodes down after the first one, and the completion of the pool.
+func (ku *Upgrader) runNodeSteps(ctx context.Context, newNode func() (UpgradeNode, error), poolName string, pool *poolCheckpoint) error {
+	ran := false
+	for start := 0; start < len(pool.Steps); {
+		end := start + 1
+		for end < len(pool.Steps) && pool.Steps[end].Batch == pool.Steps[start].Batch {
+			end++
+		}
+
+		if ran && removesNodes(pool.Steps[start:end]) {
+			if err := ku.checkHealth(true); err != nil {
+				return errors.Wrapf(err, "health checks failed while upgrading pool %s, stopping the upgrade", poolName)
+			}
+		}
 
+		var wg sync.WaitGroup
+		errs := make(chan error, end-start)
+		for _, step := range pool.Steps[start:end] {
+			if step.Status == stepCompleted {
+				continue
+			}
+			ran = true
+			node, err := newNode()
+			if err != nil {
+				wg.Wait()
+				return err
+			}
+			wg.Add(1)
+			go func(node UpgradeNode, step *checkpointStep) {
+				defer wg.Done()
+				errs <- ku.runNodeStep(ctx, node, poolName, step)
+			}(node, step)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+
+		start = end
+	}
+
+	if ran {
+		if err := ku.checkHealth(true); err != nil {
+			return errors.Wrapf(err, "health checks failed after upgrading pool %s, stopping the upgrade", poolName)
+		}
+	}
+	return nil
+}
+
+// removesNodes returns true if any step of a batch that has not completed deletes a node
+func removesNodes(steps []*checkpointStep) bool {
+	for _, step := range steps {
+		if step.Status != stepCompleted && step.Action != stepCreate {
+			return true
+		}
+	}
+	return false
+}
+
+// runNodeStep deletes or creates a single node
+func (ku *Upgrader) runNodeStep(ctx context.Context, node UpgradeNode, poolName string, step *checkpointStep) error {
+	// A deletion that was interrupted is complete if the VM is gone. An interrupted creation
+	// is simply run again, since deploying the same template is idempotent.
+	if step.Status == stepStarted && step.Action != stepCreate {
+		deleted, err := ku.vmDeleted(step.VM)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			ku.logger.Infof("VM %s in pool %s was already deleted", step.VM, poolName)
+			return ku.checkpoint.setStatus(step, stepCompleted)
+		}
+	}
+
+	if err := ku.checkpoint.setStatus(step, stepStarted); err != nil {
+		return err
+	}
+
+	vmName := step.VM
+	if step.Action == stepCreate {
+		ku.logger.Infof("Creating upgraded VM %s (index %d) in pool %s", step.VM, step.Index, poolName)
+		if err := node.CreateNode(ctx, poolName, step.Index); err != nil {
+			ku.logger.Errorf("Error creating upgraded VM %s (index %d) in pool %s: %v", step.VM, step.Index, poolName, err)
+			return ku.rollbackFailedNode(ctx, poolName, step, err)
+		}
+		ku.events.Emit(operations.Event{Type: operations.EventVMCreated, Pool: poolName, Node: step.VM})
+
+		if err := node.Validate(&vmName); err != nil {
+			ku.logger.Errorf("Error validating upgraded VM %s (index %d) in pool %s: %v", step.VM, step.Index, poolName, err)
+			return ku.rollbackFailedNode(ctx, poolName, step, err)
+		}
+		ku.events.Emit(operations.Event{Type: operations.EventNodeReady, Pool: poolName, Node: vmName})
+	} else {
+		ku.logger.Infof("Deleting VM %s in pool %s", step.VM, poolName)
+		if err := node.DeleteNode(&vmName, step.Action == stepDrain); err != nil {
+			ku.logger.Errorf("Error deleting VM %s in pool %s: %v", step.VM, poolName, err)
+			return err
+		}
+		ku.events.Emit(operations.Event{Type: operations.EventVMDeleted, Pool: poolName, Node: step.VM})
+	}
+
+	return ku.checkpoint.setStatus(step, stepCompleted)
+}
+
+// rollbackFailedNode recreates a master that failed to upgrade at the previous version when the state of the cluster
+// before the upgrade is known, and returns the error the node failed with
+func (ku *Upgrader) rollbackFailedNode(ctx context.Context, poolName string, step *checkpointStep, cause error) error {
+	// the name of a missing master is not known, so it cannot be cleaned up before recreating it
+	if poolName != MasterPoolName || ku.rollingBack || ku.checkpoint.Rollback == nil || step.VM == "" {
+		return cause
+	}
+	return ku.rollbackMasterNode(ctx, step, cause)
+}
+
+// upgradeTemplate returns the ARM template and parameters nodes are created from: those of the upgrade version,
+// or the snapshot taken before the upgrade when rolling back
+func (ku *Upgrader) upgradeTemplate() (map[string]interface{}, map[string]interface{}, error) {
+	if !ku.rollingBack {
+		return ku.generateUpgradeTemplate(ku.ClusterTopology.DataModel, ku.AKSEngineVersion)
+	}
+	if _, err := ku.ClusterTopology.DataModel.SetPropertiesDefaults(true, false); err != nil {
+		return nil, nil, ku.Translator.Errorf("error in SetPropertiesDefaults: %s", err.Error())
+	}
+	return ku.snapshotTemplate()
+}
+
+// vmDeleted returns true if ARM reports that the VM does not exist
+func (ku *Upgrader) vmDeleted(name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+	defer cancel()
+	_, err := ku.Client.GetVirtualMachine(ctx, ku.ClusterTopology.ResourceGroup, name)
+	if err == nil {
+		return false, nil
+	}
+	if detailedErr, ok := err.(autorest.DetailedError); ok && detailedErr.StatusCode == http.StatusNotFound {
+		return true, nil
+	}
+	return false, err
+}
+
+// nodeAction is a single node deletion or creation performed while upgrading a pool.
+// Consecutive actions of the same batch are performed concurrently.
+type nodeAction struct {
+	create bool
+	drain  bool
+	name   string
+	index  int
+	batch  int
+}
+
+// masterActions returns the ordered node operations needed to upgrade the master nodes
+func (ku *Upgrader) masterActions() ([]nodeAction, error) {
 	expectedMasterCount := ku.ClusterTopology.DataModel.Properties.MasterProfile.Count
 	mastersUpgradedCount := len(*ku.ClusterTopology.UpgradedMasterVMs)
 	mastersToUgradeCount := expectedMasterCount - mastersUpgradedCount
@@ -123,14 +435,13 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 	ku.logger.Infof("Master nodes that need to be upgraded: %d", mastersToUgradeCount)
 	ku.logger.Infof("Master nodes that have been upgraded: %d", mastersUpgradedCount)
 
-	ku.logger.Infof("Starting upgrade of master nodes...")
-
 	masterNodesInCluster := len(*ku.ClusterTopology.MasterVMs) + mastersUpgradedCount
 	ku.logger.Infof("masterNodesInCluster: %d", masterNodesInCluster)
 	if masterNodesInCluster > expectedMasterCount {
-		return ku.Translator.Errorf("Total count of master VMs: %d exceeded expected count: %d", masterNodesInCluster, expectedMasterCount)
+		return nil, ku.Translator.Errorf("Total count of master VMs: %d exceeded expected count: %d", masterNodesInCluster, expectedMasterCount)
 	}
 
+	var actions []nodeAction
 	upgradedMastersIndex := make(map[int]bool)
 
 	for _, vm := range *ku.ClusterTopology.UpgradedMasterVMs {
@@ -140,28 +451,10 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 	}
 
 	for _, vm := range *ku.ClusterTopology.MasterVMs {
-		ku.logger.Infof("Upgrading Master VM: %s", *vm.Name)
-
 		masterIndex, _ := utils.GetVMNameIndex(vm.StorageProfile.OsDisk.OsType, *vm.Name)
-
-		err := upgradeMasterNode.DeleteNode(vm.Name, false)
-		if err != nil {
-			ku.logger.Infof("Error deleting master VM: %s, err: %v", *vm.Name, err)
-			return err
-		}
-
-		err = upgradeMasterNode.CreateNode(ctx, "master", masterIndex)
-		if err != nil {
-			ku.logger.Infof("Error creating upgraded master VM: %s", *vm.Name)
-			return err
-		}
-
-		err = upgradeMasterNode.Validate(vm.Name)
-		if err != nil {
-			ku.logger.Infof("Error validating upgraded master VM: %s", *vm.Name)
-			return err
-		}
-
+		actions = append(actions,
+			nodeAction{name: *vm.Name, index: masterIndex, batch: len(actions)},
+			nodeAction{create: true, name: *vm.Name, index: masterIndex, batch: len(actions) + 1})
 		upgradedMastersIndex[masterIndex] = true
 	}
 
@@ -182,32 +475,24 @@ func (ku *Upgrader) upgradeMasterNodes(ctx context.Context) error {
 		for upgradedMastersIndex[masterIndexToCreate] {
 			masterIndexToCreate++
 		}
-
-		ku.logger.Infof("Creating upgraded master VM with index: %d", masterIndexToCreate)
-
-		err = upgradeMasterNode.CreateNode(ctx, "master", masterIndexToCreate)
-		if err != nil {
-			ku.logger.Infof("Error creating upgraded master VM with index: %d", masterIndexToCreate)
-			return err
-		}
-
-		tempVMName := ""
-		err = upgradeMasterNode.Validate(&tempVMName)
-		if err != nil {
-			ku.logger.Infof("Error validating upgraded master VM with index: %d", masterIndexToCreate)
-			return err
-		}
-
+		// the name of a missing master is not known, so its node condition is not checked
+		actions = append(actions, nodeAction{create: true, index: masterIndexToCreate, batch: len(actions)})
 		upgradedMastersIndex[masterIndexToCreate] = true
 	}
 
-	return nil
+	return actions, nil
 }
 
 func (ku *Upgrader) upgradeAgentPools(ctx context.Context) error {
-	for _, agentPool := range ku.ClusterTopology.AgentPools {
+	for _, agentPool := range ku.sortedAgentPools() {
+		pool := ku.checkpoint.pool(*agentPool.Name)
+		if pool != nil && pool.completed() {
+			ku.logger.Infof("Agent pool '%s' was already upgraded", *agentPool.Name)
+			continue
+		}
+
 		// Upgrade Agent VMs
-		templateMap, parametersMap, err := ku.generateUpgradeTemplate(ku.ClusterTopology.DataModel, ku.AKSEngineVersion)
+		templateMap, parametersMap, err := ku.upgradeTemplate()
 		if err != nil {
 			ku.logger.Errorf("Error generating upgrade template: %v", err)
 			return ku.Translator.Errorf("Error generating upgrade template: %s", err.Error())
@@ -228,201 +513,259 @@ func (ku *Upgrader) upgradeAgentPools(ctx context.Context) error {
 			return ku.Translator.Errorf("Error generating upgrade template: %s", err.Error())
 		}
 
-		var agentCount int
-		var agentPoolProfile *api.AgentPoolProfile
-		for _, app := range ku.ClusterTopology.DataModel.Properties.AgentPoolProfiles {
-			if app.Name == *agentPool.Name {
-				agentCount = app.Count
-				agentPoolProfile = app
-				break
-			}
-		}
-
-		if agentCount == 0 {
+		agentCount, agentPoolProfile := ku.agentPoolProfile(*agentPool.Name)
+		// an empty pool does not stop the upgrade of the pools after it
+		if pool == nil && agentCount == 0 {
 			ku.logger.Infof("Agent pool '%s' is empty", *agentPool.Name)
-			return nil
+			continue
 		}
 
-		upgradeAgentNode := UpgradeAgentNode{
-			Translator: ku.Translator,
-			logger:     ku.logger,
-		}
-		upgradeAgentNode.TemplateMap = templateMap
-		upgradeAgentNode.ParametersMap = parametersMap
-		upgradeAgentNode.UpgradeContainerService = ku.ClusterTopology.DataModel
-		upgradeAgentNode.SubscriptionID = ku.ClusterTopology.SubscriptionID
-		upgradeAgentNode.ResourceGroup = ku.ClusterTopology.ResourceGroup
-		upgradeAgentNode.Client = ku.Client
-		upgradeAgentNode.kubeConfig = ku.kubeConfig
-		if ku.stepTimeout == nil {
-			upgradeAgentNode.timeout = defaultTimeout
-		} else {
-			upgradeAgentNode.timeout = *ku.stepTimeout
-		}
-
-		agentVMs := make(map[int]*vmInfo)
-		// Go over upgraded VMs and verify provisioning state
-		// per https://docs.microsoft.com/en-us/rest/api/compute/virtualmachines/virtualmachines-state :
-		//  - Creating: Indicates the virtual Machine is being created.
-		//  - Updating: Indicates that there is an update operation in progress on the Virtual Machine.
-		//  - Succeeded: Indicates that the operation executed on the virtual machine succeeded.
-		//  - Deleting: Indicates that the virtual machine is being deleted.
-		//  - Failed: Indicates that the update operation on the Virtual Machine failed.
-		// Delete VMs in 'bad' state. Such VMs will be re-created later in this function.
-		upgradedCount := 0
-		for _, vm := range *agentPool.UpgradedAgentVMs {
-			ku.logger.Infof("Agent VM: %s, pool name: %s on expected orchestrator version", *vm.Name, *agentPool.Name)
-			var vmProvisioningState string
-			if vm.VirtualMachineProperties != nil && vm.VirtualMachineProperties.ProvisioningState != nil {
-				vmProvisioningState = *vm.VirtualMachineProperties.ProvisioningState
+		upgradeAgentNode := ku.newAgentNode(templateMap, parametersMap, *agentPool.Name)
+
+		if pool == nil {
+			actions, err := ku.agentPoolActions(agentPool, agentCount, agentPoolProfile)
+			if err != nil {
+				return err
 			}
-			agentIndex, _ := utils.GetVMNameIndex(vm.StorageProfile.OsDisk.OsType, *vm.Name)
-
-			switch vmProvisioningState {
-			case "Creating", "Updating", "Succeeded":
-				agentVMs[agentIndex] = &vmInfo{*vm.Name, vmStatusUpgraded}
-				upgradedCount++
-
-			case "Failed":
-				ku.logger.Infof("Deleting agent VM %s in provisioning state %s", *vm.Name, vmProvisioningState)
-				err := upgradeAgentNode.DeleteNode(vm.Name, false)
-				if err != nil {
-					ku.logger.Errorf("Error deleting agent VM %s: %v", *vm.Name, err)
-					return err
-				}
-
-			case "Deleting":
-				fallthrough
-			default:
-				ku.logger.Infof("Ignoring agent VM %s in provisioning state %s", *vm.Name, vmProvisioningState)
-				agentVMs[agentIndex] = &vmInfo{*vm.Name, vmStatusIgnored}
+			if pool, err = ku.checkpoint.addPool(*agentPool.Name, nodeActionSteps(actions)); err != nil {
+				return err
 			}
 		}
 
-		for _, vm := range *agentPool.AgentVMs {
-			agentIndex, _ := utils.GetVMNameIndex(vm.StorageProfile.OsDisk.OsType, *vm.Name)
-			agentVMs[agentIndex] = &vmInfo{*vm.Name, vmStatusNotUpgraded}
+		if err := ku.runNodeSteps(ctx, agentNodeCopies(upgradeAgentNode), *agentPool.Name, pool); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newAgentNode returns an agent node of the pool that is created from the passed in template and parameters
+func (ku *Upgrader) newAgentNode(templateMap, parametersMap map[string]interface{}, poolName string) *UpgradeAgentNode {
+	upgradeAgentNode := &UpgradeAgentNode{
+		Translator: ku.Translator,
+		logger:     ku.logger,
+		events:     ku.events,
+		poolName:   poolName,
+	}
+	upgradeAgentNode.TemplateMap = templateMap
+	upgradeAgentNode.ParametersMap = parametersMap
+	upgradeAgentNode.UpgradeContainerService = ku.ClusterTopology.DataModel
+	upgradeAgentNode.SubscriptionID = ku.ClusterTopology.SubscriptionID
+	upgradeAgentNode.ResourceGroup = ku.ClusterTopology.ResourceGroup
+	upgradeAgentNode.Client = ku.Client
+	upgradeAgentNode.kubeConfig = ku.kubeConfig
+	if ku.stepTimeout == nil {
+		upgradeAgentNode.timeout = defaultTimeout
+	} else {
+		upgradeAgentNode.timeout = *ku.stepTimeout
+	}
+	return upgradeAgentNode
+}
+
+// agentNodeCopies returns a function returning copies of the agent node. Every node gets its own copy of the
+// template, since creating a node updates the pool count and offset.
+func agentNodeCopies(agentNode *UpgradeAgentNode) func() (UpgradeNode, error) {
+	return func() (UpgradeNode, error) {
+		node := *agentNode
+		var err error
+		if node.TemplateMap, err = copyTemplate(agentNode.TemplateMap); err != nil {
+			return nil, err
+		}
+		if node.ParametersMap, err = copyTemplate(agentNode.ParametersMap); err != nil {
+			return nil, err
 		}
-		toBeUpgradedCount := len(*agentPool.AgentVMs)
+		return &node, nil
+	}
+}
 
-		ku.logger.Infof("Starting upgrade of %d agent nodes (out of %d) in pool identifier: %s, name: %s...",
-			toBeUpgradedCount, agentCount, *agentPool.Identifier, *agentPool.Name)
+// sortedAgentPools returns the agent pools of the topology ordered by pool identifier, so they are always upgraded in the same order
+func (ku *Upgrader) sortedAgentPools() []*AgentPoolTopology {
+	identifiers := make([]string, 0, len(ku.ClusterTopology.AgentPools))
+	for identifier := range ku.ClusterTopology.AgentPools {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Strings(identifiers)
+	pools := make([]*AgentPoolTopology, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		pools = append(pools, ku.ClusterTopology.AgentPools[identifier])
+	}
+	return pools
+}
 
-		// Create missing nodes to match agentCount. This could be due to previous upgrade failure
-		// If there are nodes that need to be upgraded, create one extra node, which will be used to take on the load from upgrading nodes.
-		if toBeUpgradedCount > 0 {
-			agentCount++
+// agentPoolProfile returns the expected node count and the profile of the named agent pool
+func (ku *Upgrader) agentPoolProfile(name string) (int, *api.AgentPoolProfile) {
+	for _, app := range ku.ClusterTopology.DataModel.Properties.AgentPoolProfiles {
+		if app.Name == name {
+			return app.Count, app
 		}
-		for upgradedCount+toBeUpgradedCount < agentCount {
-			agentIndex := getAvailableIndex(agentVMs)
+	}
+	return 0, nil
+}
 
-			vmName, err := utils.GetK8sVMName(ku.DataModel.Properties, agentPoolProfile, agentIndex)
-			if err != nil {
-				ku.logger.Errorf("Error reconstructing agent VM name with index %d: %v", agentIndex, err)
-				return err
-			}
-			ku.logger.Infof("Creating new agent node %s (index %d)", vmName, agentIndex)
+// agentPoolUpgradeSettings returns how many nodes above its count an agent pool may grow to during an upgrade,
+// and how many nodes below its count it may shrink to
+func (ku *Upgrader) agentPoolUpgradeSettings(agentPoolProfile *api.AgentPoolProfile) (int, int, error) {
+	maxSurge, maxUnavailable := defaultMaxSurge, defaultMaxUnavailable
+	if agentPoolProfile.MaxSurge != nil {
+		maxSurge = *agentPoolProfile.MaxSurge
+	}
+	if agentPoolProfile.MaxUnavailable != nil {
+		maxUnavailable = *agentPoolProfile.MaxUnavailable
+	}
+	if ku.maxSurge != nil {
+		maxSurge = *ku.maxSurge
+	}
+	if ku.maxUnavailable != nil {
+		maxUnavailable = *ku.maxUnavailable
+	}
+	if maxSurge < 0 || maxUnavailable < 0 || maxSurge+maxUnavailable == 0 {
+		return 0, 0, ku.Translator.Errorf("invalid upgrade settings for agent pool %s: maxSurge %d, maxUnavailable %d", agentPoolProfile.Name, maxSurge, maxUnavailable)
+	}
+	return maxSurge, maxUnavailable, nil
+}
 
-			err = upgradeAgentNode.CreateNode(ctx, *agentPool.Name, agentIndex)
-			if err != nil {
-				ku.logger.Errorf("Error creating agent node %s (index %d): %v", vmName, agentIndex, err)
-				return err
-			}
+// agentPoolActions returns the ordered node operations needed to upgrade an agent pool.
+// Up to maxSurge extra nodes are created first so the pool keeps its capacity, then the nodes are replaced
+// in batches of maxSurge+maxUnavailable, draining and deleting a whole batch before recreating it.
+func (ku *Upgrader) agentPoolActions(agentPool *AgentPoolTopology, agentCount int, agentPoolProfile *api.AgentPoolProfile) ([]nodeAction, error) {
+	maxSurge, maxUnavailable, err := ku.agentPoolUpgradeSettings(agentPoolProfile)
+	if err != nil {
+		return nil, err
+	}
 
-			err = upgradeAgentNode.Validate(&vmName)
-			if err != nil {
-				ku.logger.Infof("Error validating agent node %s (index %d): %v", vmName, agentIndex, err)
-				return err
-			}
+	var actions []nodeAction
+	batch := 0
+	agentVMs := make(map[int]*vmInfo)
+	// Go over upgraded VMs and verify provisioning state
+	// per https://docs.microsoft.com/en-us/rest/api/compute/virtualmachines/virtualmachines-state :
+	//  - Creating: Indicates the virtual Machine is being created.
+	//  - Updating: Indicates that there is an update operation in progress on the Virtual Machine.
+	//  - Succeeded: Indicates that the operation executed on the virtual machine succeeded.
+	//  - Deleting: Indicates that the virtual machine is being deleted.
+	//  - Failed: Indicates that the update operation on the Virtual Machine failed.
+	// Delete VMs in 'bad' state. Such VMs will be re-created later in this function.
+	upgradedCount := 0
+	for _, vm := range *agentPool.UpgradedAgentVMs {
+		ku.logger.Infof("Agent VM: %s, pool name: %s on expected orchestrator version", *vm.Name, *agentPool.Name)
+		var vmProvisioningState string
+		if vm.VirtualMachineProperties != nil && vm.VirtualMachineProperties.ProvisioningState != nil {
+			vmProvisioningState = *vm.VirtualMachineProperties.ProvisioningState
+		}
+		agentIndex, _ := utils.GetVMNameIndex(vm.StorageProfile.OsDisk.OsType, *vm.Name)
 
-			agentVMs[agentIndex] = &vmInfo{vmName, vmStatusUpgraded}
+		switch vmProvisioningState {
+		case "Creating", "Updating", "Succeeded":
+			agentVMs[agentIndex] = &vmInfo{*vm.Name, vmStatusUpgraded}
 			upgradedCount++
+
+		case "Failed":
+			ku.logger.Infof("Agent VM %s is in provisioning state %s and will be deleted", *vm.Name, vmProvisioningState)
+			actions = append(actions, nodeAction{name: *vm.Name, index: agentIndex, batch: batch})
+
+		case "Deleting":
+			fallthrough
+		default:
+			ku.logger.Infof("Ignoring agent VM %s in provisioning state %s", *vm.Name, vmProvisioningState)
+			agentVMs[agentIndex] = &vmInfo{*vm.Name, vmStatusIgnored}
 		}
+	}
 
-		if toBeUpgradedCount == 0 {
-			ku.logger.Infof("No nodes to upgrade")
-			return nil
+	for _, vm := range *agentPool.AgentVMs {
+		agentIndex, _ := utils.GetVMNameIndex(vm.StorageProfile.OsDisk.OsType, *vm.Name)
+		agentVMs[agentIndex] = &vmInfo{*vm.Name, vmStatusNotUpgraded}
+	}
+	toBeUpgradedCount := len(*agentPool.AgentVMs)
+
+	ku.logger.Infof("Planning upgrade of %d agent nodes (out of %d) in pool identifier: %s, name: %s, maxSurge: %d, maxUnavailable: %d...",
+		toBeUpgradedCount, agentCount, *agentPool.Identifier, *agentPool.Name, maxSurge, maxUnavailable)
+	if len(actions) > 0 {
+		batch++
+	}
+
+	// Create missing nodes to match agentCount. This could be due to previous upgrade failure
+	// If there are nodes that need to be upgraded, create up to maxSurge extra nodes, which will be used to take on the load from upgrading nodes.
+	surgeCount := 0
+	if toBeUpgradedCount > 0 {
+		surgeCount = maxSurge
+		if surgeCount > toBeUpgradedCount {
+			surgeCount = toBeUpgradedCount
 		}
+		agentCount += surgeCount
+	}
+	created := false
+	for upgradedCount+toBeUpgradedCount < agentCount {
+		agentIndex := getAvailableIndex(agentVMs)
 
-		// Upgrade nodes in agent pool
-		upgradedCount = 0
-		for agentIndex, vm := range agentVMs {
-			if vm.status != vmStatusNotUpgraded {
-				continue
-			}
-			ku.logger.Infof("Upgrading Agent VM: %s, pool name: %s", vm.name, *agentPool.Name)
+		vmName, err := utils.GetK8sVMName(ku.DataModel.Properties, agentPoolProfile, agentIndex)
+		if err != nil {
+			ku.logger.Errorf("Error reconstructing agent VM name with index %d: %v", agentIndex, err)
+			return nil, err
+		}
+		actions = append(actions, nodeAction{create: true, name: vmName, index: agentIndex, batch: batch})
+		created = true
 
-			err := upgradeAgentNode.DeleteNode(&vm.name, true)
-			if err != nil {
-				ku.logger.Errorf("Error deleting agent VM %s: %v", vm.name, err)
-				return err
-			}
+		agentVMs[agentIndex] = &vmInfo{vmName, vmStatusUpgraded}
+		upgradedCount++
+	}
+	if created {
+		batch++
+	}
 
+	if toBeUpgradedCount == 0 {
+		ku.logger.Infof("No nodes to upgrade")
+		return actions, nil
+	}
+
+	indexes := make([]int, 0, len(agentVMs))
+	for agentIndex := range agentVMs {
+		if agentVMs[agentIndex].status == vmStatusNotUpgraded {
+			indexes = append(indexes, agentIndex)
+		}
+	}
+	sort.Ints(indexes)
+
+	// Upgrade nodes in agent pool
+	batchSize := maxSurge + maxUnavailable
+	for start := 0; start < len(indexes); start += batchSize {
+		end := start + batchSize
+		if end > len(indexes) {
+			end = len(indexes)
+		}
+		for _, agentIndex := range indexes[start:end] {
+			actions = append(actions, nodeAction{drain: true, name: agentVMs[agentIndex].name, index: agentIndex, batch: batch})
+		}
+		batch++
+
+		created = false
+		for i := start; i < end; i++ {
+			agentIndex := indexes[i]
 			vmName, err := utils.GetK8sVMName(ku.DataModel.Properties, agentPoolProfile, agentIndex)
 			if err != nil {
 				ku.logger.Errorf("Error fetching new VM name: %v", err)
-				return err
+				return nil, err
 			}
 
-			// do not create last node in favor of already created extra node.
-			if upgradedCount == toBeUpgradedCount-1 {
+			// do not create the last nodes in favor of the already created extra nodes.
+			if i >= len(indexes)-surgeCount {
 				ku.logger.Infof("Skipping creation of VM %s (index %d)", vmName, agentIndex)
-				delete(agentVMs, agentIndex)
-			} else {
-				err = upgradeAgentNode.CreateNode(ctx, *agentPool.Name, agentIndex)
-				if err != nil {
-					ku.logger.Errorf("Error creating upgraded agent VM %s: %v", vmName, err)
-					return err
-				}
-
-				err = upgradeAgentNode.Validate(&vmName)
-				if err != nil {
-					ku.logger.Errorf("Error validating upgraded agent VM %s: %v", vmName, err)
-					return err
-				}
-				vm.status = vmStatusUpgraded
+				continue
 			}
-			upgradedCount++
+			actions = append(actions, nodeAction{create: true, name: vmName, index: agentIndex, batch: batch})
+			created = true
+		}
+		if created {
+			batch++
 		}
 	}
 
-	return nil
+	return actions, nil
 }
 
 func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 	if len(ku.ClusterTopology.AgentPoolScaleSetsToUpgrade) > 0 {
-		// need to apply the ARM template with target Kubernetes version to the VMSS first in order that the new VMSS instances
-		// created can get the expected Kubernetes version. Otherwise the new instances created still have old Kubernetes version
-		// if the topology doesn't have master nodes (so there are no ARM deployments in previous upgradeMasterNodes step)
-		templateMap, parametersMap, err := ku.generateUpgradeTemplate(ku.ClusterTopology.DataModel, ku.AKSEngineVersion)
-		if err != nil {
-			ku.logger.Errorf("error generating upgrade template in upgradeAgentScaleSets: %v", err)
-			return err
-		}
-
-		transformer := &transform.Transformer{
-			Translator: ku.Translator,
-		}
-
-		if err := transformer.NormalizeForVMSSScaling(ku.logger, templateMap); err != nil {
-			ku.logger.Errorf("unable to update template, error: %v.", err)
-			return err
-		}
-
-		random := rand.New(rand.NewSource(time.Now().UnixNano()))
-		deploymentSuffix := random.Int31()
-		deploymentName := fmt.Sprintf("agentscaleset-%s-%d", time.Now().Format("06-01-02T15.04.05"), deploymentSuffix)
-
-		ku.logger.Infof("Deploying the agent scale sets ARM template...")
-		_, err = ku.Client.DeployTemplate(
-			ctx,
-			ku.ClusterTopology.ResourceGroup,
-			deploymentName,
-			templateMap,
-			parametersMap)
-
-		if err != nil {
-			ku.logger.Errorf("error applying upgrade template in upgradeAgentScaleSets: %v", err)
+		ku.warnScaleSetUpgradeSettings()
+		if err := ku.deployAgentScaleSetsTemplate(ctx); err != nil {
 			return err
 		}
 	}
@@ -430,92 +773,53 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 	for _, vmssToUpgrade := range ku.ClusterTopology.AgentPoolScaleSetsToUpgrade {
 		ku.logger.Infof("Upgrading VMSS %s", vmssToUpgrade.Name)
 
-		if len(vmssToUpgrade.VMsToUpgrade) == 0 {
-			ku.logger.Infof("No VMs to upgrade for VMSS %s, skipping", vmssToUpgrade.Name)
-			continue
-		}
+		pool := ku.checkpoint.pool(vmssToUpgrade.Name)
+		if pool == nil {
+			if len(vmssToUpgrade.VMsToUpgrade) == 0 {
+				ku.logger.Infof("No VMs to upgrade for VMSS %s, skipping", vmssToUpgrade.Name)
+				continue
+			}
 
-		newCapacity := *vmssToUpgrade.Sku.Capacity + 1
-		ku.logger.Infof(
-			"VMSS %s current capacity is %d and new capacity will be %d while each node is swapped",
-			vmssToUpgrade.Name,
-			*vmssToUpgrade.Sku.Capacity,
-			newCapacity,
-		)
-
-		*vmssToUpgrade.Sku.Capacity = newCapacity
-
-		for _, vmToUpgrade := range vmssToUpgrade.VMsToUpgrade {
-			if err := ku.Client.SetVirtualMachineScaleSetCapacity(
-				ctx,
-				ku.ClusterTopology.ResourceGroup,
+			newCapacity := *vmssToUpgrade.Sku.Capacity + 1
+			ku.logger.Infof(
+				"VMSS %s current capacity is %d and new capacity will be %d while each node is swapped",
 				vmssToUpgrade.Name,
-				vmssToUpgrade.Sku,
-				vmssToUpgrade.Location,
-			); err != nil {
-				ku.logger.Errorf("Failure to set capacity for VMSS %s", vmssToUpgrade.Name)
+				*vmssToUpgrade.Sku.Capacity,
+				newCapacity,
+			)
+
+			steps := make([]*checkpointStep, 0, len(vmssToUpgrade.VMsToUpgrade))
+			for _, vmToUpgrade := range vmssToUpgrade.VMsToUpgrade {
+				steps = append(steps, &checkpointStep{
+					Action:     stepReplace,
+					VM:         vmToUpgrade.Name,
+					InstanceID: vmToUpgrade.InstanceID,
+					Capacity:   newCapacity,
+				})
+			}
+			var err error
+			if pool, err = ku.checkpoint.addPool(vmssToUpgrade.Name, steps); err != nil {
 				return err
 			}
+		}
 
-			ku.logger.Infof("Successfully set capacity for VMSS %s", vmssToUpgrade.Name)
-
-			// Before we can delete the node we should safely and responsibly drain it
-			var kubeAPIServerURL string
-			getClientTimeout := 10 * time.Second
-
-			if ku.DataModel.Properties.HostedMasterProfile != nil {
-				kubeAPIServerURL = ku.DataModel.Properties.HostedMasterProfile.FQDN
-			} else {
-				kubeAPIServerURL = ku.DataModel.Properties.MasterProfile.FQDN
+		for _, step := range pool.Steps {
+			if step.Status == stepCompleted {
+				continue
 			}
-			client, err := ku.Client.GetKubernetesClient(
-				kubeAPIServerURL,
-				ku.kubeConfig,
-				interval,
-				getClientTimeout,
-			)
-			if err != nil {
-				ku.logger.Errorf("Error getting Kubernetes client: %v", err)
+			resuming := step.Status == stepStarted
+			if err := ku.checkpoint.setStatus(step, stepStarted); err != nil {
 				return err
 			}
-
-			ku.logger.Infof("Draining node %s", vmToUpgrade.Name)
-			err = operations.SafelyDrainNodeWithClient(
-				client,
-				ku.logger,
-				vmToUpgrade.Name,
-				time.Minute,
-			)
-			if err != nil {
-				ku.logger.Errorf("Error draining VM in VMSS: %v", err)
+			if err := ku.replaceScaleSetVM(ctx, vmssToUpgrade, step, resuming); err != nil {
 				return err
 			}
-
-			ku.logger.Infof(
-				"Deleting VM %s in VMSS %s",
-				vmToUpgrade.Name,
-				vmssToUpgrade.Name,
-			)
-
-			// At this point we have our buffer node that will replace the node to delete
-			// so we can just remove this current node then
-			if err := ku.Client.DeleteVirtualMachineScaleSetVM(
-				ctx,
-				ku.ClusterTopology.ResourceGroup,
-				vmssToUpgrade.Name,
-				vmToUpgrade.InstanceID,
-			); err != nil {
-				ku.logger.Errorf(
-					"Failed to delete VM %s in VMSS %s",
-					vmToUpgrade.Name,
-					vmssToUpgrade.Name)
+			if err := ku.checkpoint.setStatus(step, stepCompleted); err != nil {
 				return err
 			}
-
-			ku.logger.Infof(
-				"Successfully deleted VM %s in VMSS %s",
-				vmToUpgrade.Name,
-				vmssToUpgrade.Name)
+			if err := ku.checkHealth(true); err != nil {
+				return errors.Wrapf(err, "health checks failed after replacing VM %s in VMSS %s, stopping the upgrade", step.VM, vmssToUpgrade.Name)
+			}
 		}
 		ku.logger.Infof("Completed upgrading VMSS %s", vmssToUpgrade.Name)
 	}
@@ -525,6 +829,154 @@ func (ku *Upgrader) upgradeAgentScaleSets(ctx context.Context) error {
 	return nil
 }
 
+// warnScaleSetUpgradeSettings warns that maxSurge and maxUnavailable do not apply to VirtualMachineScaleSets agent pools,
+// whose nodes are always replaced one at a time
+func (ku *Upgrader) warnScaleSetUpgradeSettings() {
+	if ku.maxSurge != nil || ku.maxUnavailable != nil {
+		ku.logger.Warnf("--max-surge and --max-unavailable only apply to AvailabilitySet agent pools, VirtualMachineScaleSets agent pools are upgraded one node at a time")
+	}
+	if ku.ClusterTopology.DataModel == nil {
+		return
+	}
+	for _, agentPoolProfile := range ku.ClusterTopology.DataModel.Properties.AgentPoolProfiles {
+		if agentPoolProfile.AvailabilityProfile == api.VirtualMachineScaleSets && (agentPoolProfile.MaxSurge != nil || agentPoolProfile.MaxUnavailable != nil) {
+			ku.logger.Warnf("maxSurge and maxUnavailable of agent pool %s are ignored, VirtualMachineScaleSets agent pools are upgraded one node at a time", agentPoolProfile.Name)
+		}
+	}
+}
+
+// deployAgentScaleSetsTemplate applies the ARM template with the target Kubernetes version to the VMSS, unless
+// a previous run of the upgrade already did
+func (ku *Upgrader) deployAgentScaleSetsTemplate(ctx context.Context) error {
+	pool := ku.checkpoint.pool(scaleSetTemplatePool)
+	if pool == nil {
+		var err error
+		if pool, err = ku.checkpoint.addPool(scaleSetTemplatePool, []*checkpointStep{{Action: stepDeploy}}); err != nil {
+			return err
+		}
+	}
+	if pool.completed() {
+		ku.logger.Infof("The agent scale sets ARM template was already deployed")
+		return nil
+	}
+	step := pool.Steps[0]
+	if err := ku.checkpoint.setStatus(step, stepStarted); err != nil {
+		return err
+	}
+
+	// need to apply the ARM template with target Kubernetes version to the VMSS first in order that the new VMSS instances
+	// created can get the expected Kubernetes version. Otherwise the new instances created still have old Kubernetes version
+	// if the topology doesn't have master nodes (so there are no ARM deployments in previous upgradeMasterNodes step)
+	templateMap, parametersMap, err := ku.upgradeTemplate()
+	if err != nil {
+		ku.logger.Errorf("error generating upgrade template in upgradeAgentScaleSets: %v", err)
+		return err
+	}
+
+	transformer := &transform.Transformer{
+		Translator: ku.Translator,
+	}
+
+	if err := transformer.NormalizeForVMSSScaling(ku.logger, templateMap); err != nil {
+		ku.logger.Errorf("unable to update template, error: %v.", err)
+		return err
+	}
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	deploymentSuffix := random.Int31()
+	deploymentName := fmt.Sprintf("agentscaleset-%s-%d", time.Now().Format("06-01-02T15.04.05"), deploymentSuffix)
+
+	ku.logger.Infof("Deploying the agent scale sets ARM template...")
+	_, err = ku.Client.DeployTemplate(
+		ctx,
+		ku.ClusterTopology.ResourceGroup,
+		deploymentName,
+		templateMap,
+		parametersMap)
+
+	if err != nil {
+		ku.logger.Errorf("error applying upgrade template in upgradeAgentScaleSets: %v", err)
+		return err
+	}
+
+	return ku.checkpoint.setStatus(step, stepCompleted)
+}
+
+// replaceScaleSetVM grows the VMSS by one instance, then drains and deletes the VM being upgraded.
+// The capacity is recorded in the step, so running it again after an interruption does not grow the VMSS twice.
+// When resuming an interrupted step, a node or VM that no longer exists was already deleted.
+func (ku *Upgrader) replaceScaleSetVM(ctx context.Context, vmssToUpgrade AgentPoolScaleSet, step *checkpointStep, resuming bool) error {
+	sku := vmssToUpgrade.Sku
+	capacity := step.Capacity
+	sku.Capacity = &capacity
+	if err := ku.Client.SetVirtualMachineScaleSetCapacity(
+		ctx,
+		ku.ClusterTopology.ResourceGroup,
+		vmssToUpgrade.Name,
+		sku,
+		vmssToUpgrade.Location,
+	); err != nil {
+		ku.logger.Errorf("Failure to set capacity for VMSS %s", vmssToUpgrade.Name)
+		return err
+	}
+
+	ku.logger.Infof("Successfully set capacity for VMSS %s", vmssToUpgrade.Name)
+
+	// Before we can delete the node we should safely and responsibly drain it
+	client, err := ku.getKubernetesClient(10 * time.Second)
+	if err != nil {
+		return err
+	}
+
+	ku.logger.Infof("Draining node %s", step.VM)
+	err = operations.SafelyDrainNodeWithClient(
+		client,
+		ku.logger,
+		step.VM,
+		time.Minute,
+	)
+	if resuming && apierrors.IsNotFound(err) {
+		ku.logger.Infof("Node %s was already removed from the cluster", step.VM)
+	} else if err != nil {
+		ku.logger.Errorf("Error draining VM in VMSS: %v", err)
+		return err
+	} else {
+		ku.events.Emit(operations.Event{Type: operations.EventNodeDrained, Pool: vmssToUpgrade.Name, Node: step.VM})
+	}
+
+	ku.logger.Infof(
+		"Deleting VM %s in VMSS %s",
+		step.VM,
+		vmssToUpgrade.Name,
+	)
+
+	// At this point we have our buffer node that will replace the node to delete
+	// so we can just remove this current node then
+	if err := ku.Client.DeleteVirtualMachineScaleSetVM(
+		ctx,
+		ku.ClusterTopology.ResourceGroup,
+		vmssToUpgrade.Name,
+		step.InstanceID,
+	); err != nil {
+		if detailedErr, ok := err.(autorest.DetailedError); ok && resuming && detailedErr.StatusCode == http.StatusNotFound {
+			ku.logger.Infof("VM %s in VMSS %s was already deleted", step.VM, vmssToUpgrade.Name)
+			return nil
+		}
+		ku.logger.Errorf(
+			"Failed to delete VM %s in VMSS %s",
+			step.VM,
+			vmssToUpgrade.Name)
+		return err
+	}
+
+	ku.logger.Infof(
+		"Successfully deleted VM %s in VMSS %s",
+		step.VM,
+		vmssToUpgrade.Name)
+	ku.events.Emit(operations.Event{Type: operations.EventVMDeleted, Pool: vmssToUpgrade.Name, Node: step.VM})
+	return nil
+}
+
 func (ku *Upgrader) generateUpgradeTemplate(upgradeContainerService *api.ContainerService, aksEngineVersion string) (map[string]interface{}, map[string]interface{}, error) {
 	var err error
 	ctx := engine.Context{
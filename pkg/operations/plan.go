@@ -0,0 +1,196 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+
+	"github.com/Azure/aks-engine/pkg/engine"
+)
+
+// Plan step actions
+const (
+	PlanActionDeploy      = "deploy"
+	PlanActionDrain       = "drain"
+	PlanActionDelete      = "delete"
+	PlanActionCreate      = "create"
+	PlanActionSetCapacity = "setCapacity"
+)
+
+// Resource changes
+const (
+	ResourceAdded    = "add"
+	ResourceModified = "modify"
+)
+
+// Plan is an ordered preview of the changes an operation will make to a cluster.
+// UnsupportedAgentPools are left unchanged because the operation does not support them.
+type Plan struct {
+	Operation             string           `json:"operation"`
+	Summary               string           `json:"summary"`
+	ResourceGroup         string           `json:"resourceGroup"`
+	Steps                 []PlanStep       `json:"steps"`
+	UntouchedAgentPools   []string         `json:"untouchedAgentPools"`
+	UnsupportedAgentPools []string         `json:"unsupportedAgentPools,omitempty"`
+	Resources             []ResourceChange `json:"resources"`
+}
+
+// PlanStep is a single action taken against the cluster
+type PlanStep struct {
+	Action string `json:"action"`
+	Pool   string `json:"pool,omitempty"`
+	Target string `json:"target"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ResourceChange is an ARM resource that a deployment will add or modify
+type ResourceChange struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Change string `json:"change"`
+}
+
+// NewPlan returns an empty plan
+func NewPlan(operation, summary, resourceGroup string) *Plan {
+	return &Plan{
+		Operation:           operation,
+		Summary:             summary,
+		ResourceGroup:       resourceGroup,
+		Steps:               []PlanStep{},
+		UntouchedAgentPools: []string{},
+		Resources:           []ResourceChange{},
+	}
+}
+
+// AddStep appends a step to the plan
+func (p *Plan) AddStep(action, pool, target, detail string) {
+	p.Steps = append(p.Steps, PlanStep{Action: action, Pool: pool, Target: target, Detail: detail})
+}
+
+// AddResources merges resource changes into the plan. A resource added by any deployment is reported as added.
+func (p *Plan) AddResources(changes []ResourceChange) {
+	for _, c := range changes {
+		found := false
+		for i := range p.Resources {
+			if p.Resources[i].Type == c.Type && p.Resources[i].Name == c.Name {
+				if c.Change == ResourceAdded {
+					p.Resources[i].Change = ResourceAdded
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			p.Resources = append(p.Resources, c)
+		}
+	}
+}
+
+// HasPoolSteps returns true if any step of the plan touches the given pool
+func (p *Plan) HasPoolSteps(pool string) bool {
+	for _, s := range p.Steps {
+		if s.Pool == pool {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	parameterRefRegex = regexp.MustCompile(`parameters\('([^']+)'\)`)
+	variableRefRegex  = regexp.MustCompile(`variables\('([^']+)'\)`)
+)
+
+// DiffTemplateResources compares the resources of a new ARM template with the template and parameters a cluster
+// was deployed with. A resource is modified if its definition changed, or if it references a parameter or variable
+// whose value changed. Resources absent from the new template are not reported since deployments are incremental.
+func DiffTemplateResources(oldTemplate, oldParameters, newTemplate, newParameters map[string]interface{}) []ResourceChange {
+	changedParams := changedParameters(oldTemplate, oldParameters, newTemplate, newParameters)
+	changedVars := changedVariables(oldTemplate, newTemplate, changedParams)
+
+	oldResources := map[string]interface{}{}
+	for _, r := range engine.TemplateResources(oldTemplate) {
+		oldResources[resourceKey(r)] = r
+	}
+
+	changes := []ResourceChange{}
+	for _, r := range engine.TemplateResources(newTemplate) {
+		resourceType, _ := r["type"].(string)
+		name, _ := r["name"].(string)
+		old, ok := oldResources[resourceKey(r)]
+		switch {
+		case !ok:
+			changes = append(changes, ResourceChange{Type: resourceType, Name: name, Change: ResourceAdded})
+		case !reflect.DeepEqual(old, r) || referencesChanged(r, changedParams, changedVars):
+			changes = append(changes, ResourceChange{Type: resourceType, Name: name, Change: ResourceModified})
+		}
+	}
+	return changes
+}
+
+func resourceKey(resource map[string]interface{}) string {
+	resourceType, _ := resource["type"].(string)
+	name, _ := resource["name"].(string)
+	return resourceType + "/" + name
+}
+
+func changedParameters(oldTemplate, oldParameters, newTemplate, newParameters map[string]interface{}) map[string]bool {
+	oldValues := engine.ParameterValues(oldTemplate, oldParameters)
+	newValues := engine.ParameterValues(newTemplate, newParameters)
+	changed := map[string]bool{}
+	for name, v := range newValues {
+		// the deployed parameters leave out the secure ones when the secrets are kept in a secret store
+		if oldValues[name] == nil && engine.IsSecureParameter(oldTemplate, name) {
+			continue
+		}
+		if !reflect.DeepEqual(oldValues[name], v) {
+			changed[name] = true
+		}
+	}
+	return changed
+}
+
+func changedVariables(oldTemplate, newTemplate map[string]interface{}, changedParams map[string]bool) map[string]bool {
+	oldVars, _ := oldTemplate["variables"].(map[string]interface{})
+	newVars, _ := newTemplate["variables"].(map[string]interface{})
+	changed := map[string]bool{}
+	for name, v := range newVars {
+		if !reflect.DeepEqual(oldVars[name], v) {
+			changed[name] = true
+		}
+	}
+	// variables that reference changed parameters or variables change too
+	for {
+		added := false
+		for name, v := range newVars {
+			if !changed[name] && referencesChanged(v, changedParams, changed) {
+				changed[name] = true
+				added = true
+			}
+		}
+		if !added {
+			return changed
+		}
+	}
+}
+
+func referencesChanged(v interface{}, changedParams, changedVars map[string]bool) bool {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return true
+	}
+	for _, m := range parameterRefRegex.FindAllStringSubmatch(string(b), -1) {
+		if changedParams[m[1]] {
+			return true
+		}
+	}
+	for _, m := range variableRefRegex.FindAllStringSubmatch(string(b), -1) {
+		if changedVars[m[1]] {
+			return true
+		}
+	}
+	return false
+}
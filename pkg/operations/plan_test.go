@@ -0,0 +1,80 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package operations
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func parseTemplate(s string) map[string]interface{} {
+	m := map[string]interface{}{}
+	Expect(json.Unmarshal([]byte(s), &m)).To(Succeed())
+	return m
+}
+
+var _ = Describe("Plan tests", func() {
+	oldTemplate := `{
+		"parameters": {
+			"orchestratorVersion": {"type": "string", "defaultValue": "1.10.9"},
+			"vmSize": {"type": "string"}
+		},
+		"variables": {
+			"customData": "[concat('version=', parameters('orchestratorVersion'))]",
+			"vmCustomData": "[variables('customData')]",
+			"nicName": "nic"
+		},
+		"resources": [
+			{"type": "Microsoft.Network/networkInterfaces", "name": "[variables('nicName')]"},
+			{"type": "Microsoft.Compute/virtualMachines", "name": "vm", "properties": {"customData": "[variables('vmCustomData')]"}},
+			{"type": "Microsoft.Compute/availabilitySets", "name": "as", "properties": {"vmSize": "[parameters('vmSize')]"}}
+		]
+	}`
+
+	It("Should report resources affected by changed parameters, variables and definitions", func() {
+		newTemplate := parseTemplate(oldTemplate)
+		resources := newTemplate["resources"].([]interface{})
+		resources = append(resources, map[string]interface{}{"type": "Microsoft.Network/loadBalancers", "name": "lb"})
+		resources[2].(map[string]interface{})["sku"] = "Aligned"
+		newTemplate["resources"] = resources
+
+		oldParameters := parseTemplate(`{"$schema": "schema", "parameters": {"vmSize": {"value": "Standard_D2_v2"}}}`)
+		newParameters := parseTemplate(`{"vmSize": {"value": "Standard_D2_v2"}, "orchestratorVersion": {"value": "1.11.5"}}`)
+
+		changes := DiffTemplateResources(parseTemplate(oldTemplate), oldParameters, newTemplate, newParameters)
+		Expect(changes).To(Equal([]ResourceChange{
+			{Type: "Microsoft.Compute/virtualMachines", Name: "vm", Change: ResourceModified},
+			{Type: "Microsoft.Compute/availabilitySets", Name: "as", Change: ResourceModified},
+			{Type: "Microsoft.Network/loadBalancers", Name: "lb", Change: ResourceAdded},
+		}))
+	})
+
+	It("Should not report changes for secure parameters missing from the deployed parameters", func() {
+		template := parseTemplate(oldTemplate)
+		template["parameters"].(map[string]interface{})["vmSize"] = map[string]interface{}{"type": "securestring"}
+		newParameters := parseTemplate(`{"vmSize": {"value": "Standard_D2_v2"}}`)
+		Expect(DiffTemplateResources(template, parseTemplate(`{}`), template, newParameters)).To(BeEmpty())
+	})
+
+	It("Should report no changes for identical templates", func() {
+		parameters := parseTemplate(`{"vmSize": {"value": "Standard_D2_v2"}}`)
+		Expect(DiffTemplateResources(parseTemplate(oldTemplate), parameters, parseTemplate(oldTemplate), parameters)).To(BeEmpty())
+	})
+
+	It("Should merge resource changes and track pools with steps", func() {
+		plan := NewPlan("upgrade", "summary", "rg")
+		plan.AddResources([]ResourceChange{{Type: "t", Name: "a", Change: ResourceModified}})
+		plan.AddResources([]ResourceChange{{Type: "t", Name: "a", Change: ResourceAdded}, {Type: "t", Name: "b", Change: ResourceModified}})
+		Expect(plan.Resources).To(Equal([]ResourceChange{
+			{Type: "t", Name: "a", Change: ResourceAdded},
+			{Type: "t", Name: "b", Change: ResourceModified},
+		}))
+
+		plan.AddStep(PlanActionDrain, "agentpool1", "vm", "")
+		Expect(plan.HasPoolSteps("agentpool1")).To(BeTrue())
+		Expect(plan.HasPoolSteps("agentpool2")).To(BeFalse())
+	})
+})
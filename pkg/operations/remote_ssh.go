@@ -4,11 +4,14 @@
 package operations
 
 import (
+	"archive/tar"
 	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"net"
 
+	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -45,3 +48,145 @@ func RemoteRun(user string, addr string, port int, sshKey []byte, cmd string) (s
 	err = session.Run(cmd)
 	return b.String(), err
 }
+
+// RemoteHost describes how to reach a cluster node over SSH.
+// Nodes without a public endpoint are reached by hopping through Jumpbox.
+type RemoteHost struct {
+	Addr    string
+	Port    int
+	Jumpbox *RemoteHost
+	// User overrides the user the runner connects as, Windows nodes are reached as their admin user
+	User string
+}
+
+func (h *RemoteHost) String() string {
+	if h.Jumpbox != nil {
+		return fmt.Sprintf("%s:%d (via %s)", h.Addr, h.Port, h.Jumpbox)
+	}
+	return fmt.Sprintf("%s:%d", h.Addr, h.Port)
+}
+
+// RemoteFile is a file written to a node by extracting the archive made by FilesArchive
+type RemoteFile struct {
+	Name    string
+	Content string
+	Mode    int64
+}
+
+// FilesArchive returns a tar archive of the files. Commands extract it from their standard input, so the
+// contents of the files, private keys included, are not on their command line.
+func FilesArchive(files []RemoteFile) (*bytes.Buffer, error) {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for _, f := range files {
+		header := &tar.Header{
+			Name: f.Name,
+			Mode: f.Mode,
+			Size: int64(len(f.Content)),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, errors.Wrapf(err, "failed to archive %s", f.Name)
+		}
+		if _, err := tw.Write([]byte(f.Content)); err != nil {
+			return nil, errors.Wrapf(err, "failed to archive %s", f.Name)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to archive files")
+	}
+	return &b, nil
+}
+
+// RemoteRunner runs commands on cluster nodes
+type RemoteRunner interface {
+	// RunCommand executes cmd on host and returns its standard output
+	RunCommand(host *RemoteHost, cmd string) (string, error)
+	// RunCommandWithInput executes cmd on host with stdin as its standard input and returns its standard output
+	RunCommandWithInput(host *RemoteHost, cmd string, stdin io.Reader) (string, error)
+}
+
+// SSHRemoteRunner is a RemoteRunner that connects to every node as the same user with the same private key
+type SSHRemoteRunner struct {
+	User   string
+	SSHKey []byte
+}
+
+// RunCommand executes cmd on host and returns its standard output
+func (r *SSHRemoteRunner) RunCommand(host *RemoteHost, cmd string) (string, error) {
+	return r.RunCommandWithInput(host, cmd, nil)
+}
+
+// RunCommandWithInput executes cmd on host with stdin as its standard input and returns its standard output
+func (r *SSHRemoteRunner) RunCommandWithInput(host *RemoteHost, cmd string, stdin io.Reader) (string, error) {
+	signer, err := ssh.ParsePrivateKey(r.SSHKey)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to parse private key")
+	}
+	config := &ssh.ClientConfig{
+		User: r.User,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signer),
+		},
+		HostKeyCallback: func(string, net.Addr, ssh.PublicKey) error { return nil },
+	}
+
+	client, closeAll, err := dialRemoteHost(host, config)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to connect to %s", host)
+	}
+	defer closeAll()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	var stdout, stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	if err = session.Run(cmd); err != nil {
+		return stdout.String(), errors.Wrapf(err, "command failed on %s: %s", host, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// dialRemoteHost opens an SSH connection to host, tunneling through its jumpbox if one is set.
+// The returned func closes the connection and any jumpbox connections it depends on.
+func dialRemoteHost(host *RemoteHost, config *ssh.ClientConfig) (*ssh.Client, func(), error) {
+	addr := fmt.Sprintf("%s:%d", host.Addr, host.Port)
+	hostConfig := config
+	if host.User != "" {
+		c := *config
+		c.User = host.User
+		hostConfig = &c
+	}
+	if host.Jumpbox == nil {
+		client, err := ssh.Dial("tcp", addr, hostConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		return client, func() { client.Close() }, nil
+	}
+	jumpbox, closeJumpbox, err := dialRemoteHost(host.Jumpbox, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := jumpbox.Dial("tcp", addr)
+	if err != nil {
+		closeJumpbox()
+		return nil, nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, hostConfig)
+	if err != nil {
+		conn.Close()
+		closeJumpbox()
+		return nil, nil, err
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	return client, func() {
+		client.Close()
+		closeJumpbox()
+	}, nil
+}
@@ -5,6 +5,7 @@ package operations
 
 import (
 	"container/list"
+	"context"
 
 	"github.com/Azure/aks-engine/pkg/armhelpers"
 	log "github.com/sirupsen/logrus"
@@ -45,3 +46,35 @@ func ScaleDownVMs(az armhelpers.AKSEngineClient, logger *log.Entry, subscription
 	}
 	return nil
 }
+
+// ScaleDownScaleSetVMs deletes the instances in the provided list from a VirtualMachineScaleSet.
+// Returns a list with details on each failure, all items in the list will always be of type *VMScalingErrorDetails
+func ScaleDownScaleSetVMs(az armhelpers.AKSEngineClient, logger *log.Entry, resourceGroup, vmssName string, instanceIDs ...string) *list.List {
+	numVmsToDelete := len(instanceIDs)
+	errChan := make(chan *VMScalingErrorDetails, numVmsToDelete)
+	defer close(errChan)
+	for _, instanceID := range instanceIDs {
+		go func(instanceID string) {
+			ctx, cancel := context.WithTimeout(context.Background(), armhelpers.DefaultARMOperationTimeout)
+			defer cancel()
+			logger.Infof("Deleting instance %s of scale set %s", instanceID, vmssName)
+			if err := az.DeleteVirtualMachineScaleSetVM(ctx, resourceGroup, vmssName, instanceID); err != nil {
+				errChan <- &VMScalingErrorDetails{Name: vmssName + "/" + instanceID, Error: err}
+				return
+			}
+			errChan <- nil
+		}(instanceID)
+	}
+	failedVMDeletions := &list.List{}
+	for i := 0; i < numVmsToDelete; i++ {
+		errDetails := <-errChan
+		if errDetails != nil {
+			failedVMDeletions.PushBack(errDetails)
+			logger.Errorf("Vm '%s' failed to delete with error: '%s'", errDetails.Name, errDetails.Error.Error())
+		}
+	}
+	if failedVMDeletions.Len() > 0 {
+		return failedVMDeletions
+	}
+	return nil
+}
@@ -35,3 +35,22 @@ var _ = Describe("Scale down vms operation tests", func() {
 		Expect(errs).To(BeNil())
 	})
 })
+
+var _ = Describe("Scale down scale set vms operation tests", func() {
+	It("Should return error messages for failing instances", func() {
+		mockClient := armhelpers.MockAKSEngineClient{}
+		mockClient.FailDeleteVirtualMachineScaleSetVM = true
+		errs := ScaleDownScaleSetVMs(&mockClient, log.NewEntry(log.New()), "rg", "k8s-agentpool1-12345678-vmss", "3", "4")
+		Expect(errs.Len()).To(Equal(2))
+		for e := errs.Front(); e != nil; e = e.Next() {
+			output := e.Value.(*VMScalingErrorDetails)
+			Expect(output.Name).To(HavePrefix("k8s-agentpool1-12345678-vmss/"))
+			Expect(output.Error).To(MatchError("DeleteVirtualMachineScaleSetVM failed"))
+		}
+	})
+	It("Should return nil for errors if all deletes successful", func() {
+		mockClient := armhelpers.MockAKSEngineClient{}
+		errs := ScaleDownScaleSetVMs(&mockClient, log.NewEntry(log.New()), "rg", "k8s-agentpool1-12345678-vmss", "3", "4")
+		Expect(errs).To(BeNil())
+	})
+})